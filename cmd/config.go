@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Maintain the configuration file",
+	Long: `Maintain the miko-shell.yaml configuration file.
+
+This command provides subcommands that work on the file itself, without
+building images or running containers.`,
+	Example: `  # Check the config is in canonical form
+  miko-shell config lint
+
+  # Rewrite it in canonical form
+  miko-shell config lint --fix`,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 2
+
+// configLintCmd represents the config lint command
+var configLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check the configuration file is in canonical form",
+	Long: `Checks that the configuration file is in canonical form: a normalized project
+name, the provider spelled out, keys in the documented order and 'commands'
+instead of the old 'cmds'. Prints what would change and exits with a non-zero
+status when the file isn't canonical.
+
+With --fix the file is rewritten in place, keeping its comments. A file that
+is already canonical is never rewritten.`,
+	Example: `  # Show what would change
+  miko-shell config lint
+
+  # Rewrite the file
+  miko-shell config lint --fix`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = mikoshell.ConfigFileName
+		}
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		changed, err := lintConfigFile(cmd.OutOrStdout(), configFile, fix)
+		if err != nil {
+			return err
+		}
+		if changed && !fix {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%s is not in canonical form; run 'miko-shell config lint --fix' to rewrite it", configFile)
+		}
+		return nil
+	},
+}
+
+// lintConfigFile reports the changes that put configFile in canonical form,
+// with a diff, and writes them when fix is set. It returns whether the file
+// needed changes.
+func lintConfigFile(w io.Writer, configFile string, fix bool) (bool, error) {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file '%s': %w", configFile, err)
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file '%s': %w", configFile, err)
+	}
+
+	formatted, changes, err := mikoshell.FormatConfig(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", configFile, err)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "%s %s is already in canonical form\n", green("[ok]"), configFile)
+		return false, nil
+	}
+
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s %s\n", yellow("[~~]"), change)
+	}
+	fmt.Fprintln(w)
+	writeDiff(w, configFile, string(data), string(formatted))
+
+	if fix {
+		if err := os.WriteFile(configFile, formatted, info.Mode().Perm()); err != nil {
+			return true, fmt.Errorf("failed to write config file '%s': %w", configFile, err)
+		}
+		fmt.Fprintf(w, "\n%s Rewrote %s\n", green("[ok]"), configFile)
+	}
+	return true, nil
+}
+
+// writeDiff prints the lines that differ between before and after, with a
+// little unchanged context around each change
+func writeDiff(w io.Writer, name, before, after string) {
+	lines := lineDiff(strings.Split(strings.TrimSuffix(before, "\n"), "\n"), strings.Split(strings.TrimSuffix(after, "\n"), "\n"))
+
+	fmt.Fprintf(w, "--- %s\n+++ %s (canonical)\n", name, name)
+	last := -1
+	for i, line := range lines {
+		if line[0] == ' ' && !nearChange(lines, i) {
+			continue
+		}
+		if last >= 0 && i > last+1 {
+			fmt.Fprintln(w, "...")
+		}
+		last = i
+
+		switch line[0] {
+		case '-':
+			fmt.Fprintln(w, red(line))
+		case '+':
+			fmt.Fprintln(w, green(line))
+		default:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// nearChange reports whether a changed line is within diffContext of lines[i]
+func nearChange(lines []string, i int) bool {
+	for j := i - diffContext; j <= i+diffContext; j++ {
+		if j >= 0 && j < len(lines) && lines[j][0] != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// lineDiff returns a line diff of a and b based on their longest common
+// subsequence; each line is prefixed with ' ', '-' or '+'
+func lineDiff(a, b []string) []string {
+	// common[i][j] is the LCS length of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	return lines
+}
+
+func init() {
+	configCmd.AddCommand(configLintCmd)
+	configLintCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	configLintCmd.Flags().Bool("fix", false, "Rewrite the file in canonical form")
+}
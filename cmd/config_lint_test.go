@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff(
+		[]string{"shell:", "name: My App", "container:"},
+		[]string{"name: my-app", "shell:", "container:"},
+	)
+	expected := []string{"+name: my-app", " shell:", "-name: My App", " container:"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("lineDiff() = %q, want %q", got, expected)
+	}
+}
+
+func TestLintConfigFile(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+
+	messy := "container:\n  image: alpine:latest\nname: My App\n"
+	canonical := "name: my-app\ncontainer:\n  provider: docker\n  image: alpine:latest\n"
+
+	t.Run("reports without fix", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "miko-shell.yaml")
+		if err := os.WriteFile(configFile, []byte(messy), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		var buf bytes.Buffer
+		changed, err := lintConfigFile(&buf, configFile, false)
+		if err != nil || !changed {
+			t.Fatalf("lintConfigFile() = %v, %v; want changes", changed, err)
+		}
+		for _, expected := range []string{"normalized name 'My App' to 'my-app'", "+name: my-app", "-name: My App"} {
+			if !strings.Contains(buf.String(), expected) {
+				t.Errorf("Expected %q in output:\n%s", expected, buf.String())
+			}
+		}
+		if data, _ := os.ReadFile(configFile); string(data) != messy {
+			t.Errorf("Expected file untouched without --fix, got:\n%s", data)
+		}
+	})
+
+	t.Run("fix rewrites", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "miko-shell.yaml")
+		if err := os.WriteFile(configFile, []byte(messy), 0600); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := lintConfigFile(&buf, configFile, true); err != nil {
+			t.Fatalf("lintConfigFile() failed: %v", err)
+		}
+		if data, _ := os.ReadFile(configFile); string(data) != canonical {
+			t.Errorf("Expected canonical file, got:\n%s", data)
+		}
+		if info, _ := os.Stat(configFile); info.Mode().Perm() != 0600 {
+			t.Errorf("Expected file mode kept, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("canonical file is left alone", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "miko-shell.yaml")
+		if err := os.WriteFile(configFile, []byte(canonical), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		var buf bytes.Buffer
+		changed, err := lintConfigFile(&buf, configFile, true)
+		if err != nil || changed {
+			t.Fatalf("lintConfigFile() = %v, %v; want no changes", changed, err)
+		}
+		if !strings.Contains(buf.String(), "already in canonical form") {
+			t.Errorf("Expected canonical message, got:\n%s", buf.String())
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+// confirm asks question on out and reads a y/N answer from in
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+
+	response, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || response == "") {
+		return false, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
+
+// isInteractive reports whether stdin is attached to a terminal
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmScriptRun asks before running a script marked with confirm: true.
+// Without a terminal to ask on, the script only runs when yes is set.
+func confirmScriptRun(script *mikoshell.Script, yes, interactive bool, in io.Reader, out io.Writer) (bool, error) {
+	if !script.Confirm || yes {
+		return true, nil
+	}
+	if !interactive {
+		return false, fmt.Errorf("script '%s' requires confirmation; pass --yes to run it non-interactively", script.Name)
+	}
+	return confirm(in, out, fmt.Sprintf("Run %s?", script.Name))
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+func TestConfirmScriptRun(t *testing.T) {
+	dangerous := &mikoshell.Script{Name: "db:reset", Confirm: true}
+
+	tests := []struct {
+		name        string
+		script      *mikoshell.Script
+		yes         bool
+		interactive bool
+		input       string
+		expected    bool
+		wantErr     bool
+		wantPrompt  bool
+	}{
+		{name: "script without confirm", script: &mikoshell.Script{Name: "test"}, expected: true},
+		{name: "prompt accepted", script: dangerous, interactive: true, input: "y\n", expected: true, wantPrompt: true},
+		{name: "prompt accepted without newline", script: dangerous, interactive: true, input: "yes", expected: true, wantPrompt: true},
+		{name: "prompt declined", script: dangerous, interactive: true, input: "\n", expected: false, wantPrompt: true},
+		{name: "yes skips prompt", script: dangerous, yes: true, interactive: true, expected: true},
+		{name: "non-interactive with yes", script: dangerous, yes: true, expected: true},
+		{name: "non-interactive refuses", script: dangerous, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ok, err := confirmScriptRun(tt.script, tt.yes, tt.interactive, strings.NewReader(tt.input), &out)
+
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("confirmScriptRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.expected {
+				t.Errorf("confirmScriptRun() = %v, want %v", ok, tt.expected)
+			}
+			if prompted := strings.Contains(out.String(), "Run db:reset? [y/N]"); prompted != tt.wantPrompt {
+				t.Errorf("Expected prompt %v, got output %q", tt.wantPrompt, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the health of the miko-shell environment",
+	Long: `Check that the project directory can be mounted in a container and that the
+container provider is available, then report the state of the current
+project's image: whether it is built, its size and age, and whether a rebuild
+is recommended because the configuration changed.
+
+Warns about workspaces that mount poorly, such as network drives or, on
+macOS, directories not shared with the container VM.`,
+	Example: `  # Check the current project
+  miko-shell doctor
+
+  # Check a specific configuration
+  miko-shell doctor -c path/to/miko-shell.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = mikoshell.ConfigFileName
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "miko-shell doctor\n")
+		fmt.Fprintf(out, "=================\n\n")
+
+		config, err := mikoshell.LoadConfigFromFile(configFile)
+		if err == nil {
+			err = applyConfigFlags(cmd, config)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "%s Config:   %v\n", red("[!!]"), err)
+			return nil
+		}
+		fmt.Fprintf(out, "%s Config:   %s\n", green("[ok]"), configFile)
+
+		warnings, err := config.CheckWorkspace()
+		printWorkspaceCheck(out, warnings, err)
+
+		provider, err := mikoshell.NewContainerProviderForConfig(config)
+		if err != nil || !provider.IsAvailable() {
+			fmt.Fprintf(out, "%s Provider: %s is not available\n", red("[!!]"), config.Container.Provider)
+			return nil
+		}
+		if err := provider.CheckDaemon(); err != nil {
+			fmt.Fprintf(out, "%s Provider: %v\n", red("[!!]"), err)
+			return nil
+		}
+		fmt.Fprintf(out, "%s Provider: %s\n", green("[ok]"), config.Container.Provider)
+
+		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		status, err := client.GetImageStatus()
+		if err != nil {
+			return fmt.Errorf("failed to get image status: %w", err)
+		}
+
+		printImageStatus(out, status)
+		return nil
+	},
+}
+
+// printWorkspaceCheck writes whether the workspace can be mounted, with the
+// warnings about setups known to cause trouble
+func printWorkspaceCheck(w io.Writer, warnings []string, err error) {
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "%s Workspace: %v\n", red("[!!]"), err)
+	case len(warnings) == 0:
+		fmt.Fprintf(w, "%s Workspace: can be mounted\n", green("[ok]"))
+	default:
+		for _, warning := range warnings {
+			fmt.Fprintf(w, "%s Workspace: %s\n", yellow("[--]"), warning)
+		}
+	}
+}
+
+// printImageStatus writes the image health summary used by doctor
+func printImageStatus(w io.Writer, status *mikoshell.ImageStatus) {
+	if !status.Built {
+		fmt.Fprintf(w, "%s Image:    %s is not built (run 'miko-shell image build')\n", yellow("[--]"), status.Tag)
+		return
+	}
+
+	fmt.Fprintf(w, "%s Image:    %s\n", green("[ok]"), status.Tag)
+	if status.Info != nil {
+		fmt.Fprintf(w, "     Size:     %s\n", status.Info.Size)
+		fmt.Fprintf(w, "     Age:      %s\n", formatAge(time.Since(status.Info.Created)))
+	}
+
+	if status.UpToDate {
+		fmt.Fprintf(w, "%s Rebuild:  not needed\n", green("[ok]"))
+	} else {
+		fmt.Fprintf(w, "%s Rebuild:  recommended (image hash %s, config hash %s)\n", red("[!!]"), status.StoredHash, status.CurrentHash)
+	}
+}
+
+// formatAge renders a duration as a coarse human-readable age
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "less than a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("%d minute(s)", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d hour(s)", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d day(s)", int(d.Hours()/24))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+func TestPrintImageStatus(t *testing.T) {
+	t.Run("not built", func(t *testing.T) {
+		var buf bytes.Buffer
+		printImageStatus(&buf, &mikoshell.ImageStatus{Tag: "proj:abc"})
+
+		if !strings.Contains(buf.String(), "proj:abc is not built") {
+			t.Errorf("Expected not built message, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("stale image", func(t *testing.T) {
+		var buf bytes.Buffer
+		printImageStatus(&buf, &mikoshell.ImageStatus{
+			Tag:         "proj:abc",
+			Built:       true,
+			Info:        &mikoshell.ImageInfo{Size: "12MB", Created: time.Now().Add(-48 * time.Hour)},
+			CurrentHash: "abc",
+			StoredHash:  "old",
+		})
+
+		output := buf.String()
+		for _, expected := range []string{"12MB", "2 day(s)", "Rebuild:  recommended"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected %q in output:\n%s", expected, output)
+			}
+		}
+	})
+}
+
+func TestPrintWorkspaceCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		warnings []string
+		err      error
+		expected string
+	}{
+		{"mountable", nil, nil, "[ok] Workspace: can be mounted"},
+		{"warning", []string{"the workspace is on a network drive"}, nil, "[--] Workspace: the workspace is on a network drive"},
+		{"error", nil, errors.New("workspace '/a:b' cannot be mounted"), "[!!] Workspace: workspace '/a:b' cannot be mounted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printWorkspaceCheck(&buf, tt.warnings, tt.err)
+			if !strings.Contains(buf.String(), tt.expected) {
+				t.Errorf("Expected %q in output:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
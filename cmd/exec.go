@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec command [args...]",
+	Short: "Run a literal command inside the container",
+	Long: `Runs its arguments as a command inside the container, like 'run -- <command>'
+but without ever matching a script name, so a script called "ls" doesn't hide
+the real ls.
+
+Flags for miko-shell go before the command; everything after it is passed verbatim.`,
+	Example: `  # Run the real ls even if a script is named "ls"
+  miko-shell exec ls -la
+
+  # Set a variable for this command
+  miko-shell exec -e DEBUG=1 go test ./...`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := mikoshell.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+		client.SetOverrides(configOverrides(cmd))
+		client.SetProfile(configProfile(cmd))
+
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile != "" {
+			if err := client.LoadConfigFromFile(configFile); err != nil {
+				return err
+			}
+		} else {
+			if err := client.LoadConfig(); err != nil {
+				return err
+			}
+		}
+
+		env, _ := cmd.Flags().GetStringArray("env")
+		if err := client.GetConfig().AddEnvironment(env); err != nil {
+			return err
+		}
+
+		noCacheCheck, _ := cmd.Flags().GetBool("no-cache-check")
+		client.SetNoCacheCheck(noCacheCheck)
+
+		opts := mikoshell.RunOptions{Literal: true, ReplaceEntrypoint: true}
+		if cmd.Flags().Changed("replace-entrypoint") {
+			opts.ReplaceEntrypoint, _ = cmd.Flags().GetBool("replace-entrypoint")
+		}
+
+		opts.Workdir, _ = cmd.Flags().GetString("workdir")
+
+		err = client.RunCommandWithOptions(args, opts)
+		if err != nil && !isInfrastructureError(err) {
+			// The command itself failed; its exit code is the error
+			cmd.SilenceUsage = true
+		}
+		return err
+	},
+}
+
+func init() {
+	execCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	execCmd.Flags().Bool("no-cache-check", false, "Ask the container engine whether the image exists instead of trusting the record of an earlier run")
+	execCmd.Flags().Bool("replace-entrypoint", true, "Clear the image ENTRYPOINT so the command runs directly")
+	execCmd.Flags().StringP("workdir", "w", "", "Run from this directory, relative to the project directory (e.g. services/api)")
+	execCmd.Flags().StringArrayP("env", "e", nil, "Set an environment variable in the container (KEY=VALUE, or KEY to pass through the host value)")
+	// Stop parsing flags at the command name so its arguments are left untouched
+	execCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(execCmd)
+}
@@ -21,7 +21,25 @@ The image is built based on the configuration in miko-shell.yaml.`,
   miko-shell image build
 
   # Force rebuild of existing image
-  miko-shell image build --force`,
+  miko-shell image build --force
+
+  # Build from a different Dockerfile
+  miko-shell image build --dockerfile Dockerfile.ci
+
+  # Show full build logs, e.g. in CI
+  miko-shell image build --progress plain
+
+  # Rebuild without the layer cache
+  miko-shell image build --force --no-cache
+
+  # Retry up to 3 times when the registry or network fails
+  miko-shell image build --retries 3
+
+  # Export the image as a tarball for an air-gapped machine
+  miko-shell image build --output env.tar
+
+  # Override a container.build.args value
+  miko-shell image build --build-arg VERSION=$(git describe --tags)`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		configFile, _ := cmd.Flags().GetString("config")
 		if configFile == "" {
@@ -32,18 +50,72 @@ The image is built based on the configuration in miko-shell.yaml.`,
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		if dockerfile, _ := cmd.Flags().GetString("dockerfile"); dockerfile != "" {
+			if err := config.OverrideDockerfile(dockerfile); err != nil {
+				return err
+			}
+		}
+
+		// Retries aren't part of the image hash, so run and open still find
+		// the image built with them
+		if cmd.Flags().Changed("retries") {
+			retries, _ := cmd.Flags().GetInt("retries")
+			if retries < 0 {
+				return fmt.Errorf("--retries must not be negative")
+			}
+			config.Container.BuildRetries = retries
+		}
+
+		progress, _ := cmd.Flags().GetString("progress")
+		switch progress {
+		case mikoshell.BuildProgressAuto, mikoshell.BuildProgressPlain, mikoshell.BuildProgressTTY:
+		default:
+			return fmt.Errorf("invalid --progress '%s' (must be %s, %s or %s)", progress,
+				mikoshell.BuildProgressAuto, mikoshell.BuildProgressPlain, mikoshell.BuildProgressTTY)
+		}
+
+		buildArgEntries, _ := cmd.Flags().GetStringArray("build-arg")
+		buildArgs, err := mikoshell.ParseBuildArgs(buildArgEntries)
+		if err != nil {
+			return err
+		}
+		if len(buildArgs) > 0 && config.Container.Build == nil {
+			return fmt.Errorf("--build-arg requires a Dockerfile build (container.build or --dockerfile)")
+		}
+
+		// Check the destination first rather than failing after a long build
+		output, _ := cmd.Flags().GetString("output")
+		if output != "" {
+			if err := mikoshell.CheckSaveDestination(output); err != nil {
+				return err
+			}
+		}
 
 		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
+		noCache, _ := cmd.Flags().GetBool("no-cache")
+		client.SetBuildOptions(mikoshell.BuildOptions{Progress: progress, NoCache: noCache, BuildArgs: buildArgs})
 
-		fmt.Println("Building container image...")
+		infof("Building container image...\n")
 		if err := client.BuildImage(imageBuildForce); err != nil {
 			return fmt.Errorf("failed to build image: %w", err)
 		}
 
-		fmt.Println("Container image built successfully!")
+		infof("Container image built successfully!\n")
+
+		if output != "" {
+			infof("Saving image to %s...\n", output)
+			if err := client.SaveImage(output); err != nil {
+				return err
+			}
+			infof("Image saved; load it on another machine with 'miko-shell image load --retag %s'\n", output)
+		}
 		return nil
 	},
 }
@@ -52,4 +124,10 @@ func init() {
 	imageCmd.AddCommand(imageBuildCmd)
 	imageBuildCmd.Flags().BoolVarP(&imageBuildForce, "force", "f", false, "Force rebuild by removing existing image first")
 	imageBuildCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	imageBuildCmd.Flags().String("progress", mikoshell.BuildProgressAuto, "Build progress output: auto, plain or tty (Docker BuildKit)")
+	imageBuildCmd.Flags().Bool("no-cache", false, "Build without the layer cache (also set by container.build.no_cache)")
+	imageBuildCmd.Flags().StringArray("build-arg", nil, "Set a build arg (KEY=VALUE), overriding container.build.args; repeatable")
+	imageBuildCmd.Flags().Int("retries", 0, "Retry a build or pull failing with a network or registry error up to N times (overrides container.build_retries)")
+	imageBuildCmd.Flags().StringP("output", "o", "", "After building, save the image to this tarball for 'docker load'")
+	imageBuildCmd.Flags().String("dockerfile", "", "Build from this Dockerfile instead of the one in the configuration")
 }
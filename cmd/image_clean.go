@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"sync"
 
 	"github.com/jepemo/miko-shell/pkg/mikoshell"
 	"github.com/spf13/cobra"
@@ -9,20 +13,123 @@ import (
 
 var imageCleanAll bool
 
+// projectCleanResult is the outcome of cleaning one discovered project
+type projectCleanResult struct {
+	configFile string
+	output     bytes.Buffer
+	removed    []string
+	err        error
+}
+
+// cleanProjects runs clean for every config file with at most jobs running at
+// once. Each project writes to its own buffer so output is not interleaved;
+// results are returned in the order of configFiles.
+func cleanProjects(configFiles []string, jobs int, clean func(configFile string, out io.Writer) ([]string, error)) []*projectCleanResult {
+	results := make([]*projectCleanResult, len(configFiles))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs && i < len(configFiles); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				result := &projectCleanResult{configFile: configFiles[index]}
+				result.removed, result.err = clean(result.configFile, &result.output)
+				results[index] = result
+			}
+		}()
+	}
+
+	for i := range configFiles {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// cleanProject removes the images of the project defined by configFile
+func cleanProject(configFile string, out io.Writer) ([]string, error) {
+	config, err := mikoshell.LoadConfigFromFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	client, err := mikoshell.NewClientWithConfigFile(config, configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	removed, err := client.CleanImages(imageCleanAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean images: %w", err)
+	}
+
+	for _, imageID := range removed {
+		fmt.Fprintf(out, "  - %s\n", imageID)
+	}
+	return removed, nil
+}
+
+// runRecursiveClean cleans every project found under the current directory
+func runRecursiveClean(jobs int) error {
+	configFiles, err := mikoshell.FindConfigFiles(".")
+	if err != nil {
+		return err
+	}
+	if len(configFiles) == 0 {
+		fmt.Println("No miko-shell projects found")
+		return nil
+	}
+
+	infof("Cleaning container images of %d project(s)...\n", len(configFiles))
+
+	var removed, failed int
+	for _, result := range cleanProjects(configFiles, jobs, cleanProject) {
+		fmt.Printf("==> %s\n", result.configFile)
+		io.Copy(os.Stdout, &result.output)
+		if result.err != nil {
+			fmt.Printf("  error: %v\n", result.err)
+			failed++
+			continue
+		}
+		removed += len(result.removed)
+	}
+
+	fmt.Printf("Removed %d image(s) across %d project(s)\n", removed, len(configFiles))
+	if failed > 0 {
+		return fmt.Errorf("failed to clean %d project(s)", failed)
+	}
+	return nil
+}
+
 // imageCleanCmd represents the image clean command
 var imageCleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Remove container images",
-	Long: `Remove container images related to miko-shell environments.
+	Long: `Remove the container images miko-shell built for the project.
 
-By default, this command removes unused images. Use --all to remove all miko-shell images,
-including the ones that might be in use.`,
-	Example: `  # Remove unused miko-shell images
+By default, this command removes the project's old images and keeps the one matching
+the current configuration. Use --all to remove that one as well.`,
+	Example: `  # Remove the project's outdated images
   miko-shell image clean
 
-  # Remove all miko-shell images (including active ones)
-  miko-shell image clean --all`,
+  # Remove all of the project's images, including the current one
+  miko-shell image clean --all
+
+  # Clean every project below the current directory, 8 at a time
+  miko-shell image clean --recursive --jobs 8`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if recursive, _ := cmd.Flags().GetBool("recursive"); recursive {
+			jobs, _ := cmd.Flags().GetInt("jobs")
+			if jobs < 1 {
+				return fmt.Errorf("--jobs must be at least 1")
+			}
+			return runRecursiveClean(jobs)
+		}
+
 		configFile, _ := cmd.Flags().GetString("config")
 		if configFile == "" {
 			configFile = "miko-shell.yaml"
@@ -32,13 +139,16 @@ including the ones that might be in use.`,
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
 
 		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
 
-		fmt.Println("Cleaning container images...")
+		infof("Cleaning container images...\n")
 
 		removed, err := client.CleanImages(imageCleanAll)
 		if err != nil {
@@ -61,6 +171,8 @@ including the ones that might be in use.`,
 
 func init() {
 	imageCmd.AddCommand(imageCleanCmd)
-	imageCleanCmd.Flags().BoolVarP(&imageCleanAll, "all", "a", false, "Remove all miko-shell images, including active ones")
+	imageCleanCmd.Flags().BoolVarP(&imageCleanAll, "all", "a", false, "Remove all of the project's images, including the current one")
+	imageCleanCmd.Flags().BoolP("recursive", "r", false, "Clean every miko-shell project found below the current directory")
+	imageCleanCmd.Flags().Int("jobs", 4, "Number of projects cleaned in parallel with --recursive")
 	imageCleanCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
 }
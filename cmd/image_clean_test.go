@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCleanProjects(t *testing.T) {
+	configFiles := []string{"a/miko-shell.yaml", "b/miko-shell.yaml", "c/miko-shell.yaml", "d/miko-shell.yaml", "e/miko-shell.yaml"}
+
+	var running, maxRunning int32
+	clean := func(configFile string, out io.Writer) ([]string, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		if configFile == "c/miko-shell.yaml" {
+			return nil, errors.New("provider not available")
+		}
+		fmt.Fprintf(out, "cleaned %s\n", configFile)
+		return []string{configFile + ":old"}, nil
+	}
+
+	results := cleanProjects(configFiles, 2, clean)
+
+	if len(results) != len(configFiles) {
+		t.Fatalf("Expected %d results, got %d", len(configFiles), len(results))
+	}
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent cleans, got %d", maxRunning)
+	}
+
+	var removed, failed int
+	for i, result := range results {
+		if result.configFile != configFiles[i] {
+			t.Errorf("Expected result %d for %s, got %s", i, configFiles[i], result.configFile)
+		}
+		if result.err != nil {
+			failed++
+			continue
+		}
+		removed += len(result.removed)
+		if expected := fmt.Sprintf("cleaned %s\n", configFiles[i]); result.output.String() != expected {
+			t.Errorf("Expected buffered output %q, got %q", expected, result.output.String())
+		}
+	}
+	if removed != 4 || failed != 1 {
+		t.Errorf("Expected 4 removed and 1 failed, got %d removed and %d failed", removed, failed)
+	}
+}
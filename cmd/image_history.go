@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// imageHistoryCmd represents the image history command
+var imageHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Show the layers of a container image",
+	Long: `Show the layers of a container image with the size and command of each,
+newest first, to find out which setup step adds the most size.
+
+If no image is provided, shows the history of the current project's image
+based on the miko-shell.yaml configuration.
+
+Usage: miko-shell image history [IMAGE]`,
+	Example: `  # Show the layers of the current project's image
+  miko-shell image history
+
+  # Show full layer commands
+  miko-shell image history --no-trunc`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = "miko-shell.yaml"
+		}
+
+		config, err := mikoshell.LoadConfigFromFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		var imageID string
+		if len(args) > 0 {
+			imageID = args[0]
+		}
+
+		layers, err := client.ImageHistory(imageID)
+		if err != nil {
+			return err
+		}
+
+		noTrunc, _ := cmd.Flags().GetBool("no-trunc")
+
+		fmt.Printf("%-10s %s\n", "SIZE", "COMMAND")
+		fmt.Println(strings.Repeat("-", 67))
+		for _, layer := range layers {
+			command := layer.CreatedBy
+			if !noTrunc && len(command) > 56 {
+				command = command[:53] + "..."
+			}
+			fmt.Printf("%-10s %s\n", layer.Size, command)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(imageHistoryCmd)
+	imageHistoryCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	imageHistoryCmd.Flags().Bool("no-trunc", false, "Show full layer commands")
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/jepemo/miko-shell/pkg/mikoshell"
@@ -23,7 +25,10 @@ Usage: miko-shell image info [IMAGE_ID]`,
   miko-shell image info
 
   # Show info for specific image
-  miko-shell image info abc123def456`,
+  miko-shell image info abc123def456
+
+  # Print the full inspect JSON from docker/podman
+  miko-shell image info --raw`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		configFile, _ := cmd.Flags().GetString("config")
 		if configFile == "" {
@@ -34,6 +39,9 @@ Usage: miko-shell image info [IMAGE_ID]`,
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
 
 		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
 		if err != nil {
@@ -45,6 +53,15 @@ Usage: miko-shell image info [IMAGE_ID]`,
 			imageID = args[0]
 		}
 
+		if raw, _ := cmd.Flags().GetBool("raw"); raw {
+			output, err := client.InspectImage(imageID)
+			if err != nil {
+				return fmt.Errorf("failed to inspect image: %w", err)
+			}
+			_, err = os.Stdout.Write(output)
+			return err
+		}
+
 		imageInfo, err := client.GetImageInfo(imageID)
 		if err != nil {
 			return fmt.Errorf("failed to get image info: %w", err)
@@ -60,6 +77,12 @@ Usage: miko-shell image info [IMAGE_ID]`,
 		fmt.Printf("Created:     %s\n", imageInfo.Created.Format("2006-01-02 15:04:05"))
 		fmt.Printf("Platform:    %s\n", imageInfo.Platform)
 
+		imageStatus, err := client.GetImageStatus()
+		if err != nil {
+			return fmt.Errorf("failed to get image status: %w", err)
+		}
+		printCacheInfo(os.Stdout, imageInfo.Labels[mikoshell.LabelConfigHash], imageStatus)
+
 		if len(imageInfo.Labels) > 0 {
 			fmt.Printf("\nLabels:\n")
 			for key, value := range imageInfo.Labels {
@@ -70,7 +93,15 @@ Usage: miko-shell image info [IMAGE_ID]`,
 		if len(imageInfo.Layers) > 0 {
 			fmt.Printf("\nLayers (%d):\n", len(imageInfo.Layers))
 			for i, layer := range imageInfo.Layers {
-				fmt.Printf("  %d. %s (%s)\n", i+1, layer.ID[:12], layer.Size)
+				id := layer.ID
+				if len(id) > 12 {
+					id = id[:12]
+				}
+				if layer.Size == "" {
+					fmt.Printf("  %d. %s\n", i+1, id)
+				} else {
+					fmt.Printf("  %d. %s (%s)\n", i+1, id, layer.Size)
+				}
 			}
 		}
 
@@ -95,7 +126,23 @@ Usage: miko-shell image info [IMAGE_ID]`,
 	},
 }
 
+// printCacheInfo explains whether an image with the stored config hash label
+// would be reused for the current configuration
+func printCacheInfo(w io.Writer, storedHash string, status *mikoshell.ImageStatus) {
+	fmt.Fprintf(w, "Current tag: %s\n", status.Tag)
+
+	switch storedHash {
+	case "":
+		fmt.Fprintf(w, "Config hash: not stored (image predates config hash labels)\n")
+	case status.CurrentHash:
+		fmt.Fprintf(w, "Config hash: %s (matches current config)\n", storedHash)
+	default:
+		fmt.Fprintf(w, "Config hash: %s (current config is %s, rebuild needed)\n", storedHash, status.CurrentHash)
+	}
+}
+
 func init() {
 	imageCmd.AddCommand(imageInfoCmd)
 	imageInfoCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	imageInfoCmd.Flags().Bool("raw", false, "Print the provider's inspect output verbatim instead of the summary")
 }
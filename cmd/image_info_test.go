@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+func TestPrintCacheInfo(t *testing.T) {
+	status := &mikoshell.ImageStatus{Tag: "proj:abc123def456", CurrentHash: "abc123def456"}
+
+	tests := []struct {
+		name       string
+		storedHash string
+		expected   string
+	}{
+		{
+			name:       "matching hash",
+			storedHash: "abc123def456",
+			expected:   "Config hash: abc123def456 (matches current config)",
+		},
+		{
+			name:       "mismatching hash",
+			storedHash: "0123456789ab",
+			expected:   "Config hash: 0123456789ab (current config is abc123def456, rebuild needed)",
+		},
+		{
+			name:     "no stored hash",
+			expected: "Config hash: not stored",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printCacheInfo(&buf, tt.storedHash, status)
+			output := buf.String()
+
+			if !strings.Contains(output, "Current tag: proj:abc123def456") {
+				t.Errorf("Expected current tag in output, got:\n%s", output)
+			}
+			if !strings.Contains(output, tt.expected) {
+				t.Errorf("Expected %q in output, got:\n%s", tt.expected, output)
+			}
+		})
+	}
+}
@@ -32,6 +32,9 @@ along with their basic information like image ID, size, and creation date.`,
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
 
 		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
 		if err != nil {
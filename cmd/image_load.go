@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// imageLoadCmd represents the image load command
+var imageLoadCmd = &cobra.Command{
+	Use:   "load",
+	Args:  cobra.ExactArgs(1),
+	Short: "Load an image from a tarball",
+	Long: `Load a container image from a tarball written by 'image build --output' or
+'docker save', for example to use an environment built on another machine
+or to work offline.
+
+With --retag, the image in the tarball is also tagged with this project's
+image tag, so run and open use it instead of building. The tarball must then
+hold a single tagged image.
+
+Usage: miko-shell image load FILE`,
+	Example: `  # Load an image saved with 'image build --output'
+  miko-shell image load env.tar
+
+  # Load an image and use it for this project
+  miko-shell image load --retag env.tar`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = "miko-shell.yaml"
+		}
+
+		config, err := mikoshell.LoadConfigFromFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		retag, _ := cmd.Flags().GetBool("retag")
+		infof("Loading image from %s...\n", args[0])
+		source, err := client.LoadImage(args[0], retag)
+		if err != nil {
+			return err
+		}
+
+		if source != "" {
+			tag, err := client.GetImageTag()
+			if err != nil {
+				return err
+			}
+			infof("Tagged %s as %s\n", source, tag)
+		}
+		return nil
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(imageLoadCmd)
+	imageLoadCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	imageLoadCmd.Flags().Bool("retag", false, "Tag the loaded image with the project's image tag so run and open use it")
+}
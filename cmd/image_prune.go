@@ -1,10 +1,8 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/jepemo/miko-shell/pkg/mikoshell"
 	"github.com/spf13/cobra"
@@ -15,20 +13,26 @@ var imagePruneForce bool
 // imagePruneCmd represents the image prune command
 var imagePruneCmd = &cobra.Command{
 	Use:   "prune",
-	Short: "Remove all unused container images and build cache",
-	Long: `Remove all unused container images and build cache to reclaim disk space.
+	Short: "Remove dangling container images and build cache",
+	Long: `Remove dangling container images and build cache to reclaim disk space.
 
 This command removes:
-- All dangling images (not associated with any container)
-- All unused images (not referenced by any container) 
+- Dangling images (untagged images, e.g. left behind by rebuilds)
 - Build cache and intermediate layers
 
+Tagged images are kept, even when no container uses them; use
+'miko-shell image clean' to remove miko-shell images.
+
+Use --builder-only to clear just the BuildKit build cache and keep images.
 Use --force to skip the confirmation prompt.`,
-	Example: `  # Prune unused images with confirmation
+	Example: `  # Prune dangling images with confirmation
   miko-shell image prune
 
   # Prune without confirmation prompt
-  miko-shell image prune --force`,
+  miko-shell image prune --force
+
+  # Clear only the build cache
+  miko-shell image prune --builder-only`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		configFile, _ := cmd.Flags().GetString("config")
 		if configFile == "" {
@@ -39,53 +43,55 @@ Use --force to skip the confirmation prompt.`,
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
 
 		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
 
+		if builderOnly, _ := cmd.Flags().GetBool("builder-only"); builderOnly {
+			return pruneBuildCache(client)
+		}
+
 		// Show what will be removed
 		pruneInfo, err := client.GetPruneInfo()
 		if err != nil {
 			return fmt.Errorf("failed to get prune info: %w", err)
 		}
 
-		if pruneInfo.TotalImages == 0 {
+		if pruneInfo.DanglingImages == 0 && pruneInfo.TotalSize == "0B" {
 			fmt.Println("No images to prune")
 			return nil
 		}
 
 		fmt.Printf("This will remove:\n")
-		fmt.Printf("  - %d unused image(s)\n", pruneInfo.UnusedImages)
 		fmt.Printf("  - %d dangling image(s)\n", pruneInfo.DanglingImages)
 		fmt.Printf("  - Build cache (~%s)\n", pruneInfo.BuildCacheSize)
 		fmt.Printf("Total space to reclaim: ~%s\n\n", pruneInfo.TotalSize)
 
 		// Confirm unless --force is used
 		if !imagePruneForce {
-			fmt.Print("Are you sure you want to continue? [y/N]: ")
-			reader := bufio.NewReader(os.Stdin)
-			response, err := reader.ReadString('\n')
+			ok, err := confirm(os.Stdin, os.Stdout, "Are you sure you want to continue?")
 			if err != nil {
-				return fmt.Errorf("failed to read input: %w", err)
+				return err
 			}
-
-			response = strings.TrimSpace(strings.ToLower(response))
-			if response != "y" && response != "yes" {
+			if !ok {
 				fmt.Println("Operation cancelled")
 				return nil
 			}
 		}
 
-		fmt.Println("Pruning images and build cache...")
+		infof("Pruning images and build cache...\n")
 
 		result, err := client.PruneImages()
 		if err != nil {
 			return fmt.Errorf("failed to prune images: %w", err)
 		}
 
-		fmt.Printf("Pruning completed successfully!\n")
+		infof("Pruning completed successfully!\n")
 		fmt.Printf("Removed %d image(s)\n", result.RemovedImages)
 		fmt.Printf("Reclaimed space: %s\n", result.ReclaimedSpace)
 
@@ -93,8 +99,36 @@ Use --force to skip the confirmation prompt.`,
 	},
 }
 
+// pruneBuildCache implements image prune --builder-only
+func pruneBuildCache(client *mikoshell.Client) error {
+	if !imagePruneForce {
+		ok, err := confirm(os.Stdin, os.Stdout, "This will remove the build cache. Are you sure you want to continue?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Operation cancelled")
+			return nil
+		}
+	}
+
+	infof("Pruning build cache...\n")
+
+	result, err := client.PruneBuildCache()
+	if err != nil {
+		return fmt.Errorf("failed to prune build cache: %w", err)
+	}
+
+	infof("Pruning completed successfully!\n")
+	fmt.Printf("Removed %d build cache object(s)\n", result.RemovedCacheObjects)
+	fmt.Printf("Reclaimed space: %s\n", result.ReclaimedSpace)
+
+	return nil
+}
+
 func init() {
 	imageCmd.AddCommand(imagePruneCmd)
 	imagePruneCmd.Flags().BoolVarP(&imagePruneForce, "force", "f", false, "Do not prompt for confirmation")
+	imagePruneCmd.Flags().Bool("builder-only", false, "Only remove the BuildKit build cache, keeping images")
 	imagePruneCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
 }
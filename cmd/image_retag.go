@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// imageRetagCmd represents the image retag command
+var imageRetagCmd = &cobra.Command{
+	Use:   "retag",
+	Args:  cobra.ExactArgs(2),
+	Short: "Add a new tag to an existing image",
+	Long: `Add a new tag to an existing container image, for example to promote a
+built development image to a release tag or to a registry name before pushing.
+
+Usage: miko-shell image retag SOURCE TARGET`,
+	Example: `  # Promote the project image to a release tag
+  miko-shell image retag my-project:abc123def456 my-project:1.0
+
+  # Prepare an image for a registry
+  miko-shell image retag my-project:abc123def456 registry.example.com/team/my-project:1.0`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = "miko-shell.yaml"
+		}
+
+		config, err := mikoshell.LoadConfigFromFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		client, err := mikoshell.NewClientWithConfigFile(config, configFile)
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		if err := client.TagImage(args[0], args[1]); err != nil {
+			return err
+		}
+
+		infof("Tagged %s as %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(imageRetagCmd)
+	imageRetagCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+}
@@ -24,7 +24,7 @@ func TestImageCommand(t *testing.T) {
 
 	// Test that subcommands are properly registered
 	subcommands := imageCmd.Commands()
-	expectedSubcommands := []string{"build", "list", "clean", "info", "prune"}
+	expectedSubcommands := []string{"build", "list", "clean", "info", "prune", "retag", "history", "load"}
 
 	// Verify each expected subcommand exists
 	for _, expected := range expectedSubcommands {
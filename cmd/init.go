@@ -2,19 +2,48 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/jepemo/miko-shell/pkg/mikoshell"
 	"github.com/spf13/cobra"
 )
 
+// initTemplates maps each template init can generate to a one-line description
+var initTemplates = map[string]string{
+	"image":      "Pre-built Alpine image with setup commands (default)",
+	"dockerfile": "Custom Dockerfile next to miko-shell.yaml (--dockerfile)",
+}
+
+// writeTemplateList prints the available init templates sorted by name
+func writeTemplateList(w io.Writer) {
+	names := make([]string, 0, len(initTemplates))
+	for name := range initTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, initTemplates[name])
+	}
+}
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Create a miko-shell.yaml file in the current directory",
 	Long: `Creates a miko-shell.yaml configuration file with default values in the current directory.
 
 By default, creates a configuration using a pre-built Alpine image with setup commands.
-Use --dockerfile flag to create a configuration with custom Dockerfile support.`,
+Use --dockerfile flag to create a configuration with custom Dockerfile support.
+Use --list-templates to see the available templates.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if list, _ := cmd.Flags().GetBool("list-templates"); list {
+			fmt.Println("Available templates:")
+			writeTemplateList(os.Stdout)
+			return nil
+		}
+
 		client, err := mikoshell.NewClient()
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
@@ -25,7 +54,7 @@ Use --dockerfile flag to create a configuration with custom Dockerfile support.`
 			return err
 		}
 
-		fmt.Println("Created miko-shell.yaml successfully")
+		infof("Created miko-shell.yaml successfully\n")
 		return nil
 	},
 }
@@ -33,4 +62,5 @@ Use --dockerfile flag to create a configuration with custom Dockerfile support.`
 func init() {
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().BoolP("dockerfile", "d", false, "Generate configuration with custom Dockerfile instead of pre-built image")
+	initCmd.Flags().Bool("list-templates", false, "List the available configuration templates and exit")
 }
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTemplateList(t *testing.T) {
+	var buf bytes.Buffer
+	writeTemplateList(&buf)
+	output := buf.String()
+
+	for _, name := range []string{"image", "dockerfile"} {
+		if !strings.Contains(output, name) {
+			t.Errorf("Expected template %q in listing, got:\n%s", name, output)
+		}
+	}
+
+	if strings.Index(output, "dockerfile") > strings.Index(output, "image") {
+		t.Errorf("Expected templates sorted by name, got:\n%s", output)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jepemo/miko-shell/pkg/mikoshell"
 	"github.com/spf13/cobra"
@@ -16,6 +17,8 @@ var openCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
+		client.SetOverrides(configOverrides(cmd))
+		client.SetProfile(configProfile(cmd))
 
 		configFile, _ := cmd.Flags().GetString("config")
 		if configFile != "" {
@@ -28,11 +31,63 @@ var openCmd = &cobra.Command{
 			}
 		}
 
-		return client.OpenShell()
+		env, _ := cmd.Flags().GetStringArray("env")
+		if err := client.GetConfig().AddEnvironment(env); err != nil {
+			return err
+		}
+
+		ports, _ := cmd.Flags().GetStringArray("port")
+		if err := client.GetConfig().AddPorts(ports); err != nil {
+			return err
+		}
+
+		if cmd.Flags().Changed("network") {
+			network, _ := cmd.Flags().GetString("network")
+			if err := client.GetConfig().SetNetwork(network); err != nil {
+				return err
+			}
+		}
+
+		if cmd.Flags().Changed("gpus") {
+			gpus, _ := cmd.Flags().GetString("gpus")
+			if err := client.GetConfig().SetGPUs(gpus); err != nil {
+				return err
+			}
+		}
+
+		caches, _ := cmd.Flags().GetStringArray("cache")
+		if err := client.GetConfig().AddCachePresets(caches); err != nil {
+			return err
+		}
+
+		homeMounts, _ := cmd.Flags().GetStringArray("mount-home")
+		if err := client.SetHomeMounts(homeMounts); err != nil {
+			return err
+		}
+
+		noCacheCheck, _ := cmd.Flags().GetBool("no-cache-check")
+		client.SetNoCacheCheck(noCacheCheck)
+
+		if done, err := printImageFlags(cmd, client); done || err != nil {
+			return err
+		}
+
+		noStartup, _ := cmd.Flags().GetBool("no-startup")
+		return client.OpenShellWithOptions(mikoshell.OpenOptions{NoStartup: noStartup})
 	},
 }
 
 func init() {
 	openCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	openCmd.Flags().Bool("no-cache-check", false, "Ask the container engine whether the image exists instead of trusting the record of an earlier run")
+	openCmd.Flags().StringArrayP("env", "e", nil, "Set an environment variable in the container (KEY=VALUE, or KEY to pass through the host value)")
+	openCmd.Flags().StringArrayP("port", "p", nil, "Publish a container port (container, host:container or ip:host:container), added to container.ports")
+	openCmd.Flags().String("network", "", "Join this network instead of container.network: bridge, host, none, container:<name> or a network name")
+	openCmd.Flags().String("gpus", "", "Give the container GPUs instead of container.gpus: all, a number or device=<id>[,<id>...]")
+	openCmd.Flags().StringArray("cache", nil, "Mount named cache volumes for a language: "+strings.Join(mikoshell.CachePresets(), ", ")+" (repeatable)")
+	openCmd.Flags().StringArray("mount-home", nil, "Keep this directory of the container home, e.g. .aws, on the host between runs (repeatable)")
+	openCmd.Flags().Bool("print-image", false, "Print the resolved image tag and whether it exists locally before opening")
+	openCmd.Flags().Bool("print-image-only", false, "Print the resolved image tag and exit")
+	openCmd.Flags().Bool("no-startup", false, "Skip the shell.startup hooks and open a plain shell")
 	rootCmd.AddCommand(openCmd)
 }
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// pluginPrefix starts the executable name of plugins: "miko-shell foo ..."
+// runs miko-shell-foo from PATH when foo isn't a built-in command
+const pluginPrefix = "miko-shell-"
+
+// Environment variables describing the project to plugins
+const (
+	// pluginBinEnv is the path of the miko-shell executable, for calling back
+	pluginBinEnv = "MIKO_SHELL_BIN"
+	// pluginConfigEnv is the absolute path of the project's config file
+	pluginConfigEnv = "MIKO_SHELL_CONFIG"
+	// pluginProviderEnv is the container provider the config selects
+	pluginProviderEnv = "MIKO_SHELL_PROVIDER"
+	// pluginImageEnv is the image tag for the current config
+	pluginImageEnv = "MIKO_SHELL_IMAGE"
+)
+
+// findPlugin returns the plugin executable for args, which start with the
+// command name, or "" when it is a built-in command or no plugin exists
+func findPlugin(args []string) string {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || isBuiltinCommand(args[0]) {
+		return ""
+	}
+	path, err := exec.LookPath(pluginPrefix + args[0])
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// isBuiltinCommand reports whether name is a miko-shell command, including
+// those cobra only adds when it executes
+func isBuiltinCommand(name string) bool {
+	builtins := append(commandNames(rootCmd), "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd)
+	for _, builtin := range builtins {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginEnv returns the variables describing the project to a plugin. The
+// config, provider and image are left out when they can't be resolved, e.g.
+// outside a project, so plugins can still run.
+func pluginEnv(configFile string) []string {
+	var env []string
+	if executable, err := os.Executable(); err == nil {
+		env = append(env, pluginBinEnv+"="+executable)
+	}
+
+	absPath, err := filepath.Abs(configFile)
+	if err != nil {
+		return env
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return env
+	}
+	env = append(env, pluginConfigEnv+"="+absPath)
+
+	config, err := mikoshell.LoadConfigFromFile(absPath)
+	if err == nil {
+		err = config.ApplyProfile(os.Getenv(profileEnv))
+	}
+	if err != nil {
+		return env
+	}
+	env = append(env, pluginProviderEnv+"="+config.Container.Provider)
+
+	client, err := mikoshell.NewClientWithConfigFile(config, absPath)
+	if err != nil {
+		return env
+	}
+	if tag, err := client.GetImageTag(); err == nil {
+		env = append(env, pluginImageEnv+"="+tag)
+	}
+	return env
+}
+
+// runPlugin runs a plugin with args, attached to the terminal. A plugin
+// that exits non-zero has already reported why, so only its exit code is
+// passed on.
+func runPlugin(path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(os.Environ(), pluginEnv(mikoshell.ConfigFileName)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		err = fmt.Errorf("failed to run plugin '%s': %w", path, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return err
+}
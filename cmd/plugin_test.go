@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+// writePlugin creates an executable miko-shell-<name> script in dir
+func writePlugin(t *testing.T, dir, name, script string) {
+	t.Helper()
+	path := filepath.Join(dir, pluginPrefix+name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+}
+
+func TestFindPlugin(t *testing.T) {
+	binDir := t.TempDir()
+	writePlugin(t, binDir, "hello", "exit 0\n")
+	writePlugin(t, binDir, "run", "exit 0\n")
+	t.Setenv("PATH", binDir)
+
+	if got := findPlugin([]string{"hello", "world"}); got != filepath.Join(binDir, "miko-shell-hello") {
+		t.Errorf("Expected the hello plugin, got %q", got)
+	}
+	for _, args := range [][]string{nil, {"run", "test"}, {"help"}, {"completion"}, {"--version"}, {"missing"}} {
+		if got := findPlugin(args); got != "" {
+			t.Errorf("Expected no plugin for %v, got %q", args, got)
+		}
+	}
+}
+
+func TestRunPlugin(t *testing.T) {
+	binDir := t.TempDir()
+	output := filepath.Join(t.TempDir(), "plugin.out")
+	writePlugin(t, binDir, "hello", `{
+  echo "args=$*"
+  echo "config=$MIKO_SHELL_CONFIG"
+  echo "provider=$MIKO_SHELL_PROVIDER"
+  echo "bin=$MIKO_SHELL_BIN"
+} > "$PLUGIN_OUT"
+exit 3
+`)
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("PLUGIN_OUT", output)
+
+	project := t.TempDir()
+	config := "name: demo\ncontainer:\n  provider: podman\n  image: alpine:latest\n"
+	if err := os.WriteFile(filepath.Join(project, mikoshell.ConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Chdir(project)
+
+	err := runPlugin(findPlugin([]string{"hello"}), []string{"a", "--flag"})
+	if code := mikoshell.ExitCode(err); code != 3 {
+		t.Errorf("Expected the plugin's exit code 3, got %d (%v)", code, err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Plugin didn't run: %v", err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"args=a --flag\n",
+		"config=" + filepath.Join(project, mikoshell.ConfigFileName) + "\n",
+		"provider=podman\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected plugin output to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "bin=\n") {
+		t.Errorf("Expected MIKO_SHELL_BIN to be set, got:\n%s", got)
+	}
+}
+
+func TestPluginEnv_NoProject(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, entry := range pluginEnv(mikoshell.ConfigFileName) {
+		if !strings.HasPrefix(entry, pluginBinEnv+"=") {
+			t.Errorf("Expected only %s outside a project, got %s", pluginBinEnv, entry)
+		}
+	}
+}
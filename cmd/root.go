@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
 	"github.com/spf13/cobra"
 )
 
@@ -15,13 +17,105 @@ var rootCmd = &cobra.Command{
 	Long: `miko-shell is a CLI tool that serves to abstract dependencies used in a local development project and use containers.
 It allows creating a container image based on configuration, and connecting to containers to execute scripts in the project context.`,
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkNotInContainer(cmd); err != nil {
+			return err
+		}
+		return setupProviderTrace(cmd)
+	},
+}
+
+// checkNotInContainer refuses to run container commands from inside a
+// miko-shell container, where they would recurse; informational commands
+// still work
+func checkNotInContainer(cmd *cobra.Command) error {
+	if os.Getenv(mikoshell.InContainerEnv) != "1" {
+		return nil
+	}
+	switch cmd.Name() {
+	case "version", "help", "completion", "validate", "config", "lint", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return nil
+	}
+	cmd.SilenceUsage = true
+	return fmt.Errorf("already inside a miko-shell environment; run the command directly instead of through '%s'", cmd.CommandPath())
+}
+
+// setupProviderTrace installs a tracing command runner when --trace-provider
+// is given; "-" traces to stderr, anything else is a file to append to
+func setupProviderTrace(cmd *cobra.Command) error {
+	target, _ := cmd.Flags().GetString("trace-provider")
+	if target == "" {
+		return nil
+	}
+
+	w := os.Stderr
+	if target != "-" {
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open provider trace file: %w", err)
+		}
+		w = file
+	}
+
+	previous := mikoshell.SetCommandRunner(nil)
+	mikoshell.SetCommandRunner(mikoshell.NewTraceRunner(previous, w))
+	return nil
 }
 
+// Execute runs the command line, dispatching commands that aren't built in
+// to a miko-shell-<name> plugin on PATH when there is one
 func Execute() error {
+	if plugin := findPlugin(os.Args[1:]); plugin != "" {
+		return runPlugin(plugin, os.Args[2:])
+	}
 	return rootCmd.Execute()
 }
 
+// profileEnv selects a config profile when --profile isn't given
+const profileEnv = "MIKO_PROFILE"
+
+// configProfile returns the profile selected with --profile or MIKO_PROFILE
+func configProfile(cmd *cobra.Command) string {
+	if profile, _ := cmd.Flags().GetString("profile"); profile != "" {
+		return profile
+	}
+	return os.Getenv(profileEnv)
+}
+
+// applyConfigFlags merges the selected profile over config, then applies the
+// overrides given on the command line
+func applyConfigFlags(cmd *cobra.Command, config *mikoshell.Config) error {
+	if err := config.ApplyProfile(configProfile(cmd)); err != nil {
+		return err
+	}
+	return config.ApplyOverrides(configOverrides(cmd))
+}
+
+// configOverrides returns the --set overrides given on the command line,
+// plus --docker-context and --image-tag-format as overrides of
+// container.context and container.tag_format
+func configOverrides(cmd *cobra.Command) []string {
+	overrides, _ := cmd.Flags().GetStringArray("set")
+	if context, _ := cmd.Flags().GetString("docker-context"); context != "" {
+		overrides = append(overrides, "container.context="+context)
+	}
+	if format, _ := cmd.Flags().GetString("image-tag-format"); format != "" {
+		overrides = append(overrides, "container.tag_format="+format)
+	}
+	return overrides
+}
+
 func init() {
+	mikoshell.Version = version
+
+	rootCmd.PersistentFlags().BoolVar(&plainOutput, "plain", false, "Plain output without colors or decoration (also enabled by NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVarP(&quietOutput, "quiet", "q", false, "Suppress informational messages such as build progress notices; command output and errors are kept")
+	rootCmd.PersistentFlags().String("profile", "", "Use a profile from the config's 'profiles' section, e.g. ci (default: $"+profileEnv+")")
+	rootCmd.PersistentFlags().StringArray("set", nil, "Override a config value for this invocation (key=value, e.g. container.image=ubuntu:22.04)")
+	rootCmd.PersistentFlags().String("docker-context", "", "Docker context (or podman connection) to target, overriding container.context")
+	rootCmd.PersistentFlags().String("image-tag-format", "", "Image tag template, e.g. '{{.Name}}:{{.Hash}}-{{.Platform}}', overriding container.tag_format")
+	rootCmd.PersistentFlags().String("trace-provider", "", "Log every docker/podman command with its exit code and output to a file (or stderr when no file is given)")
+	rootCmd.PersistentFlags().Lookup("trace-provider").NoOptDefVal = "-"
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+func TestCheckNotInContainer(t *testing.T) {
+	t.Run("host", func(t *testing.T) {
+		t.Setenv(mikoshell.InContainerEnv, "")
+		if err := checkNotInContainer(runCmd); err != nil {
+			t.Errorf("Expected run to be allowed on the host, got %v", err)
+		}
+	})
+
+	t.Run("inside a container", func(t *testing.T) {
+		t.Setenv(mikoshell.InContainerEnv, "1")
+
+		err := checkNotInContainer(runCmd)
+		if err == nil || !strings.Contains(err.Error(), "already inside a miko-shell environment") {
+			t.Errorf("Expected run to be refused, got %v", err)
+		}
+		if err := checkNotInContainer(versionCmd); err != nil {
+			t.Errorf("Expected version to be allowed, got %v", err)
+		}
+	})
+}
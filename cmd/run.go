@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jepemo/miko-shell/pkg/mikoshell"
 	"github.com/spf13/cobra"
@@ -22,8 +27,10 @@ func isInfrastructureError(err error) bool {
 		"failed to build image",
 		"docker: not found",
 		"podman: not found",
+		"nerdctl: not found",
 		"container provider",
 		"failed to calculate config hash",
+		"daemon isn't running",
 	}
 
 	for _, pattern := range infrastructurePatterns {
@@ -35,16 +42,84 @@ func isInfrastructureError(err error) bool {
 	return false
 }
 
+// scriptArgs drops a "--" placed right after the command name, so
+// "run <script> -- --flag" and "run <script> --flag" pass the same arguments
+func scriptArgs(args []string) []string {
+	if len(args) > 1 && args[1] == "--" {
+		return append([]string{args[0]}, args[2:]...)
+	}
+	return args
+}
+
+// scriptCompletions returns shell completion entries for scripts, using the
+// description as help text when there is one
+func scriptCompletions(scripts []mikoshell.Script) []string {
+	completions := make([]string, 0, len(scripts))
+	for _, script := range scripts {
+		if script.Description != "" {
+			completions = append(completions, script.Name+"\t"+script.Description)
+		} else {
+			completions = append(completions, script.Name)
+		}
+	}
+	return completions
+}
+
 var runCmd = &cobra.Command{
 	Use:   "run [command...]",
 	Short: "Run a command inside the container",
-	Long:  `Runs a command inside the container. If the command matches a script name, it will run that script.`,
-	Args:  cobra.ArbitraryArgs,
+	Long: `Runs a command inside the container. If the command matches a script name, it will run that script.
+
+Flags for miko-shell go before the command; everything after the command name,
+including arguments starting with "-", is passed to the script verbatim.`,
+	Example: `  # Run a script with arguments
+  miko-shell run greet Alice 42
+
+  # Pass flags through to a script
+  miko-shell run test -- --verbose -run TestFoo
+
+  # Run a direct command
+  miko-shell run -- go env
+
+  # Keep the AWS CLI credentials and config between runs
+  miko-shell run --mount-home .aws deploy
+
+  # Run a script from a package of a monorepo
+  miko-shell run -w services/api test
+
+  # List the scripts as JSON, e.g. for an editor integration
+  miko-shell run --list -o json
+
+  # Show the shell script "greet Alice" runs, without running it
+  miko-shell run --dry-run-script greet Alice`,
+	Args: cobra.ArbitraryArgs,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// Only the script name is completed; script arguments are free-form
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = mikoshell.ConfigFileName
+		}
+		config, err := mikoshell.LoadConfigFromFile(configFile)
+		if err == nil {
+			err = config.ApplyProfile(configProfile(cmd))
+		}
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		return scriptCompletions(config.HostScripts()), cobra.ShellCompDirectiveNoFileComp
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		client, err := mikoshell.NewClient()
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
+		client.SetOverrides(configOverrides(cmd))
+		client.SetProfile(configProfile(cmd))
 
 		configFile, _ := cmd.Flags().GetString("config")
 		if configFile != "" {
@@ -57,13 +132,136 @@ var runCmd = &cobra.Command{
 			}
 		}
 
+		env, _ := cmd.Flags().GetStringArray("env")
+		if err := client.GetConfig().AddEnvironment(env); err != nil {
+			return err
+		}
+
+		ports, _ := cmd.Flags().GetStringArray("port")
+		if err := client.GetConfig().AddPorts(ports); err != nil {
+			return err
+		}
+
+		if cmd.Flags().Changed("network") {
+			network, _ := cmd.Flags().GetString("network")
+			if err := client.GetConfig().SetNetwork(network); err != nil {
+				return err
+			}
+		}
+
+		if cmd.Flags().Changed("gpus") {
+			gpus, _ := cmd.Flags().GetString("gpus")
+			if err := client.GetConfig().SetGPUs(gpus); err != nil {
+				return err
+			}
+		}
+
+		caches, _ := cmd.Flags().GetStringArray("cache")
+		if err := client.GetConfig().AddCachePresets(caches); err != nil {
+			return err
+		}
+
+		homeMounts, _ := cmd.Flags().GetStringArray("mount-home")
+		if err := client.SetHomeMounts(homeMounts); err != nil {
+			return err
+		}
+
+		noCacheCheck, _ := cmd.Flags().GetBool("no-cache-check")
+		client.SetNoCacheCheck(noCacheCheck)
+
+		if done, err := printImageFlags(cmd, client); done || err != nil {
+			return err
+		}
+
+		list, _ := cmd.Flags().GetBool("list")
+		output, _ := cmd.Flags().GetString("output")
+		if output != "text" && output != "json" {
+			return fmt.Errorf("invalid output format: %s. Must be 'text' or 'json'", output)
+		}
+		if list && len(args) > 0 {
+			return fmt.Errorf("--list doesn't take a command")
+		}
+		if output == "json" && len(args) > 0 {
+			return fmt.Errorf("--output only applies to listing scripts")
+		}
+
 		// If no arguments provided, show available scripts
 		if len(args) == 0 {
-			return client.ListScripts()
+			all, _ := cmd.Flags().GetBool("all")
+			if output == "json" {
+				scripts, err := client.ScriptInfos(mikoshell.ListOptions{All: all})
+				if err != nil {
+					return err
+				}
+				return printScriptsJSON(cmd.OutOrStdout(), scripts)
+			}
+			return client.ListScriptsWithOptions(mikoshell.ListOptions{All: all})
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run-script"); dryRun {
+			script, err := client.ExpandScript(scriptArgs(args), strictArgs(cmd))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), script)
+			return nil
+		}
+
+		if script, exists := client.GetConfig().GetScript(args[0]); exists {
+			yes, _ := cmd.Flags().GetBool("yes")
+			ci, _ := cmd.Flags().GetBool("ci")
+			ok, err := confirmScriptRun(script, yes, !ci && isInteractive(), os.Stdin, os.Stdout)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+			if !ok {
+				fmt.Println("Operation cancelled")
+				return nil
+			}
+		}
+
+		var opts mikoshell.RunOptions
+
+		// Direct commands after a leading "--" bypass the image ENTRYPOINT unless told otherwise
+		opts.ReplaceEntrypoint = cmd.ArgsLenAtDash() == 0
+		if cmd.Flags().Changed("replace-entrypoint") {
+			opts.ReplaceEntrypoint, _ = cmd.Flags().GetBool("replace-entrypoint")
+		}
+
+		opts.Retries, _ = cmd.Flags().GetInt("retries")
+		if opts.Retries < 0 {
+			return fmt.Errorf("--retries must not be negative")
+		}
+		opts.RetryDelay, _ = cmd.Flags().GetDuration("retry-delay")
+		opts.OutputPrefix, _ = cmd.Flags().GetString("output-prefix")
+		opts.RerunWithTTY, _ = cmd.Flags().GetBool("allocate-tty-for-errors")
+		opts.StrictArgs = strictArgs(cmd)
+		opts.Workdir, _ = cmd.Flags().GetString("workdir")
+		opts.ShellWrap, _ = cmd.Flags().GetBool("entrypoint-shell")
+		opts.DumpEnv, _ = cmd.Flags().GetString("dump-env")
+		opts.Summary, _ = cmd.Flags().GetBool("summary")
+
+		copyOut, _ := cmd.Flags().GetStringArray("copy-out")
+		for _, value := range copyOut {
+			spec, err := mikoshell.ParseCopySpec(value)
+			if err != nil {
+				return err
+			}
+			opts.CopyOut = append(opts.CopyOut, spec)
 		}
 
 		// Run command and handle exit codes properly
-		err = client.RunCommand(args)
+		err = client.RunCommandWithOptions(scriptArgs(args), opts)
+		if exitFile, _ := cmd.Flags().GetString("capture-exit-file"); exitFile != "" {
+			if writeErr := writeExitFile(exitFile, err); writeErr != nil {
+				if err == nil {
+					return writeErr
+				}
+				// Keep the command's own error so its exit code is preserved
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", writeErr)
+			}
+		}
 		if err != nil {
 			// Check if this is an infrastructure error or a script execution error
 			if isInfrastructureError(err) {
@@ -79,7 +277,86 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// strictArgs reports whether --strict-args was given
+func strictArgs(cmd *cobra.Command) bool {
+	strict, _ := cmd.Flags().GetBool("strict-args")
+	return strict
+}
+
+// writeExitFile records the exit code of a run in path, 0 when err is nil
+func writeExitFile(path string, err error) error {
+	code := strconv.Itoa(mikoshell.ExitCode(err)) + "\n"
+	if writeErr := os.WriteFile(path, []byte(code), 0644); writeErr != nil {
+		return fmt.Errorf("failed to write exit code file: %w", writeErr)
+	}
+	return nil
+}
+
+// printScriptsJSON writes the script listing as indented JSON, an empty
+// array when there are no scripts
+func printScriptsJSON(w io.Writer, scripts []mikoshell.ScriptInfo) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(scripts)
+}
+
+// printImageFlags handles --print-image and --print-image-only, reporting
+// whether the command should stop after printing
+func printImageFlags(cmd *cobra.Command, client *mikoshell.Client) (bool, error) {
+	printImage, _ := cmd.Flags().GetBool("print-image")
+	printOnly, _ := cmd.Flags().GetBool("print-image-only")
+	if !printImage && !printOnly {
+		return false, nil
+	}
+
+	tag, err := client.GetImageTag()
+	if err != nil {
+		return false, err
+	}
+	writeImageTag(os.Stdout, tag, client.ImageExists(tag))
+
+	return printOnly, nil
+}
+
+// writeImageTag prints the resolved image tag and whether it exists locally
+func writeImageTag(w io.Writer, tag string, exists bool) {
+	if exists {
+		fmt.Fprintf(w, "Image: %s (exists locally)\n", tag)
+	} else {
+		fmt.Fprintf(w, "Image: %s (not built yet)\n", tag)
+	}
+}
+
 func init() {
 	runCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	runCmd.Flags().Bool("no-cache-check", false, "Ask the container engine whether the image exists instead of trusting the record of an earlier run")
+	runCmd.Flags().Bool("replace-entrypoint", false, "Clear the image ENTRYPOINT so the command runs directly (default for 'run -- <command>')")
+	runCmd.Flags().BoolP("yes", "y", false, "Run scripts marked with 'confirm: true' without asking")
+	runCmd.Flags().Bool("ci", false, "Non-interactive mode: never prompt, refuse scripts needing confirmation unless --yes")
+	runCmd.Flags().Int("retries", 0, "Re-run the command up to N more times if it fails")
+	runCmd.Flags().Duration("retry-delay", time.Second, "Delay between retries")
+	runCmd.Flags().String("output-prefix", "", "Prefix every output line with [PREFIX], e.g. the script name")
+	runCmd.Flags().Bool("allocate-tty-for-errors", false, "Re-run a failed command with a TTY in the same container to see its terminal output; the command runs twice")
+	runCmd.Flags().StringArrayP("env", "e", nil, "Set an environment variable in the container (KEY=VALUE, or KEY to pass through the host value)")
+	runCmd.Flags().StringArrayP("port", "p", nil, "Publish a container port (container, host:container or ip:host:container), added to container.ports")
+	runCmd.Flags().String("network", "", "Join this network instead of container.network: bridge, host, none, container:<name> or a network name")
+	runCmd.Flags().String("gpus", "", "Give the container GPUs instead of container.gpus: all, a number or device=<id>[,<id>...]")
+	runCmd.Flags().StringArray("cache", nil, "Mount named cache volumes for a language: "+strings.Join(mikoshell.CachePresets(), ", ")+" (repeatable)")
+	runCmd.Flags().StringArray("mount-home", nil, "Keep this directory of the container home, e.g. .aws, on the host between runs (repeatable)")
+	runCmd.Flags().Bool("print-image", false, "Print the resolved image tag and whether it exists locally before running")
+	runCmd.Flags().Bool("print-image-only", false, "Print the resolved image tag and exit")
+	runCmd.Flags().Bool("entrypoint-shell", false, "Run a direct command through 'sh -c' so pipes and globs work, e.g. run --entrypoint-shell -- 'ls *.go | wc -l'")
+	runCmd.Flags().Bool("list", false, "List the available scripts, as without a command")
+	runCmd.Flags().StringP("output", "o", "text", "Script listing format: text or json (for editors and other tools)")
+	runCmd.Flags().Bool("all", false, "List scripts restricted to other host systems too (without a command)")
+	runCmd.Flags().Bool("strict-args", false, "Fail a script that references a positional argument that wasn't passed (like shell.strict_args)")
+	runCmd.Flags().StringP("workdir", "w", "", "Run from this directory, relative to the project directory (e.g. services/api)")
+	runCmd.Flags().String("capture-exit-file", "", "Write the command's exit code to this file after the run, including 0 on success")
+	runCmd.Flags().Bool("dry-run-script", false, "Print the shell script a script runs as, with its arguments and dependencies, without running it")
+	runCmd.Flags().Bool("summary", false, "Print how long each command of the script took after the run")
+	runCmd.Flags().String("dump-env", "", "Write the container environment, as the command sees it, to this host file")
+	runCmd.Flags().StringArray("copy-out", nil, "Copy a container path to a host directory after the run (container:/path:hostdir)")
+	// Stop parsing flags at the command name so script arguments are left untouched
+	runCmd.Flags().SetInterspersed(false)
 	rootCmd.AddCommand(runCmd)
 }
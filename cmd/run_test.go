@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+func TestRunCommandScriptArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "plain script arguments",
+			args:     []string{"greet", "Alice", "42"},
+			expected: []string{"greet", "Alice", "42"},
+		},
+		{
+			name:     "arguments after dash separator",
+			args:     []string{"test", "--", "--verbose", "-run", "TestFoo"},
+			expected: []string{"test", "--verbose", "-run", "TestFoo"},
+		},
+		{
+			name:     "dashed arguments without separator",
+			args:     []string{"test", "--verbose", "-x"},
+			expected: []string{"test", "--verbose", "-x"},
+		},
+		{
+			name:     "later separator is kept",
+			args:     []string{"test", "a", "--", "b"},
+			expected: []string{"test", "a", "--", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runCmd.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags() failed: %v", err)
+			}
+
+			result := scriptArgs(runCmd.Flags().Args())
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("scriptArgs(%v) = %v, want %v", tt.args, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScriptCompletions(t *testing.T) {
+	scripts := []mikoshell.Script{
+		{Name: "test", Description: "Run the test suite"},
+		{Name: "lint"},
+		{Name: "db:reset", Description: "Drop and recreate the database"},
+	}
+
+	expected := []string{
+		"test\tRun the test suite",
+		"lint",
+		"db:reset\tDrop and recreate the database",
+	}
+	if result := scriptCompletions(scripts); !reflect.DeepEqual(result, expected) {
+		t.Errorf("scriptCompletions() = %q, want %q", result, expected)
+	}
+}
+
+func TestWriteImageTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		exists   bool
+		expected string
+	}{
+		{name: "built", exists: true, expected: "Image: proj:abc123def456 (exists locally)\n"},
+		{name: "not built", exists: false, expected: "Image: proj:abc123def456 (not built yet)\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeImageTag(&buf, "proj:abc123def456", tt.exists)
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
+
+// exitStatusError simulates a container command that exited with a status
+type exitStatusError int
+
+func (e exitStatusError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitStatusError) ExitCode() int { return int(e) }
+
+func TestWriteExitFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "success", err: nil, expected: "0\n"},
+		{name: "script exit code", err: fmt.Errorf("script failed: %w", exitStatusError(3)), expected: "3\n"},
+		{name: "error without exit code", err: fmt.Errorf("failed to build image"), expected: "1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "exit-code")
+			if err := writeExitFile(path, tt.err); err != nil {
+				t.Fatalf("writeExitFile() failed: %v", err)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read exit file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+
+	if err := writeExitFile(filepath.Join(t.TempDir(), "missing", "exit-code"), nil); err == nil {
+		t.Error("writeExitFile() should fail when the directory doesn't exist")
+	}
+}
+
+func TestPrintScriptsJSON(t *testing.T) {
+	scripts := []mikoshell.ScriptInfo{
+		{Name: "test", Description: "Run the tests", Commands: 2},
+		{Name: "lint", Commands: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := printScriptsJSON(&buf, scripts); err != nil {
+		t.Fatalf("printScriptsJSON() failed: %v", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(decoded) != len(scripts) {
+		t.Fatalf("Expected %d scripts, got:\n%s", len(scripts), buf.String())
+	}
+	for i, script := range scripts {
+		if decoded[i]["name"] != script.Name || decoded[i]["description"] != script.Description || decoded[i]["commands"] != float64(script.Commands) {
+			t.Errorf("Expected %+v, got %v", script, decoded[i])
+		}
+	}
+
+	buf.Reset()
+	if err := printScriptsJSON(&buf, []mikoshell.ScriptInfo{}); err != nil || buf.String() != "[]\n" {
+		t.Errorf("Expected an empty array, got %q (%v)", buf.String(), err)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the project's configuration and image state",
+	Long: `Show a summary of the current project: the resolved configuration file,
+project name, container provider and its availability, the computed image tag,
+whether that image exists and is up to date, and the number of scripts.
+
+Nothing is built; this only inspects the current state.`,
+	Example: `  # Show status
+  miko-shell status
+
+  # Machine-readable output
+  miko-shell status -o json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = mikoshell.ConfigFileName
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output != "text" && output != "json" {
+			return fmt.Errorf("invalid output format: %s. Must be 'text' or 'json'", output)
+		}
+
+		config, err := mikoshell.LoadConfigFromFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyConfigFlags(cmd, config); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		provider, err := mikoshell.NewContainerProviderForConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create container provider: %w", err)
+		}
+
+		// Setting the provider up front lets status report an unavailable provider
+		// instead of failing on it
+		client, err := mikoshell.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+		client.SetProvider(provider)
+		client.SetOverrides(configOverrides(cmd))
+		client.SetProfile(configProfile(cmd))
+		if err := client.LoadConfigFromFile(configFile); err != nil {
+			return err
+		}
+
+		status, err := client.GetStatus()
+		if err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+
+		if output == "json" {
+			return printStatusJSON(cmd.OutOrStdout(), status)
+		}
+		printStatus(cmd.OutOrStdout(), status)
+		return nil
+	},
+}
+
+// printStatus writes the human-readable status summary
+func printStatus(w io.Writer, status *mikoshell.Status) {
+	fmt.Fprintf(w, "Config:    %s\n", status.ConfigFile)
+	fmt.Fprintf(w, "Project:   %s\n", status.Name)
+
+	if status.ProviderAvailable {
+		fmt.Fprintf(w, "Provider:  %s (available)\n", status.Provider)
+	} else {
+		fmt.Fprintf(w, "Provider:  %s (not available)\n", status.Provider)
+	}
+
+	if status.Image != nil {
+		fmt.Fprintf(w, "Image:     %s\n", status.Image.Tag)
+		switch {
+		case !status.Image.Built:
+			fmt.Fprintf(w, "State:     not built\n")
+		case status.Image.UpToDate:
+			fmt.Fprintf(w, "State:     built, up to date\n")
+		default:
+			fmt.Fprintf(w, "State:     built, rebuild recommended\n")
+		}
+	}
+
+	fmt.Fprintf(w, "Scripts:   %d\n", status.Scripts)
+}
+
+// printStatusJSON writes the status summary as indented JSON
+func printStatusJSON(w io.Writer, status *mikoshell.Status) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(status)
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	statusCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+)
+
+func TestStatusCommand(t *testing.T) {
+	if statusCmd.Flags().Lookup("output") == nil {
+		t.Error("Expected --output flag to be present")
+	}
+	if statusCmd.Flags().Lookup("config") == nil {
+		t.Error("Expected --config flag to be present")
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	status := &mikoshell.Status{
+		ConfigFile:        "/project/miko-shell.yaml",
+		Name:              "proj",
+		Provider:          "docker",
+		ProviderAvailable: true,
+		Image:             &mikoshell.ImageStatus{Tag: "proj:abc", Built: true, UpToDate: true},
+		Scripts:           3,
+	}
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		printStatus(&buf, status)
+
+		for _, expected := range []string{"proj:abc", "docker (available)", "built, up to date", "Scripts:   3"} {
+			if !strings.Contains(buf.String(), expected) {
+				t.Errorf("Expected %q in output:\n%s", expected, buf.String())
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printStatusJSON(&buf, status); err != nil {
+			t.Fatalf("printStatusJSON() failed: %v", err)
+		}
+
+		var decoded mikoshell.Status
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("Output is not valid JSON: %v", err)
+		}
+		if decoded.Name != "proj" || decoded.Image == nil || !decoded.Image.Built {
+			t.Errorf("Unexpected decoded status: %+v", decoded)
+		}
+	})
+}
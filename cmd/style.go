@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// plainOutput is set by the --plain flag to disable colors and other decoration
+var plainOutput bool
+
+// quietOutput is set by the --quiet flag to suppress informational messages
+var quietOutput bool
+
+// stdoutIsTerminal reports whether stdout is a terminal; replaced in tests
+var stdoutIsTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// usePlain reports whether output decoration is disabled by --plain or NO_COLOR
+// (https://no-color.org). Output code should check this before adding colors,
+// symbols or spinners.
+func usePlain() bool {
+	return plainOutput || os.Getenv("NO_COLOR") != ""
+}
+
+// useColor reports whether ANSI colors should be written to stdout
+func useColor() bool {
+	return !usePlain() && stdoutIsTerminal()
+}
+
+// ANSI color codes used by the colorize helpers
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+)
+
+// colorize wraps text in the given ANSI color when colors are enabled
+func colorize(color, text string) string {
+	if !useColor() {
+		return text
+	}
+	return "\x1b[" + color + "m" + text + "\x1b[0m"
+}
+
+func green(text string) string  { return colorize(colorGreen, text) }
+func red(text string) string    { return colorize(colorRed, text) }
+func yellow(text string) string { return colorize(colorYellow, text) }
+
+// infof prints an informational message to stdout, such as progress or a
+// success notice, unless --quiet is set. Command results, container output
+// and errors never go through it.
+func infof(format string, args ...interface{}) {
+	if !quietOutput {
+		fmt.Printf(format, args...)
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	previous := stdoutIsTerminal
+	stdoutIsTerminal = func() bool { return true }
+	t.Cleanup(func() { stdoutIsTerminal = previous })
+
+	tests := []struct {
+		name      string
+		noColor   string
+		plain     bool
+		wantColor bool
+	}{
+		{name: "terminal", wantColor: true},
+		{name: "NO_COLOR set", noColor: "1"},
+		{name: "plain flag", plain: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			plainOutput = tt.plain
+			t.Cleanup(func() { plainOutput = false })
+
+			for _, output := range []string{green("[ok]"), red("[!!]"), yellow("[--]")} {
+				if hasEscape := strings.Contains(output, "\x1b["); hasEscape != tt.wantColor {
+					t.Errorf("Expected escape codes %v, got %q", tt.wantColor, output)
+				}
+			}
+		})
+	}
+}
+
+func TestInfof(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		quietOutput = quiet
+		t.Cleanup(func() { quietOutput = false })
+
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Failed to create pipe: %v", err)
+		}
+		stdout := os.Stdout
+		os.Stdout = writer
+		infof("Building %s...\n", "image")
+		os.Stdout = stdout
+		writer.Close()
+
+		output, _ := io.ReadAll(reader)
+		expected := "Building image...\n"
+		if quiet {
+			expected = ""
+		}
+		if string(output) != expected {
+			t.Errorf("quiet=%v: expected %q, got %q", quiet, expected, output)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file without building anything",
+	Long: `Loads the configuration and reports every problem found: unknown keys such as
+typos in field names, invalid values, duplicate or empty scripts, broken
+depends_on entries and script names that clash with miko-shell commands.
+
+Exits with a non-zero status when any problem is found.`,
+	Example: `  # Check the current project
+  miko-shell validate
+
+  # Check a specific configuration
+  miko-shell validate -c path/to/miko-shell.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = mikoshell.ConfigFileName
+		}
+
+		problems := mikoshell.ValidateConfigFile(configFile, commandNames(rootCmd))
+		printValidation(cmd.OutOrStdout(), configFile, problems)
+
+		if len(problems) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%s has %d problem(s)", configFile, len(problems))
+		}
+		return nil
+	},
+}
+
+// commandNames returns the names and aliases of the subcommands of root,
+// plus the implicit help command
+func commandNames(root *cobra.Command) []string {
+	names := []string{"help"}
+	for _, command := range root.Commands() {
+		names = append(names, command.Name())
+		names = append(names, command.Aliases...)
+	}
+	return names
+}
+
+// printValidation writes the validate report
+func printValidation(w io.Writer, configFile string, problems []error) {
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "%s %s is valid\n", green("[ok]"), configFile)
+		return
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintf(w, "%s %v\n", red("[!!]"), problem)
+	}
+	fmt.Fprintf(w, "\n%d problem(s) found in %s\n", len(problems), configFile)
+}
+
+func init() {
+	validateCmd.Flags().StringP("config", "c", "", "Path to configuration file (default: miko-shell.yaml)")
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCommandNames(t *testing.T) {
+	names := strings.Join(commandNames(rootCmd), " ")
+	for _, expected := range []string{"help", "run", "exec", "validate"} {
+		if !strings.Contains(" "+names+" ", " "+expected+" ") {
+			t.Errorf("Expected %q in command names, got %s", expected, names)
+		}
+	}
+}
+
+func TestPrintValidation(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		var buf bytes.Buffer
+		printValidation(&buf, "miko-shell.yaml", nil)
+
+		if !strings.Contains(buf.String(), "miko-shell.yaml is valid") {
+			t.Errorf("Expected valid message, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		var buf bytes.Buffer
+		printValidation(&buf, "miko-shell.yaml", []error{
+			errors.New("line 5: unknown field 'scirpts'"),
+			errors.New("script 'empty' has no commands"),
+		})
+
+		output := buf.String()
+		for _, expected := range []string{"unknown field 'scirpts'", "has no commands", "2 problem(s) found in miko-shell.yaml"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected %q in output:\n%s", expected, output)
+			}
+		}
+	})
+}
@@ -4,10 +4,12 @@ import (
 	"os"
 
 	"github.com/jepemo/miko-shell/cmd"
+	"github.com/jepemo/miko-shell/pkg/mikoshell"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
-		os.Exit(1)
+		// A failing container command exits with its own code
+		os.Exit(mikoshell.ExitCode(err))
 	}
 }
@@ -1,8 +1,21 @@
 package mikoshell
 
 import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -22,16 +35,18 @@ type ImageInfo struct {
 
 // LayerInfo represents information about a container image layer
 type LayerInfo struct {
-	ID   string `json:"id"`
-	Size string `json:"size"`
+	ID        string `json:"id"`
+	Size      string `json:"size"`
+	CreatedBy string `json:"created_by,omitempty"`
 }
 
 // ImageListItem represents a container image in a list
 type ImageListItem struct {
-	ID      string    `json:"id"`
-	Tag     string    `json:"tag"`
-	Size    string    `json:"size"`
-	Created time.Time `json:"created"`
+	ID      string            `json:"id"`
+	Tag     string            `json:"tag"`
+	Size    string            `json:"size"`
+	Created time.Time         `json:"created"`
+	Labels  map[string]string `json:"labels,omitempty"`
 }
 
 // PruneInfo represents information about what will be pruned
@@ -45,8 +60,38 @@ type PruneInfo struct {
 
 // PruneResult represents the result of a prune operation
 type PruneResult struct {
-	RemovedImages  int    `json:"removed_images"`
-	ReclaimedSpace string `json:"reclaimed_space"`
+	RemovedImages int `json:"removed_images"`
+	// RemovedCacheObjects counts the build cache entries removed by PruneBuildCache
+	RemovedCacheObjects int    `json:"removed_cache_objects,omitempty"`
+	ReclaimedSpace      string `json:"reclaimed_space"`
+}
+
+// ImageStatus describes the state of the current project's image
+type ImageStatus struct {
+	Tag         string     `json:"tag"`
+	Built       bool       `json:"built"`
+	Info        *ImageInfo `json:"info,omitempty"`
+	CurrentHash string     `json:"current_hash"`
+	StoredHash  string     `json:"stored_hash,omitempty"`
+	UpToDate    bool       `json:"up_to_date"`
+}
+
+// ScriptInfo describes a script for machine-readable listings, e.g. editors
+// discovering the tasks of a project
+type ScriptInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Commands    int    `json:"commands"`
+}
+
+// Status summarizes the project configuration and the state of its image
+type Status struct {
+	ConfigFile        string       `json:"config_file"`
+	Name              string       `json:"name"`
+	Provider          string       `json:"provider"`
+	ProviderAvailable bool         `json:"provider_available"`
+	Image             *ImageStatus `json:"image,omitempty"`
+	Scripts           int          `json:"scripts"`
 }
 
 // Client provides the main functionality of the miko-shell tool
@@ -55,6 +100,18 @@ type Client struct {
 	config     *Config
 	provider   ContainerProvider
 	configFile string
+	buildOpts  BuildOptions
+	overrides  []string
+	// profile is the entry of 'profiles' merged over each loaded config
+	profile string
+	// daemonChecked records that the provider daemon answered once already
+	daemonChecked bool
+	// noCacheCheck always asks the provider whether the image exists instead
+	// of trusting an image marker
+	noCacheCheck bool
+	// homeMounts are subdirectories of the container home directory kept on
+	// the host between runs, mounted once the image is known
+	homeMounts []string
 }
 
 // NewClient creates a new miko-shell client instance
@@ -82,7 +139,7 @@ func NewClientWithConfig(config *Config) (*Client, error) {
 	}
 
 	// Initialize the container provider
-	provider, err := NewContainerProvider(config.Container.Provider)
+	provider, err := NewContainerProviderForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create container provider: %w", err)
 	}
@@ -109,7 +166,7 @@ func NewClientWithConfigFile(config *Config, configFile string) (*Client, error)
 	}
 
 	// Initialize the container provider
-	provider, err := NewContainerProvider(config.Container.Provider)
+	provider, err := NewContainerProviderForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create container provider: %w", err)
 	}
@@ -128,13 +185,19 @@ func (c *Client) LoadConfig() error {
 	if err != nil {
 		return err
 	}
+	if err := cfg.ApplyProfile(c.profile); err != nil {
+		return err
+	}
+	if err := cfg.ApplyOverrides(c.overrides); err != nil {
+		return err
+	}
 
 	c.config = cfg
 	c.configFile = ConfigFileName
 
 	// Initialize the container provider only if not already set (for testing)
 	if c.provider == nil {
-		provider, err := NewContainerProvider(cfg.Container.Provider)
+		provider, err := NewContainerProviderForConfig(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to create container provider: %w", err)
 		}
@@ -154,13 +217,19 @@ func (c *Client) LoadConfigFromFile(filePath string) error {
 	if err != nil {
 		return err
 	}
+	if err := cfg.ApplyProfile(c.profile); err != nil {
+		return err
+	}
+	if err := cfg.ApplyOverrides(c.overrides); err != nil {
+		return err
+	}
 
 	c.config = cfg
 	c.configFile = filePath
 
 	// Initialize the container provider only if not already set (for testing)
 	if c.provider == nil {
-		provider, err := NewContainerProvider(cfg.Container.Provider)
+		provider, err := NewContainerProviderForConfig(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to create container provider: %w", err)
 		}
@@ -204,30 +273,100 @@ func (c *Client) InitProject(useDockerfile bool) error {
 	return nil
 }
 
+// SetOverrides sets "key=value" config overrides applied whenever the client loads a config
+func (c *Client) SetOverrides(overrides []string) {
+	c.overrides = overrides
+}
+
+// SetProfile selects the profile merged over the config whenever the client
+// loads one; overrides still apply on top of it
+func (c *Client) SetProfile(profile string) {
+	c.profile = profile
+}
+
+// SetBuildOptions sets the options used whenever the client builds an image
+func (c *Client) SetBuildOptions(opts BuildOptions) {
+	c.buildOpts = opts
+}
+
+// SetNoCacheCheck makes runs ask the provider whether the image exists even
+// when an earlier run recorded that it does
+func (c *Client) SetNoCacheCheck(noCacheCheck bool) {
+	c.noCacheCheck = noCacheCheck
+}
+
+// SetHomeMounts persists the given subdirectories of the container home
+// directory, e.g. .aws or .config/gcloud, on the host between runs
+func (c *Client) SetHomeMounts(subdirs []string) error {
+	for _, subdir := range subdirs {
+		if err := validateHomeSubdir(subdir); err != nil {
+			return err
+		}
+	}
+	c.homeMounts = subdirs
+	return nil
+}
+
 // BuildImage builds the container image, optionally forcing a rebuild
 func (c *Client) BuildImage(force bool) error {
 	if c.config == nil {
 		return fmt.Errorf("configuration not loaded")
 	}
 
-	hash, err := GetConfigHashFromFile(c.configFile)
+	tag, err := c.GetImageTag()
 	if err != nil {
-		return fmt.Errorf("failed to calculate config hash: %w", err)
+		return err
+	}
+
+	if err := c.checkDaemon(); err != nil {
+		return err
 	}
 
-	tag := fmt.Sprintf("%s:%s", c.config.Name, hash)
+	// A pulled image isn't ours to remove, so forcing pulls it again
+	if c.config.Container.Pull {
+		return c.pullImage(tag)
+	}
 
 	// If force is enabled, remove existing image first
 	if force && c.provider.ImageExists(tag) {
 		if err := c.provider.RemoveImage(tag); err != nil {
 			return fmt.Errorf("failed to remove existing image: %w", err)
 		}
+		c.unmarkImage(tag)
 	}
 
-	if err := c.provider.BuildImage(c.config, tag); err != nil {
+	if err := c.provider.BuildImage(c.config, tag, c.buildOpts); err != nil {
 		return fmt.Errorf("failed to build image: %w", err)
 	}
 
+	if err := c.verifyImage(tag); err != nil {
+		return err
+	}
+	c.markImage(tag)
+	return nil
+}
+
+// pullImage pulls the container.image run as it is in pull mode
+func (c *Client) pullImage(ref string) error {
+	if err := c.provider.PullImage(c.config, ref); err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	c.markImage(ref)
+	return nil
+}
+
+// verifyImage runs the container.verify commands against a freshly built image
+func (c *Client) verifyImage(tag string) error {
+	if len(c.config.Container.Verify) == 0 {
+		return nil
+	}
+
+	if err := c.provider.VerifyImage(tag, c.config.Container.Verify); err != nil {
+		// Drop the image so the next run rebuilds instead of reusing it
+		_ = c.provider.RemoveImage(tag)
+		c.unmarkImage(tag)
+		return fmt.Errorf("image verification failed: %w", err)
+	}
 	return nil
 }
 
@@ -240,29 +379,46 @@ func (c *Client) BuildImageWithForce(force bool) (string, error) {
 		return "", fmt.Errorf("configuration not loaded")
 	}
 
-	hash, err := GetConfigHashFromFile(c.configFile)
+	tag, err := c.GetImageTag()
 	if err != nil {
-		return "", fmt.Errorf("failed to calculate config hash: %w", err)
+		return "", err
+	}
+
+	if err := c.checkDaemon(); err != nil {
+		return "", err
 	}
 
-	tag := fmt.Sprintf("%s:%s", c.config.Name, hash)
+	if c.config.Container.Pull {
+		return tag, c.pullImage(tag)
+	}
 
 	// If force is enabled, remove existing image first
 	if force && c.provider.ImageExists(tag) {
 		if err := c.provider.RemoveImage(tag); err != nil {
 			return "", fmt.Errorf("failed to remove existing image: %w", err)
 		}
+		c.unmarkImage(tag)
 	}
 
-	if err := c.provider.BuildImage(c.config, tag); err != nil {
+	if err := c.provider.BuildImage(c.config, tag, c.buildOpts); err != nil {
 		return "", fmt.Errorf("failed to build image: %w", err)
 	}
 
+	if err := c.verifyImage(tag); err != nil {
+		return "", err
+	}
+	c.markImage(tag)
+
 	return tag, nil
 }
 
 // RunCommand executes a command in the container
 func (c *Client) RunCommand(args []string) error {
+	return c.RunCommandWithOptions(args, RunOptions{})
+}
+
+// RunCommandWithOptions executes a command in the container using the given run options
+func (c *Client) RunCommandWithOptions(args []string, opts RunOptions) error {
 	if c.config == nil {
 		return fmt.Errorf("configuration not loaded")
 	}
@@ -271,51 +427,501 @@ func (c *Client) RunCommand(args []string) error {
 		return fmt.Errorf("no command specified")
 	}
 
-	tag, err := c.ensureImageExists()
+	if opts.Workdir != "" {
+		if err := c.config.checkSubWorkdir(opts.Workdir); err != nil {
+			return err
+		}
+		opts.Workdir = path.Clean(filepath.ToSlash(opts.Workdir))
+	}
+
+	tag, cached, err := c.ensureImageExists()
 	if err != nil {
 		return err
 	}
+	if err := c.addHomeMounts(tag); err != nil {
+		return err
+	}
 
 	// Check if the command is a script
+	command := args
 	commandName := args[0]
-	if script, exists := c.config.GetScript(commandName); exists {
+	// timedCommand is the command instrumented for the summary, labels name its commands
+	var timedCommand []string
+	var labels []string
+	if script, exists := c.config.GetScript(commandName); exists && !opts.Literal {
 		// Run the script commands with parameters
 		scriptArgs := args[1:] // Get the remaining arguments
-		commandStr := script.GetCommandsAsStringWithArgs(scriptArgs)
-		command := []string{"/bin/sh", "-c", commandStr}
-		return c.provider.RunCommand(c.config, tag, command)
+		strict := opts.StrictArgs || c.config.Shell.StrictArgs
+		chain, err := c.config.runnableChain(script, scriptHostOS())
+		if err != nil {
+			return err
+		}
+		annotated := annotatedScripts(chain)
+		command = c.config.shellCommand(scriptCommand(annotated, scriptArgs, strict))
+		if opts.Summary {
+			labels = commandLabels(chain)
+			timedCommand = c.config.shellCommand(scriptCommand(timedScripts(annotated), scriptArgs, strict))
+		}
+	} else if opts.ShellWrap {
+		command = c.config.shellCommand(strings.Join(args, " "))
+	}
+	if opts.Summary && labels == nil {
+		labels = []string{strings.Join(args, " ")}
+	}
+
+	// The environment is dumped into the project mount, then moved into place
+	var envDump string
+	if opts.DumpEnv != "" {
+		name := ".miko-shell-env-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		envDump = filepath.Join(c.config.workspaceDir(), name)
+		defer os.Remove(envDump)
+		command = withEnvDump(command, path.Join(c.config.workdir(), name))
+		if timedCommand != nil {
+			timedCommand = withEnvDump(timedCommand, path.Join(c.config.workdir(), name))
+		}
 	}
 
-	// Run the command directly
-	return c.provider.RunCommand(c.config, tag, args)
+	summaryOut := writerOr(opts.Stderr, os.Stderr)
+	if opts.OutputPrefix != "" {
+		prefix := "[" + opts.OutputPrefix + "] "
+		opts.Stdout = newPrefixWriter(writerOr(opts.Stdout, os.Stdout), prefix)
+		opts.Stderr = newPrefixWriter(writerOr(opts.Stderr, os.Stderr), prefix)
+	}
+
+	// The TTY re-run is for reading output, so only the regular run is timed
+	runCommand := command
+	var timer *timingWriter
+	if opts.Summary {
+		if timedCommand != nil {
+			runCommand = timedCommand
+		}
+		timer = newTimingWriter(writerOr(opts.Stderr, os.Stderr))
+		opts.Stderr = timer
+	}
+
+	// A failure is re-run in the container it happened in, so the container
+	// is kept running and the command exec'd into it
+	if opts.RerunWithTTY {
+		if opts.Name == "" {
+			if opts.Name, err = containerName(c.config.Name, "run", ""); err != nil {
+				return err
+			}
+		}
+		err = c.provider.StartContainer(c.config, tag, opts)
+		if err != nil && c.staleImage(tag, cached) {
+			if tag, cached, err = c.ensureImageExists(); err == nil {
+				err = c.provider.StartContainer(c.config, tag, opts)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start container: %w", err)
+		}
+		defer c.provider.RemoveContainer(opts.Name)
+	}
+
+	// Only the command is retried; the image was built above
+	for attempt := 0; ; attempt++ {
+		if timer != nil {
+			timer.reset()
+		}
+		err = c.runInContainer(tag, runCommand, opts)
+		if err != nil && !opts.RerunWithTTY && c.staleImage(tag, cached) {
+			// The image was removed outside miko-shell; build it and run again
+			if tag, cached, err = c.ensureImageExists(); err != nil {
+				return err
+			}
+			if timer != nil {
+				timer.reset()
+			}
+			err = c.runInContainer(tag, runCommand, opts)
+		}
+		if err == nil || attempt >= opts.Retries {
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "Attempt %d/%d failed: %v; retrying in %s\n", attempt+1, opts.Retries+1, err, opts.RetryDelay)
+		time.Sleep(opts.RetryDelay)
+	}
+
+	if timer != nil {
+		timer.flush()
+		writeTimingSummary(summaryOut, labels, timer.durations(len(labels), time.Now()), err != nil)
+	}
+
+	if opts.RerunWithTTY {
+		// Files are copied out as the original run left them
+		copyErr := c.copyOut(opts.Name, opts.CopyOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Command failed: %v; re-running it with a TTY in the same container\n", err)
+			_ = c.provider.ExecCommand(c.config, opts.Name, command, ttyRerunOptions(opts))
+		} else {
+			err = copyErr
+		}
+	}
+
+	if envDump != "" {
+		// A failed command still dumps its environment; its error comes first
+		if dumpErr := moveFile(envDump, opts.DumpEnv); dumpErr != nil && err == nil {
+			err = fmt.Errorf("failed to write environment dump: %w", dumpErr)
+		}
+	}
+
+	return err
+}
+
+// ExpandScript returns the shell script a named script runs as: args[0] is
+// the script name and the rest its arguments, dependencies are chained in,
+// arguments set with "set --" and commands joined. It is the script passed
+// to "sh -c", for debugging, and nothing is run.
+func (c *Client) ExpandScript(args []string, strictArgs bool) (string, error) {
+	if c.config == nil {
+		return "", fmt.Errorf("configuration not loaded")
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("no script specified")
+	}
+
+	script, exists := c.config.GetScript(args[0])
+	if !exists {
+		return "", fmt.Errorf("unknown script '%s'", args[0])
+	}
+	chain, err := c.config.runnableChain(script, scriptHostOS())
+	if err != nil {
+		return "", err
+	}
+	return scriptCommand(annotatedScripts(chain), args[1:], strictArgs || c.config.Shell.StrictArgs), nil
+}
+
+// withEnvDump returns command preceded by writing the environment to file, a
+// container path. Shell commands get the dump as their first line; direct
+// commands are exec'd from a shell so their arguments are left untouched.
+func withEnvDump(command []string, file string) []string {
+	dump := "env > " + shellQuote(file)
+	if n := len(command); n >= 3 && command[0] == "/bin/sh" && command[n-2] == "-c" {
+		dumped := append([]string{}, command...)
+		dumped[n-1] = dump + "\n" + command[n-1]
+		return dumped
+	}
+	return append([]string{"/bin/sh", "-c", dump + "\nexec \"$@\"", "sh"}, command...)
+}
+
+// moveFile moves src to dest, which is created with owner-only permissions
+// since an environment may hold secrets. Copying rather than renaming works
+// across file systems.
+func moveFile(src, dest string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, data, 0600); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// ttyRerunOptions returns the options for re-running a failed command with a
+// TTY attached: the same command setup, without the output handling and
+// retries of the original run
+func ttyRerunOptions(opts RunOptions) RunOptions {
+	rerun := opts
+	rerun.TTY = true
+	rerun.RerunWithTTY = false
+	rerun.Retries = 0
+	rerun.RetryDelay = 0
+	rerun.CopyOut = nil
+	rerun.Summary = false
+	rerun.OutputPrefix = ""
+	rerun.Stdout = nil
+	rerun.Stderr = nil
+	return rerun
+}
+
+// containerSuffixPattern matches the suffixes allowed in container names
+var containerSuffixPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// containerName returns the name of a project container as
+// <project>-<kind>-<suffix>, so concurrent containers of one project can
+// coexist. An empty suffix is generated.
+func containerName(project, kind, suffix string) (string, error) {
+	if suffix == "" {
+		suffix = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	if !containerSuffixPattern.MatchString(suffix) {
+		return "", fmt.Errorf("invalid container name suffix '%s': use letters, digits, '_', '.' or '-'", suffix)
+	}
+	return fmt.Sprintf("%s-%s-%s", NormalizeName(project), kind, suffix), nil
+}
+
+// runInContainer runs a command and copies any requested paths out of the
+// container before it is removed
+func (c *Client) runInContainer(tag string, command []string, opts RunOptions) error {
+	if opts.RerunWithTTY {
+		// The container was started for the re-run, which copies files out
+		return c.provider.ExecCommand(c.config, opts.Name, command, opts)
+	}
+	if len(opts.CopyOut) == 0 {
+		return c.provider.RunCommand(c.config, tag, command, opts)
+	}
+
+	// The container must outlive the command so its files can be copied out
+	if opts.Name == "" {
+		name, err := containerName(c.config.Name, "run", "")
+		if err != nil {
+			return err
+		}
+		opts.Name = name
+	}
+	opts.Keep = true
+
+	runErr := c.provider.RunCommand(c.config, tag, command, opts)
+
+	copyErr := c.copyOut(opts.Name, opts.CopyOut)
+
+	if err := c.provider.RemoveContainer(opts.Name); err != nil && runErr == nil && copyErr == nil {
+		return fmt.Errorf("failed to remove container '%s': %w", opts.Name, err)
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	return copyErr
+}
+
+// copyOut copies the given paths out of a container to their host directories
+func (c *Client) copyOut(container string, specs []CopySpec) error {
+	for _, spec := range specs {
+		if err := os.MkdirAll(spec.Dest, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory '%s': %w", spec.Dest, err)
+		}
+		if err := c.provider.CopyFromContainer(container, spec.Src, spec.Dest); err != nil {
+			return fmt.Errorf("failed to copy '%s' from container: %w", spec.Src, err)
+		}
+	}
+	return nil
+}
+
+// ParseBuildArgs parses repeated KEY=VALUE build arg overrides; a later
+// entry for the same key wins
+func ParseBuildArgs(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	args := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid build arg '%s': expected KEY=VALUE", entry)
+		}
+		args[key] = value
+	}
+	return args, nil
+}
+
+// ParseCopySpec parses a "[container:]/container/path:hostdir" copy-out specification
+func ParseCopySpec(value string) (CopySpec, error) {
+	spec := strings.TrimPrefix(value, "container:")
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return CopySpec{}, fmt.Errorf("invalid copy-out spec '%s': expected container:/path:hostdir", value)
+	}
+
+	if !strings.HasPrefix(parts[0], "/") {
+		return CopySpec{}, fmt.Errorf("invalid copy-out spec '%s': container path must be absolute", value)
+	}
+
+	return CopySpec{Src: parts[0], Dest: parts[1]}, nil
 }
 
 // OpenShell opens an interactive shell in the container
 func (c *Client) OpenShell() error {
+	return c.OpenShellWithOptions(OpenOptions{})
+}
+
+// OpenOptions holds settings for opening an interactive shell
+type OpenOptions struct {
+	// NoStartup skips the shell.startup hooks and opens a plain shell
+	NoStartup bool
+}
+
+// OpenShellWithOptions opens an interactive shell in the container
+func (c *Client) OpenShellWithOptions(opts OpenOptions) error {
 	if c.config == nil {
 		return fmt.Errorf("configuration not loaded")
 	}
 
-	tag, err := c.ensureImageExists()
+	tag, cached, err := c.ensureImageExists()
 	if err != nil {
 		return err
 	}
+	if err := c.addHomeMounts(tag); err != nil {
+		return err
+	}
+
+	err = c.openShell(tag, opts)
+	if err != nil && c.staleImage(tag, cached) {
+		if tag, _, err = c.ensureImageExists(); err != nil {
+			return err
+		}
+		err = c.openShell(tag, opts)
+	}
+	return err
+}
 
+// openShell runs the interactive shell in a container of tag
+func (c *Client) openShell(tag string, opts OpenOptions) error {
+	if opts.NoStartup {
+		return c.provider.RunShell(c.config, tag)
+	}
 	return c.provider.RunShellWithStartup(c.config, tag)
 }
 
+// configHash calculates the hash identifying the current configuration, with
+// the files it copies into the image and this build's arguments
+func (c *Client) configHash() (string, error) {
+	hash, err := c.config.hash()
+	if err != nil {
+		return "", err
+	}
+
+	var inputs []string
+
+	// The Dockerfile of a custom build is read at build time, so its
+	// contents affect the tag. A missing one is left for the build to report.
+	if build := c.config.Container.Build; build != nil {
+		dockerfile := c.config.resolvePath(build.Dockerfile)
+		if _, err := os.Stat(dockerfile); err == nil {
+			digest, err := hashPath(dockerfile)
+			if err != nil {
+				return "", fmt.Errorf("failed to read dockerfile '%s': %w", build.Dockerfile, err)
+			}
+			inputs = append(inputs, fmt.Sprintf("dockerfile=%s", digest))
+		}
+	}
+
+	// Copied files are part of the image, so their contents affect the tag
+	for _, entry := range c.config.Container.Copy {
+		digest, err := hashPath(c.config.resolvePath(entry.Src))
+		if err != nil {
+			return "", fmt.Errorf("failed to read copy source '%s': %w", entry.Src, err)
+		}
+		inputs = append(inputs, fmt.Sprintf("copy=%s:%s:%s", entry.Src, entry.Dest, digest))
+	}
+
+	// Build args given for this build produce their own image
+	keys := make([]string, 0, len(c.buildOpts.BuildArgs))
+	for key := range c.buildOpts.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		inputs = append(inputs, fmt.Sprintf("build-arg=%s=%s", key, c.buildOpts.BuildArgs[key]))
+	}
+
+	if len(inputs) == 0 {
+		return hash, nil
+	}
+
+	hasher := sha256.New()
+	hasher.Write([]byte(hash))
+	for _, input := range inputs {
+		hasher.Write([]byte("\n" + input))
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil))[:12], nil
+}
+
 // GetImageTag returns the current image tag
 func (c *Client) GetImageTag() (string, error) {
 	if c.config == nil {
 		return "", fmt.Errorf("configuration not loaded")
 	}
 
-	hash, err := GetConfigHashFromFile(c.configFile)
+	// A pulled image is run as it is, under its own reference
+	if c.config.Container.Pull {
+		return c.config.Container.Image, nil
+	}
+
+	hash, err := c.configHash()
 	if err != nil {
 		return "", fmt.Errorf("failed to calculate config hash: %w", err)
 	}
 
-	return fmt.Sprintf("%s:%s", c.config.Name, hash), nil
+	return c.config.imageTag(hash, time.Now())
+}
+
+// GetImageStatus reports whether the project's image is built and matches the current config
+func (c *Client) GetImageStatus() (*ImageStatus, error) {
+	if c.config == nil {
+		return nil, fmt.Errorf("configuration not loaded")
+	}
+
+	hash, err := c.configHash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate config hash: %w", err)
+	}
+
+	tag, err := c.GetImageTag()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ImageStatus{
+		Tag:         tag,
+		CurrentHash: hash,
+	}
+
+	if c.provider == nil || !c.provider.ImageExists(tag) {
+		return status, nil
+	}
+	status.Built = true
+
+	info, err := c.provider.GetImageInfo(tag)
+	if err != nil {
+		// The image exists, so treat missing details as non-fatal
+		status.UpToDate = true
+		return status, nil
+	}
+	status.Info = info
+	status.StoredHash = info.Labels[LabelConfigHash]
+
+	// Images built before labels were stamped can only be matched by tag
+	status.UpToDate = status.StoredHash == "" || status.StoredHash == hash
+
+	return status, nil
+}
+
+// GetStatus summarizes the loaded configuration and image state without building anything
+func (c *Client) GetStatus() (*Status, error) {
+	if c.config == nil {
+		return nil, fmt.Errorf("configuration not loaded")
+	}
+
+	configFile, err := filepath.Abs(c.configFile)
+	if err != nil {
+		configFile = c.configFile
+	}
+
+	status := &Status{
+		ConfigFile: configFile,
+		Name:       c.config.Name,
+		Provider:   c.config.Container.Provider,
+		Scripts:    len(c.config.Shell.Scripts),
+	}
+
+	if c.provider == nil || !c.provider.IsAvailable() {
+		return status, nil
+	}
+	status.ProviderAvailable = true
+
+	imageStatus, err := c.GetImageStatus()
+	if err != nil {
+		return nil, err
+	}
+	status.Image = imageStatus
+
+	return status, nil
 }
 
 // GetCommandsAsString converts Commands field to a shell command string
@@ -325,8 +931,21 @@ func (s *Script) GetCommandsAsString() string {
 
 // GetCommandsAsStringWithArgs converts Commands field to a shell command string with arguments
 func (s *Script) GetCommandsAsStringWithArgs(args []string) string {
+	return s.commandString(args, false)
+}
+
+// commandString joins the commands with their argument setup; in strict mode
+// a referenced positional argument without a default must be passed
+func (s *Script) commandString(args []string, strict bool) string {
 	// Join all commands with &&
 	command := strings.Join(s.Commands, " && ")
+	if strict {
+		if n := s.requiredArgs(command); n > 0 {
+			command = argsGuard(n) + "; " + command
+		}
+	}
+
+	args = s.argsWithDefaults(args)
 
 	// If there are no arguments, return the command as is
 	if len(args) == 0 {
@@ -345,52 +964,435 @@ func (s *Script) GetCommandsAsStringWithArgs(args []string) string {
 	return argSetup + "; " + command
 }
 
-// ListScripts displays all available scripts with their descriptions
+// scriptCommand returns the shell command running chain, a script preceded
+// by its dependencies; only the last script receives args
+func scriptCommand(chain []*Script, args []string, strict bool) string {
+	if len(chain) == 1 {
+		return chain[0].commandString(args, strict)
+	}
+	return chainCommands(chain, args, strict)
+}
+
+// annotatedScripts returns copies of scripts whose commands report on stderr
+// which one failed, by script and position, before exiting with its status.
+// Scripts running a single command in total are returned as they are.
+func annotatedScripts(scripts []*Script) []*Script {
+	total := 0
+	for _, script := range scripts {
+		total += len(script.Commands)
+	}
+	if total < 2 {
+		return scripts
+	}
+
+	annotated := make([]*Script, len(scripts))
+	for i, script := range scripts {
+		copied := *script
+		copied.Commands = make([]string, len(script.Commands))
+		for j, command := range script.Commands {
+			note := fmt.Sprintf("script '%s' failed at command %d: %s", script.Name, j+1, commandLabel(script, command, false))
+			copied.Commands[j] = fmt.Sprintf("{ %s\n} || { miko_status=$?; printf '%%s\\n' %s >&2; exit $miko_status; }", command, shellQuote(note))
+		}
+		annotated[i] = &copied
+	}
+	return annotated
+}
+
+// timedScripts returns copies of scripts whose commands each write a timing
+// marker to stderr before they start, numbered in the order of commandLabels
+func timedScripts(scripts []*Script) []*Script {
+	timed := make([]*Script, len(scripts))
+	n := 0
+	for i, script := range scripts {
+		copied := *script
+		copied.Commands = make([]string, len(script.Commands))
+		for j, command := range script.Commands {
+			n++
+			copied.Commands[j] = fmt.Sprintf("printf '%%s\\n' '%s %d' >&2 && { %s\n}", timingMarker, n, command)
+		}
+		timed[i] = &copied
+	}
+	return timed
+}
+
+// commandLabels returns the summary labels of the commands of scripts in
+// order. Commands of dependencies are labelled with their script.
+func commandLabels(scripts []*Script) []string {
+	var labels []string
+	for _, script := range scripts {
+		for _, command := range script.Commands {
+			labels = append(labels, commandLabel(script, command, len(scripts) > 1))
+		}
+	}
+	return labels
+}
+
+// commandLabel names a command in the summary by its first line, prefixed
+// with the script name when several scripts run
+func commandLabel(script *Script, command string, withScript bool) string {
+	label, _, multiline := strings.Cut(strings.TrimSpace(command), "\n")
+	if multiline {
+		label += " ..."
+	}
+	if withScript {
+		label = script.Name + ": " + label
+	}
+	return label
+}
+
+// chainCommands joins scripts so each runs only if the previous one succeeded.
+// Only the last script receives args; every script starts from its own
+// positional arguments so they don't leak between scripts.
+func chainCommands(scripts []*Script, args []string, strict bool) string {
+	segments := make([]string, len(scripts))
+	for i, script := range scripts {
+		var scriptArgs []string
+		if i == len(scripts)-1 {
+			scriptArgs = args
+		}
+
+		command := script.commandString(scriptArgs, strict)
+		if len(script.argsWithDefaults(scriptArgs)) == 0 {
+			command = "set --; " + command
+		}
+		segments[i] = "{ " + command + "\n}"
+	}
+	return strings.Join(segments, " && ")
+}
+
+// positionalPattern matches a positional parameter reference at the start of
+// a string: $1..$9 or ${N}
+var positionalPattern = regexp.MustCompile(`^\$(?:([1-9])|\{([1-9][0-9]*)\})`)
+
+// requiredArgs returns the highest positional parameter command references
+// without a default, or 0 if there is none. References in single quotes or
+// after a backslash are literal text, e.g. awk '{print $1}', and don't count.
+func (s *Script) requiredArgs(command string) int {
+	required := 0
+	inSingle, inDouble := false, false
+	for i := 0; i < len(command); i++ {
+		switch c := command[i]; {
+		case inSingle:
+			inSingle = c != '\''
+		case c == '\\':
+			// The next character is literal
+			i++
+		case c == '\'' && !inDouble:
+			inSingle = true
+		case c == '"':
+			inDouble = !inDouble
+		case c == '$':
+			match := positionalPattern.FindStringSubmatch(command[i:])
+			if match == nil {
+				continue
+			}
+			n, _ := strconv.Atoi(match[1] + match[2])
+			if n > required && s.argDefault(n) == "" {
+				required = n
+			}
+			i += len(match[0]) - 1
+		}
+	}
+	return required
+}
+
+// argsGuard returns a shell command aborting the script unless at least n
+// positional arguments are set
+func argsGuard(n int) string {
+	return fmt.Sprintf(`[ $# -ge %d ] || { echo "missing argument %d" >&2; exit 1; }`, n, n)
+}
+
+// argDefault returns the default of the n-th positional argument (1-based), or ""
+func (s *Script) argDefault(n int) string {
+	if n < 1 || n > len(s.Args) {
+		return ""
+	}
+	return s.Args[n-1].Default
+}
+
+// argsWithDefaults fills positional arguments missing from args with the
+// defaults declared in Args. Arguments without a default are left empty only
+// when needed to reach a later default.
+func (s *Script) argsWithDefaults(args []string) []string {
+	last := -1
+	for i := len(args); i < len(s.Args); i++ {
+		if s.Args[i].Default != "" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return args
+	}
+
+	result := append([]string{}, args...)
+	for i := len(args); i <= last; i++ {
+		result = append(result, s.Args[i].Default)
+	}
+	return result
+}
+
+// validateHomeSubdir checks that subdir is a directory below the home
+// directory, e.g. .aws
+func validateHomeSubdir(subdir string) error {
+	cleaned := path.Clean(filepath.ToSlash(subdir))
+	if subdir == "" || path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		strings.ContainsAny(subdir, ":\n") {
+		return fmt.Errorf("invalid --mount-home '%s': must be a directory below the home directory, e.g. .aws", subdir)
+	}
+	return nil
+}
+
+// homeMountVolumes returns the volume specs mounting a host directory per
+// subdir, kept in the user cache directory per project, at its place in home
+func homeMountVolumes(project, home string, subdirs []string) ([]string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the cache directory for --mount-home: %w", err)
+	}
+
+	specs := make([]string, 0, len(subdirs))
+	for _, subdir := range subdirs {
+		subdir = path.Clean(filepath.ToSlash(subdir))
+		host := filepath.Join(cacheDir, "miko-shell", NormalizeName(project), "home", filepath.FromSlash(subdir))
+		specs = append(specs, host+":"+path.Join(home, subdir))
+	}
+	return specs, nil
+}
+
+// addHomeMounts mounts the --mount-home directories into the containers of
+// tag, at the home directory of the user they run as. The host directories
+// are created on first use, private as they often hold credentials.
+func (c *Client) addHomeMounts(tag string) error {
+	if len(c.homeMounts) == 0 {
+		return nil
+	}
+
+	home, err := c.provider.HomeDir(c.config, tag)
+	if err != nil {
+		return err
+	}
+	specs, err := homeMountVolumes(c.config.Name, home, c.homeMounts)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		host := spec[:strings.LastIndex(spec, ":")]
+		if err := os.MkdirAll(host, 0700); err != nil {
+			return fmt.Errorf("failed to create --mount-home directory: %w", err)
+		}
+	}
+
+	c.config.Container.Volumes = append(c.config.Container.Volumes, specs...)
+	// Retries and re-runs reuse the mounts
+	c.homeMounts = nil
+	return nil
+}
+
+// ListOptions holds settings for listing scripts
+type ListOptions struct {
+	// All includes scripts restricted to other host systems with shell.scripts[].os
+	All bool
+}
+
+// ListScripts displays the scripts available on this host with their descriptions
 func (c *Client) ListScripts() error {
+	return c.ListScriptsWithOptions(ListOptions{})
+}
+
+// ListScriptsWithOptions displays the scripts with their descriptions
+func (c *Client) ListScriptsWithOptions(opts ListOptions) error {
 	if c.config == nil {
 		return fmt.Errorf("configuration not loaded")
 	}
 
-	if len(c.config.Shell.Scripts) == 0 {
+	scripts, hidden := c.config.hostScripts(scriptHostOS(), opts.All)
+	if len(scripts) == 0 && hidden == 0 {
 		fmt.Println("No scripts available in this configuration.")
 		return nil
 	}
 
 	fmt.Println("Available scripts:")
 	fmt.Println()
-
-	for _, script := range c.config.Shell.Scripts {
-		if script.Description != "" {
-			fmt.Printf("  %s - %s\n", script.Name, script.Description)
-		} else {
-			fmt.Printf("  %s\n", script.Name)
-		}
+	writeScriptList(os.Stdout, scripts)
+	if hidden > 0 {
+		fmt.Println()
+		fmt.Printf("%d script(s) for other host systems hidden; use --all to list them\n", hidden)
 	}
-
 	fmt.Println()
 	fmt.Println("Usage: ./miko-shell run <script-name>")
 	return nil
 }
 
+// ScriptInfos returns the scripts ListScriptsWithOptions would list, in
+// config order
+func (c *Client) ScriptInfos(opts ListOptions) ([]ScriptInfo, error) {
+	if c.config == nil {
+		return nil, fmt.Errorf("configuration not loaded")
+	}
+
+	scripts, _ := c.config.hostScripts(scriptHostOS(), opts.All)
+	infos := make([]ScriptInfo, 0, len(scripts))
+	for _, script := range scripts {
+		infos = append(infos, ScriptInfo{
+			Name:        script.Name,
+			Description: script.Description,
+			Commands:    len(script.Commands),
+		})
+	}
+	return infos, nil
+}
+
+// writeScriptList writes the scripts grouped by the prefix before the first
+// ":" in their names. Unprefixed scripts come first; groups follow in the
+// order they first appear.
+func writeScriptList(w io.Writer, scripts []Script) {
+	var prefixes []string
+	groups := make(map[string][]Script)
+	for _, script := range scripts {
+		prefix, _, found := strings.Cut(script.Name, ":")
+		if !found {
+			prefix = ""
+		}
+		if _, seen := groups[prefix]; !seen && prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+		groups[prefix] = append(groups[prefix], script)
+	}
+
+	writeScripts := func(indent string, scripts []Script) {
+		for _, script := range scripts {
+			if script.Description != "" {
+				fmt.Fprintf(w, "%s%s - %s\n", indent, script.Name, script.Description)
+			} else {
+				fmt.Fprintf(w, "%s%s\n", indent, script.Name)
+			}
+		}
+	}
+
+	writeScripts("  ", groups[""])
+	for i, prefix := range prefixes {
+		if i > 0 || len(groups[""]) > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "  %s:\n", prefix)
+		writeScripts("    ", groups[prefix])
+	}
+}
+
 // GetConfig returns the current configuration
 func (c *Client) GetConfig() *Config {
 	return c.config
 }
 
-// ensureImageExists checks if the image exists and builds it if necessary
-func (c *Client) ensureImageExists() (string, error) {
-	tag, err := c.GetImageTag()
+// checkDaemon makes sure the provider daemon is reachable before the first
+// build or run, so a stopped daemon is reported clearly instead of failing midway
+func (c *Client) checkDaemon() error {
+	if c.daemonChecked {
+		return nil
+	}
+	if err := c.provider.CheckDaemon(); err != nil {
+		return err
+	}
+	c.daemonChecked = true
+	return nil
+}
+
+// ensureImageExists checks if the image exists and builds it if necessary.
+// cached reports that an image marker answered instead of the provider.
+func (c *Client) ensureImageExists() (tag string, cached bool, err error) {
+	tag, err = c.GetImageTag()
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+
+	// A marker from an earlier run saves the daemon check and image inspect
+	if !c.noCacheCheck && c.hasImageMarker(tag) {
+		return tag, true, nil
+	}
+
+	if err := c.checkDaemon(); err != nil {
+		return "", false, err
 	}
 
 	if !c.provider.ImageExists(tag) {
-		if err := c.BuildImage(false); err != nil {
-			return "", fmt.Errorf("failed to build image: %w", err)
+		if c.config.Container.Pull {
+			if err := c.pullImage(tag); err != nil {
+				return "", false, err
+			}
+		} else if err := c.BuildImage(false); err != nil {
+			return "", false, fmt.Errorf("failed to build image: %w", err)
 		}
 	}
+	c.markImage(tag)
 
-	return tag, nil
+	return tag, false, nil
+}
+
+// imageMarkerDir returns the directory of markers recording images known to
+// exist, or "" to disable them; a variable so tests can redirect it
+var imageMarkerDir = func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "miko-shell", "images")
+}
+
+// imageMarker returns the marker path for tag, or "" when markers are
+// disabled. The tag embeds the config hash, so config changes use a new
+// marker; the provider and daemon settings are part of the key too.
+func (c *Client) imageMarker(tag string) string {
+	dir := imageMarkerDir()
+	if dir == "" || c.config == nil {
+		return ""
+	}
+
+	key := strings.Join([]string{
+		c.config.Container.Provider, c.config.Container.Context,
+		os.Getenv("DOCKER_HOST"), os.Getenv("DOCKER_CONTEXT"), os.Getenv("CONTAINER_HOST"),
+		tag,
+	}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:12]))
+}
+
+// hasImageMarker reports whether an earlier run recorded that tag exists
+func (c *Client) hasImageMarker(tag string) bool {
+	marker := c.imageMarker(tag)
+	if marker == "" {
+		return false
+	}
+	_, err := os.Stat(marker)
+	return err == nil
+}
+
+// markImage records that tag exists. Markers only save time, so failing to
+// write one is ignored.
+func (c *Client) markImage(tag string) {
+	marker := c.imageMarker(tag)
+	if marker == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err == nil {
+		_ = os.WriteFile(marker, nil, 0644)
+	}
+}
+
+// unmarkImage forgets that tag exists, e.g. after removing it
+func (c *Client) unmarkImage(tag string) {
+	if marker := c.imageMarker(tag); marker != "" {
+		_ = os.Remove(marker)
+	}
+}
+
+// staleImage reports whether a failed run used a marker for an image that
+// has since been removed outside miko-shell, dropping the marker if so
+func (c *Client) staleImage(tag string, cached bool) bool {
+	if !cached || c.provider.ImageExists(tag) {
+		return false
+	}
+	c.unmarkImage(tag)
+	return true
 }
 
 // generateImageConfig generates configuration using pre-built image
@@ -485,6 +1487,11 @@ func (c *Client) SetProvider(provider ContainerProvider) {
 	c.provider = provider
 }
 
+// ImageExists reports whether the image tag exists locally
+func (c *Client) ImageExists(tag string) bool {
+	return c.provider != nil && c.provider.ImageExists(tag)
+}
+
 // ListImages returns a list of container images related to miko-shell
 func (c *Client) ListImages() ([]ImageListItem, error) {
 	if c.provider == nil {
@@ -494,13 +1501,30 @@ func (c *Client) ListImages() ([]ImageListItem, error) {
 	return c.provider.ListImages()
 }
 
-// CleanImages removes unused or all miko-shell images
+// CleanImages removes the project's images other than the current one, or
+// all of them, and returns the removed references
 func (c *Client) CleanImages(all bool) ([]string, error) {
 	if c.provider == nil {
 		return nil, fmt.Errorf("container provider not initialized")
 	}
 
-	return c.provider.CleanImages(all)
+	var keep []string
+	if !all {
+		tag, err := c.GetImageTag()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current image tag: %w", err)
+		}
+		keep = append(keep, tag)
+		if c.config.Container.Build != nil {
+			keep = append(keep, customImageTag(c.config, tag))
+		}
+	}
+
+	removed, err := c.provider.CleanImages(c.config, keep)
+	for _, ref := range removed {
+		c.unmarkImage(ref)
+	}
+	return removed, err
 }
 
 // GetImageInfo returns detailed information about a container image
@@ -521,6 +1545,246 @@ func (c *Client) GetImageInfo(imageID string) (*ImageInfo, error) {
 	return c.provider.GetImageInfo(imageID)
 }
 
+// InspectImage returns the provider's raw inspect output for an image,
+// defaulting to the current project's image like GetImageInfo
+func (c *Client) InspectImage(imageID string) ([]byte, error) {
+	if c.provider == nil {
+		return nil, fmt.Errorf("container provider not initialized")
+	}
+
+	if imageID == "" {
+		tag, err := c.GetImageTag()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current image tag: %w", err)
+		}
+		imageID = tag
+	}
+
+	return c.provider.InspectImage(imageID)
+}
+
+// TagImage adds the tag dst to the existing image src
+func (c *Client) TagImage(src, dst string) error {
+	if c.provider == nil {
+		return fmt.Errorf("container provider not initialized")
+	}
+
+	for _, ref := range []string{src, dst} {
+		if err := validateImageRef(ref); err != nil {
+			return err
+		}
+	}
+	if strings.Contains(dst, "@") {
+		return fmt.Errorf("invalid target '%s': a tag cannot include a digest", dst)
+	}
+
+	if !c.provider.ImageExists(src) {
+		return fmt.Errorf("image '%s' not found", src)
+	}
+
+	if err := c.provider.TagImage(src, dst); err != nil {
+		return fmt.Errorf("failed to tag image '%s' as '%s': %w", src, dst, err)
+	}
+	return nil
+}
+
+// CheckSaveDestination checks that an image tarball can be written to path,
+// so a bad destination fails before a long build rather than after it
+func CheckSaveDestination(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("output '%s' is a directory", path)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("output '%s' is not writable: %w", path, err)
+		}
+		file.Close()
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	probe, err := os.CreateTemp(dir, ".miko-shell-save-*")
+	if err != nil {
+		return fmt.Errorf("output directory '%s' is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// SaveImage writes the project image to path as a tarball, to move it to
+// another machine and "docker load" it there
+func (c *Client) SaveImage(path string) error {
+	if c.config == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	if err := CheckSaveDestination(path); err != nil {
+		return err
+	}
+
+	tag, err := c.GetImageTag()
+	if err != nil {
+		return err
+	}
+	if err := c.checkDaemon(); err != nil {
+		return err
+	}
+	if !c.provider.ImageExists(tag) {
+		return fmt.Errorf("image '%s' not found; build it first", tag)
+	}
+
+	if err := c.provider.SaveImage(tag, path); err != nil {
+		return fmt.Errorf("failed to save image '%s': %w", tag, err)
+	}
+	return nil
+}
+
+// ImageArchiveTags returns the image tags recorded in a tarball written by
+// "docker save", "podman save" or "nerdctl save", gzipped or not
+func ImageArchiveTags(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var stream io.Reader = reader
+	if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+		defer gz.Close()
+		stream = gz
+	}
+
+	// Docker archives list tags in manifest.json; OCI archives from nerdctl
+	// may only name the image in index.json
+	var manifestTags, indexTags []string
+	archive := tar.NewReader(stream)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+		}
+
+		switch strings.TrimPrefix(header.Name, "./") {
+		case "manifest.json":
+			var manifest []struct {
+				RepoTags []string `json:"RepoTags"`
+			}
+			if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest.json in '%s': %w", path, err)
+			}
+			for _, entry := range manifest {
+				manifestTags = append(manifestTags, entry.RepoTags...)
+			}
+		case "index.json":
+			var index struct {
+				Manifests []struct {
+					Annotations map[string]string `json:"annotations"`
+				} `json:"manifests"`
+			}
+			if err := json.NewDecoder(archive).Decode(&index); err != nil {
+				return nil, fmt.Errorf("invalid index.json in '%s': %w", path, err)
+			}
+			for _, entry := range index.Manifests {
+				if name := entry.Annotations["io.containerd.image.name"]; name != "" {
+					indexTags = append(indexTags, name)
+				}
+			}
+		}
+	}
+
+	if len(manifestTags) > 0 {
+		return manifestTags, nil
+	}
+	return indexTags, nil
+}
+
+// LoadImage imports an image tarball written by "image build --output" or
+// "docker save". With retag, the image in it is also tagged with the
+// project's image tag so run and open use it; the tag it was retagged from is
+// returned, or "" when the tarball already has the project tag.
+func (c *Client) LoadImage(path string, retag bool) (string, error) {
+	if c.config == nil {
+		return "", fmt.Errorf("configuration not loaded")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("image file '%s' not found", path)
+		}
+		return "", fmt.Errorf("failed to access image file '%s': %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("image file '%s' is not a regular file", path)
+	}
+
+	var tag, source string
+	if retag {
+		if tag, err = c.GetImageTag(); err != nil {
+			return "", err
+		}
+		tags, err := ImageArchiveTags(path)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case slices.Contains(tags, tag):
+		case len(tags) == 0:
+			return "", fmt.Errorf("'%s' has no tagged image to retag; load it and use 'image retag'", path)
+		case len(tags) > 1:
+			return "", fmt.Errorf("'%s' holds several images (%s); load it and use 'image retag' to pick one",
+				path, strings.Join(tags, ", "))
+		default:
+			source = tags[0]
+		}
+	}
+
+	if err := c.checkDaemon(); err != nil {
+		return "", err
+	}
+	if err := c.provider.LoadImage(path); err != nil {
+		return "", fmt.Errorf("failed to load image from '%s': %w", path, err)
+	}
+	if !retag {
+		return "", nil
+	}
+
+	if source != "" {
+		if err := c.provider.TagImage(source, tag); err != nil {
+			return "", fmt.Errorf("failed to tag image '%s' as '%s': %w", source, tag, err)
+		}
+	}
+	c.markImage(tag)
+	return source, nil
+}
+
+// ImageHistory returns the layers of an image, newest first. When imageID is
+// empty the current project's image is used.
+func (c *Client) ImageHistory(imageID string) ([]LayerInfo, error) {
+	if c.provider == nil {
+		return nil, fmt.Errorf("container provider not initialized")
+	}
+
+	if imageID == "" {
+		tag, err := c.GetImageTag()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current image tag: %w", err)
+		}
+		imageID = tag
+	}
+
+	return c.provider.ImageHistory(imageID)
+}
+
 // GetPruneInfo returns information about what would be pruned
 func (c *Client) GetPruneInfo() (*PruneInfo, error) {
 	if c.provider == nil {
@@ -538,3 +1802,12 @@ func (c *Client) PruneImages() (*PruneResult, error) {
 
 	return c.provider.PruneImages()
 }
+
+// PruneBuildCache removes the provider's build cache, leaving images alone
+func (c *Client) PruneBuildCache() (*PruneResult, error) {
+	if c.provider == nil {
+		return nil, fmt.Errorf("container provider not initialized")
+	}
+
+	return c.provider.PruneBuildCache()
+}
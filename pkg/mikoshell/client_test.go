@@ -1,43 +1,156 @@
 package mikoshell
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 )
 
+func TestMain(m *testing.M) {
+	// Image markers would leak between tests through the user cache
+	// directory; tests that need them use useImageMarkers
+	imageMarkerDir = func() string { return "" }
+	os.Exit(m.Run())
+}
+
+// useImageMarkers keeps image markers in a temporary directory for a test
+func useImageMarkers(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	previous := imageMarkerDir
+	imageMarkerDir = func() string { return dir }
+	t.Cleanup(func() { imageMarkerDir = previous })
+	return dir
+}
+
 // MockContainerProvider implements ContainerProvider for testing
-type MockContainerProvider struct{}
+type MockContainerProvider struct {
+	commands          [][]string
+	runTags           []string
+	runOptions        []RunOptions
+	copies            []CopySpec
+	removedContainers []string
+	started           []string
+	execContainers    []string
+	missingImages     bool
+	labels            map[string]string
+	runErrors         []error
+	tags              [][2]string
+	shells            []string
+	output            string
+	verified          [][]string
+	verifyErr         error
+	removedImages     []string
+	kept              []string
+	daemonErr         error
+	daemonChecks      int
+	built             []string
+	pulled            []string
+	saved             [][2]string
+	loaded            []string
+	home              string
+	pullErr           error
+	baseImages        []string
+	existsChecks      int
+	// onRun is called with each command run, e.g. to fake its effects
+	onRun func(cfg *Config, command []string)
+}
 
 func (m *MockContainerProvider) IsAvailable() bool {
 	return true // Always available in tests
 }
 
-func (m *MockContainerProvider) BuildImage(cfg *Config, tag string) error {
+func (m *MockContainerProvider) CheckDaemon() error {
+	m.daemonChecks++
+	return m.daemonErr
+}
+
+func (m *MockContainerProvider) BuildImage(cfg *Config, tag string, opts BuildOptions) error {
+	m.built = append(m.built, tag)
+	m.baseImages = append(m.baseImages, cfg.Container.Image)
 	return nil // Mock successful build
 }
 
-func (m *MockContainerProvider) RunCommand(cfg *Config, tag string, command []string) error {
+func (m *MockContainerProvider) RunCommand(cfg *Config, tag string, command []string, opts RunOptions) error {
+	m.commands = append(m.commands, command)
+	m.runTags = append(m.runTags, tag)
+	m.runOptions = append(m.runOptions, opts)
+	if m.onRun != nil {
+		m.onRun(cfg, command)
+	}
+	if m.output != "" && opts.Stdout != nil {
+		io.WriteString(opts.Stdout, m.output)
+	}
+	if len(m.runErrors) > 0 {
+		err := m.runErrors[0]
+		m.runErrors = m.runErrors[1:]
+		return err
+	}
 	return nil // Mock successful command
 }
 
 func (m *MockContainerProvider) RunShell(cfg *Config, tag string) error {
+	m.shells = append(m.shells, "plain")
 	return nil // Mock successful shell
 }
 
 func (m *MockContainerProvider) RunShellWithStartup(cfg *Config, tag string) error {
+	m.shells = append(m.shells, "startup")
 	return nil // Mock successful shell with startup
 }
 
 func (m *MockContainerProvider) ImageExists(tag string) bool {
-	return true // Always exists in tests
+	m.existsChecks++
+	return !m.missingImages // Exists in tests unless told otherwise
 }
 
 func (m *MockContainerProvider) RemoveImage(tag string) error {
+	m.removedImages = append(m.removedImages, tag)
 	return nil // Mock successful image removal
 }
 
+func (m *MockContainerProvider) ImageHistory(tag string) ([]LayerInfo, error) {
+	return []LayerInfo{{ID: "sha256:abc123", Size: "5MB", CreatedBy: "/bin/sh -c apk add curl"}}, nil
+}
+
+func (m *MockContainerProvider) TagImage(src, dst string) error {
+	m.tags = append(m.tags, [2]string{src, dst})
+	return nil // Mock successful tag
+}
+
+func (m *MockContainerProvider) HomeDir(cfg *Config, tag string) (string, error) {
+	if m.home == "" {
+		return "/root", nil
+	}
+	return m.home, nil
+}
+
+func (m *MockContainerProvider) SaveImage(tag, path string) error {
+	m.saved = append(m.saved, [2]string{tag, path})
+	return nil
+}
+
+func (m *MockContainerProvider) LoadImage(path string) error {
+	m.loaded = append(m.loaded, path)
+	return nil
+}
+
+func (m *MockContainerProvider) PullImage(cfg *Config, ref string) error {
+	m.pulled = append(m.pulled, ref)
+	return m.pullErr
+}
+
 func (m *MockContainerProvider) ListImages() ([]ImageListItem, error) {
 	return []ImageListItem{
 		{
@@ -49,24 +162,33 @@ func (m *MockContainerProvider) ListImages() ([]ImageListItem, error) {
 	}, nil
 }
 
-func (m *MockContainerProvider) CleanImages(all bool) ([]string, error) {
+func (m *MockContainerProvider) CleanImages(cfg *Config, keep []string) ([]string, error) {
+	m.kept = keep
 	return []string{"removed1", "removed2"}, nil
 }
 
 func (m *MockContainerProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
+	labels := m.labels
+	if labels == nil {
+		labels = make(map[string]string)
+	}
 	return &ImageInfo{
 		ID:           imageID,
 		Tag:          "test:latest",
 		Size:         "100MB",
 		Created:      time.Now(),
 		Platform:     "linux/amd64",
-		Labels:       make(map[string]string),
+		Labels:       labels,
 		Layers:       []LayerInfo{},
 		Env:          []string{},
 		ExposedPorts: []string{},
 	}, nil
 }
 
+func (m *MockContainerProvider) InspectImage(imageID string) ([]byte, error) {
+	return []byte(`[{"Id":"` + imageID + `"}]`), nil
+}
+
 func (m *MockContainerProvider) GetPruneInfo() (*PruneInfo, error) {
 	return &PruneInfo{
 		TotalImages:    5,
@@ -84,6 +206,39 @@ func (m *MockContainerProvider) PruneImages() (*PruneResult, error) {
 	}, nil
 }
 
+func (m *MockContainerProvider) PruneBuildCache() (*PruneResult, error) {
+	return &PruneResult{
+		RemovedCacheObjects: 2,
+		ReclaimedSpace:      "80MB",
+	}, nil
+}
+
+func (m *MockContainerProvider) CopyFromContainer(container, src, dest string) error {
+	m.copies = append(m.copies, CopySpec{Src: container + ":" + src, Dest: dest})
+	return nil
+}
+
+func (m *MockContainerProvider) RemoveContainer(name string) error {
+	m.removedContainers = append(m.removedContainers, name)
+	return nil
+}
+
+func (m *MockContainerProvider) StartContainer(cfg *Config, tag string, opts RunOptions) error {
+	m.started = append(m.started, opts.Name)
+	return nil
+}
+
+// ExecCommand is recorded like a run, with the container it went to
+func (m *MockContainerProvider) ExecCommand(cfg *Config, container string, command []string, opts RunOptions) error {
+	m.execContainers = append(m.execContainers, container)
+	return m.RunCommand(cfg, "", command, opts)
+}
+
+func (m *MockContainerProvider) VerifyImage(tag string, commands []string) error {
+	m.verified = append(m.verified, commands)
+	return m.verifyErr
+}
+
 func TestNewClient(t *testing.T) {
 	client, err := NewClient()
 	if err != nil {
@@ -381,6 +536,234 @@ container:
 	})
 }
 
+func TestParseBuildArgs(t *testing.T) {
+	args, err := ParseBuildArgs([]string{"VERSION=v1", "EMPTY=", "URL=http://x?a=b", "VERSION=v2"})
+	if err != nil {
+		t.Fatalf("ParseBuildArgs() failed: %v", err)
+	}
+	expected := map[string]string{"VERSION": "v2", "EMPTY": "", "URL": "http://x?a=b"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+
+	for _, entry := range []string{"VERSION", "=v1", "BAD KEY=v1"} {
+		if _, err := ParseBuildArgs([]string{entry}); err == nil {
+			t.Errorf("ParseBuildArgs() should reject %q", entry)
+		}
+	}
+}
+
+func TestClient_BuildArgsChangeTag(t *testing.T) {
+	configContent := `name: test-project
+container:
+  build:
+    dockerfile: Dockerfile
+`
+	client := newTestClient(t, configContent, &MockContainerProvider{})
+
+	base, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	client.SetBuildOptions(BuildOptions{BuildArgs: map[string]string{"VERSION": "v1"}})
+	v1, _ := client.GetImageTag()
+	client.SetBuildOptions(BuildOptions{BuildArgs: map[string]string{"VERSION": "v2"}})
+	v2, _ := client.GetImageTag()
+
+	if base == v1 || v1 == v2 {
+		t.Errorf("Expected build args to produce distinct tags, got %s, %s and %s", base, v1, v2)
+	}
+}
+
+func TestClient_RuntimeOverridesKeepTag(t *testing.T) {
+	configContent := `name: test-project
+container:
+  provider: docker
+  image: alpine:latest
+`
+	client := newTestClient(t, configContent, &MockContainerProvider{})
+
+	before, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+
+	config := client.GetConfig()
+	if err := config.AddEnvironment([]string{"FOO=1"}); err != nil {
+		t.Fatalf("AddEnvironment() failed: %v", err)
+	}
+	if err := config.AddPorts([]string{"8080:80"}); err != nil {
+		t.Fatalf("AddPorts() failed: %v", err)
+	}
+	if err := config.SetNetwork("host"); err != nil {
+		t.Fatalf("SetNetwork() failed: %v", err)
+	}
+	if err := config.SetGPUs("all"); err != nil {
+		t.Fatalf("SetGPUs() failed: %v", err)
+	}
+	if err := config.AddCachePresets([]string{"go"}); err != nil {
+		t.Fatalf("AddCachePresets() failed: %v", err)
+	}
+	config.Container.Volumes = append(config.Container.Volumes, "/home/user/.gitconfig:/root/.gitconfig:ro")
+
+	after, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if before != after {
+		t.Errorf("Expected runtime overrides to keep tag %s, got %s", before, after)
+	}
+}
+
+func TestClient_BuildRetriesKeepTag(t *testing.T) {
+	configContent := `name: test-project
+container:
+  provider: docker
+  image: alpine:latest
+`
+	client := newTestClient(t, configContent, &MockContainerProvider{})
+
+	before, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	// As image build --retries sets it
+	client.GetConfig().Container.BuildRetries = 3
+	after, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if before != after {
+		t.Errorf("Expected retries to keep tag %s, got %s", before, after)
+	}
+}
+
+func TestClient_CleanImages(t *testing.T) {
+	configContent := `name: test-project
+container:
+  provider: docker
+  image: alpine:latest
+`
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+	tag, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+
+	if _, err := client.CleanImages(false); err != nil {
+		t.Fatalf("CleanImages() failed: %v", err)
+	}
+	if !reflect.DeepEqual(mock.kept, []string{tag}) {
+		t.Errorf("Expected the current image %s kept, got %v", tag, mock.kept)
+	}
+
+	if _, err := client.CleanImages(true); err != nil {
+		t.Fatalf("CleanImages() failed: %v", err)
+	}
+	if len(mock.kept) != 0 {
+		t.Errorf("Expected no image kept with all, got %v", mock.kept)
+	}
+}
+
+func TestClient_DockerfileChangesTag(t *testing.T) {
+	configContent := `name: test-project
+container:
+  build:
+    dockerfile: Dockerfile
+`
+	client := newTestClient(t, configContent, &MockContainerProvider{})
+	dockerfile := client.GetConfig().resolvePath("Dockerfile")
+
+	if err := os.WriteFile(dockerfile, []byte("FROM alpine:3.19\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	before, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if err := os.WriteFile(dockerfile, []byte("FROM alpine:3.20\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	after, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if before == after {
+		t.Errorf("Expected the tag to change with the Dockerfile, got %s twice", before)
+	}
+}
+
+func TestClient_TagFormat(t *testing.T) {
+	configContent := `name: test-project
+container:
+  provider: docker
+  image: alpine:latest
+  tag_format: "registry.example.com/{{.Name}}:{{.Hash}}-{{.Platform}}"
+`
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+
+	tag, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if !strings.HasPrefix(tag, "registry.example.com/test-project:") {
+		t.Errorf("Expected tag from tag_format, got '%s'", tag)
+	}
+
+	status, err := client.GetImageStatus()
+	if err != nil {
+		t.Fatalf("GetImageStatus() failed: %v", err)
+	}
+	if status.Tag != tag || tagHash(tag) != status.CurrentHash {
+		t.Errorf("Expected status for %s with hash %s, got %s with hash %s", tag, tagHash(tag), status.Tag, status.CurrentHash)
+	}
+
+	built, err := client.BuildImageWithForce(false)
+	if err != nil {
+		t.Fatalf("BuildImageWithForce() failed: %v", err)
+	}
+	if built != tag || len(mock.built) != 1 || mock.built[0] != tag {
+		t.Errorf("Expected build of %s, got %s (%v)", tag, built, mock.built)
+	}
+}
+
+func TestClient_TagFormatProfile(t *testing.T) {
+	configContent := `name: test-project
+container:
+  image: alpine:latest
+profiles:
+  ci:
+    container:
+      image: golang:1.22
+      tag_format: "{{.Name}}:{{.Profile}}-{{.Hash}}"
+  dev:
+    container:
+      tag_format: "{{.Name}}:{{.Hash}}{{with .Profile}}-{{.}}{{end}}"
+`
+	client := newTestClient(t, configContent, &MockContainerProvider{})
+	if err := client.GetConfig().ApplyProfile("ci"); err != nil {
+		t.Fatalf("ApplyProfile() failed: %v", err)
+	}
+
+	tag, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if !strings.HasPrefix(tag, "test-project:ci-") {
+		t.Errorf("Expected the profile name in the tag, got '%s'", tag)
+	}
+
+	client = newTestClient(t, configContent, &MockContainerProvider{})
+	if err := client.GetConfig().ApplyProfile("dev"); err != nil {
+		t.Fatalf("ApplyProfile() failed: %v", err)
+	}
+	if tag, _ := client.GetImageTag(); !strings.HasSuffix(tag, "-dev") {
+		t.Errorf("Expected the profile name in the tag, got '%s'", tag)
+	}
+}
+
 func TestClient_GetConfig(t *testing.T) {
 	client, err := NewClient()
 	if err != nil {
@@ -446,3 +829,2083 @@ func TestClient_OpenShell(t *testing.T) {
 		}
 	})
 }
+
+func TestClient_RunCommandWithCopyOut(t *testing.T) {
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, "name: test\ncontainer:\n  image: alpine:latest\n", mock)
+
+	outDir := filepath.Join(t.TempDir(), "dist")
+	opts := RunOptions{CopyOut: []CopySpec{{Src: "/out", Dest: outDir}}}
+	if err := client.RunCommandWithOptions([]string{"make"}, opts); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+
+	if len(mock.runOptions) != 1 {
+		t.Fatalf("Expected 1 run, got %d", len(mock.runOptions))
+	}
+	runOpts := mock.runOptions[0]
+	if !runOpts.Keep || runOpts.Name == "" {
+		t.Errorf("Expected a named, kept container, got %+v", runOpts)
+	}
+
+	if len(mock.copies) != 1 || mock.copies[0].Src != runOpts.Name+":/out" || mock.copies[0].Dest != outDir {
+		t.Errorf("Unexpected copies: %+v", mock.copies)
+	}
+
+	if len(mock.removedContainers) != 1 || mock.removedContainers[0] != runOpts.Name {
+		t.Errorf("Expected container %s to be removed, got %v", runOpts.Name, mock.removedContainers)
+	}
+
+	if _, err := os.Stat(outDir); err != nil {
+		t.Errorf("Expected output directory to be created: %v", err)
+	}
+}
+
+func TestParseCopySpec(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    CopySpec
+		wantErr bool
+	}{
+		{input: "container:/out:dist", want: CopySpec{Src: "/out", Dest: "dist"}},
+		{input: "/app/build:./build", want: CopySpec{Src: "/app/build", Dest: "./build"}},
+		{input: "/out", wantErr: true},
+		{input: "out:dist", wantErr: true},
+		{input: "container::dist", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseCopySpec(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseCopySpec(%q) should fail", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCopySpec(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCopySpec(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestClient writes a config into a temp dir and returns a client loaded with it
+func newTestClient(t *testing.T, configContent string, mock *MockContainerProvider) *Client {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.SetProvider(mock)
+	if err := client.LoadConfigFromFile(configFile); err != nil {
+		t.Fatalf("LoadConfigFromFile() failed: %v", err)
+	}
+	return client
+}
+
+// exitCodeError is a command failure with a specific exit status
+type exitCodeError int
+
+func (e exitCodeError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitCodeError) ExitCode() int { return int(e) }
+
+func TestClient_RunCommandExitCode(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: lint
+      commands:
+        - golangci-lint run
+`
+	mock := &MockContainerProvider{runErrors: []error{exitCodeError(2)}}
+	client := newTestClient(t, configContent, mock)
+
+	err := client.RunCommand([]string{"lint"})
+	if err == nil {
+		t.Fatal("RunCommand() should fail when the command fails")
+	}
+	if code := ExitCode(err); code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+}
+
+func TestClient_RunCommandWorkdir(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+`
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+	if err := os.MkdirAll(filepath.Join(filepath.Dir(client.configFile), "services", "api"), 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+
+	if err := client.RunCommandWithOptions([]string{"ls"}, RunOptions{Workdir: "./services/api/"}); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+	if got := mock.runOptions[0].Workdir; got != "services/api" {
+		t.Errorf("Expected workdir services/api, got %q", got)
+	}
+
+	for _, dir := range []string{"../other", "services/../..", "/etc", "services/missing"} {
+		if err := client.RunCommandWithOptions([]string{"ls"}, RunOptions{Workdir: dir}); err == nil {
+			t.Errorf("RunCommandWithOptions() should reject workdir %q", dir)
+		}
+	}
+	if len(mock.commands) != 1 {
+		t.Errorf("Expected rejected workdirs not to run, got %v", mock.commands)
+	}
+}
+
+func TestClient_RunCommandShellFlags(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  flags: -eu
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+`
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+
+	if err := client.RunCommand([]string{"test"}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+	if err := client.RunCommandWithOptions([]string{"ls", "*.go"}, RunOptions{ShellWrap: true}); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+	if err := client.RunCommand([]string{"ls"}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	if got := mock.commands[0][:3]; !reflect.DeepEqual(got, []string{"/bin/sh", "-eu", "-c"}) {
+		t.Errorf("Expected the script to run with sh -eu -c, got %v", mock.commands[0])
+	}
+	if expected := []string{"/bin/sh", "-eu", "-c", "ls *.go"}; !reflect.DeepEqual(mock.commands[1], expected) {
+		t.Errorf("Expected %v, got %v", expected, mock.commands[1])
+	}
+	if !reflect.DeepEqual(mock.commands[2], []string{"ls"}) {
+		t.Errorf("Expected a direct command to run as is, got %v", mock.commands[2])
+	}
+}
+
+func TestClient_RunCommandDumpEnv(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+`
+	// fakeEnvDump plays the container: it writes the dump to the project
+	// directory, which the container sees at /workspace
+	fakeEnvDump := func(cfg *Config, command []string) {
+		match := regexp.MustCompile(`env > '/workspace/([^']+)'`).FindStringSubmatch(strings.Join(command, " "))
+		if match != nil {
+			_ = os.WriteFile(filepath.Join(cfg.workspaceDir(), match[1]), []byte("PATH=/usr/bin\nMIKO_IN_CONTAINER=1\n"), 0644)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		command []string
+		runErr  error
+	}{
+		{name: "script", command: []string{"test"}},
+		{name: "direct command", command: []string{"go", "version"}},
+		{name: "failing command", command: []string{"test"}, runErr: exitCodeError(2)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockContainerProvider{onRun: fakeEnvDump, runErrors: []error{tt.runErr}}
+			client := newTestClient(t, configContent, mock)
+			dumpFile := filepath.Join(t.TempDir(), "env.txt")
+
+			err := client.RunCommandWithOptions(tt.command, RunOptions{DumpEnv: dumpFile})
+			if ExitCode(err) != ExitCode(tt.runErr) {
+				t.Fatalf("Expected the command's error %v, got %v", tt.runErr, err)
+			}
+
+			data, readErr := os.ReadFile(dumpFile)
+			if readErr != nil || !strings.Contains(string(data), "MIKO_IN_CONTAINER=1") {
+				t.Errorf("Expected the environment dump in %s, got %q (%v)", dumpFile, data, readErr)
+			}
+			leftovers, _ := filepath.Glob(filepath.Join(client.GetConfig().workspaceDir(), ".miko-shell-env-*"))
+			if len(leftovers) != 0 {
+				t.Errorf("Expected the in-project dump removed, found %v", leftovers)
+			}
+		})
+	}
+
+	t.Run("missing dump", func(t *testing.T) {
+		client := newTestClient(t, configContent, &MockContainerProvider{})
+		err := client.RunCommandWithOptions([]string{"test"}, RunOptions{DumpEnv: filepath.Join(t.TempDir(), "env.txt")})
+		if err == nil || !strings.Contains(err.Error(), "environment dump") {
+			t.Errorf("Expected an error when the dump wasn't written, got %v", err)
+		}
+	})
+}
+
+func TestWithEnvDump(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+
+	for _, tt := range []struct {
+		name     string
+		command  []string
+		expected string
+	}{
+		{name: "shell command", command: []string{"/bin/sh", "-eu", "-c", "echo $FOO"}, expected: "bar\n"},
+		{name: "direct command", command: []string{"printf", "%s|", "a b", "$FOO"}, expected: "a b|$FOO|"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "env")
+			command := withEnvDump(tt.command, file)
+
+			cmd := exec.Command(command[0], command[1:]...)
+			cmd.Env = append(os.Environ(), "FOO=bar")
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\n%s", err, output)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("Expected output %q, got %q", tt.expected, output)
+			}
+			if data, _ := os.ReadFile(file); !strings.Contains(string(data), "FOO=bar") {
+				t.Errorf("Expected FOO=bar in the dump, got:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestClient_RunCommandSummary(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go mod download
+        - go test ./...
+`
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+
+	var stderr bytes.Buffer
+	if err := client.RunCommandWithOptions([]string{"test"}, RunOptions{Summary: true, Stderr: &stderr}); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+	if err := client.RunCommand([]string{"test"}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	timed := mock.commands[0][len(mock.commands[0])-1]
+	for _, expected := range []string{
+		"printf '%s\\n' '" + timingMarker + " 1' >&2 && { { go mod download\n}",
+		"printf '%s\\n' '" + timingMarker + " 2' >&2 && { { go test ./...\n}",
+	} {
+		if !strings.Contains(timed, expected) {
+			t.Errorf("Expected %q in the timed command:\n%s", expected, timed)
+		}
+	}
+	if plain := strings.Join(mock.commands[1], " "); strings.Contains(plain, timingMarker) {
+		t.Errorf("Expected no timing markers without --summary, got %s", plain)
+	}
+
+	stderr.Reset()
+	if err := client.RunCommandWithOptions([]string{"go", "version"}, RunOptions{Summary: true, Stderr: &stderr}); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+	if !regexp.MustCompile(`\d\.\d{3}s  go version\n`).MatchString(stderr.String()) {
+		t.Errorf("Expected the direct command timed as a whole, got:\n%s", stderr.String())
+	}
+	stderr.Reset()
+	if err := client.RunCommandWithOptions([]string{"test"}, RunOptions{Summary: true, Stderr: &stderr}); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+
+	output := stderr.String()
+	// The mock runs nothing, so no command reports that it started
+	for _, expected := range []string{"Summary:", "go mod download (not run)\n", "go test ./... (not run)\n", "total\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in the summary:\n%s", expected, output)
+		}
+	}
+}
+
+func TestTimedScripts(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+
+	build := &Script{Name: "build", Commands: []string{"echo built >&2"}}
+	test := &Script{Name: "test", Commands: []string{"echo \"testing $1\" >&2", "false", "echo unreachable"}}
+	labels := commandLabels([]*Script{build, test})
+	timed := timedScripts([]*Script{build, test})
+
+	expectedLabels := []string{"build: echo built >&2", "test: echo \"testing $1\" >&2", "test: false", "test: echo unreachable"}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("Expected labels %v, got %v", expectedLabels, labels)
+	}
+
+	var stderr bytes.Buffer
+	timer := newTimingWriter(&stderr)
+	cmd := exec.Command("/bin/sh", "-c", scriptCommand(timed, []string{"unit"}, false))
+	cmd.Stderr = timer
+	if err := cmd.Run(); err == nil {
+		t.Fatal("Expected the script to fail")
+	}
+	timer.flush()
+
+	if stderr.String() != "built\ntesting unit\n" {
+		t.Errorf("Expected the markers removed from stderr, got %q", stderr.String())
+	}
+	durations := timer.durations(len(labels), time.Now())
+	for i, d := range durations {
+		if started := d >= 0; started != (i < 3) {
+			t.Errorf("Expected commands 1-3 to start and 4 not to, command %d got %v", i+1, d)
+		}
+	}
+}
+
+func TestAnnotatedScripts(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh not available")
+	}
+
+	run := func(scripts []*Script, strict bool) (string, string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("/bin/sh", "-c", scriptCommand(annotatedScripts(scripts), []string{"unit"}, strict))
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), ExitCode(err)
+	}
+
+	t.Run("failing command", func(t *testing.T) {
+		test := &Script{Name: "test", Commands: []string{"echo one", "(exit 3)", "echo unreachable"}}
+		stdout, stderr, code := run([]*Script{test}, false)
+		if stdout != "one\n" {
+			t.Errorf("Expected the script to stop at the failure, got %q", stdout)
+		}
+		if stderr != "script 'test' failed at command 2: (exit 3)\n" {
+			t.Errorf("Expected the failure annotated, got %q", stderr)
+		}
+		if code != 3 {
+			t.Errorf("Expected exit code 3, got %d", code)
+		}
+	})
+
+	t.Run("dependency", func(t *testing.T) {
+		build := &Script{Name: "build", Commands: []string{"echo building\ntest -n \"$1\""}}
+		test := &Script{Name: "test", Commands: []string{"echo \"testing $1\""}}
+		_, stderr, code := run([]*Script{build, test}, false)
+		if stderr != "script 'build' failed at command 1: echo building ...\n" {
+			t.Errorf("Expected the dependency's failure annotated, got %q", stderr)
+		}
+		if code != 1 {
+			t.Errorf("Expected exit code 1, got %d", code)
+		}
+	})
+
+	t.Run("arguments in the note", func(t *testing.T) {
+		test := &Script{Name: "test", Commands: []string{"true", "test \"$1\" = ci"}}
+		_, stderr, code := run([]*Script{test}, true)
+		if stderr != "script 'test' failed at command 2: test \"$1\" = ci\n" {
+			t.Errorf("Expected the command text as written, got %q", stderr)
+		}
+		if code != 1 {
+			t.Errorf("Expected exit code 1, got %d", code)
+		}
+	})
+
+	t.Run("single command", func(t *testing.T) {
+		test := &Script{Name: "test", Commands: []string{"(exit 4)"}}
+		if annotated := annotatedScripts([]*Script{test}); annotated[0] != test {
+			t.Errorf("Expected a single command left as it is, got %v", annotated[0].Commands)
+		}
+		_, stderr, code := run([]*Script{test}, false)
+		if stderr != "" || code != 4 {
+			t.Errorf("Expected exit code 4 without a note, got %d and %q", code, stderr)
+		}
+	})
+}
+
+func TestTimingWriter_SplitWrites(t *testing.T) {
+	var out bytes.Buffer
+	timer := newTimingWriter(&out)
+
+	stream := "first line\n" + timingMarker + " 1\nmid::line" + timingMarker + " 2\nlast::"
+	for i := 0; i < len(stream); i += 5 {
+		end := i + 5
+		if end > len(stream) {
+			end = len(stream)
+		}
+		if _, err := timer.Write([]byte(stream[i:end])); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	timer.flush()
+
+	if out.String() != "first line\nmid::linelast::" {
+		t.Errorf("Expected the markers removed, got %q", out.String())
+	}
+	if len(timer.starts) != 2 {
+		t.Errorf("Expected 2 recorded commands, got %d", len(timer.starts))
+	}
+}
+
+func TestClient_RunCommandShellWrap(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+`
+
+	t.Run("exec form by default", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"ls *.go | wc -l"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommandWithOptions() failed: %v", err)
+		}
+		if !reflect.DeepEqual(mock.commands[0], []string{"ls *.go | wc -l"}) {
+			t.Errorf("Expected the command as argv, got %v", mock.commands[0])
+		}
+	})
+
+	t.Run("wrapped in a shell", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"ls", "*.go", "|", "wc", "-l"}, RunOptions{ShellWrap: true}); err != nil {
+			t.Fatalf("RunCommandWithOptions() failed: %v", err)
+		}
+		expected := []string{"/bin/sh", "-c", "ls *.go | wc -l"}
+		if !reflect.DeepEqual(mock.commands[0], expected) {
+			t.Errorf("Expected %v, got %v", expected, mock.commands[0])
+		}
+	})
+}
+
+func TestClient_RunCommandLiteral(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: ls
+      commands:
+        - echo "not the real ls"
+`
+
+	t.Run("script name matches", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"ls", "-la"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommandWithOptions() failed: %v", err)
+		}
+		if mock.commands[0][0] != "/bin/sh" {
+			t.Errorf("Expected the script to run, got %v", mock.commands[0])
+		}
+	})
+
+	t.Run("literal bypasses scripts", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"ls", "-la"}, RunOptions{Literal: true}); err != nil {
+			t.Fatalf("RunCommandWithOptions() failed: %v", err)
+		}
+		if !reflect.DeepEqual(mock.commands[0], []string{"ls", "-la"}) {
+			t.Errorf("Expected the literal command, got %v", mock.commands[0])
+		}
+	})
+}
+
+func TestClient_RunCommandStrictArgs(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: greet
+      commands:
+        - echo "hello $1 from $2"
+`
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []struct {
+		name    string
+		strict  bool
+		wantErr bool
+	}{
+		{name: "lenient expands to empty", strict: false},
+		{name: "strict fails", strict: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockContainerProvider{}
+			client := newTestClient(t, configContent, mock)
+
+			if err := client.RunCommandWithOptions([]string{"greet", "Alice"}, RunOptions{StrictArgs: tt.strict}); err != nil {
+				t.Fatalf("RunCommandWithOptions() failed: %v", err)
+			}
+
+			output, err := exec.Command("sh", "-c", mock.commands[0][2]).CombinedOutput()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(string(output), "missing argument 2") {
+					t.Errorf("Expected a missing argument error, got %q (%v)", output, err)
+				}
+				return
+			}
+			if err != nil || string(output) != "hello Alice from \n" {
+				t.Errorf("Expected empty expansion, got %q (%v)", output, err)
+			}
+		})
+	}
+}
+
+func TestScript_RequiredArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		args     []ScriptArg
+		expected int
+	}{
+		{name: "plain", command: `echo $1 ${3}`, expected: 3},
+		{name: "single quoted", command: `awk '{print $1}' file`, expected: 0},
+		{name: "escaped", command: `echo \$2 "\$3"`, expected: 0},
+		{name: "apostrophe in double quotes", command: `echo "it's $2" '$4'`, expected: 2},
+		{name: "with default", command: `echo $1 $2`, args: []ScriptArg{{Name: "a"}, {Name: "b", Default: "x"}}, expected: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &Script{Args: tt.args}
+			if got := script.requiredArgs(tt.command); got != tt.expected {
+				t.Errorf("Expected %d required arguments in %q, got %d", tt.expected, tt.command, got)
+			}
+		})
+	}
+}
+
+func TestClient_RunCommandStrictArgsQuoted(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  strict_args: true
+  scripts:
+    - name: first
+      commands:
+        - printf 'a b\nc d\n' | awk '{print $1}'
+`
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk not available")
+	}
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+
+	if err := client.RunCommand([]string{"first"}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	output, err := exec.Command("sh", "-c", mock.commands[0][2]).CombinedOutput()
+	if err != nil || string(output) != "a\nc\n" {
+		t.Errorf("Expected awk's $1 left alone, got %q (%v)", output, err)
+	}
+}
+
+func TestContainerName(t *testing.T) {
+	first, err := containerName("My Project", "shell", "a")
+	if err != nil {
+		t.Fatalf("containerName() failed: %v", err)
+	}
+	second, err := containerName("My Project", "shell", "b")
+	if err != nil {
+		t.Fatalf("containerName() failed: %v", err)
+	}
+
+	if first != "my-project-shell-a" || second != "my-project-shell-b" {
+		t.Errorf("Expected distinct names per suffix, got %q and %q", first, second)
+	}
+	for _, name := range []string{first, second} {
+		if !containerSuffixPattern.MatchString(name) {
+			t.Errorf("Expected a valid container name, got %q", name)
+		}
+	}
+
+	generated, err := containerName("proj", "run", "")
+	if err != nil || !strings.HasPrefix(generated, "proj-run-") || generated == "proj-run-" {
+		t.Errorf("Expected a generated suffix, got %q (%v)", generated, err)
+	}
+
+	if _, err := containerName("proj", "shell", "-rm"); err == nil {
+		t.Error("containerName() should reject a suffix starting with '-'")
+	}
+}
+
+// useHostOS simulates a host running hostOS for shell.scripts[].os
+func useHostOS(t *testing.T, hostOS string) {
+	t.Helper()
+	previous := scriptHostOS
+	scriptHostOS = func() string { return hostOS }
+	t.Cleanup(func() { scriptHostOS = previous })
+}
+
+func TestClient_RunCommandScriptOS(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: setup-mac
+      os: [darwin]
+      commands:
+        - brew bundle
+    - name: setup
+      depends_on: [setup-mac]
+      commands:
+        - make setup
+    - name: test
+      commands:
+        - go test ./...
+`
+
+	t.Run("matching host", func(t *testing.T) {
+		useHostOS(t, "darwin")
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"setup-mac"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommandWithOptions() failed: %v", err)
+		}
+		if len(mock.commands) != 1 {
+			t.Errorf("Expected the script to run, got %v", mock.commands)
+		}
+	})
+
+	t.Run("other host", func(t *testing.T) {
+		useHostOS(t, "linux")
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		for _, name := range []string{"setup-mac", "setup"} {
+			err := client.RunCommandWithOptions([]string{name}, RunOptions{})
+			if err == nil || !strings.Contains(err.Error(), "script 'setup-mac' is only available on darwin (this host is linux)") {
+				t.Errorf("Expected %s to be refused on linux, got %v", name, err)
+			}
+		}
+		if err := client.RunCommandWithOptions([]string{"test"}, RunOptions{}); err != nil {
+			t.Errorf("Expected unrestricted scripts to run, got %v", err)
+		}
+		if len(mock.commands) != 1 {
+			t.Errorf("Expected only the unrestricted script to run, got %v", mock.commands)
+		}
+	})
+}
+
+func TestClient_RunCommandScriptFile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, ConfigFileName)
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: build
+      file: scripts/build.sh
+`
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	scriptFile := filepath.Join(dir, "scripts", "build.sh")
+	if err := os.MkdirAll(filepath.Dir(scriptFile), 0755); err != nil {
+		t.Fatalf("Failed to create scripts dir: %v", err)
+	}
+	if err := os.WriteFile(scriptFile, []byte("#!/bin/sh\necho one\necho \"two $1\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write script file: %v", err)
+	}
+
+	loadClient := func() *Client {
+		mock := &MockContainerProvider{}
+		client, err := NewClient()
+		if err != nil {
+			t.Fatalf("NewClient() failed: %v", err)
+		}
+		client.SetProvider(mock)
+		if err := client.LoadConfigFromFile(configFile); err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		return client
+	}
+
+	t.Run("runs the file contents", func(t *testing.T) {
+		client := loadClient()
+		mock := client.provider.(*MockContainerProvider)
+
+		if err := client.RunCommand([]string{"build", "arg"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		command := mock.commands[0]
+		if len(command) != 3 || command[0] != "/bin/sh" {
+			t.Fatalf("Expected a shell command, got %v", command)
+		}
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh not available")
+		}
+		output, err := exec.Command("sh", "-c", command[2]).Output()
+		if err != nil {
+			t.Fatalf("Running %q failed: %v", command[2], err)
+		}
+		if string(output) != "one\ntwo arg\n" {
+			t.Errorf("Expected the script file output, got %q", output)
+		}
+	})
+
+	t.Run("file contents change the tag", func(t *testing.T) {
+		before, err := loadClient().GetImageTag()
+		if err != nil {
+			t.Fatalf("GetImageTag() failed: %v", err)
+		}
+		if err := os.WriteFile(scriptFile, []byte("echo changed\n"), 0644); err != nil {
+			t.Fatalf("Failed to write script file: %v", err)
+		}
+		after, err := loadClient().GetImageTag()
+		if err != nil {
+			t.Fatalf("GetImageTag() failed: %v", err)
+		}
+		if before == after {
+			t.Errorf("Expected the tag to change with the script file, got %s twice", before)
+		}
+	})
+}
+
+func TestClient_RunCommandScriptDependencies(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: lint
+      commands:
+        - echo "lint $# $1"
+    - name: test
+      depends_on: [lint]
+      commands:
+        - echo "test $1"
+    - name: loop
+      depends_on: [loop]
+      commands:
+        - "true"
+`
+
+	t.Run("dependencies run first without arguments", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommand([]string{"test", "./pkg"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		command := mock.commands[0]
+		if len(command) != 3 || command[0] != "/bin/sh" {
+			t.Fatalf("Expected a shell command, got %v", command)
+		}
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh not available")
+		}
+		output, err := exec.Command("sh", "-c", command[2]).Output()
+		if err != nil {
+			t.Fatalf("Running %q failed: %v", command[2], err)
+		}
+		if string(output) != "lint 0 \ntest ./pkg\n" {
+			t.Errorf("Expected dependency output without arguments, got %q", output)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.RunCommand([]string{"loop"})
+		if err == nil || !strings.Contains(err.Error(), "loop -> loop") {
+			t.Errorf("Expected a cycle error, got %v", err)
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("Expected nothing to run, got %v", mock.commands)
+		}
+	})
+}
+
+func TestChainCommandsStopsOnFailure(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	scripts := []*Script{
+		{Name: "lint", Commands: []string{"echo lint", "false"}},
+		{Name: "test", Commands: []string{"echo test"}},
+	}
+	output, err := exec.Command("sh", "-c", chainCommands(scripts, []string{"x"}, false)).Output()
+	if err == nil {
+		t.Error("Expected the chain to fail")
+	}
+	if string(output) != "lint\n" {
+		t.Errorf("Expected the chain to stop after the failing dependency, got %q", output)
+	}
+}
+
+func TestClient_CheckDaemon(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\n"
+
+	t.Run("stopped daemon fails before running", func(t *testing.T) {
+		mock := &MockContainerProvider{daemonErr: &DaemonUnavailableError{Provider: "docker", Err: errors.New("connection refused")}}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.RunCommand([]string{"echo", "hi"})
+		var daemonErr *DaemonUnavailableError
+		if !errors.As(err, &daemonErr) {
+			t.Fatalf("Expected a DaemonUnavailableError, got %v", err)
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("Expected no command to run, got %v", mock.commands)
+		}
+	})
+
+	t.Run("checked once per client", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		for i := 0; i < 2; i++ {
+			if err := client.RunCommand([]string{"echo", "hi"}); err != nil {
+				t.Fatalf("RunCommand() failed: %v", err)
+			}
+		}
+		if mock.daemonChecks != 1 {
+			t.Errorf("Expected 1 daemon check, got %d", mock.daemonChecks)
+		}
+	})
+}
+
+func TestClient_BuildImageVerify(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\n  verify:\n    - go version\n    - node --version\n"
+
+	t.Run("passing verification", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.BuildImage(false); err != nil {
+			t.Fatalf("BuildImage() failed: %v", err)
+		}
+
+		expected := [][]string{{"go version", "node --version"}}
+		if !reflect.DeepEqual(mock.verified, expected) {
+			t.Errorf("Expected verify commands %v, got %v", expected, mock.verified)
+		}
+		if len(mock.removedImages) != 0 {
+			t.Errorf("Expected the image to be kept, removed %v", mock.removedImages)
+		}
+	})
+
+	t.Run("failing verification", func(t *testing.T) {
+		mock := &MockContainerProvider{verifyErr: errors.New("verify command 'go version' failed: exit status 127\nsh: go: not found")}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.BuildImage(false)
+		if err == nil || !strings.Contains(err.Error(), "go: not found") {
+			t.Fatalf("Expected verification failure with output, got %v", err)
+		}
+
+		tag, _ := client.GetImageTag()
+		if !reflect.DeepEqual(mock.removedImages, []string{tag}) {
+			t.Errorf("Expected failed image %s to be removed, got %v", tag, mock.removedImages)
+		}
+	})
+
+	t.Run("verification is opt-in", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, "name: test\ncontainer:\n  image: alpine:latest\n", mock)
+
+		if err := client.BuildImage(false); err != nil {
+			t.Fatalf("BuildImage() failed: %v", err)
+		}
+		if len(mock.verified) != 0 {
+			t.Errorf("Expected no verification, got %v", mock.verified)
+		}
+	})
+}
+
+func TestClient_GetImageStatus(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\n"
+
+	t.Run("not built", func(t *testing.T) {
+		client := newTestClient(t, configContent, &MockContainerProvider{missingImages: true})
+
+		status, err := client.GetImageStatus()
+		if err != nil {
+			t.Fatalf("GetImageStatus() failed: %v", err)
+		}
+		if status.Built || status.UpToDate || status.Info != nil {
+			t.Errorf("Expected unbuilt status, got %+v", status)
+		}
+		if !strings.HasPrefix(status.Tag, "test:") {
+			t.Errorf("Expected tag to start with 'test:', got '%s'", status.Tag)
+		}
+	})
+
+	t.Run("built and up to date", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		hash, _ := GetConfigHashFromFile(client.configFile)
+		mock.labels = map[string]string{LabelConfigHash: hash}
+
+		status, err := client.GetImageStatus()
+		if err != nil {
+			t.Fatalf("GetImageStatus() failed: %v", err)
+		}
+		if !status.Built || !status.UpToDate || status.Info == nil {
+			t.Errorf("Expected built, up-to-date status, got %+v", status)
+		}
+	})
+
+	t.Run("built with stale hash label", func(t *testing.T) {
+		mock := &MockContainerProvider{labels: map[string]string{LabelConfigHash: "000000000000"}}
+		client := newTestClient(t, configContent, mock)
+
+		status, err := client.GetImageStatus()
+		if err != nil {
+			t.Fatalf("GetImageStatus() failed: %v", err)
+		}
+		if !status.Built || status.UpToDate {
+			t.Errorf("Expected built but stale status, got %+v", status)
+		}
+		if status.StoredHash != "000000000000" {
+			t.Errorf("Expected stored hash '000000000000', got '%s'", status.StoredHash)
+		}
+	})
+}
+
+func TestClient_GetStatus(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: a
+      commands: [echo a]
+    - name: b
+      commands: [echo b]
+`
+
+	t.Run("built", func(t *testing.T) {
+		client := newTestClient(t, configContent, &MockContainerProvider{})
+
+		status, err := client.GetStatus()
+		if err != nil {
+			t.Fatalf("GetStatus() failed: %v", err)
+		}
+		if !filepath.IsAbs(status.ConfigFile) {
+			t.Errorf("Expected absolute config path, got '%s'", status.ConfigFile)
+		}
+		if status.Name != "test" || status.Provider != "docker" || !status.ProviderAvailable || status.Scripts != 2 {
+			t.Errorf("Unexpected status: %+v", status)
+		}
+		if status.Image == nil || !status.Image.Built {
+			t.Errorf("Expected built image, got %+v", status.Image)
+		}
+	})
+
+	t.Run("not built", func(t *testing.T) {
+		client := newTestClient(t, configContent, &MockContainerProvider{missingImages: true})
+
+		status, err := client.GetStatus()
+		if err != nil {
+			t.Fatalf("GetStatus() failed: %v", err)
+		}
+		if status.Image == nil || status.Image.Built {
+			t.Errorf("Expected unbuilt image, got %+v", status.Image)
+		}
+	})
+}
+
+func TestClient_DockerfileOverrideChangesTag(t *testing.T) {
+	client := newTestClient(t, "name: test\ncontainer:\n  image: alpine:latest\n", &MockContainerProvider{})
+
+	before, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile.ci")
+	if err := os.WriteFile(dockerfile, []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	if err := client.GetConfig().OverrideDockerfile(dockerfile); err != nil {
+		t.Fatalf("OverrideDockerfile() failed: %v", err)
+	}
+
+	after, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+
+	if before == after {
+		t.Errorf("Expected the override to change the image tag, got '%s' both times", after)
+	}
+}
+
+func TestClient_CopySourcesAffectTag(t *testing.T) {
+	// Copy sources resolve against the config file's directory
+	tempDir := t.TempDir()
+	certs := filepath.Join(tempDir, "certs")
+	if err := os.MkdirAll(certs, 0755); err != nil {
+		t.Fatalf("Failed to create certs directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(certs, "ca.pem"), []byte("one"), 0644); err != nil {
+		t.Fatalf("Failed to write cert: %v", err)
+	}
+
+	configFile := filepath.Join(tempDir, ConfigFileName)
+	configContent := `name: test
+container:
+  image: alpine:latest
+  copy:
+    - src: certs
+      dest: /certs
+`
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.SetProvider(&MockContainerProvider{})
+	if err := client.LoadConfigFromFile(configFile); err != nil {
+		t.Fatalf("LoadConfigFromFile() failed: %v", err)
+	}
+
+	first, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(certs, "ca.pem"), []byte("two"), 0644); err != nil {
+		t.Fatalf("Failed to update cert: %v", err)
+	}
+
+	second, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if first == second {
+		t.Error("Expected changed copy source contents to change the image tag")
+	}
+
+	if err := os.RemoveAll(certs); err != nil {
+		t.Fatalf("Failed to remove certs: %v", err)
+	}
+	if _, err := client.GetImageTag(); err == nil {
+		t.Error("Expected an error for a missing copy source")
+	}
+}
+
+func TestClient_RunCommandRetries(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: flaky
+      commands:
+        - ./integration.sh
+`
+	failure := errors.New("exit status 1")
+
+	t.Run("succeeds after failures", func(t *testing.T) {
+		mock := &MockContainerProvider{runErrors: []error{failure, failure}}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"flaky"}, RunOptions{Retries: 3}); err != nil {
+			t.Fatalf("Expected success on third attempt, got %v", err)
+		}
+		if len(mock.commands) != 3 {
+			t.Errorf("Expected 3 attempts, got %d", len(mock.commands))
+		}
+	})
+
+	t.Run("returns last failure", func(t *testing.T) {
+		last := errors.New("exit status 2")
+		mock := &MockContainerProvider{runErrors: []error{failure, last}}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.RunCommandWithOptions([]string{"flaky"}, RunOptions{Retries: 1})
+		if err != last {
+			t.Errorf("Expected last failure %v, got %v", last, err)
+		}
+		if len(mock.commands) != 2 {
+			t.Errorf("Expected 2 attempts, got %d", len(mock.commands))
+		}
+	})
+
+	t.Run("no retries by default", func(t *testing.T) {
+		mock := &MockContainerProvider{runErrors: []error{failure}}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommand([]string{"flaky"}); err != failure {
+			t.Errorf("Expected failure %v, got %v", failure, err)
+		}
+		if len(mock.commands) != 1 {
+			t.Errorf("Expected 1 attempt, got %d", len(mock.commands))
+		}
+	})
+}
+
+func TestClient_OverridesChangeTag(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\n"
+
+	base := newTestClient(t, configContent, &MockContainerProvider{})
+	baseTag, err := base.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+
+	configFile := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.SetProvider(&MockContainerProvider{})
+	client.SetOverrides([]string{"container.image=ubuntu:22.04"})
+	if err := client.LoadConfigFromFile(configFile); err != nil {
+		t.Fatalf("LoadConfigFromFile() failed: %v", err)
+	}
+
+	if client.GetConfig().Container.Image != "ubuntu:22.04" {
+		t.Errorf("Expected override applied, got image '%s'", client.GetConfig().Container.Image)
+	}
+	tag, err := client.GetImageTag()
+	if err != nil {
+		t.Fatalf("GetImageTag() failed: %v", err)
+	}
+	if tag == baseTag {
+		t.Error("Expected overrides to produce a distinct image tag")
+	}
+}
+
+func TestClient_DigestPinnedImage(t *testing.T) {
+	image := "registry.example.com:5000/team/alpine:3.19@sha256:" + strings.Repeat("ab", 32)
+
+	for _, tt := range []struct {
+		name      string
+		content   string
+		overrides []string
+	}{
+		{"from config", "name: test-project\ncontainer:\n  image: " + image + "\n", nil},
+		{"from override", "name: test-project\ncontainer:\n  image: alpine:latest\n", []string{"container.image=" + image}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), ConfigFileName)
+			if err := os.WriteFile(configFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+			client, err := NewClient()
+			if err != nil {
+				t.Fatalf("NewClient() failed: %v", err)
+			}
+			mock := &MockContainerProvider{missingImages: true}
+			client.SetProvider(mock)
+			client.SetOverrides(tt.overrides)
+			if err := client.LoadConfigFromFile(configFile); err != nil {
+				t.Fatalf("LoadConfigFromFile() failed: %v", err)
+			}
+
+			if err := client.BuildImage(false); err != nil {
+				t.Fatalf("BuildImage() failed: %v", err)
+			}
+			if len(mock.baseImages) != 1 || mock.baseImages[0] != image {
+				t.Errorf("Expected the digest-pinned image to reach the build unaltered, got %v", mock.baseImages)
+			}
+			if len(mock.built) != 1 || !strings.HasPrefix(mock.built[0], "test-project:") {
+				t.Errorf("Expected the image to be tagged after the project, got %v", mock.built)
+			}
+		})
+	}
+}
+
+func TestClient_ImageMarkers(t *testing.T) {
+	configContent := "name: test-project\ncontainer:\n  image: alpine:latest\n"
+
+	t.Run("later runs skip the image check", func(t *testing.T) {
+		useImageMarkers(t)
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		for i := 0; i < 3; i++ {
+			if err := client.RunCommand([]string{"true"}); err != nil {
+				t.Fatalf("RunCommand() failed: %v", err)
+			}
+		}
+		if mock.existsChecks != 1 || mock.daemonChecks != 1 {
+			t.Errorf("Expected one image and daemon check, got %d and %d", mock.existsChecks, mock.daemonChecks)
+		}
+
+		client.SetNoCacheCheck(true)
+		if err := client.RunCommand([]string{"true"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if mock.existsChecks != 2 {
+			t.Errorf("Expected --no-cache-check to inspect the image, got %d checks", mock.existsChecks)
+		}
+	})
+
+	t.Run("config changes check again", func(t *testing.T) {
+		useImageMarkers(t)
+		mock := &MockContainerProvider{}
+		if err := newTestClient(t, configContent, mock).RunCommand([]string{"true"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		changed := newTestClient(t, configContent+"  setup:\n    - apk add git\n", mock)
+		if err := changed.RunCommand([]string{"true"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if mock.existsChecks != 2 {
+			t.Errorf("Expected the new image to be checked, got %d checks", mock.existsChecks)
+		}
+	})
+
+	t.Run("image removed behind the marker is rebuilt", func(t *testing.T) {
+		useImageMarkers(t)
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		if err := client.RunCommand([]string{"true"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		// Removed with e.g. "docker rmi": the run fails as the image is gone
+		mock.missingImages = true
+		mock.runErrors = []error{exitCodeError(125)}
+		if err := client.RunCommand([]string{"true"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if len(mock.built) != 1 || len(mock.commands) != 3 {
+			t.Errorf("Expected a rebuild and a second run, got builds %v and commands %v", mock.built, mock.commands)
+		}
+	})
+
+	t.Run("failing command keeps the marker", func(t *testing.T) {
+		dir := useImageMarkers(t)
+		mock := &MockContainerProvider{runErrors: []error{nil, exitCodeError(1)}}
+		client := newTestClient(t, configContent, mock)
+		_ = client.RunCommand([]string{"true"})
+
+		if err := client.RunCommand([]string{"false"}); ExitCode(err) != 1 {
+			t.Fatalf("Expected the command's exit code, got %v", err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 || len(mock.built) != 0 {
+			t.Errorf("Expected the marker kept without a rebuild, got %d markers and builds %v", len(entries), mock.built)
+		}
+	})
+}
+
+func TestClient_TagImage(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\n"
+
+	t.Run("tags existing image", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.TagImage("test:abc123def456", "registry.example.com:5000/team/test:1.0"); err != nil {
+			t.Fatalf("TagImage() failed: %v", err)
+		}
+		if len(mock.tags) != 1 || mock.tags[0] != [2]string{"test:abc123def456", "registry.example.com:5000/team/test:1.0"} {
+			t.Errorf("Unexpected tag calls %v", mock.tags)
+		}
+	})
+
+	t.Run("missing source image", func(t *testing.T) {
+		mock := &MockContainerProvider{missingImages: true}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.TagImage("test:abc123def456", "test:release")
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Expected not found error, got %v", err)
+		}
+		if len(mock.tags) != 0 {
+			t.Errorf("Expected no tag calls, got %v", mock.tags)
+		}
+	})
+
+	t.Run("invalid references", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		for _, refs := range [][2]string{{"Test:1", "test:2"}, {"test:1", "test:bad tag"}, {"test:1", ""}} {
+			if err := client.TagImage(refs[0], refs[1]); err == nil {
+				t.Errorf("TagImage(%q, %q) should fail", refs[0], refs[1])
+			}
+		}
+		if len(mock.tags) != 0 {
+			t.Errorf("Expected no tag calls, got %v", mock.tags)
+		}
+	})
+}
+
+func TestClient_ScriptInfos(t *testing.T) {
+	useHostOS(t, "linux")
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: test
+      description: Run the tests
+      commands:
+        - go vet ./...
+        - go test ./...
+    - name: ci
+      depends_on: [test]
+    - name: notarize
+      os: [darwin]
+      commands:
+        - xcrun notarytool submit
+`
+	client := newTestClient(t, configContent, &MockContainerProvider{})
+
+	infos, err := client.ScriptInfos(ListOptions{})
+	if err != nil {
+		t.Fatalf("ScriptInfos() failed: %v", err)
+	}
+	expected := []ScriptInfo{
+		{Name: "test", Description: "Run the tests", Commands: 2},
+		{Name: "ci", Commands: 0},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, infos)
+	}
+
+	all, err := client.ScriptInfos(ListOptions{All: true})
+	if err != nil {
+		t.Fatalf("ScriptInfos() failed: %v", err)
+	}
+	if len(all) != 3 || all[2].Name != "notarize" {
+		t.Errorf("Expected all three scripts with --all, got %+v", all)
+	}
+}
+
+func TestClient_PullImage(t *testing.T) {
+	configContent := `name: test
+container:
+  image: ghcr.io/acme/toolbox:1.4
+  pull: true
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+`
+
+	t.Run("tag is the image", func(t *testing.T) {
+		client := newTestClient(t, configContent, &MockContainerProvider{})
+		tag, err := client.GetImageTag()
+		if err != nil {
+			t.Fatalf("GetImageTag() failed: %v", err)
+		}
+		if tag != "ghcr.io/acme/toolbox:1.4" {
+			t.Errorf("Expected the image reference unchanged, got %s", tag)
+		}
+	})
+
+	t.Run("missing image is pulled", func(t *testing.T) {
+		mock := &MockContainerProvider{missingImages: true}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommand([]string{"test"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if !reflect.DeepEqual(mock.pulled, []string{"ghcr.io/acme/toolbox:1.4"}) || len(mock.built) != 0 {
+			t.Errorf("Expected a pull and no build, got pulls %v and builds %v", mock.pulled, mock.built)
+		}
+		if !reflect.DeepEqual(mock.runTags, []string{"ghcr.io/acme/toolbox:1.4"}) {
+			t.Errorf("Expected the run on the pulled image, got %v", mock.runTags)
+		}
+	})
+
+	t.Run("present image is used", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommand([]string{"test"}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if len(mock.pulled) != 0 || len(mock.built) != 0 {
+			t.Errorf("Expected no pull or build, got pulls %v and builds %v", mock.pulled, mock.built)
+		}
+	})
+
+	t.Run("forced build pulls again", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.BuildImage(true); err != nil {
+			t.Fatalf("BuildImage() failed: %v", err)
+		}
+		if len(mock.pulled) != 1 || len(mock.built) != 0 || len(mock.removedImages) != 0 {
+			t.Errorf("Expected only a pull, got pulls %v, builds %v and removals %v", mock.pulled, mock.built, mock.removedImages)
+		}
+	})
+
+	t.Run("pull failure", func(t *testing.T) {
+		mock := &MockContainerProvider{missingImages: true, pullErr: errors.New("manifest unknown")}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.RunCommand([]string{"test"})
+		if err == nil || !strings.Contains(err.Error(), "failed to pull image: manifest unknown") {
+			t.Errorf("Expected the pull error, got %v", err)
+		}
+		if len(mock.commands) != 0 {
+			t.Errorf("Expected nothing to run, got %v", mock.commands)
+		}
+	})
+}
+
+func TestClient_HomeMounts(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	configContent := `name: My App
+container:
+  image: node:22
+`
+
+	mock := &MockContainerProvider{home: "/home/node", runErrors: []error{exitCodeError(1)}}
+	client := newTestClient(t, configContent, mock)
+	if err := client.SetHomeMounts([]string{".aws", ".config/gcloud/"}); err != nil {
+		t.Fatalf("SetHomeMounts() failed: %v", err)
+	}
+
+	if err := client.RunCommandWithOptions([]string{"aws", "s3", "ls"}, RunOptions{Retries: 1}); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+
+	base := filepath.Join(cacheDir, "miko-shell", "my-app", "home")
+	expected := []string{
+		filepath.Join(base, ".aws") + ":/home/node/.aws",
+		filepath.Join(base, ".config", "gcloud") + ":/home/node/.config/gcloud",
+	}
+	if !reflect.DeepEqual(client.GetConfig().Container.Volumes, expected) {
+		t.Errorf("Expected the volumes %v once across retries, got %v", expected, client.GetConfig().Container.Volumes)
+	}
+	info, err := os.Stat(filepath.Join(base, ".config", "gcloud"))
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected a private host directory, got %v, %v", info, err)
+	}
+
+	for _, subdir := range []string{"", "/root/.aws", "..", "../.ssh", ".aws/../../etc", "."} {
+		if err := client.SetHomeMounts([]string{subdir}); err == nil {
+			t.Errorf("Expected SetHomeMounts(%q) to fail", subdir)
+		}
+	}
+}
+
+func TestClient_SaveImage(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+`
+	dir := t.TempDir()
+	output := filepath.Join(dir, "env.tar")
+
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+	if err := client.SaveImage(output); err != nil {
+		t.Fatalf("SaveImage() failed: %v", err)
+	}
+	tag, _ := client.GetImageTag()
+	if !reflect.DeepEqual(mock.saved, [][2]string{{tag, output}}) {
+		t.Errorf("Expected %s saved to %s, got %v", tag, output, mock.saved)
+	}
+
+	missing := &MockContainerProvider{missingImages: true}
+	client = newTestClient(t, configContent, missing)
+	if err := client.SaveImage(output); err == nil || !strings.Contains(err.Error(), "build it first") {
+		t.Errorf("Expected a missing image error, got %v", err)
+	}
+	if len(missing.saved) != 0 {
+		t.Errorf("Expected nothing saved, got %v", missing.saved)
+	}
+}
+
+func TestCheckSaveDestination(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckSaveDestination(filepath.Join(dir, "env.tar")); err != nil {
+		t.Errorf("Expected a new file in a writable directory to pass, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no files left behind, got %v", entries)
+	}
+	if err := CheckSaveDestination(dir); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("Expected a directory error, got %v", err)
+	}
+	if err := CheckSaveDestination(filepath.Join(dir, "missing", "env.tar")); err == nil || !strings.Contains(err.Error(), "not writable") {
+		t.Errorf("Expected a missing directory error, got %v", err)
+	}
+}
+
+// writeImageArchive writes a tarball holding only the given archive
+// metadata files, enough for ImageArchiveTags
+func writeImageArchive(t *testing.T, path string, compress bool, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if compress {
+		var gz bytes.Buffer
+		writer := gzip.NewWriter(&gz)
+		writer.Write(data)
+		writer.Close()
+		data = gz.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageArchiveTags(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		compress bool
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name:     "docker archive",
+			files:    map[string]string{"manifest.json": `[{"Config":"abc.json","RepoTags":["proj:abc123def456"]}]`},
+			expected: []string{"proj:abc123def456"},
+		},
+		{
+			name:     "gzipped docker archive",
+			compress: true,
+			files:    map[string]string{"manifest.json": `[{"RepoTags":["proj:1.0"]},{"RepoTags":["alpine:latest"]}]`},
+			expected: []string{"proj:1.0", "alpine:latest"},
+		},
+		{
+			name: "oci archive",
+			files: map[string]string{"index.json": `{"manifests":[{"annotations":` +
+				`{"io.containerd.image.name":"docker.io/library/proj:abc123def456","org.opencontainers.image.ref.name":"abc123def456"}}]}`},
+			expected: []string{"docker.io/library/proj:abc123def456"},
+		},
+		{
+			name:  "untagged",
+			files: map[string]string{"manifest.json": `[{"Config":"abc.json","RepoTags":null}]`},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("image%d.tar", i))
+			writeImageArchive(t, path, tt.compress, tt.files)
+			tags, err := ImageArchiveTags(path)
+			if err != nil {
+				t.Fatalf("ImageArchiveTags() failed: %v", err)
+			}
+			if !reflect.DeepEqual(tags, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, tags)
+			}
+		})
+	}
+
+	notArchive := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notArchive, []byte("not a tarball"), 0644)
+	if _, err := ImageArchiveTags(notArchive); err == nil {
+		t.Error("Expected an error for a file that isn't a tarball")
+	}
+}
+
+func TestClient_LoadImage(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+`
+	dir := t.TempDir()
+	archive := func(tags ...string) string {
+		path := filepath.Join(dir, strings.Join(append(tags, "image"), "_")+".tar")
+		manifest := `[{"RepoTags":["` + strings.Join(tags, `","`) + `"]}]`
+		writeImageArchive(t, path, false, map[string]string{"manifest.json": manifest})
+		return path
+	}
+
+	t.Run("load only", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		path := archive("other:1.0")
+		if source, err := client.LoadImage(path, false); err != nil || source != "" {
+			t.Fatalf("LoadImage() = %q, %v", source, err)
+		}
+		if !reflect.DeepEqual(mock.loaded, []string{path}) || len(mock.tags) != 0 {
+			t.Errorf("Expected %s loaded without tagging, got %v and tags %v", path, mock.loaded, mock.tags)
+		}
+	})
+
+	t.Run("retag", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		tag, _ := client.GetImageTag()
+		path := archive("test:0123456789ab")
+		source, err := client.LoadImage(path, true)
+		if err != nil {
+			t.Fatalf("LoadImage() failed: %v", err)
+		}
+		if source != "test:0123456789ab" {
+			t.Errorf("Expected the archive's tag as source, got %q", source)
+		}
+		if !reflect.DeepEqual(mock.tags, [][2]string{{"test:0123456789ab", tag}}) {
+			t.Errorf("Expected the image tagged %s, got %v", tag, mock.tags)
+		}
+	})
+
+	t.Run("already tagged", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		tag, _ := client.GetImageTag()
+		if source, err := client.LoadImage(archive(tag, "test:latest"), true); err != nil || source != "" {
+			t.Fatalf("LoadImage() = %q, %v", source, err)
+		}
+		if len(mock.loaded) != 1 || len(mock.tags) != 0 {
+			t.Errorf("Expected a load without tagging, got %v and tags %v", mock.loaded, mock.tags)
+		}
+	})
+
+	t.Run("ambiguous retag", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		if _, err := client.LoadImage(archive("a:1", "b:1"), true); err == nil || !strings.Contains(err.Error(), "several images") {
+			t.Errorf("Expected an ambiguous archive error, got %v", err)
+		}
+		if len(mock.loaded) != 0 {
+			t.Errorf("Expected nothing loaded, got %v", mock.loaded)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+		if _, err := client.LoadImage(filepath.Join(dir, "missing.tar"), false); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("Expected a missing file error, got %v", err)
+		}
+		if _, err := client.LoadImage(dir, false); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+			t.Errorf("Expected a directory error, got %v", err)
+		}
+		if len(mock.loaded) != 0 {
+			t.Errorf("Expected nothing loaded, got %v", mock.loaded)
+		}
+	})
+}
+
+func TestClient_ExpandScript(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: lint
+      commands:
+        - go vet ./...
+    - name: test
+      depends_on: [lint]
+      commands:
+        - go test $1
+        - echo done
+    - name: greet
+      commands:
+        - echo "Hello $1"
+    - name: loop
+      depends_on: [loop]
+`
+	mock := &MockContainerProvider{}
+	client := newTestClient(t, configContent, mock)
+
+	tests := []struct {
+		name     string
+		args     []string
+		strict   bool
+		expected string
+	}{
+		{
+			name:     "arguments",
+			args:     []string{"greet", "Alice's"},
+			expected: `set -- 'Alice'"'"'s' ; echo "Hello $1"`,
+		},
+		{
+			name:     "no arguments",
+			args:     []string{"greet"},
+			expected: `echo "Hello $1"`,
+		},
+		{
+			name:     "strict arguments",
+			args:     []string{"greet"},
+			strict:   true,
+			expected: `[ $# -ge 1 ] || { echo "missing argument 1" >&2; exit 1; }; echo "Hello $1"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := client.ExpandScript(tt.args, tt.strict)
+			if err != nil {
+				t.Fatalf("ExpandScript() failed: %v", err)
+			}
+			if script != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, script)
+			}
+		})
+	}
+
+	script, err := client.ExpandScript([]string{"test", "./pkg"}, false)
+	if err != nil {
+		t.Fatalf("ExpandScript() failed: %v", err)
+	}
+	if !strings.HasPrefix(script, "{ set --; { go vet ./...\n}") || !strings.Contains(script, "} && { set -- './pkg' ; { go test $1\n}") {
+		t.Errorf("Expected the dependency chained in before the script, got %q", script)
+	}
+
+	if _, err := client.ExpandScript([]string{"loop"}, false); err == nil || !strings.Contains(err.Error(), "loop -> loop") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+	if _, err := client.ExpandScript([]string{"missing"}, false); err == nil || !strings.Contains(err.Error(), "unknown script 'missing'") {
+		t.Errorf("Expected an unknown script error, got %v", err)
+	}
+	if len(mock.commands) != 0 || len(mock.built) != 0 {
+		t.Errorf("Expected nothing to run or build, got %v and %v", mock.commands, mock.built)
+	}
+}
+
+func TestWriteScriptList(t *testing.T) {
+	scripts := []Script{
+		{Name: "db:migrate", Description: "Apply migrations"},
+		{Name: "build"},
+		{Name: "test:unit"},
+		{Name: "db:seed"},
+		{Name: "lint", Description: "Run linters"},
+		{Name: "test:e2e"},
+	}
+
+	var buf strings.Builder
+	writeScriptList(&buf, scripts)
+
+	expected := `  build
+  lint - Run linters
+
+  db:
+    db:migrate - Apply migrations
+    db:seed
+
+  test:
+    test:unit
+    test:e2e
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected script list:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestScript_AllArgs(t *testing.T) {
+	args := []string{"-k", "slow tests", "it's"}
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{name: "quoted $@ keeps each argument", command: `printf '[%s]' "$@"`, expected: "[-k][slow tests][it's]"},
+		{name: "unquoted $@ is word-split", command: `printf '[%s]' $@`, expected: "[-k][slow][tests][it's]"},
+		{name: "quoted $* joins arguments", command: `printf '[%s]' "$*"`, expected: "[-k slow tests it's]"},
+		{name: "$# counts arguments", command: `echo $#`, expected: "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := &Script{Name: "pytest", Commands: []string{tt.command}}
+			out, err := exec.Command("/bin/sh", "-c", script.GetCommandsAsStringWithArgs(args)).Output()
+			if err != nil {
+				t.Fatalf("script failed: %v", err)
+			}
+			if strings.TrimSpace(string(out)) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, strings.TrimSpace(string(out)))
+			}
+		})
+	}
+
+	t.Run("no arguments", func(t *testing.T) {
+		script := &Script{Name: "pytest", Commands: []string{`printf '[%s]' "$@"; echo $#`}}
+		out, err := exec.Command("/bin/sh", "-c", script.GetCommandsAsStringWithArgs(nil)).Output()
+		if err != nil {
+			t.Fatalf("script failed: %v", err)
+		}
+		if strings.TrimSpace(string(out)) != "[]0" {
+			t.Errorf("Expected no arguments, got %q", strings.TrimSpace(string(out)))
+		}
+	})
+}
+
+func TestScript_ArgDefaults(t *testing.T) {
+	script := &Script{
+		Name: "serve",
+		Args: []ScriptArg{
+			{Name: "port", Default: "8080"},
+			{Name: "host"},
+			{Name: "mode", Default: "dev"},
+		},
+		Commands: []string{`echo "$1 $2 $3"`},
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "defaults used", args: nil, expected: "8080  dev"},
+		{name: "first provided", args: []string{"3000"}, expected: "3000  dev"},
+		{name: "all provided", args: []string{"3000", "0.0.0.0", "prod"}, expected: "3000 0.0.0.0 prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exec.Command("/bin/sh", "-c", script.GetCommandsAsStringWithArgs(tt.args)).Output()
+			if err != nil {
+				t.Fatalf("script failed: %v", err)
+			}
+			if strings.TrimSpace(string(out)) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, strings.TrimSpace(string(out)))
+			}
+		})
+	}
+
+	t.Run("wrapper substitutes defaults", func(t *testing.T) {
+		if got := script.argDefault(1); got != "8080" {
+			t.Errorf("argDefault(1) = %q, want %q", got, "8080")
+		}
+		if got := script.argDefault(2); got != "" {
+			t.Errorf("argDefault(2) = %q, want empty", got)
+		}
+		if got := script.argDefault(4); got != "" {
+			t.Errorf("argDefault(4) = %q, want empty", got)
+		}
+	})
+}
+
+func TestClient_OpenShellNoStartup(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\nshell:\n  startup:\n    - export READY=1\n"
+
+	tests := []struct {
+		name     string
+		opts     OpenOptions
+		expected string
+	}{
+		{name: "with startup", opts: OpenOptions{}, expected: "startup"},
+		{name: "without startup", opts: OpenOptions{NoStartup: true}, expected: "plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockContainerProvider{}
+			client := newTestClient(t, configContent, mock)
+
+			if err := client.OpenShellWithOptions(tt.opts); err != nil {
+				t.Fatalf("OpenShellWithOptions() failed: %v", err)
+			}
+			if len(mock.shells) != 1 || mock.shells[0] != tt.expected {
+				t.Errorf("Expected %s shell, got %v", tt.expected, mock.shells)
+			}
+		})
+	}
+}
+
+func TestClient_RunCommandOutputPrefix(t *testing.T) {
+	configContent := "name: test\ncontainer:\n  image: alpine:latest\n"
+	mock := &MockContainerProvider{output: "first line\nsecond line\npartial"}
+	client := newTestClient(t, configContent, mock)
+
+	var stdout bytes.Buffer
+	opts := RunOptions{OutputPrefix: "build", Stdout: &stdout}
+	if err := client.RunCommandWithOptions([]string{"make"}, opts); err != nil {
+		t.Fatalf("RunCommandWithOptions() failed: %v", err)
+	}
+
+	expected := "[build] first line\n[build] second line\n[build] partial"
+	if stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestClient_RunCommandRerunWithTTY(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: diff
+      commands:
+        - git diff --exit-code
+`
+
+	t.Run("failure re-runs with tty", func(t *testing.T) {
+		mock := &MockContainerProvider{runErrors: []error{errors.New("exit status 1")}}
+		client := newTestClient(t, configContent, mock)
+
+		err := client.RunCommandWithOptions([]string{"diff"}, RunOptions{RerunWithTTY: true, ReplaceEntrypoint: true})
+		if err == nil {
+			t.Fatal("Expected the original failure to be returned")
+		}
+
+		if len(mock.started) != 1 {
+			t.Fatalf("Expected one container to be started, got %v", mock.started)
+		}
+		name := mock.started[0]
+		if !reflect.DeepEqual(mock.execContainers, []string{name, name}) {
+			t.Errorf("Expected the command and its re-run exec'd into %s, got %v", name, mock.execContainers)
+		}
+		if !reflect.DeepEqual(mock.commands[0], mock.commands[1]) {
+			t.Errorf("Expected the same command to be re-run, got %v and %v", mock.commands[0], mock.commands[1])
+		}
+		if rerun := mock.runOptions[1]; !rerun.TTY || !rerun.ReplaceEntrypoint || rerun.RerunWithTTY {
+			t.Errorf("Unexpected re-run options %+v", rerun)
+		}
+		if !reflect.DeepEqual(mock.removedContainers, []string{name}) {
+			t.Errorf("Expected %s to be removed after the re-run, got %v", name, mock.removedContainers)
+		}
+	})
+
+	t.Run("re-run keeps the command setup", func(t *testing.T) {
+		mock := &MockContainerProvider{runErrors: []error{errors.New("exit status 1")}}
+		client := newTestClient(t, configContent, mock)
+		if err := os.MkdirAll(filepath.Join(client.GetConfig().workspaceDir(), "services", "api"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := RunOptions{
+			RerunWithTTY: true,
+			Workdir:      "services/api",
+			ShellWrap:    true,
+			StrictArgs:   true,
+			Literal:      true,
+			Retries:      1,
+			OutputPrefix: "api",
+		}
+		// Both attempts fail, then the re-run
+		mock.runErrors = append(mock.runErrors, errors.New("exit status 1"))
+		if err := client.RunCommandWithOptions([]string{"ls", "*.go", "|", "wc", "-l"}, opts); err == nil {
+			t.Fatal("Expected the original failure to be returned")
+		}
+
+		if len(mock.commands) != 3 {
+			t.Fatalf("Expected two attempts and a re-run, got %d runs", len(mock.commands))
+		}
+		if !reflect.DeepEqual(mock.commands[2], mock.commands[0]) {
+			t.Errorf("Expected the re-run to use the same shell-wrapped command, got %v and %v", mock.commands[2], mock.commands[0])
+		}
+		rerun := mock.runOptions[2]
+		if rerun.Workdir != "services/api" || !rerun.ShellWrap || !rerun.StrictArgs || !rerun.Literal {
+			t.Errorf("Expected the re-run to keep the command options, got %+v", rerun)
+		}
+		if rerun.Retries != 0 || rerun.OutputPrefix != "" || rerun.Stdout != nil || rerun.Stderr != nil {
+			t.Errorf("Expected the re-run without retries or output handling, got %+v", rerun)
+		}
+	})
+
+	t.Run("success runs once", func(t *testing.T) {
+		mock := &MockContainerProvider{}
+		client := newTestClient(t, configContent, mock)
+
+		if err := client.RunCommandWithOptions([]string{"diff"}, RunOptions{RerunWithTTY: true}); err != nil {
+			t.Fatalf("RunCommandWithOptions() failed: %v", err)
+		}
+		if len(mock.commands) != 1 {
+			t.Errorf("Expected a single run, got %d", len(mock.commands))
+		}
+		if len(mock.started) != 1 || !reflect.DeepEqual(mock.removedContainers, mock.started) {
+			t.Errorf("Expected the started container to be removed, got %v and %v", mock.started, mock.removedContainers)
+		}
+	})
+}
+
+func TestClient_ProfileImageTag(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), ConfigFileName)
+	configContent := `name: test
+container:
+  image: alpine:latest
+profiles:
+  ci:
+    container:
+      setup:
+        - apk add make
+`
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	tags := make(map[string]string)
+	for _, profile := range []string{"", "ci"} {
+		client, err := NewClient()
+		if err != nil {
+			t.Fatalf("NewClient() failed: %v", err)
+		}
+		client.SetProvider(&MockContainerProvider{})
+		client.SetProfile(profile)
+		if err := client.LoadConfigFromFile(configFile); err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+
+		tag, err := client.GetImageTag()
+		if err != nil {
+			t.Fatalf("GetImageTag() failed: %v", err)
+		}
+		tags[profile] = tag
+	}
+
+	if tags[""] == tags["ci"] {
+		t.Errorf("Expected the ci profile to get its own image, both use %s", tags[""])
+	}
+}
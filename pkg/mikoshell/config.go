@@ -1,14 +1,22 @@
 package mikoshell
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 	"unicode"
 
 	"golang.org/x/text/runes"
@@ -21,148 +29,2178 @@ const ConfigFileName = "miko-shell.yaml"
 
 // Config represents the project configuration
 type Config struct {
-	Name      string    `yaml:"name"`
-	Container Container `yaml:"container"`
-	Shell     Shell     `yaml:"shell"`
+	// Extends names configs, as a path or list of paths relative to this
+	// file, that this one is merged over
+	Extends   StringList `yaml:"extends,omitempty"`
+	Name      string     `yaml:"name"`
+	Container Container  `yaml:"container"`
+	Shell     Shell      `yaml:"shell"`
+	// Profiles are named variants of the config selected with --profile
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+
+	// profileNodes keeps the YAML of each profile, so ApplyProfile only
+	// overrides the keys a profile sets
+	profileNodes map[string]*yaml.Node
+	// profile is the name of the applied profile, for container.tag_format
+	profile string
+
+	// dir is the directory of the loaded config file; relative paths in the
+	// config resolve against it. Empty means the current directory.
+	dir string
+}
+
+// StringList is a list of strings that may also be written as one string
+type StringList []string
+
+// UnmarshalYAML accepts a single string as a list of one
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
+
+// Profile overrides container and shell settings of the base config, e.g.
+// a "ci" profile with other setup steps. Keys it sets replace the base
+// values; maps such as mounts are merged, and environment entries are
+// merged by variable name.
+type Profile struct {
+	Container Container `yaml:"container,omitempty"`
+	Shell     Shell     `yaml:"shell,omitempty"`
+}
+
+// Container represents the container configuration
+type Container struct {
+	Provider string `yaml:"provider"`
+	// Context is the docker context (podman connection, containerd namespace) to target
+	Context string          `yaml:"context,omitempty"`
+	Image   string          `yaml:"image,omitempty"`
+	Build   *ContainerBuild `yaml:"build,omitempty"`
+	Copy    []CopyEntry     `yaml:"copy,omitempty"`
+	Setup   []string        `yaml:"setup,omitempty"`
+	// Verify lists commands run in a throwaway container after a build; the
+	// build fails if any of them exits non-zero
+	Verify []string `yaml:"verify,omitempty"`
+	// Pull runs Image as it is, pulling it when it is missing, instead of
+	// building a derived image; build, copy, setup and verify don't apply
+	Pull bool `yaml:"pull,omitempty"`
+	// BuildRetries re-runs an image build or pull failing with a network or
+	// registry error up to this many times, with exponential backoff
+	BuildRetries int `yaml:"build_retries,omitempty"`
+	// SyncTimezone passes the host timezone into run and open containers
+	SyncTimezone bool `yaml:"sync_timezone,omitempty"`
+	// Mounts maps logical names to host paths mounted into run and open containers
+	Mounts map[string]Mount `yaml:"mounts,omitempty"`
+	// Volumes are raw "source:target[:options]" volume specs; sources may be
+	// host paths or named volumes
+	Volumes []string `yaml:"volumes,omitempty"`
+	// Environment lists KEY=VALUE variables set in run and open containers;
+	// a bare KEY passes through the host value
+	Environment []string `yaml:"environment,omitempty"`
+	// EnvFile lists dotenv-style files passed to run and open containers;
+	// later files override earlier ones
+	EnvFile []string `yaml:"env_file,omitempty"`
+	// AutoEnv loads a .env file next to the config file when there is one,
+	// with lower precedence than EnvFile
+	AutoEnv bool `yaml:"auto_env,omitempty"`
+	// PassEnvPrefix forwards every host variable whose name starts with one of
+	// these prefixes, e.g. "MYAPP_"
+	PassEnvPrefix []string `yaml:"pass_env_prefix,omitempty"`
+	// Ports are published from run and open containers, as "container",
+	// "host:container" or "ip:host:container" with an optional "/proto"
+	Ports []string `yaml:"ports,omitempty"`
+	// HostGateway maps host.docker.internal to the host, including on Linux
+	HostGateway bool `yaml:"host_gateway,omitempty"`
+	// Network is the network run and open containers join: bridge (the
+	// default), host, none, container:<name> or a network name, e.g. one
+	// created by docker compose
+	Network string `yaml:"network,omitempty"`
+	// GPUs gives run and open containers GPUs: "all", a count, or
+	// "device=<id>[,<id>...]"
+	GPUs string `yaml:"gpus,omitempty"`
+	// RunArgs are passed verbatim to the engine's run command for flags
+	// miko-shell has no setting for, e.g. --cap-add; they aren't validated
+	RunArgs []string `yaml:"run_args,omitempty"`
+	// Init runs an init process as PID 1 in run and open containers, which
+	// reaps zombies left by background processes and forwards signals
+	Init bool `yaml:"init,omitempty"`
+	// Shell is the interactive shell binary, e.g. /bin/bash; /bin/sh is used
+	// when unset or missing from the image
+	Shell string `yaml:"shell,omitempty"`
+	// Workdir is where the project is mounted and commands run; defaults to
+	// DefaultWorkdir
+	Workdir string `yaml:"workdir,omitempty"`
+	// User runs containers as this user: "uid[:gid]", a user name, or
+	// UserHost for the host's uid:gid so created files aren't owned by root
+	User string `yaml:"user,omitempty"`
+	// TagFormat is a text/template for the image tag, evaluated with
+	// TagFields; defaults to DefaultTagFormat
+	TagFormat string `yaml:"tag_format,omitempty"`
+}
+
+// DefaultWorkdir is the container path the project is mounted at when
+// container.workdir is not set
+const DefaultWorkdir = "/workspace"
+
+// UserHost as container.user runs containers as the host user
+const UserHost = "host"
+
+// DefaultTagFormat is the image tag template used when container.tag_format
+// is not set
+const DefaultTagFormat = "{{.Name}}:{{.Hash}}"
+
+// TagFields are the values available to container.tag_format
+type TagFields struct {
+	// Name is the project name
+	Name string
+	// Hash is the config hash; a tag must include it so config changes rebuild
+	Hash string
+	// Profile is the active config profile; empty when none is selected
+	Profile string
+	// Platform is the host platform as os-arch, e.g. linux-amd64
+	Platform string
+	// Date is the current UTC date as YYYYMMDD
+	Date string
+}
+
+// Mount represents a host path mounted into the container. Relative host paths
+// are resolved against the config directory and "~" expands to the home directory.
+type Mount struct {
+	Host     string `yaml:"host"`
+	Path     string `yaml:"path"`
+	ReadOnly bool   `yaml:"readonly,omitempty"`
+}
+
+// CopyEntry represents a local file or directory copied into the image
+type CopyEntry struct {
+	Src  string `yaml:"src"`
+	Dest string `yaml:"dest"`
+}
+
+// ContainerBuild represents custom image build configuration
+type ContainerBuild struct {
+	Dockerfile string            `yaml:"dockerfile"`
+	Context    string            `yaml:"context,omitempty"`
+	Args       map[string]string `yaml:"args,omitempty"`
+	// Contexts are named additional build contexts for COPY --from=<name>;
+	// values are local paths or docker-image://, oci-layout:// or URL refs
+	Contexts map[string]string `yaml:"contexts,omitempty"`
+	// Labels are extra image labels added to the custom image
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// NoCache always builds the custom image fresh, without the layer cache
+	NoCache bool `yaml:"no_cache,omitempty"`
+	// BuildKit builds the custom image with BuildKit, for Dockerfiles using
+	// RUN --mount=type=cache and other BuildKit-only features
+	BuildKit bool `yaml:"buildkit,omitempty"`
+}
+
+// Startup failure policies for shell.startup_policy
+const (
+	// StartupPolicyStrict aborts on the first failing startup command
+	StartupPolicyStrict = "strict"
+	// StartupPolicyContinue logs failing startup commands and keeps going
+	StartupPolicyContinue = "continue"
+	// StartupPolicyPrompt asks whether to continue after a failing startup command
+	StartupPolicyPrompt = "prompt"
+)
+
+// Interactive shell modes for shell.interactive
+const (
+	// InteractiveShellSh always opens /bin/sh
+	InteractiveShellSh = "sh"
+	// InteractiveShellAuto opens bash when the image has it, falling back to /bin/sh
+	InteractiveShellAuto = "auto"
+)
+
+// Shell represents the shell configuration
+type Shell struct {
+	InitHook      []string `yaml:"startup"`
+	StartupPolicy string   `yaml:"startup_policy,omitempty"`
+	Interactive   string   `yaml:"interactive,omitempty"`
+	// StrictArgs makes scripts fail when they reference a positional argument
+	// that wasn't passed and has no default, instead of expanding it to ""
+	StrictArgs bool `yaml:"strict_args,omitempty"`
+	// Flags are sh options such as "-eu" for the shell running script
+	// commands and "run --entrypoint-shell" commands
+	Flags   string   `yaml:"flags,omitempty"`
+	Scripts []Script `yaml:"scripts"`
+}
+
+// Script represents a shell script
+type Script struct {
+	Name        string      `yaml:"name"`
+	Description string      `yaml:"description,omitempty"`
+	Args        []ScriptArg `yaml:"args,omitempty"`
+	Commands    []string    `yaml:"commands"`
+	// File is a shell script, relative to the config file, whose contents are
+	// read at load time and used as the script body instead of Commands
+	File string `yaml:"file,omitempty"`
+	// Confirm asks before running the script, e.g. for destructive tasks
+	Confirm bool `yaml:"confirm,omitempty"`
+	// DependsOn names scripts run, in order and without arguments, before this one
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	// OS restricts the script to hosts running one of these systems (linux,
+	// darwin, windows); empty means any host
+	OS []string `yaml:"os,omitempty"`
+
+	// line is where the script is defined in the config file, 0 if unknown
+	line int
+}
+
+// reservedScriptNames are the commands of the in-container miko-shell
+// wrapper, which a script of the same name would shadow
+var reservedScriptNames = []string{"run", "open", "list", "version", "help"}
+
+// ScriptArg describes a positional script argument; the first entry is $1
+type ScriptArg struct {
+	Name    string `yaml:"name,omitempty"`
+	Default string `yaml:"default,omitempty"`
+}
+
+// ConfigExists checks if the configuration file exists in the current directory
+func ConfigExists() bool {
+	_, err := os.Stat(ConfigFileName)
+	return err == nil
+}
+
+// FindConfigFiles returns the miko-shell.yaml files found under root, in
+// walk order. Hidden directories and dependency folders are skipped.
+func FindConfigFiles(root string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() == ConfigFileName {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for config files: %w", err)
+	}
+
+	return files, nil
+}
+
+// LoadConfig loads the configuration from miko-shell.yaml
+func LoadConfig() (*Config, error) {
+	if !ConfigExists() {
+		return nil, fmt.Errorf("miko-shell.yaml not found. Run 'miko-shell init' first")
+	}
+
+	data, err := os.ReadFile(ConfigFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	root, err := resolveExtends(&document, ConfigFileName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := root.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	config.recordScriptLines(root)
+	config.recordProfiles(root)
+
+	if err := validateConfig(&config); err != nil {
+		return nil, err
+	}
+
+	if err := config.loadScriptFiles(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// LoadConfigFromFile loads the configuration from a specific file
+func LoadConfigFromFile(filePath string) (*Config, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file '%s': %w", filePath, err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config file '%s': %w", filePath, err)
+	}
+	root, err := resolveExtends(&document, filePath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := root.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file '%s': %w", filePath, err)
+	}
+	config.recordScriptLines(root)
+	config.recordProfiles(root)
+
+	if err := validateConfig(&config); err != nil {
+		return nil, err
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config file '%s': %w", filePath, err)
+	}
+	config.dir = filepath.Dir(absPath)
+
+	if err := config.loadScriptFiles(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// recordScriptLines notes the line each script is defined on so errors can
+// point at it
+func (c *Config) recordScriptLines(root *yaml.Node) {
+	scripts := mappingValue(mappingValue(root, "shell"), "scripts")
+	if scripts == nil || scripts.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, item := range scripts.Content {
+		if i < len(c.Shell.Scripts) {
+			c.Shell.Scripts[i].line = item.Line
+		}
+	}
+}
+
+// recordProfiles keeps the YAML of each profile for ApplyProfile
+func (c *Config) recordProfiles(root *yaml.Node) {
+	profiles := mappingValue(root, "profiles")
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return
+	}
+	c.profileNodes = make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		c.profileNodes[profiles.Content[i].Value] = profiles.Content[i+1]
+	}
+}
+
+// ProfileNames returns the names of the profiles defined in the config, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile merges the named profile over the config and validates the
+// result; an empty name leaves the config untouched.
+func (c *Config) ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	node, ok := c.profileNodes[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return fmt.Errorf("unknown profile '%s'; the config defines no profiles", name)
+		}
+		return fmt.Errorf("unknown profile '%s'; available profiles are %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	// Decoding onto the loaded values only replaces the keys the profile sets
+	if container := mappingValue(node, "container"); container != nil {
+		environment := c.Container.Environment
+		if err := container.Decode(&c.Container); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+		if mappingValue(container, "environment") != nil {
+			c.Container.Environment = mergeEnvironment(environment, c.Container.Environment)
+		}
+	}
+	if shell := mappingValue(node, "shell"); shell != nil {
+		if err := shell.Decode(&c.Shell); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", name, err)
+		}
+		// The profile's scripts replace the base ones and still need their files read
+		if scripts := mappingValue(shell, "scripts"); scripts != nil {
+			for i, item := range scripts.Content {
+				if i < len(c.Shell.Scripts) {
+					c.Shell.Scripts[i].line = item.Line
+				}
+			}
+			if err := c.loadScriptFiles(); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.profile = name
+	if err := validateConfig(c); err != nil {
+		return fmt.Errorf("profile '%s': %w", name, err)
+	}
+	return nil
+}
+
+// mergeEnvironment returns the base environment entries with the overrides
+// applied: an override replaces the base entry for the same variable in
+// place, and new variables are appended
+func mergeEnvironment(base, overrides []string) []string {
+	merged := append([]string{}, base...)
+	index := make(map[string]int, len(merged))
+	for i, entry := range merged {
+		key, _, _ := strings.Cut(entry, "=")
+		index[key] = i
+	}
+	for _, entry := range overrides {
+		key, _, _ := strings.Cut(entry, "=")
+		if i, ok := index[key]; ok {
+			merged[i] = entry
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// maxExtendsDepth caps how many configs a chain of extends may go through
+const maxExtendsDepth = 10
+
+// resolveExtends returns the root mapping of the config document read from
+// filePath, merged over the configs named in its 'extends' field. chain holds
+// the files extending this one, to detect cycles.
+func resolveExtends(document *yaml.Node, filePath string, chain []string) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(document.Content) > 0 {
+		root = document.Content[0]
+	}
+
+	paths, err := extendsPaths(mappingValue(root, "extends"), filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return root, nil
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config file '%s': %w", filePath, err)
+	}
+	chain = append(chain, absPath)
+	if len(chain) > maxExtendsDepth {
+		return nil, fmt.Errorf("config '%s' extends more than %d levels deep", chain[0], maxExtendsDepth)
+	}
+
+	var base *yaml.Node
+	for _, path := range paths {
+		for _, seen := range chain {
+			if seen == path {
+				return nil, fmt.Errorf("extends cycle: %s -> %s", strings.Join(chain, " -> "), path)
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config '%s' extends '%s', which was not found", filePath, path)
+		}
+		var parent yaml.Node
+		if err := yaml.Unmarshal(data, &parent); err != nil {
+			return nil, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+		}
+		parentRoot, err := resolveExtends(&parent, path, chain)
+		if err != nil {
+			return nil, err
+		}
+		rebaseConfigPaths(parentRoot, filepath.Dir(path), filepath.Dir(absPath))
+		base = mergeConfigNodes(base, withoutKey(parentRoot, "extends"), "")
+	}
+
+	return mergeConfigNodes(base, root, ""), nil
+}
+
+// rebaseConfigPaths rewrites the relative host paths in a config's YAML from
+// relative to dir from to relative to dir to, so the paths of a base config
+// keep pointing at its own files once merged into a config elsewhere.
+// container.copy sources are left alone: they must be in the project's build
+// context.
+func rebaseConfigPaths(root *yaml.Node, from, to string) {
+	rebaseSectionPaths(root, from, to)
+	if profiles := mappingValue(root, "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			rebaseSectionPaths(profiles.Content[i], from, to)
+		}
+	}
+}
+
+// rebaseSectionPaths rebases the paths of the container and shell sections
+// of root, a config or a profile
+func rebaseSectionPaths(root *yaml.Node, from, to string) {
+	rebase := func(node *yaml.Node) {
+		if node != nil && node.Kind == yaml.ScalarNode {
+			node.Value = rebasePath(node.Value, from, to)
+		}
+	}
+	// items returns the entries of a list, or a lone value as a list of one
+	items := func(node *yaml.Node) []*yaml.Node {
+		if node != nil && node.Kind == yaml.SequenceNode {
+			return node.Content
+		}
+		return []*yaml.Node{node}
+	}
+
+	if container := mappingValue(root, "container"); container != nil {
+		if mounts := mappingValue(container, "mounts"); mounts != nil && mounts.Kind == yaml.MappingNode {
+			for i := 1; i < len(mounts.Content); i += 2 {
+				rebase(mappingValue(mounts.Content[i], "host"))
+			}
+		}
+		for _, item := range items(mappingValue(container, "env_file")) {
+			rebase(item)
+		}
+		for _, item := range items(mappingValue(container, "volumes")) {
+			if item == nil || item.Kind != yaml.ScalarNode {
+				continue
+			}
+			source, target, options, err := parseVolumeSpec(item.Value)
+			if err != nil || isNamedVolume(source) {
+				continue
+			}
+			item.Value = rebasePath(source, from, to) + ":" + target
+			if options != "" {
+				item.Value += ":" + options
+			}
+		}
+		if build := mappingValue(container, "build"); build != nil {
+			rebase(mappingValue(build, "dockerfile"))
+			rebase(mappingValue(build, "context"))
+			if contexts := mappingValue(build, "contexts"); contexts != nil && contexts.Kind == yaml.MappingNode {
+				for i := 1; i < len(contexts.Content); i += 2 {
+					if !isRemoteBuildContext(contexts.Content[i].Value) {
+						rebase(contexts.Content[i])
+					}
+				}
+			}
+		}
+	}
+
+	if scripts := mappingValue(mappingValue(root, "shell"), "scripts"); scripts != nil && scripts.Kind == yaml.SequenceNode {
+		for _, script := range scripts.Content {
+			rebase(mappingValue(script, "file"))
+		}
+	}
+}
+
+// rebasePath returns value, a path relative to dir from, relative to dir to.
+// Empty, absolute and "~" paths are returned unchanged.
+func rebasePath(value, from, to string) string {
+	if value == "" || filepath.IsAbs(value) || strings.HasPrefix(value, "~") || from == to {
+		return value
+	}
+	target := filepath.Join(from, filepath.FromSlash(value))
+	if rel, err := filepath.Rel(to, target); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	// Paths on another Windows drive can't be made relative
+	return target
+}
+
+// extendsPaths returns the absolute paths of the configs named by an
+// 'extends' value, a path or a list of paths relative to filePath
+func extendsPaths(node *yaml.Node, filePath string) ([]string, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	var values []string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		values = []string{node.Value}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("invalid 'extends' in '%s': must be a path or a list of paths", filePath)
+			}
+			values = append(values, item.Value)
+		}
+	default:
+		return nil, fmt.Errorf("invalid 'extends' in '%s': must be a path or a list of paths", filePath)
+	}
+
+	paths := make([]string, 0, len(values))
+	for _, value := range values {
+		if value == "" {
+			return nil, fmt.Errorf("invalid 'extends' in '%s': empty path", filePath)
+		}
+		if strings.Contains(value, "://") {
+			return nil, fmt.Errorf("invalid 'extends' '%s' in '%s': only local files can be extended", value, filePath)
+		}
+		if !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(filePath), value)
+		}
+		absPath, err := filepath.Abs(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve extends '%s': %w", value, err)
+		}
+		paths = append(paths, absPath)
+	}
+	return paths, nil
+}
+
+// mergeConfigNodes merges the config YAML over over base: mappings merge by
+// key, values of over win, and lists are appended to, except scripts, where
+// a script replaces the base script of the same name. key is the mapping key
+// holding the nodes.
+func mergeConfigNodes(base, over *yaml.Node, key string) *yaml.Node {
+	if base == nil {
+		return over
+	}
+	if over == nil {
+		return base
+	}
+
+	switch {
+	case base.Kind == yaml.MappingNode && over.Kind == yaml.MappingNode:
+		merged := *over
+		merged.Content = append([]*yaml.Node{}, base.Content...)
+		for i := 0; i+1 < len(over.Content); i += 2 {
+			name := over.Content[i].Value
+			replaced := false
+			for j := 0; j+1 < len(merged.Content); j += 2 {
+				if merged.Content[j].Value == name {
+					merged.Content[j+1] = mergeConfigNodes(merged.Content[j+1], over.Content[i+1], name)
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				merged.Content = append(merged.Content, over.Content[i], over.Content[i+1])
+			}
+		}
+		return &merged
+
+	case base.Kind == yaml.SequenceNode && over.Kind == yaml.SequenceNode:
+		merged := *over
+		merged.Content = append([]*yaml.Node{}, base.Content...)
+		for _, item := range over.Content {
+			if key == "scripts" {
+				if name := mappingValue(item, "name"); name != nil {
+					if i := scriptNodeIndex(merged.Content, name.Value); i >= 0 {
+						merged.Content[i] = item
+						continue
+					}
+				}
+			}
+			merged.Content = append(merged.Content, item)
+		}
+		return &merged
+	}
+
+	return over
+}
+
+// scriptNodeIndex returns the index of the script called name in items, or -1
+func scriptNodeIndex(items []*yaml.Node, name string) int {
+	for i, item := range items {
+		if value := mappingValue(item, "name"); value != nil && value.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// withoutKey returns a copy of a mapping node without key
+func withoutKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return node
+	}
+	copied := *node
+	copied.Content = nil
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != key {
+			copied.Content = append(copied.Content, node.Content[i], node.Content[i+1])
+		}
+	}
+	return &copied
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// location describes where the script is defined, for error messages
+func (s *Script) location() string {
+	if s.line == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (line %d)", s.line)
+}
+
+// validateScriptNames rejects duplicate script names, which GetScript would
+// silently ignore, and names reserved by the in-container wrapper
+func validateScriptNames(scripts []Script) error {
+	defined := make(map[string]*Script)
+	for i := range scripts {
+		script := &scripts[i]
+		for _, reserved := range reservedScriptNames {
+			if script.Name == reserved {
+				return fmt.Errorf("script name '%s'%s is reserved; reserved names are %s", script.Name, script.location(), strings.Join(reservedScriptNames, ", "))
+			}
+		}
+
+		if first, exists := defined[script.Name]; exists {
+			if script.line > 0 && first.line > 0 {
+				return fmt.Errorf("duplicate script name '%s' (line %d, first defined on line %d)", script.Name, script.line, first.line)
+			}
+			return fmt.Errorf("duplicate script name '%s'", script.Name)
+		}
+		defined[script.Name] = script
+	}
+	return nil
+}
+
+// loadScriptFiles reads the body of scripts defined with 'file', resolved
+// against the config directory
+func (c *Config) loadScriptFiles() error {
+	for i := range c.Shell.Scripts {
+		script := &c.Shell.Scripts[i]
+		if script.File == "" {
+			continue
+		}
+		if len(script.Commands) > 0 {
+			return fmt.Errorf("script '%s' sets both 'file' and 'commands'", script.Name)
+		}
+
+		data, err := os.ReadFile(c.resolvePath(script.File))
+		if err != nil {
+			return fmt.Errorf("script '%s' file '%s' not found", script.Name, script.File)
+		}
+		script.Commands = []string{strings.TrimRight(string(data), "\n")}
+	}
+	return nil
+}
+
+// unknownFieldPattern matches the yaml.v3 error for a key with no config field
+var unknownFieldPattern = regexp.MustCompile(`^line (\d+): field (.+) not found in type \S+$`)
+
+// ValidateConfigFile checks a config file without building anything. Besides
+// the checks LoadConfigFromFile applies, it reports unknown keys and script
+// problems the loader tolerates: empty scripts, broken depends_on and names
+// in reservedNames, such as the CLI's own commands. It
+// returns every problem found, or nil for a valid file.
+func ValidateConfigFile(filePath string, reservedNames []string) []error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return []error{fmt.Errorf("failed to read config file '%s': %w", filePath, err)}
+	}
+
+	var problems []error
+
+	// Strict decoding catches typos like "scirpts:" that Unmarshal ignores
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var strict Config
+	if err := decoder.Decode(&strict); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return []error{fmt.Errorf("failed to parse config file '%s': %w", filePath, err)}
+		}
+		for _, message := range typeErr.Errors {
+			if match := unknownFieldPattern.FindStringSubmatch(message); match != nil {
+				message = fmt.Sprintf("line %s: unknown field '%s'", match[1], match[2])
+			}
+			problems = append(problems, errors.New(message))
+		}
+	}
+
+	config, err := LoadConfigFromFile(filePath)
+	if err != nil {
+		return append(problems, err)
+	}
+
+	baseProblems := config.lintScripts(reservedNames)
+	problems = append(problems, baseProblems...)
+	reported := make(map[string]bool, len(baseProblems))
+	for _, problem := range baseProblems {
+		reported[problem.Error()] = true
+	}
+
+	// Each profile has to produce a valid config of its own; problems it
+	// inherits from the base config are only reported once
+	for _, name := range config.ProfileNames() {
+		profile, err := LoadConfigFromFile(filePath)
+		if err == nil {
+			err = profile.ApplyProfile(name)
+		}
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		for _, problem := range profile.lintScripts(reservedNames) {
+			if reported[problem.Error()] {
+				continue
+			}
+			problems = append(problems, fmt.Errorf("profile '%s': %w", name, problem))
+		}
+	}
+
+	return problems
+}
+
+// lintScripts reports script definitions that load fine but can't work as
+// intended
+func (c *Config) lintScripts(reservedNames []string) []error {
+	var problems []error
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	reserved := make(map[string]bool, len(reservedNames))
+	for _, name := range reservedNames {
+		reserved[name] = true
+	}
+
+	chainErrors := make(map[string]bool)
+	for i, script := range c.Shell.Scripts {
+		if script.Name == "" {
+			report("script #%d has no name", i+1)
+			continue
+		}
+		if reserved[script.Name] {
+			report("script '%s' has the same name as the built-in '%s' command", script.Name, script.Name)
+		}
+		if len(script.Commands) == 0 && len(script.DependsOn) == 0 {
+			report("script '%s' has no commands", script.Name)
+		}
+		for j, command := range script.Commands {
+			if strings.TrimSpace(command) == "" {
+				report("script '%s' command #%d is empty", script.Name, j+1)
+			}
+		}
+
+		// Identical dependency errors are reported once
+		if _, err := c.scriptChain(script.Name); err != nil && !chainErrors[err.Error()] {
+			chainErrors[err.Error()] = true
+			problems = append(problems, err)
+		}
+	}
+
+	return problems
+}
+
+// FormatConfig rewrites config file data into the canonical form applied by
+// "config lint --fix": a normalized name, the default provider spelled out
+// unless the config extends another, keys in the order of the config reference and the old "cmds" key renamed
+// to "commands". Comments are kept. It returns a description of each change
+// made, and data untouched when there are none.
+func FormatConfig(data []byte) ([]byte, []string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("config file must be a YAML mapping")
+	}
+	root := document.Content[0]
+
+	var changes []string
+	if name := mappingValue(root, "name"); name != nil && name.Kind == yaml.ScalarNode && name.Value != "" {
+		if normalized := NormalizeName(name.Value); normalized != name.Value {
+			changes = append(changes, fmt.Sprintf("normalized name '%s' to '%s'", name.Value, normalized))
+			name.Value = normalized
+		}
+	}
+
+	// A config that extends others may get its provider from them
+	container := mappingValue(root, "container")
+	if container != nil && container.Kind == yaml.MappingNode && mappingValue(root, "extends") == nil {
+		provider := mappingValue(container, "provider")
+		if provider == nil {
+			provider = &yaml.Node{Kind: yaml.ScalarNode}
+			container.Content = append([]*yaml.Node{{Kind: yaml.ScalarNode, Value: "provider"}, provider}, container.Content...)
+		}
+		if provider.Kind == yaml.ScalarNode && provider.Value == "" {
+			provider.Tag, provider.Value = "!!str", "docker"
+			changes = append(changes, "set container.provider to the default 'docker'")
+		}
+	}
+
+	if scripts := mappingValue(mappingValue(root, "shell"), "scripts"); scripts != nil && scripts.Kind == yaml.SequenceNode {
+		for i, script := range scripts.Content {
+			if script.Kind != yaml.MappingNode || mappingValue(script, "commands") != nil {
+				continue
+			}
+			for j := 0; j+1 < len(script.Content); j += 2 {
+				if key := script.Content[j]; key.Value == "cmds" {
+					key.Value = "commands"
+					name := fmt.Sprintf("#%d", i+1)
+					if value := mappingValue(script, "name"); value != nil && value.Value != "" {
+						name = "'" + value.Value + "'"
+					}
+					changes = append(changes, fmt.Sprintf("renamed 'cmds' to 'commands' in script %s", name))
+				}
+			}
+		}
+	}
+
+	changes = append(changes, sortKeys(root, reflect.TypeOf(Config{}), "")...)
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, nil, fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write config file: %w", err)
+	}
+	return buf.Bytes(), changes, nil
+}
+
+// sortKeys orders the keys of a mapping node like the fields of t, which is
+// the order the config reference documents them in, and recurses into nested
+// settings. Unknown keys keep their relative order after the known ones. It
+// returns a change for each mapping reordered, named by its path.
+func sortKeys(node *yaml.Node, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var changes []string
+	switch {
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for i, item := range node.Content {
+			changes = append(changes, sortKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			changes = append(changes, sortKeys(node.Content[i+1], t.Elem(), path+"."+node.Content[i].Value)...)
+		}
+
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := make(map[string]int)
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if t.Field(i).IsExported() && name != "" && name != "-" {
+				fields[name] = i
+			}
+		}
+
+		type entry struct {
+			key, value *yaml.Node
+			rank       int
+		}
+		entries := make([]entry, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			rank := t.NumField()
+			if index, ok := fields[key.Value]; ok {
+				rank = index
+				child := key.Value
+				if path != "" {
+					child = path + "." + key.Value
+				}
+				changes = append(changes, sortKeys(value, t.Field(index).Type, child)...)
+			}
+			entries = append(entries, entry{key, value, rank})
+		}
+
+		less := func(i, j int) bool { return entries[i].rank < entries[j].rank }
+		if !sort.SliceIsSorted(entries, less) {
+			first := entries[0].key
+			sort.SliceStable(entries, less)
+			// A comment at the top of the file is a header, not the first key's
+			if path == "" && entries[0].key.HeadComment == "" {
+				entries[0].key.HeadComment, first.HeadComment = first.HeadComment, ""
+			}
+			node.Content = node.Content[:0]
+			for _, entry := range entries {
+				node.Content = append(node.Content, entry.key, entry.value)
+			}
+			if path == "" {
+				changes = append(changes, "reordered the top-level keys")
+			} else {
+				changes = append(changes, fmt.Sprintf("reordered the keys of %s", path))
+			}
+		}
+	}
+	return changes
+}
+
+// validateConfig applies defaults and validates a parsed configuration
+func validateConfig(config *Config) error {
+	// Set defaults
+	if config.Container.Provider == "" {
+		config.Container.Provider = "docker"
+	}
+
+	// Validate container provider
+	switch config.Container.Provider {
+	case "docker", "podman", "nerdctl":
+	default:
+		return fmt.Errorf("invalid provider: %s. Must be 'docker', 'podman' or 'nerdctl'", config.Container.Provider)
+	}
+
+	// Validate that either image or build is specified
+	if config.Container.Image == "" && config.Container.Build == nil {
+		return fmt.Errorf("either 'container.image' or 'container.build' must be specified")
+	}
+
+	if strings.HasPrefix(config.Container.Context, "-") || strings.ContainsAny(config.Container.Context, " \t\n") {
+		return fmt.Errorf("invalid 'container.context' '%s': must be a context or connection name", config.Container.Context)
+	}
+
+	if shell := config.Container.Shell; shell != "" && (!strings.HasPrefix(shell, "/") || strings.ContainsAny(shell, " \t\n")) {
+		return fmt.Errorf("invalid 'container.shell' '%s': must be an absolute path to a shell binary", shell)
+	}
+
+	if config.Container.Workdir != "" && !strings.HasPrefix(config.Container.Workdir, "/") {
+		return fmt.Errorf("invalid 'container.workdir' '%s': must be an absolute container path", config.Container.Workdir)
+	}
+
+	if user := config.Container.User; strings.HasPrefix(user, "-") || strings.ContainsAny(user, " \t\n") {
+		return fmt.Errorf("invalid 'container.user' '%s': must be uid[:gid], a user name or '%s'", user, UserHost)
+	}
+
+	if err := config.validateTagFormat(); err != nil {
+		return err
+	}
+
+	if config.Container.Image != "" {
+		if err := validateImageRef(config.Container.Image); err != nil {
+			return fmt.Errorf("invalid 'container.image': %w", err)
+		}
+	}
+
+	if config.Container.BuildRetries < 0 {
+		return fmt.Errorf("'container.build_retries' must not be negative")
+	}
+
+	// A pulled image is used as it is, so nothing may be built on top of it
+	if config.Container.Pull {
+		if config.Container.Image == "" {
+			return fmt.Errorf("'container.pull' requires 'container.image'")
+		}
+		var changes []string
+		if config.Container.Build != nil {
+			changes = append(changes, "build")
+		}
+		if len(config.Container.Copy) > 0 {
+			changes = append(changes, "copy")
+		}
+		if len(config.Container.Setup) > 0 {
+			changes = append(changes, "setup")
+		}
+		if len(config.Container.Verify) > 0 {
+			changes = append(changes, "verify")
+		}
+		if len(changes) > 0 {
+			return fmt.Errorf("'container.pull' runs the image as it is; remove 'container.%s' or 'container.pull'", strings.Join(changes, "', 'container."))
+		}
+	}
+
+	// Validate build configuration if present
+	if config.Container.Build != nil {
+		if config.Container.Build.Dockerfile == "" {
+			return fmt.Errorf("'container.build.dockerfile' is required when using custom build")
+		}
+		if config.Container.Build.Context == "" {
+			config.Container.Build.Context = "."
+		}
+		for key := range config.Container.Build.Labels {
+			if key == "" {
+				return fmt.Errorf("'container.build.labels' keys must not be empty")
+			}
+		}
+		for name, value := range config.Container.Build.Contexts {
+			if name == "" || value == "" {
+				return fmt.Errorf("'container.build.contexts' entries require a name and a path")
+			}
+		}
+	}
+
+	for name, mount := range config.Container.Mounts {
+		if name == "" || mount.Host == "" || mount.Path == "" {
+			return fmt.Errorf("'container.mounts' entries require a name, 'host' and 'path'")
+		}
+		if !strings.HasPrefix(mount.Path, "/") {
+			return fmt.Errorf("invalid 'container.mounts.%s' path '%s': must be an absolute container path", name, mount.Path)
+		}
+		if path.Clean(mount.Path) == path.Clean(config.workdir()) {
+			return fmt.Errorf("invalid 'container.mounts.%s' path: %s is reserved for the project", name, config.workdir())
+		}
+	}
+
+	if err := validateEnvironment(config.Container.Environment); err != nil {
+		return fmt.Errorf("invalid 'container.environment' entry: %w", err)
+	}
+
+	for _, prefix := range config.Container.PassEnvPrefix {
+		if !envKeyPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid 'container.pass_env_prefix' entry '%s': must be the start of a variable name", prefix)
+		}
+	}
+
+	if err := validatePorts(config.Container.Ports); err != nil {
+		return fmt.Errorf("invalid 'container.ports': %w", err)
+	}
+
+	if err := validateNetwork(&config.Container); err != nil {
+		return fmt.Errorf("invalid 'container.network': %w", err)
+	}
+
+	if err := validateGPUs(config.Container.GPUs); err != nil {
+		return fmt.Errorf("invalid 'container.gpus': %w", err)
+	}
+
+	for _, file := range config.Container.EnvFile {
+		if file == "" {
+			return fmt.Errorf("'container.env_file' entries must not be empty")
+		}
+	}
+
+	for _, spec := range config.Container.Volumes {
+		if _, _, _, err := parseVolumeSpec(spec); err != nil {
+			return fmt.Errorf("invalid 'container.volumes' entry: %w", err)
+		}
+	}
+
+	// Validate copy entries; sources must stay inside the build context
+	for _, entry := range config.Container.Copy {
+		if entry.Src == "" || entry.Dest == "" {
+			return fmt.Errorf("'container.copy' entries require both 'src' and 'dest'")
+		}
+		if !filepath.IsLocal(entry.Src) {
+			return fmt.Errorf("invalid 'container.copy' source '%s': must be a relative path inside the build context", entry.Src)
+		}
+	}
+
+	if err := validateScriptNames(config.Shell.Scripts); err != nil {
+		return err
+	}
+
+	for _, script := range config.Shell.Scripts {
+		for _, hostOS := range script.OS {
+			switch hostOS {
+			case "linux", "darwin", "windows":
+			default:
+				return fmt.Errorf("invalid 'os' '%s' for script '%s': must be 'linux', 'darwin' or 'windows'", hostOS, script.Name)
+			}
+		}
+	}
+
+	// Validate startup failure policy
+	if config.Shell.StartupPolicy == "" {
+		config.Shell.StartupPolicy = StartupPolicyStrict
+	}
+	switch config.Shell.StartupPolicy {
+	case StartupPolicyStrict, StartupPolicyContinue, StartupPolicyPrompt:
+	default:
+		return fmt.Errorf("invalid startup_policy: %s. Must be '%s', '%s' or '%s'",
+			config.Shell.StartupPolicy, StartupPolicyStrict, StartupPolicyContinue, StartupPolicyPrompt)
+	}
+
+	// Validate interactive shell mode
+	switch config.Shell.Interactive {
+	case "", InteractiveShellSh, InteractiveShellAuto:
+	default:
+		return fmt.Errorf("invalid shell.interactive: %s. Must be '%s' or '%s'",
+			config.Shell.Interactive, InteractiveShellSh, InteractiveShellAuto)
+	}
+
+	for _, flag := range strings.Fields(config.Shell.Flags) {
+		if !shellFlagPattern.MatchString(flag) {
+			return fmt.Errorf("invalid shell.flags: %s. Must be sh options from -%s, e.g. -eu", flag, shellFlagLetters)
+		}
+	}
+
+	return nil
+}
+
+// shellFlagLetters are the sh options allowed in shell.flags: allexport,
+// noclobber, errexit, noglob, nounset, verbose and xtrace
+const shellFlagLetters = "aCefuvx"
+
+// shellFlagPattern matches one shell.flags entry, e.g. "-e" or "-eu"
+var shellFlagPattern = regexp.MustCompile(`^-[` + shellFlagLetters + `]+$`)
+
+// shellCommand returns the command running script with sh and the
+// shell.flags options
+func (c *Config) shellCommand(script string) []string {
+	command := append([]string{"/bin/sh"}, strings.Fields(c.Shell.Flags)...)
+	return append(command, "-c", script)
+}
+
+// GetConfigHash calculates a hash of the configuration file
+func GetConfigHash() (string, error) {
+	return GetConfigHashFromFile(ConfigFileName)
+}
+
+// GetConfigHashFromFile calculates a hash of the configuration loaded from
+// the specified file
+func GetConfigHashFromFile(filePath string) (string, error) {
+	config, err := LoadConfigFromFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return config.hash()
+}
+
+// imageConfig holds the settings that go into the image. Runtime settings
+// such as environment, ports, mounts or network are left out, so changing
+// them, in the file or from the command line, reuses the same image.
+type imageConfig struct {
+	Name     string          `yaml:"name"`
+	Provider string          `yaml:"provider"`
+	Image    string          `yaml:"image,omitempty"`
+	Build    *ContainerBuild `yaml:"build,omitempty"`
+	Copy     []CopyEntry     `yaml:"copy,omitempty"`
+	Setup    []string        `yaml:"setup,omitempty"`
+	Verify   []string        `yaml:"verify,omitempty"`
+	Pull     bool            `yaml:"pull,omitempty"`
+	Workdir  string          `yaml:"workdir,omitempty"`
+	// Scripts count too, with the contents of script files, so a project's
+	// image follows the commands it's used with
+	Scripts []Script `yaml:"scripts,omitempty"`
+}
+
+// hash returns a short hash of the resolved image settings: the values in
+// effect after profiles, overrides and script files are applied, rather than
+// the bytes of the file, so comments and formatting don't matter while a
+// different profile or provider always does. Only the settings in
+// imageConfig count, and the profiles themselves are left out, so editing
+// an unselected one doesn't affect the tag.
+func (c *Config) hash() (string, error) {
+	image := imageConfig{
+		Name:     c.Name,
+		Provider: c.Container.Provider,
+		Image:    c.Container.Image,
+		Build:    c.Container.Build,
+		Copy:     c.Container.Copy,
+		Setup:    c.Container.Setup,
+		Verify:   c.Container.Verify,
+		Pull:     c.Container.Pull,
+		Workdir:  c.Container.Workdir,
+		Scripts:  c.Shell.Scripts,
+	}
+
+	// yaml.v3 writes struct fields in order and map keys sorted, a stable form
+	data, err := yaml.Marshal(&image)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate hash: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%x", sum)[:12], nil
+}
+
+// OverrideDockerfile builds from the given Dockerfile instead of the configured one.
+// An image-based configuration is switched into build mode.
+func (c *Config) OverrideDockerfile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("dockerfile '%s' not found", path)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve dockerfile '%s': %w", path, err)
+	}
+
+	if c.Container.Build == nil {
+		c.Container.Build = &ContainerBuild{Context: "."}
+	}
+	c.Container.Build.Dockerfile = absPath
+	// The Dockerfile is built instead of pulling container.image
+	c.Container.Pull = false
+
+	return nil
+}
+
+// ApplyOverrides sets config fields from "key=value" overrides and validates
+// the result. Keys are dotted YAML field names with optional list indices,
+// e.g. "container.image=ubuntu:22.04" or "container.setup[0]=apk add git";
+// an index one past the end appends.
+func (c *Config) ApplyOverrides(overrides []string) error {
+	for _, override := range overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid override '%s': expected key=value", override)
+		}
+		if err := setConfigField(reflect.ValueOf(c).Elem(), strings.Split(key, "."), value); err != nil {
+			return fmt.Errorf("invalid override '%s': %w", override, err)
+		}
+	}
+
+	return validateConfig(c)
+}
+
+// setConfigField walks path through v by YAML field name and assigns value
+func setConfigField(v reflect.Value, path []string, value string) error {
+	name, index, err := parseOverrideKey(path[0])
+	if err != nil {
+		return err
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	var field reflect.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if tag == name {
+				field = v.Field(i)
+				break
+			}
+		}
+	case reflect.Map:
+		if len(path) > 1 || index >= 0 || v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("'%s' must be the last key", name)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(value))
+		return nil
+	}
+	if !field.IsValid() {
+		return fmt.Errorf("unknown key '%s'", name)
+	}
+
+	if index >= 0 {
+		if field.Kind() != reflect.Slice {
+			return fmt.Errorf("'%s' is not a list", name)
+		}
+		switch {
+		case index == field.Len():
+			field.Set(reflect.Append(field, reflect.Zero(field.Type().Elem())))
+		case index > field.Len():
+			return fmt.Errorf("index %d out of range for '%s' (length %d)", index, name, field.Len())
+		}
+		field = field.Index(index)
+	}
+
+	if len(path) > 1 {
+		return setConfigField(field, path[1:], value)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' expects true or false", name)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' expects a number", name)
+		}
+		field.SetInt(int64(n))
+	default:
+		return fmt.Errorf("'%s' cannot be set directly; set one of its entries instead", name)
+	}
+
+	return nil
+}
+
+// parseOverrideKey splits "name[3]" into its name and index; index is -1 when absent
+func parseOverrideKey(segment string) (string, int, error) {
+	name, rest, ok := strings.Cut(segment, "[")
+	if !ok {
+		return segment, -1, nil
+	}
+
+	index, err := strconv.Atoi(strings.TrimSuffix(rest, "]"))
+	if err != nil || !strings.HasSuffix(rest, "]") || index < 0 {
+		return "", 0, fmt.Errorf("invalid list index in '%s'", segment)
+	}
+	return name, index, nil
+}
+
+// resolvePath resolves a path from the config relative to the config file's directory
+func (c *Config) resolvePath(path string) string {
+	if c.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
+// buildContextArgs returns the --build-context arguments for the named
+// build contexts, sorted by name. Local paths are resolved against the config
+// directory and must exist.
+func (c *Config) buildContextArgs() ([]string, error) {
+	contexts := c.Container.Build.Contexts
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		value := contexts[name]
+		if !isRemoteBuildContext(value) {
+			value = c.resolvePath(value)
+			if _, err := os.Stat(value); err != nil {
+				return nil, fmt.Errorf("build context '%s' path '%s' not found", name, value)
+			}
+		}
+		args = append(args, "--build-context", name+"="+value)
+	}
+
+	return args, nil
+}
+
+// mountArgs returns the -v arguments for container.mounts, sorted by name.
+// Host paths are resolved against the config directory and must exist.
+func (c *Config) mountArgs() ([]string, error) {
+	mounts := c.Container.Mounts
+	names := make([]string, 0, len(mounts))
+	for name := range mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		mount := mounts[name]
+		host, err := expandHome(mount.Host)
+		if err != nil {
+			return nil, fmt.Errorf("mount '%s': %w", name, err)
+		}
+		host = c.resolvePath(host)
+		if _, err := os.Stat(host); err != nil {
+			return nil, fmt.Errorf("mount '%s' host path '%s' not found", name, host)
+		}
+
+		spec := c.hostMountPath(host) + ":" + mount.Path
+		if mount.ReadOnly {
+			spec += ":ro"
+		}
+		args = append(args, "-v", spec)
+	}
+
+	return args, nil
+}
+
+// envKeyPattern matches environment variable names
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnvironment checks that KEY=VALUE or KEY entries have valid names
+func validateEnvironment(entries []string) error {
+	for _, entry := range entries {
+		key, _, _ := strings.Cut(entry, "=")
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("'%s' must be KEY=VALUE or KEY with a valid variable name", entry)
+		}
+	}
+	return nil
+}
+
+// AddEnvironment appends KEY=VALUE or KEY entries, e.g. from --env, to
+// container.environment
+func (c *Config) AddEnvironment(entries []string) error {
+	if err := validateEnvironment(entries); err != nil {
+		return fmt.Errorf("invalid --env: %w", err)
+	}
+	c.Container.Environment = append(c.Container.Environment, entries...)
+	return nil
+}
+
+// validatePorts checks port specs and rejects host ports published twice
+func validatePorts(specs []string) error {
+	hostPorts := make(map[string]string)
+	for _, spec := range specs {
+		mapping, proto, _ := strings.Cut(spec, "/")
+		switch proto {
+		case "", "tcp", "udp", "sctp":
+		default:
+			return fmt.Errorf("'%s' has unknown protocol '%s'", spec, proto)
+		}
+		if proto == "" {
+			proto = "tcp"
+		}
+
+		parts := strings.Split(mapping, ":")
+		if len(parts) > 3 {
+			return fmt.Errorf("'%s' must be 'container', 'host:container' or 'ip:host:container'", spec)
+		}
+		ports := parts
+		if len(parts) == 3 {
+			ports = parts[1:]
+		}
+		for _, port := range ports {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("'%s' has invalid port '%s'", spec, port)
+			}
+		}
+
+		// A bare container port is published on a random host port
+		if len(parts) == 1 {
+			continue
+		}
+		key := strings.Join(parts[:len(parts)-1], ":") + "/" + proto
+		if previous, ok := hostPorts[key]; ok {
+			return fmt.Errorf("host port in '%s' is already published by '%s'", spec, previous)
+		}
+		hostPorts[key] = spec
+	}
+	return nil
+}
+
+// validateNetwork checks container.network, rejecting values that can't be a
+// network mode and modes that conflict with other container settings. Other
+// values, e.g. podman's slirp4netns, are left to the engine.
+func validateNetwork(container *Container) error {
+	network := container.Network
+	if network == "" {
+		return nil
+	}
+	if strings.HasPrefix(network, "-") || strings.IndexFunc(network, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("'%s' must be bridge, host, none, container:<name> or a network name", network)
+	}
+
+	name, shared := strings.CutPrefix(network, "container:")
+	if shared && name == "" {
+		return fmt.Errorf("'%s' must name the container whose network is shared", network)
+	}
+	// The engine only adds hosts and publishes ports on a network of its own
+	if container.HostGateway && (shared || network == "host") {
+		return fmt.Errorf("'%s' can't be combined with 'container.host_gateway'", network)
+	}
+	if shared && len(container.Ports) > 0 {
+		return fmt.Errorf("'%s' can't be combined with published ports", network)
+	}
+	return nil
 }
 
-// Container represents the container configuration
-type Container struct {
-	Provider string          `yaml:"provider"`
-	Image    string          `yaml:"image,omitempty"`
-	Build    *ContainerBuild `yaml:"build,omitempty"`
-	Setup    []string        `yaml:"setup,omitempty"`
+// gpuDevicesPattern matches a GPU selection by device index or UUID
+var gpuDevicesPattern = regexp.MustCompile(`^device=[A-Za-z0-9-]+(,[A-Za-z0-9-]+)*$`)
+
+// validateGPUs checks a container.gpus value: "all", a count or devices
+func validateGPUs(gpus string) error {
+	if gpus == "" || gpus == "all" || gpuDevicesPattern.MatchString(gpus) {
+		return nil
+	}
+	if n, err := strconv.Atoi(gpus); err == nil && n > 0 {
+		return nil
+	}
+	return fmt.Errorf("'%s' must be all, a number of GPUs or device=<id>[,<id>...]", gpus)
 }
 
-// ContainerBuild represents custom image build configuration
-type ContainerBuild struct {
-	Dockerfile string            `yaml:"dockerfile"`
-	Context    string            `yaml:"context,omitempty"`
-	Args       map[string]string `yaml:"args,omitempty"`
+// SetGPUs replaces container.gpus, e.g. from --gpus
+func (c *Config) SetGPUs(gpus string) error {
+	if err := validateGPUs(gpus); err != nil {
+		return fmt.Errorf("invalid --gpus: %w", err)
+	}
+	c.Container.GPUs = gpus
+	return nil
 }
 
-// Shell represents the shell configuration
-type Shell struct {
-	InitHook []string `yaml:"startup"`
-	Scripts  []Script `yaml:"scripts"`
+// SetNetwork replaces container.network, e.g. from --network
+func (c *Config) SetNetwork(network string) error {
+	container := c.Container
+	container.Network = network
+	if err := validateNetwork(&container); err != nil {
+		return fmt.Errorf("invalid --network: %w", err)
+	}
+	c.Container.Network = network
+	return nil
 }
 
-// Script represents a shell script
-type Script struct {
-	Name        string   `yaml:"name"`
-	Description string   `yaml:"description,omitempty"`
-	Commands    []string `yaml:"commands"`
+// AddPorts appends port specs, e.g. from --port, to container.ports
+func (c *Config) AddPorts(specs []string) error {
+	ports := append(append([]string{}, c.Container.Ports...), specs...)
+	if err := validatePorts(ports); err != nil {
+		return fmt.Errorf("invalid --port: %w", err)
+	}
+	c.Container.Ports = ports
+	return nil
 }
 
-// ConfigExists checks if the configuration file exists in the current directory
-func ConfigExists() bool {
-	_, err := os.Stat(ConfigFileName)
-	return err == nil
+// cachePresets maps --cache names to named volumes for each language's
+// package and build caches, at the paths the official images use
+var cachePresets = map[string][]string{
+	"go":     {"miko-shell-go-mod:/go/pkg/mod", "miko-shell-go-build:/root/.cache/go-build"},
+	"node":   {"miko-shell-npm:/root/.npm"},
+	"yarn":   {"miko-shell-yarn:/usr/local/share/.cache/yarn"},
+	"pip":    {"miko-shell-pip:/root/.cache/pip"},
+	"cargo":  {"miko-shell-cargo-registry:/usr/local/cargo/registry", "miko-shell-cargo-git:/usr/local/cargo/git"},
+	"maven":  {"miko-shell-maven:/root/.m2"},
+	"gradle": {"miko-shell-gradle:/root/.gradle"},
 }
 
-// LoadConfig loads the configuration from miko-shell.yaml
-func LoadConfig() (*Config, error) {
-	if !ConfigExists() {
-		return nil, fmt.Errorf("miko-shell.yaml not found. Run 'miko-shell init' first")
+// CachePresets returns the names accepted by AddCachePresets, sorted
+func CachePresets() []string {
+	names := make([]string, 0, len(cachePresets))
+	for name := range cachePresets {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	data, err := os.ReadFile(ConfigFileName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+// AddCachePresets appends the volumes of the named cache presets, e.g. from
+// --cache, to container.volumes. A path that is already mounted keeps its
+// existing volume, so presets compose with each other and with the config.
+func (c *Config) AddCachePresets(names []string) error {
+	mounted := make(map[string]bool)
+	for _, spec := range c.Container.Volumes {
+		if _, target, _, err := parseVolumeSpec(spec); err == nil {
+			mounted[target] = true
+		}
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	for _, name := range names {
+		specs, ok := cachePresets[name]
+		if !ok {
+			return fmt.Errorf("invalid --cache: unknown preset '%s'; available presets are %s", name, strings.Join(CachePresets(), ", "))
+		}
+		for _, spec := range specs {
+			_, target, _, _ := parseVolumeSpec(spec)
+			if mounted[target] {
+				continue
+			}
+			mounted[target] = true
+			c.Container.Volumes = append(c.Container.Volumes, spec)
+		}
 	}
+	return nil
+}
 
-	// Set defaults
-	if config.Container.Provider == "" {
-		config.Container.Provider = "docker"
+// autoEnvFile is the dotenv file container.auto_env loads from the config directory
+const autoEnvFile = ".env"
+
+// envFileArgs returns the --env-file arguments for container.env_file. Paths
+// are resolved against the config directory and must exist. With
+// container.auto_env, an existing .env in that directory comes first so every
+// other source overrides it.
+func (c *Config) envFileArgs() ([]string, error) {
+	var args []string
+	if c.Container.AutoEnv {
+		path := c.resolvePath(autoEnvFile)
+		listed := false
+		for _, file := range c.Container.EnvFile {
+			if filepath.Clean(c.resolvePath(file)) == filepath.Clean(path) {
+				listed = true
+			}
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && !listed {
+			args = append(args, "--env-file", path)
+		}
 	}
 
-	// Validate container provider
-	if config.Container.Provider != "docker" && config.Container.Provider != "podman" {
-		return nil, fmt.Errorf("invalid provider: %s. Must be 'docker' or 'podman'", config.Container.Provider)
+	for _, file := range c.Container.EnvFile {
+		path := c.resolvePath(file)
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("env file '%s' not found", path)
+		}
+		args = append(args, "--env-file", path)
 	}
+	return args, nil
+}
 
-	// Validate that either image or build is specified
-	if config.Container.Image == "" && config.Container.Build == nil {
-		return nil, fmt.Errorf("either 'container.image' or 'container.build' must be specified")
+// passEnvArgs returns "-e KEY" arguments for the variables in environ whose
+// names start with a container.pass_env_prefix entry. Only the names are
+// passed, so the provider reads the values from the host environment and they
+// never appear on the command line.
+func (c *Config) passEnvArgs(environ []string) []string {
+	var names []string
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		for _, prefix := range c.Container.PassEnvPrefix {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+				break
+			}
+		}
 	}
+	sort.Strings(names)
 
-	// Validate build configuration if present
-	if config.Container.Build != nil {
-		if config.Container.Build.Dockerfile == "" {
-			return nil, fmt.Errorf("'container.build.dockerfile' is required when using custom build")
+	var args []string
+	for _, name := range names {
+		args = append(args, "-e", name)
+	}
+	return args
+}
+
+// userArgs returns the --user argument for container.user, resolving
+// UserHost to the host uid:gid. Hosts without uids, like Windows, keep the
+// image's default user.
+func (c *Config) userArgs() []string {
+	user := c.Container.User
+	if user == UserHost {
+		uid, gid := os.Getuid(), os.Getgid()
+		if uid < 0 || gid < 0 {
+			return nil
 		}
-		if config.Container.Build.Context == "" {
-			config.Container.Build.Context = "."
+		user = fmt.Sprintf("%d:%d", uid, gid)
+	}
+	if user == "" {
+		return nil
+	}
+	return []string{"--user", user}
+}
+
+// volumeOptions are the mount options accepted in container.volumes
+var volumeOptions = map[string]bool{"ro": true, "rw": true, "z": true, "Z": true, "cached": true, "delegated": true}
+
+// parseVolumeSpec splits a "source:target[:options]" volume spec
+func parseVolumeSpec(spec string) (source, target, options string, err error) {
+	// The ':' of a Windows drive letter doesn't separate the source
+	drive, rest := "", spec
+	if windowsDrivePath.MatchString(spec) {
+		drive, rest = spec[:2], spec[2:]
+	}
+	parts := strings.Split(rest, ":")
+	parts[0] = drive + parts[0]
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("'%s' must be 'source:target[:options]'", spec)
+	}
+	if !strings.HasPrefix(parts[1], "/") {
+		return "", "", "", fmt.Errorf("'%s' target must be an absolute container path", spec)
+	}
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			if !volumeOptions[option] {
+				return "", "", "", fmt.Errorf("'%s' has unknown option '%s'", spec, option)
+			}
 		}
+		options = parts[2]
 	}
+	return parts[0], parts[1], options, nil
+}
 
-	return &config, nil
+// isNamedVolume reports whether a volume source names a volume rather than a
+// host path, following the docker convention
+func isNamedVolume(source string) bool {
+	return !strings.ContainsAny(source, "/\\~") && !strings.HasPrefix(source, ".")
 }
 
-// LoadConfigFromFile loads the configuration from a specific file
-func LoadConfigFromFile(filePath string) (*Config, error) {
-	data, err := os.ReadFile(filePath)
+// volumeArgs returns the -v arguments for container.volumes. Host paths have
+// "~" expanded and are resolved against the config directory.
+func (c *Config) volumeArgs() ([]string, error) {
+	var args []string
+	for _, spec := range c.Container.Volumes {
+		source, target, options, err := parseVolumeSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isNamedVolume(source) {
+			if source, err = expandHome(source); err != nil {
+				return nil, err
+			}
+			source = c.resolvePath(source)
+		}
+
+		if !isNamedVolume(source) {
+			source = c.hostMountPath(source)
+		}
+		resolved := source + ":" + target
+		if options != "" {
+			resolved += ":" + options
+		}
+		args = append(args, "-v", resolved)
+	}
+
+	return args, nil
+}
+
+// expandHome replaces a leading "~" with the user's home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file '%s': %w", filePath, err)
+		return "", fmt.Errorf("failed to expand '%s': %w", path, err)
 	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file '%s': %w", filePath, err)
+// isRemoteBuildContext reports whether a named build context refers to an
+// image or URL rather than a local path
+func isRemoteBuildContext(value string) bool {
+	for _, prefix := range []string{"docker-image://", "oci-layout://", "https://", "http://", "git@"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Set defaults
-	if config.Container.Provider == "" {
-		config.Container.Provider = "docker"
+// workdir returns the container path the project is mounted at
+func (c *Config) workdir() string {
+	if c.Container.Workdir != "" {
+		return c.Container.Workdir
 	}
+	return DefaultWorkdir
+}
 
-	// Validate container provider
-	if config.Container.Provider != "docker" && config.Container.Provider != "podman" {
-		return nil, fmt.Errorf("invalid provider: %s. Must be 'docker' or 'podman'", config.Container.Provider)
+// imageTag renders container.tag_format for the given config hash
+func (c *Config) imageTag(hash string, now time.Time) (string, error) {
+	format := c.Container.TagFormat
+	if format == "" {
+		format = DefaultTagFormat
 	}
 
-	// Validate that either image or build is specified
-	if config.Container.Image == "" && config.Container.Build == nil {
-		return nil, fmt.Errorf("either 'container.image' or 'container.build' must be specified")
+	tmpl, err := template.New("tag_format").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return "", fmt.Errorf("invalid 'container.tag_format': %w", err)
 	}
 
-	// Validate build configuration if present
-	if config.Container.Build != nil {
-		if config.Container.Build.Dockerfile == "" {
-			return nil, fmt.Errorf("'container.build.dockerfile' is required when using custom build")
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	if hostOS, hostArch, err := detectHostPlatform(); err == nil {
+		platform = hostOS + "-" + hostArch
+	}
+
+	var tag strings.Builder
+	err = tmpl.Execute(&tag, TagFields{
+		Name:     c.Name,
+		Hash:     hash,
+		Profile:  c.profile,
+		Platform: platform,
+		Date:     now.UTC().Format("20060102"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid 'container.tag_format': %w", err)
+	}
+	return tag.String(), nil
+}
+
+// validateTagFormat checks that container.tag_format renders a legal image
+// reference that changes with the config hash
+func (c *Config) validateTagFormat() error {
+	if c.Container.TagFormat == "" {
+		return nil
+	}
+
+	now := time.Now()
+	first, err := c.imageTag("000000000000", now)
+	if err != nil {
+		return err
+	}
+	second, err := c.imageTag("111111111111", now)
+	if err != nil {
+		return err
+	}
+
+	if err := validateImageRef(first); err != nil || strings.Contains(first, "@") {
+		return fmt.Errorf("invalid 'container.tag_format' '%s': renders '%s', which is not a valid image tag", c.Container.TagFormat, first)
+	}
+	if first == second {
+		return fmt.Errorf("invalid 'container.tag_format' '%s': must include {{.Hash}} so config changes produce a new image", c.Container.TagFormat)
+	}
+	return nil
+}
+
+// workspaceDir returns the host directory mounted at the workdir: the config
+// file's directory, or the current directory when it is unknown
+func (c *Config) workspaceDir() string {
+	if c.dir != "" {
+		return c.dir
+	}
+	workingDir, _ := os.Getwd()
+	return workingDir
+}
+
+// checkSubWorkdir checks that dir, given relative to the project mount, is
+// an existing directory of the workspace
+func (c *Config) checkSubWorkdir(dir string) error {
+	cleaned := path.Clean(filepath.ToSlash(dir))
+	if path.IsAbs(cleaned) || filepath.IsAbs(dir) {
+		return fmt.Errorf("invalid workdir '%s': must be relative to the project directory", dir)
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("invalid workdir '%s': must stay inside the project directory", dir)
+	}
+
+	info, err := os.Stat(filepath.Join(c.workspaceDir(), filepath.FromSlash(cleaned)))
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("invalid workdir '%s': no such directory in the project", dir)
+	}
+	return nil
+}
+
+// maxWorkspacePath is the longest workspace path that mounts reliably; file
+// sharing on Windows and Docker Desktop fails past 260 characters, and files
+// inside the workspace need room too
+const maxWorkspacePath = 200
+
+// desktopSharedDirs are the host directories Docker Desktop and podman
+// machine share with their VM on macOS by default
+var desktopSharedDirs = []string{"/Users", "/Volumes", "/private", "/tmp", "/var/folders"}
+
+// networkFilesystems are filesystem types of network drives, where bind
+// mounts are slow and lose file ownership and change notifications
+var networkFilesystems = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true, "fuse.sshfs": true,
+}
+
+// windowsDrivePath matches an absolute Windows path on a drive, e.g.
+// C:\Users or C:/Users
+var windowsDrivePath = regexp.MustCompile(`^([A-Za-z]):[\\/]`)
+
+// hostMountPath returns host path p as the engine takes it in -v. On Windows
+// a drive path like C:\Users\me\proj isn't accepted as is and is converted
+// for the engine in use; elsewhere p is returned unchanged.
+func (c *Config) hostMountPath(p string) string {
+	if runtime.GOOS != "windows" {
+		return p
+	}
+	return windowsEnginePath(p, c.engineInWSL(os.Getenv("DOCKER_HOST")))
+}
+
+// engineInWSL reports whether the engine of a Windows host runs in a WSL
+// distribution, which sees the drives under /mnt: podman machine and
+// Rancher Desktop always do, docker when DOCKER_HOST points at a WSL daemon
+// instead of Docker Desktop's named pipe
+func (c *Config) engineInWSL(dockerHost string) bool {
+	switch c.Container.Provider {
+	case "podman", "nerdctl":
+		return true
+	}
+	return dockerHost != "" && !strings.HasPrefix(dockerHost, "npipe://")
+}
+
+// windowsEnginePath converts a Windows drive path to /c/Users/me for Docker
+// Desktop, or /mnt/c/Users/me for an engine running in WSL. Other paths,
+// e.g. UNC shares, are returned unchanged.
+func windowsEnginePath(p string, wsl bool) string {
+	match := windowsDrivePath.FindStringSubmatch(p)
+	if match == nil {
+		return p
+	}
+
+	converted := "/" + strings.ToLower(match[1])
+	if wsl {
+		converted = "/mnt" + converted
+	}
+	if rest := strings.Trim(strings.ReplaceAll(p[3:], `\`, "/"), "/"); rest != "" {
+		converted += "/" + rest
+	}
+	return converted
+}
+
+// hostMount is a mounted filesystem of the host
+type hostMount struct {
+	dir    string
+	fsType string
+}
+
+// CheckWorkspace checks that the workspace directory can be mounted in the
+// container. It returns an error for paths that can't be mounted, and
+// warnings for setups known to cause trouble.
+func (c *Config) CheckWorkspace() ([]string, error) {
+	dir := c.workspaceDir()
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return checkWorkspacePath(dir, runtime.GOOS, readHostMounts())
+}
+
+// checkWorkspacePath checks that dir can be mounted on a host running
+// hostOS, whose filesystems are mounts
+func checkWorkspacePath(dir, hostOS string, mounts []hostMount) ([]string, error) {
+	// The host and container paths of -v are separated by ':', so only a
+	// Windows drive letter may have one
+	spec := dir
+	if hostOS == "windows" && len(spec) >= 2 && spec[1] == ':' {
+		spec = spec[2:]
+	}
+	if strings.Contains(spec, ":") {
+		return nil, fmt.Errorf("workspace '%s' cannot be mounted: the path contains ':'", dir)
+	}
+	if strings.IndexFunc(dir, unicode.IsControl) >= 0 {
+		return nil, fmt.Errorf("workspace %q cannot be mounted: the path contains control characters", dir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("workspace '%s' cannot be mounted: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("workspace '%s' cannot be mounted: not a directory", dir)
+	}
+	file, err := os.Open(dir)
+	if err == nil {
+		_, err = file.Readdirnames(1)
+		file.Close()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("workspace '%s' cannot be mounted: the directory is not readable", dir)
+	}
+
+	return workspaceWarnings(dir, hostOS, mounts), nil
+}
+
+// workspaceWarnings returns the problems a mountable workspace may still run
+// into on a host running hostOS
+func workspaceWarnings(dir, hostOS string, mounts []hostMount) []string {
+	var warnings []string
+
+	if len(dir) > maxWorkspacePath {
+		warnings = append(warnings, fmt.Sprintf("the workspace path is %d characters long; paths over %d characters often fail to mount on Windows and Docker Desktop", len(dir), maxWorkspacePath))
+	}
+
+	switch hostOS {
+	case "darwin":
+		shared := false
+		for _, sharedDir := range desktopSharedDirs {
+			if pathWithin(dir, sharedDir) {
+				shared = true
+				break
+			}
 		}
-		if config.Container.Build.Context == "" {
-			config.Container.Build.Context = "."
+		if !shared {
+			warnings = append(warnings, fmt.Sprintf("the workspace is outside the directories shared with the container VM by default (%s); add it to the file sharing settings of Docker Desktop or podman machine", strings.Join(desktopSharedDirs, ", ")))
+		}
+	case "windows":
+		if strings.HasPrefix(dir, `\\`) || strings.HasPrefix(dir, "//") {
+			warnings = append(warnings, "the workspace is on a network share; Docker Desktop can't mount network paths, copy the project to a local drive")
 		}
 	}
 
-	return &config, nil
+	if mount, ok := mountOf(dir, mounts); ok && networkFilesystems[mount.fsType] {
+		warnings = append(warnings, fmt.Sprintf("the workspace is on a network drive (%s at %s); mounts will be slow and may lose file ownership", mount.fsType, mount.dir))
+	}
+
+	return warnings
 }
 
-// GetConfigHash calculates a hash of the configuration file
-func GetConfigHash() (string, error) {
-	return GetConfigHashFromFile(ConfigFileName)
+// pathWithin reports whether dir is parent or inside it
+func pathWithin(dir, parent string) bool {
+	return dir == parent || strings.HasPrefix(dir, strings.TrimSuffix(parent, "/")+"/")
 }
 
-// GetConfigHashFromFile calculates a hash of the specified configuration file
-func GetConfigHashFromFile(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// mountOf returns the filesystem holding dir, the one mounted deepest
+func mountOf(dir string, mounts []hostMount) (hostMount, bool) {
+	var found hostMount
+	ok := false
+	for _, mount := range mounts {
+		if pathWithin(dir, mount.dir) && (!ok || len(mount.dir) > len(found.dir)) {
+			found, ok = mount, true
+		}
+	}
+	return found, ok
+}
+
+// readHostMounts returns the mounted filesystems of a Linux host, or nil
+// when they can't be read
+func readHostMounts() []hostMount {
+	data, err := os.ReadFile("/proc/self/mounts")
 	if err != nil {
-		return "", fmt.Errorf("failed to open config file: %w", err)
+		return nil
 	}
-	defer file.Close()
+	return parseMounts(string(data))
+}
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("failed to calculate hash: %w", err)
+// parseMounts parses the fstab format of /proc/self/mounts, where spaces in
+// paths are escaped as octal
+func parseMounts(data string) []hostMount {
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	var mounts []hostMount
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mounts = append(mounts, hostMount{dir: unescape.Replace(fields[1]), fsType: fields[2]})
+	}
+	return mounts
+}
+
+// buildPaths returns the resolved Dockerfile and context of container.build,
+// checking that both exist
+func (c *Config) buildPaths() (dockerfile, context string, err error) {
+	build := c.Container.Build
+	dockerfile = c.resolvePath(build.Dockerfile)
+	context = c.resolvePath(build.Context)
+
+	if _, err := os.Stat(dockerfile); err != nil {
+		return "", "", fmt.Errorf("dockerfile '%s' not found", dockerfile)
+	}
+	if info, err := os.Stat(context); err != nil || !info.IsDir() {
+		return "", "", fmt.Errorf("build context '%s' not found or not a directory", context)
+	}
+
+	return dockerfile, context, nil
+}
+
+// hashPath hashes the contents of a file, or of every file under a directory
+func hashPath(path string) (string, error) {
+	hasher := sha256.New()
+
+	err := filepath.WalkDir(path, func(current string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(path, current)
+		if err != nil {
+			return err
+		}
+		hasher.Write([]byte(filepath.ToSlash(rel) + "\n"))
+
+		file, err := os.Open(current)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(hasher, file)
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil))[:12], nil
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
 // GetScript returns a script by name
@@ -175,6 +2213,120 @@ func (c *Config) GetScript(name string) (*Script, bool) {
 	return nil, false
 }
 
+// scriptHostOS returns the host OS that shell.scripts[].os is matched against;
+// a variable so tests can simulate other hosts
+var scriptHostOS = func() string {
+	hostOS, _, err := detectHostPlatform()
+	if err != nil {
+		return runtime.GOOS
+	}
+	return hostOS
+}
+
+// supportsOS reports whether the script may run on a host running hostOS
+func (s *Script) supportsOS(hostOS string) bool {
+	if len(s.OS) == 0 {
+		return true
+	}
+	for _, name := range s.OS {
+		if name == hostOS {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOS returns an error when the script is restricted to other host systems
+func (s *Script) checkOS(hostOS string) error {
+	if s.supportsOS(hostOS) {
+		return nil
+	}
+	return fmt.Errorf("script '%s' is only available on %s (this host is %s)", s.Name, strings.Join(s.OS, ", "), hostOS)
+}
+
+// hostScripts returns the scripts available on a host running hostOS and how
+// many were left out; with all set every script is returned
+func (c *Config) hostScripts(hostOS string, all bool) ([]Script, int) {
+	if all {
+		return c.Shell.Scripts, 0
+	}
+
+	var scripts []Script
+	for _, script := range c.Shell.Scripts {
+		if script.supportsOS(hostOS) {
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts, len(c.Shell.Scripts) - len(scripts)
+}
+
+// HostScripts returns the scripts available on this host, leaving out those
+// restricted to other systems with shell.scripts[].os
+func (c *Config) HostScripts() []Script {
+	scripts, _ := c.hostScripts(scriptHostOS(), false)
+	return scripts
+}
+
+// runnableChain returns script preceded by its dependencies, checking that
+// each of them may run on hostOS
+func (c *Config) runnableChain(script *Script, hostOS string) ([]*Script, error) {
+	if err := script.checkOS(hostOS); err != nil {
+		return nil, err
+	}
+	if len(script.DependsOn) == 0 {
+		return []*Script{script}, nil
+	}
+
+	chain, err := c.scriptChain(script.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, dependency := range chain {
+		if err := dependency.checkOS(hostOS); err != nil {
+			return nil, err
+		}
+	}
+	return chain, nil
+}
+
+// scriptChain returns the named script preceded by its dependencies in
+// execution order; each script appears once even if several depend on it
+func (c *Config) scriptChain(name string) ([]*Script, error) {
+	var chain []*Script
+	visited := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		for i, previous := range path {
+			if previous == name {
+				cycle := append(append([]string{}, path[i:]...), name)
+				return fmt.Errorf("script dependency cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		if visited[name] {
+			return nil
+		}
+
+		script, exists := c.GetScript(name)
+		if !exists {
+			return fmt.Errorf("script '%s' depends on unknown script '%s'", path[len(path)-1], name)
+		}
+		for _, dependency := range script.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		visited[name] = true
+		chain = append(chain, script)
+		return nil
+	}
+
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
 // NormalizeName normalizes a directory name to be used as a container image name
 func NormalizeName(name string) string {
 	// Remove accents and normalize unicode
@@ -240,3 +2392,23 @@ func detectHostPlatform() (string, string, error) {
 
 	return hostOS, hostArch, nil
 }
+
+// detectHostTimezone returns the host's IANA timezone name from $TZ,
+// the /etc/localtime symlink or /etc/timezone, or "" if it cannot be found
+func detectHostTimezone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		return tz
+	}
+
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if _, zone, found := strings.Cut(target, "zoneinfo/"); found {
+			return zone
+		}
+	}
+
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+
+	return ""
+}
@@ -1,9 +1,14 @@
 package mikoshell
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNormalizeName(t *testing.T) {
@@ -231,6 +236,41 @@ container:
 			t.Error("LoadConfig() should return error for invalid container provider")
 		}
 	})
+
+	t.Run("startup policy defaults to strict", func(t *testing.T) {
+		configContent := `name: test-project
+container:
+  image: alpine:latest
+`
+		if err := os.WriteFile(ConfigFileName, []byte(configContent), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() failed: %v", err)
+		}
+		if config.Shell.StartupPolicy != StartupPolicyStrict {
+			t.Errorf("Expected startup policy '%s', got '%s'", StartupPolicyStrict, config.Shell.StartupPolicy)
+		}
+	})
+
+	t.Run("invalid startup policy", func(t *testing.T) {
+		configContent := `name: test-project
+container:
+  image: alpine:latest
+shell:
+  startup_policy: sometimes
+`
+		if err := os.WriteFile(ConfigFileName, []byte(configContent), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		_, err := LoadConfig()
+		if err == nil {
+			t.Error("LoadConfig() should return error for invalid startup policy")
+		}
+	})
 }
 
 func TestConfig_GetScript(t *testing.T) {
@@ -263,3 +303,1596 @@ func TestConfig_GetScript(t *testing.T) {
 		}
 	})
 }
+
+func TestConfig_OverrideDockerfile(t *testing.T) {
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile.ci")
+	if err := os.WriteFile(dockerfile, []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+
+	t.Run("switches image config to build mode", func(t *testing.T) {
+		config := &Config{Container: Container{Image: "alpine:latest"}}
+		if err := config.OverrideDockerfile(dockerfile); err != nil {
+			t.Fatalf("OverrideDockerfile() failed: %v", err)
+		}
+
+		if config.Container.Build == nil || config.Container.Build.Dockerfile != dockerfile {
+			t.Errorf("Expected build with dockerfile '%s', got %+v", dockerfile, config.Container.Build)
+		}
+		if config.Container.Build.Context != "." {
+			t.Errorf("Expected default context '.', got '%s'", config.Container.Build.Context)
+		}
+	})
+
+	t.Run("replaces configured dockerfile", func(t *testing.T) {
+		config := &Config{Container: Container{Build: &ContainerBuild{Dockerfile: "./Dockerfile", Context: "ctx"}}}
+		if err := config.OverrideDockerfile(dockerfile); err != nil {
+			t.Fatalf("OverrideDockerfile() failed: %v", err)
+		}
+
+		if config.Container.Build.Dockerfile != dockerfile || config.Container.Build.Context != "ctx" {
+			t.Errorf("Unexpected build config: %+v", config.Container.Build)
+		}
+	})
+
+	t.Run("missing dockerfile", func(t *testing.T) {
+		config := &Config{Container: Container{Image: "alpine:latest"}}
+		if err := config.OverrideDockerfile(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Error("OverrideDockerfile() should fail for a missing file")
+		}
+	})
+}
+
+func TestValidateConfig_Copy(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   CopyEntry
+		wantErr bool
+	}{
+		{name: "relative source", entry: CopyEntry{Src: "certs/ca.pem", Dest: "/certs/ca.pem"}},
+		{name: "missing dest", entry: CopyEntry{Src: "certs/ca.pem"}, wantErr: true},
+		{name: "absolute source", entry: CopyEntry{Src: "/etc/passwd", Dest: "/tmp/passwd"}, wantErr: true},
+		{name: "source outside context", entry: CopyEntry{Src: "../secret", Dest: "/secret"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Copy: []CopyEntry{tt.entry}}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_Pull(t *testing.T) {
+	tests := []struct {
+		name      string
+		container Container
+		wantErr   string
+	}{
+		{name: "image as it is", container: Container{Image: "alpine:3.20", Pull: true}},
+		{name: "startup only", container: Container{Image: "alpine:3.20", Pull: true, Environment: []string{"CI=1"}}},
+		{name: "no image", container: Container{Pull: true, Build: &ContainerBuild{Dockerfile: "Dockerfile"}}, wantErr: "requires 'container.image'"},
+		{name: "setup", container: Container{Image: "alpine:3.20", Pull: true, Setup: []string{"apk add git"}}, wantErr: "remove 'container.setup'"},
+		{
+			name:      "copy and verify",
+			container: Container{Image: "alpine:3.20", Pull: true, Copy: []CopyEntry{{Src: "ca.pem", Dest: "/ca.pem"}}, Verify: []string{"git --version"}},
+			wantErr:   "remove 'container.copy', 'container.verify'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfig(&Config{Container: tt.container})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_Network(t *testing.T) {
+	tests := []struct {
+		name      string
+		container Container
+		wantErr   bool
+	}{
+		{name: "host", container: Container{Network: "host"}},
+		{name: "none", container: Container{Network: "none"}},
+		{name: "compose network", container: Container{Network: "myapp_default", Ports: []string{"8080:8080"}}},
+		{name: "shared container", container: Container{Network: "container:db"}},
+		{name: "podman mode with options", container: Container{Network: "slirp4netns:allow_host_loopback=true"}},
+		{name: "flag", container: Container{Network: "--privileged"}, wantErr: true},
+		{name: "whitespace", container: Container{Network: "my net"}, wantErr: true},
+		{name: "container without name", container: Container{Network: "container:"}, wantErr: true},
+		{name: "host with host gateway", container: Container{Network: "host", HostGateway: true}, wantErr: true},
+		{name: "shared container with ports", container: Container{Network: "container:db", Ports: []string{"8080"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.container.Image = "alpine:latest"
+			err := validateConfig(&Config{Container: tt.container})
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+
+	config := &Config{Container: Container{Image: "alpine:latest", Network: "host"}}
+	if err := config.SetNetwork("bad name"); err == nil || config.Container.Network != "host" {
+		t.Errorf("Expected SetNetwork() to reject the value and keep host, got %v and %q", err, config.Container.Network)
+	}
+	if err := config.SetNetwork("none"); err != nil || config.Container.Network != "none" {
+		t.Errorf("Expected SetNetwork() to switch to none, got %v and %q", err, config.Container.Network)
+	}
+}
+
+func TestValidateGPUs(t *testing.T) {
+	for _, gpus := range []string{"", "all", "1", "4", "device=0", "device=0,2", "device=GPU-3a23c669-1f69"} {
+		if err := validateGPUs(gpus); err != nil {
+			t.Errorf("validateGPUs(%q) failed: %v", gpus, err)
+		}
+	}
+	for _, gpus := range []string{"0", "-1", "yes", "ALL", "device=", "device=0,,1", "all --privileged"} {
+		if err := validateGPUs(gpus); err == nil {
+			t.Errorf("validateGPUs(%q) should fail", gpus)
+		}
+	}
+
+	config := &Config{}
+	if err := config.SetGPUs("two"); err == nil || !strings.Contains(err.Error(), "invalid --gpus") {
+		t.Errorf("Expected an invalid --gpus error, got %v", err)
+	}
+}
+
+func TestValidateConfig_Mounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		mount   Mount
+		wantErr bool
+	}{
+		{name: "relative host", mount: Mount{Host: "../shared", Path: "/shared"}},
+		{name: "home host", mount: Mount{Host: "~/lib", Path: "/lib/shared", ReadOnly: true}},
+		{name: "missing host", mount: Mount{Path: "/shared"}, wantErr: true},
+		{name: "relative container path", mount: Mount{Host: "../shared", Path: "shared"}, wantErr: true},
+		{name: "workspace path", mount: Mount{Host: "../shared", Path: "/workspace/"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Mounts: map[string]Mount{"shared": tt.mount}}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromFile_ScriptFile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, ConfigFileName)
+
+	t.Run("missing file", func(t *testing.T) {
+		content := "name: proj\ncontainer:\n  image: alpine:latest\nshell:\n  scripts:\n    - name: build\n      file: scripts/missing.sh\n"
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		_, err := LoadConfigFromFile(configFile)
+		if err == nil || !strings.Contains(err.Error(), "scripts/missing.sh") {
+			t.Errorf("Expected an error naming the missing file, got %v", err)
+		}
+	})
+
+	t.Run("file and commands", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "build.sh"), []byte("make\n"), 0644); err != nil {
+			t.Fatalf("Failed to write script file: %v", err)
+		}
+		content := "name: proj\ncontainer:\n  image: alpine:latest\nshell:\n  scripts:\n    - name: build\n      file: build.sh\n      commands: [make]\n"
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		if _, err := LoadConfigFromFile(configFile); err == nil {
+			t.Error("LoadConfigFromFile() should fail when both 'file' and 'commands' are set")
+		}
+	})
+}
+
+func TestValidateConfig_Shell(t *testing.T) {
+	tests := []struct {
+		name    string
+		shell   string
+		wantErr bool
+	}{
+		{name: "default", shell: ""},
+		{name: "bash", shell: "/bin/bash"},
+		{name: "relative", shell: "bash", wantErr: true},
+		{name: "with arguments", shell: "/bin/bash -l", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Shell: tt.shell}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_Workdir(t *testing.T) {
+	tests := []struct {
+		name    string
+		workdir string
+		wantErr bool
+	}{
+		{name: "default", workdir: ""},
+		{name: "absolute", workdir: "/app"},
+		{name: "relative", workdir: "app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Workdir: tt.workdir}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_ImageTag(t *testing.T) {
+	now := time.Date(2026, 3, 9, 23, 30, 0, 0, time.UTC)
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{name: "default", format: "", expected: "proj:abc123def456"},
+		{name: "registry", format: "registry.example.com/team/{{.Name}}:{{.Hash}}", expected: "registry.example.com/team/proj:abc123def456"},
+		{name: "platform", format: "{{.Name}}:{{.Hash}}-{{.Platform}}", expected: "proj:abc123def456-" + platform},
+		{name: "date", format: "{{.Name}}:{{.Date}}-{{.Hash}}", expected: "proj:20260309-abc123def456"},
+		{name: "profile", format: "{{.Name}}:{{with .Profile}}{{.}}-{{end}}{{.Hash}}", expected: "proj:abc123def456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Name: "proj", Container: Container{TagFormat: tt.format}}
+			tag, err := config.imageTag("abc123def456", now)
+			if err != nil {
+				t.Fatalf("imageTag() failed: %v", err)
+			}
+			if tag != tt.expected {
+				t.Errorf("Expected tag %q, got %q", tt.expected, tag)
+			}
+			if hash := tagHash(tag); hash != "abc123def456" {
+				t.Errorf("Expected hash abc123def456 from %q, got %q", tag, hash)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_TagFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{name: "default", format: ""},
+		{name: "custom", format: "{{.Name}}:{{.Date}}-{{.Hash}}"},
+		{name: "syntax error", format: "{{.Name}:{{.Hash}}", wantErr: true},
+		{name: "unknown field", format: "{{.Name}}:{{.Branch}}-{{.Hash}}", wantErr: true},
+		{name: "illegal reference", format: "{{.Name}}:{{.Hash}} latest", wantErr: true},
+		{name: "digest", format: "{{.Name}}@sha256:{{.Hash}}", wantErr: true},
+		{name: "missing hash", format: "{{.Name}}:latest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", TagFormat: tt.format}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatConfig(t *testing.T) {
+	t.Run("messy config is normalized", func(t *testing.T) {
+		messy := `# Project config
+shell:
+  scripts:
+    - commands:
+        - go test ./...
+      name: test # run the tests
+    - name: build
+      cmds:
+        - go build ./...
+container:
+  image: golang:1.24
+  mounts:
+    cache:
+      path: /cache
+      host: ~/.cache
+name: My App
+`
+		expected := `# Project config
+name: my-app
+container:
+  provider: docker
+  image: golang:1.24
+  mounts:
+    cache:
+      host: ~/.cache
+      path: /cache
+shell:
+  scripts:
+    - name: test # run the tests
+      commands:
+        - go test ./...
+    - name: build
+      commands:
+        - go build ./...
+`
+
+		formatted, changes, err := FormatConfig([]byte(messy))
+		if err != nil {
+			t.Fatalf("FormatConfig() failed: %v", err)
+		}
+		if string(formatted) != expected {
+			t.Errorf("FormatConfig() mismatch.\nExpected:\n%s\nGot:\n%s", expected, formatted)
+		}
+
+		summary := strings.Join(changes, "\n")
+		for _, change := range []string{
+			"normalized name 'My App' to 'my-app'",
+			"set container.provider to the default 'docker'",
+			"renamed 'cmds' to 'commands' in script 'build'",
+			"reordered the keys of container.mounts.cache",
+			"reordered the keys of shell.scripts[0]",
+			"reordered the top-level keys",
+		} {
+			if !strings.Contains(summary, change) {
+				t.Errorf("Expected change %q, got:\n%s", change, summary)
+			}
+		}
+
+		if _, changes, _ := FormatConfig(formatted); len(changes) != 0 {
+			t.Errorf("Expected formatting to be idempotent, got %v", changes)
+		}
+	})
+
+	t.Run("clean config is untouched", func(t *testing.T) {
+		// Blank lines and comments would be lost if clean files were rewritten
+		clean := `name: app
+container:
+  provider: podman
+  image: alpine:latest
+
+shell:
+  # Scripts
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+`
+		formatted, changes, err := FormatConfig([]byte(clean))
+		if err != nil {
+			t.Fatalf("FormatConfig() failed: %v", err)
+		}
+		if len(changes) != 0 || string(formatted) != clean {
+			t.Errorf("Expected clean config untouched, got changes %v:\n%s", changes, formatted)
+		}
+	})
+
+	t.Run("unknown keys go last", func(t *testing.T) {
+		formatted, _, err := FormatConfig([]byte("x-team: core\nname: app\ncontainer:\n  provider: docker\n  image: alpine\n"))
+		if err != nil {
+			t.Fatalf("FormatConfig() failed: %v", err)
+		}
+		if !strings.HasSuffix(string(formatted), "x-team: core\n") {
+			t.Errorf("Expected unknown key after the known ones, got:\n%s", formatted)
+		}
+	})
+
+	t.Run("extending config keeps the inherited provider", func(t *testing.T) {
+		extending := "extends: base.yaml\nname: app\ncontainer:\n  image: alpine\n"
+		formatted, changes, err := FormatConfig([]byte(extending))
+		if err != nil {
+			t.Fatalf("FormatConfig() failed: %v", err)
+		}
+		if len(changes) != 0 || string(formatted) != extending {
+			t.Errorf("Expected no provider added, got changes %v:\n%s", changes, formatted)
+		}
+	})
+
+	t.Run("not a mapping", func(t *testing.T) {
+		if _, _, err := FormatConfig([]byte("- a\n- b\n")); err == nil {
+			t.Error("FormatConfig() should reject a config that isn't a mapping")
+		}
+	})
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name: "valid",
+			content: `name: proj
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+`,
+		},
+		{
+			name: "unknown key",
+			content: `name: proj
+container:
+  image: alpine:latest
+shell:
+  scirpts:
+    - name: test
+`,
+			expected: []string{"line 5: unknown field 'scirpts'"},
+		},
+		{
+			name: "invalid value",
+			content: `name: proj
+container:
+  provider: lxc
+  image: alpine:latest
+`,
+			expected: []string{"invalid provider: lxc"},
+		},
+		{
+			name: "script problems",
+			content: `name: proj
+container:
+  image: alpine:latest
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+    - name: empty
+    - name: exec
+      commands:
+        - echo hi
+    - name: ci
+      depends_on: [lint]
+`,
+			expected: []string{
+				"script 'empty' has no commands",
+				"script 'exec' has the same name as the built-in 'exec' command",
+				"script 'ci' depends on unknown script 'lint'",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), ConfigFileName)
+			if err := os.WriteFile(configFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			problems := ValidateConfigFile(configFile, []string{"exec", "help"})
+			if len(problems) != len(tt.expected) {
+				t.Fatalf("Expected %d problem(s), got %v", len(tt.expected), problems)
+			}
+			for i, expected := range tt.expected {
+				if !strings.Contains(problems[i].Error(), expected) {
+					t.Errorf("Expected problem %q, got %q", expected, problems[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_HostScripts(t *testing.T) {
+	config := &Config{Shell: Shell{Scripts: []Script{
+		{Name: "build"},
+		{Name: "setup-mac", OS: []string{"darwin"}},
+		{Name: "setup-unix", OS: []string{"linux", "darwin"}},
+		{Name: "setup-windows", OS: []string{"windows"}},
+	}}}
+
+	tests := []struct {
+		hostOS   string
+		all      bool
+		expected string
+		hidden   int
+	}{
+		{hostOS: "linux", expected: "build setup-unix", hidden: 2},
+		{hostOS: "darwin", expected: "build setup-mac setup-unix", hidden: 1},
+		{hostOS: "windows", expected: "build setup-windows", hidden: 2},
+		{hostOS: "linux", all: true, expected: "build setup-mac setup-unix setup-windows"},
+	}
+
+	for _, tt := range tests {
+		scripts, hidden := config.hostScripts(tt.hostOS, tt.all)
+		var names []string
+		for _, script := range scripts {
+			names = append(names, script.Name)
+		}
+		if got := strings.Join(names, " "); got != tt.expected || hidden != tt.hidden {
+			t.Errorf("%s (all=%v): expected %q with %d hidden, got %q with %d hidden", tt.hostOS, tt.all, tt.expected, tt.hidden, got, hidden)
+		}
+	}
+
+	invalid := &Config{
+		Container: Container{Image: "alpine:latest"},
+		Shell:     Shell{Scripts: []Script{{Name: "setup", OS: []string{"macos"}}}},
+	}
+	if err := validateConfig(invalid); err == nil {
+		t.Error("validateConfig() should reject an unknown os")
+	}
+}
+
+func TestLoadConfigFromFile_ScriptNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		scripts string
+		wantErr string
+	}{
+		{
+			name: "unique names",
+			scripts: `    - name: test
+      commands: [go test ./...]
+    - name: lint
+      commands: [go vet ./...]
+`,
+		},
+		{
+			name: "duplicate name",
+			scripts: `    - name: test
+      commands: [go test ./...]
+    - name: lint
+      commands: [go vet ./...]
+    - name: test
+      commands: [go test -race ./...]
+`,
+			wantErr: "duplicate script name 'test' (line 10, first defined on line 6)",
+		},
+		{name: "reserved run", scripts: "    - name: run\n      commands: [echo]\n", wantErr: "script name 'run' (line 6) is reserved"},
+		{name: "reserved open", scripts: "    - name: open\n      commands: [echo]\n", wantErr: "script name 'open' (line 6) is reserved"},
+		{name: "reserved list", scripts: "    - name: list\n      commands: [echo]\n", wantErr: "script name 'list' (line 6) is reserved"},
+		{name: "reserved version", scripts: "    - name: version\n      commands: [echo]\n", wantErr: "script name 'version' (line 6) is reserved"},
+		{name: "reserved help", scripts: "    - name: help\n      commands: [echo]\n", wantErr: "script name 'help' (line 6) is reserved"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "name: proj\ncontainer:\n  image: alpine:latest\nshell:\n  scripts:\n" + tt.scripts
+			configFile := filepath.Join(t.TempDir(), ConfigFileName)
+			if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			_, err := LoadConfigFromFile(configFile)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("LoadConfigFromFile() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseVolumeSpec_WindowsDrive(t *testing.T) {
+	source, target, options, err := parseVolumeSpec(`C:\Users\me\.m2:/root/.m2:ro`)
+	if err != nil {
+		t.Fatalf("parseVolumeSpec() failed: %v", err)
+	}
+	if source != `C:\Users\me\.m2` || target != "/root/.m2" || options != "ro" {
+		t.Errorf("Expected the drive letter kept in the source, got %q, %q, %q", source, target, options)
+	}
+	if isNamedVolume(source) || isNamedVolume(`cache\go`) {
+		t.Errorf("Expected Windows paths not to be taken for named volumes")
+	}
+}
+
+func TestWindowsEnginePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		desktop string
+		wsl     string
+	}{
+		{path: `C:\Users\me\project`, desktop: "/c/Users/me/project", wsl: "/mnt/c/Users/me/project"},
+		{path: `D:\src\My Project\`, desktop: "/d/src/My Project", wsl: "/mnt/d/src/My Project"},
+		{path: "e:/work/api", desktop: "/e/work/api", wsl: "/mnt/e/work/api"},
+		{path: `C:\`, desktop: "/c", wsl: "/mnt/c"},
+		{path: `\\fileserver\share\project`, desktop: `\\fileserver\share\project`, wsl: `\\fileserver\share\project`},
+		{path: "/home/me/project", desktop: "/home/me/project", wsl: "/home/me/project"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := windowsEnginePath(tt.path, false); got != tt.desktop {
+				t.Errorf("Docker Desktop path = %q, want %q", got, tt.desktop)
+			}
+			if got := windowsEnginePath(tt.path, true); got != tt.wsl {
+				t.Errorf("WSL path = %q, want %q", got, tt.wsl)
+			}
+		})
+	}
+}
+
+func TestConfig_EngineInWSL(t *testing.T) {
+	tests := []struct {
+		provider   string
+		dockerHost string
+		expected   bool
+	}{
+		{provider: "docker"},
+		{provider: "docker", dockerHost: "npipe:////./pipe/docker_engine"},
+		{provider: "docker", dockerHost: "tcp://localhost:2375", expected: true},
+		{provider: "podman", expected: true},
+		{provider: "nerdctl", expected: true},
+	}
+
+	for _, tt := range tests {
+		config := &Config{Container: Container{Provider: tt.provider}}
+		if got := config.engineInWSL(tt.dockerHost); got != tt.expected {
+			t.Errorf("engineInWSL() for %s with DOCKER_HOST %q = %v, want %v", tt.provider, tt.dockerHost, got, tt.expected)
+		}
+	}
+}
+
+func TestValidateConfig_Volumes(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "home path", spec: "~/.m2:/root/.m2"},
+		{name: "named volume", spec: "mydata:/data"},
+		{name: "options", spec: "./cache:/cache:ro,z"},
+		{name: "missing target", spec: "mydata", wantErr: true},
+		{name: "relative target", spec: "mydata:data", wantErr: true},
+		{name: "unknown option", spec: "mydata:/data:rx", wantErr: true},
+		{name: "too many parts", spec: "a:/b:ro:extra", wantErr: true},
+		{name: "windows drive path", spec: `C:\cache:/cache:ro`},
+		{name: "windows drive path with slashes", spec: "D:/data:/data"},
+		{name: "windows drive path without target", spec: `C:\cache`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Volumes: []string{tt.spec}}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_VolumeArgs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	config := &Config{
+		Container: Container{Volumes: []string{
+			"~/.m2:/root/.m2",
+			"mydata:/data",
+			"../shared:/shared:ro",
+			"/var/cache:/var/cache",
+		}},
+		dir: "/projects/app",
+	}
+
+	args, err := config.volumeArgs()
+	if err != nil {
+		t.Fatalf("volumeArgs() failed: %v", err)
+	}
+
+	expected := []string{
+		"-v", filepath.Join(home, ".m2") + ":/root/.m2",
+		"-v", "mydata:/data",
+		"-v", "/projects/shared:/shared:ro",
+		"-v", "/var/cache:/var/cache",
+	}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("volumeArgs() = %v, want %v", args, expected)
+	}
+}
+
+func TestValidateConfig_ShellFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   string
+		wantErr bool
+	}{
+		{name: "unset", flags: ""},
+		{name: "combined", flags: "-eu"},
+		{name: "separate", flags: "-e -x"},
+		{name: "noclobber", flags: "-C"},
+		{name: "no dash", flags: "eu", wantErr: true},
+		{name: "unknown option", flags: "-ez", wantErr: true},
+		{name: "long option", flags: "-o pipefail", wantErr: true},
+		{name: "noexec", flags: "-n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest"}, Shell: Shell{Flags: tt.flags}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_Environment(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr bool
+	}{
+		{name: "key and value", entry: "APP_ENV=dev"},
+		{name: "empty value", entry: "DEBUG="},
+		{name: "value with equals", entry: "OPTS=-Dfoo=bar"},
+		{name: "passthrough", entry: "GITHUB_TOKEN"},
+		{name: "leading digit", entry: "1KEY=x", wantErr: true},
+		{name: "dash in key", entry: "MY-KEY=x", wantErr: true},
+		{name: "empty key", entry: "=x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Environment: []string{tt.entry}}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_AddEnvironment(t *testing.T) {
+	config := &Config{Container: Container{Environment: []string{"APP_ENV=dev"}}}
+
+	if err := config.AddEnvironment([]string{"DEBUG=1", "HOME"}); err != nil {
+		t.Fatalf("AddEnvironment() failed: %v", err)
+	}
+	expected := "APP_ENV=dev DEBUG=1 HOME"
+	if got := strings.Join(config.Container.Environment, " "); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	if err := config.AddEnvironment([]string{"BAD KEY=1"}); err == nil {
+		t.Error("AddEnvironment() should reject invalid keys")
+	}
+}
+
+func TestConfig_PassEnvArgs(t *testing.T) {
+	config := &Config{Container: Container{PassEnvPrefix: []string{"MYAPP_", "CI"}}}
+	environ := []string{
+		"MYAPP_TOKEN=secret",
+		"PATH=/usr/bin",
+		"MYAPP_DEBUG=",
+		"CI=true",
+		"NOT_MYAPP_X=1",
+		"myapp_lower=1",
+	}
+
+	expected := []string{"-e", "CI", "-e", "MYAPP_DEBUG", "-e", "MYAPP_TOKEN"}
+	if got := config.passEnvArgs(environ); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if err := validateConfig(&Config{Container: Container{Image: "alpine:latest", PassEnvPrefix: []string{""}}}); err == nil {
+		t.Error("validateConfig() should reject an empty prefix")
+	}
+}
+
+func TestConfig_UserArgs(t *testing.T) {
+	hostUser := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+
+	tests := []struct {
+		name     string
+		user     string
+		expected string
+	}{
+		{name: "unset", user: "", expected: ""},
+		{name: "uid and gid", user: "1000:1000", expected: "--user 1000:1000"},
+		{name: "user name", user: "node", expected: "--user node"},
+		{name: "host", user: UserHost, expected: "--user " + hostUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.user == UserHost && os.Getuid() < 0 {
+				t.Skip("host has no uids")
+			}
+			config := &Config{Container: Container{User: tt.user}}
+			if got := strings.Join(config.userArgs(), " "); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	invalid := &Config{Container: Container{Image: "alpine:latest", User: "--privileged"}}
+	if err := validateConfig(invalid); err == nil {
+		t.Error("validateConfig() should reject a user starting with '-'")
+	}
+}
+
+func TestValidateConfig_Ports(t *testing.T) {
+	tests := []struct {
+		name    string
+		ports   []string
+		wantErr string
+	}{
+		{name: "host and container", ports: []string{"8080:80"}},
+		{name: "container only", ports: []string{"3000", "3000"}},
+		{name: "ip and protocol", ports: []string{"127.0.0.1:5353:53/udp", "5353:53/tcp"}},
+		{name: "same port different protocol", ports: []string{"5353:53/udp", "5353:53"}},
+		{name: "not a number", ports: []string{"http:80"}, wantErr: "invalid port 'http'"},
+		{name: "out of range", ports: []string{"70000:80"}, wantErr: "invalid port '70000'"},
+		{name: "unknown protocol", ports: []string{"8080:80/http"}, wantErr: "unknown protocol"},
+		{name: "too many parts", ports: []string{"a:1:2:3"}, wantErr: "must be"},
+		{name: "duplicate host port", ports: []string{"8080:80", "8080:8000"}, wantErr: "already published by '8080:80'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Image: "alpine:latest", Ports: tt.ports}}
+			err := validateConfig(config)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_AddPorts(t *testing.T) {
+	config := &Config{Container: Container{Ports: []string{"8080:80"}}}
+
+	if err := config.AddPorts([]string{"8080:8000"}); err == nil {
+		t.Error("AddPorts() should reject a host port already in container.ports")
+	}
+	if len(config.Container.Ports) != 1 {
+		t.Errorf("Expected ports unchanged after a failed merge, got %v", config.Container.Ports)
+	}
+
+	if err := config.AddPorts([]string{"3000:3000"}); err != nil {
+		t.Fatalf("AddPorts() failed: %v", err)
+	}
+	if got := strings.Join(config.Container.Ports, " "); got != "8080:80 3000:3000" {
+		t.Errorf("Expected merged ports, got %q", got)
+	}
+}
+
+func TestConfig_AddCachePresets(t *testing.T) {
+	tests := []struct {
+		name     string
+		volumes  []string
+		presets  []string
+		expected []string
+	}{
+		{name: "go", presets: []string{"go"}, expected: []string{
+			"-v", "miko-shell-go-mod:/go/pkg/mod", "-v", "miko-shell-go-build:/root/.cache/go-build",
+		}},
+		{name: "node", presets: []string{"node"}, expected: []string{"-v", "miko-shell-npm:/root/.npm"}},
+		{name: "pip", presets: []string{"pip"}, expected: []string{"-v", "miko-shell-pip:/root/.cache/pip"}},
+		{name: "cargo", presets: []string{"cargo"}, expected: []string{
+			"-v", "miko-shell-cargo-registry:/usr/local/cargo/registry", "-v", "miko-shell-cargo-git:/usr/local/cargo/git",
+		}},
+		{name: "composed", presets: []string{"go", "node"}, expected: []string{
+			"-v", "miko-shell-go-mod:/go/pkg/mod", "-v", "miko-shell-go-build:/root/.cache/go-build",
+			"-v", "miko-shell-npm:/root/.npm",
+		}},
+		{name: "repeated", presets: []string{"pip", "pip"}, expected: []string{"-v", "miko-shell-pip:/root/.cache/pip"}},
+		{name: "config volume wins", volumes: []string{"gomod:/go/pkg/mod"}, presets: []string{"go"}, expected: []string{
+			"-v", "gomod:/go/pkg/mod", "-v", "miko-shell-go-build:/root/.cache/go-build",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Container: Container{Volumes: tt.volumes}}
+			if err := config.AddCachePresets(tt.presets); err != nil {
+				t.Fatalf("AddCachePresets() failed: %v", err)
+			}
+			args, err := config.volumeArgs()
+			if err != nil {
+				t.Fatalf("volumeArgs() failed: %v", err)
+			}
+			if strings.Join(args, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("volumeArgs() = %v, want %v", args, tt.expected)
+			}
+		})
+	}
+
+	t.Run("unknown preset", func(t *testing.T) {
+		err := (&Config{}).AddCachePresets([]string{"cobol"})
+		if err == nil || !strings.Contains(err.Error(), "available presets are cargo, go, gradle") {
+			t.Errorf("Expected unknown preset error listing presets, got %v", err)
+		}
+	})
+}
+
+func TestConfig_ScriptChain(t *testing.T) {
+	config := &Config{Shell: Shell{Scripts: []Script{
+		{Name: "lint", Commands: []string{"golangci-lint run"}},
+		{Name: "build", DependsOn: []string{"lint"}, Commands: []string{"go build ./..."}},
+		{Name: "test", DependsOn: []string{"lint", "build"}, Commands: []string{"go test ./..."}},
+		{Name: "a", DependsOn: []string{"b"}, Commands: []string{"true"}},
+		{Name: "b", DependsOn: []string{"c"}, Commands: []string{"true"}},
+		{Name: "c", DependsOn: []string{"a"}, Commands: []string{"true"}},
+		{Name: "broken", DependsOn: []string{"missing"}, Commands: []string{"true"}},
+	}}}
+
+	chain, err := config.scriptChain("test")
+	if err != nil {
+		t.Fatalf("scriptChain() failed: %v", err)
+	}
+	var names []string
+	for _, script := range chain {
+		names = append(names, script.Name)
+	}
+	if got := strings.Join(names, ","); got != "lint,build,test" {
+		t.Errorf("Expected lint,build,test, got %s", got)
+	}
+
+	_, err = config.scriptChain("a")
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("Expected cycle naming the scripts, got %v", err)
+	}
+
+	_, err = config.scriptChain("broken")
+	if err == nil || !strings.Contains(err.Error(), "'broken' depends on unknown script 'missing'") {
+		t.Errorf("Expected unknown dependency error, got %v", err)
+	}
+}
+
+func TestValidateConfig_Context(t *testing.T) {
+	for _, context := range []string{"", "colima", "remote-host.example", "default"} {
+		config := &Config{Container: Container{Image: "alpine:latest", Context: context}}
+		if err := validateConfig(config); err != nil {
+			t.Errorf("validateConfig() with context %q failed: %v", context, err)
+		}
+	}
+	for _, context := range []string{"--host=tcp://x", "my context"} {
+		config := &Config{Container: Container{Image: "alpine:latest", Context: context}}
+		if err := validateConfig(config); err == nil {
+			t.Errorf("validateConfig() with context %q should fail", context)
+		}
+	}
+}
+
+func TestConfig_ApplyOverrides(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Name: "test-project",
+			Container: Container{
+				Provider: "docker",
+				Image:    "alpine:latest",
+				Setup:    []string{"apk add curl"},
+			},
+			Shell: Shell{Scripts: []Script{{Name: "test", Commands: []string{"go test ./..."}}}},
+		}
+	}
+
+	t.Run("image", func(t *testing.T) {
+		config := newConfig()
+		if err := config.ApplyOverrides([]string{"container.image=ubuntu:22.04"}); err != nil {
+			t.Fatalf("ApplyOverrides() failed: %v", err)
+		}
+		if config.Container.Image != "ubuntu:22.04" {
+			t.Errorf("Expected image 'ubuntu:22.04', got '%s'", config.Container.Image)
+		}
+	})
+
+	t.Run("provider", func(t *testing.T) {
+		config := newConfig()
+		if err := config.ApplyOverrides([]string{"container.provider=podman"}); err != nil {
+			t.Fatalf("ApplyOverrides() failed: %v", err)
+		}
+		if config.Container.Provider != "podman" {
+			t.Errorf("Expected provider 'podman', got '%s'", config.Container.Provider)
+		}
+	})
+
+	t.Run("invalid provider fails validation", func(t *testing.T) {
+		config := newConfig()
+		if err := config.ApplyOverrides([]string{"container.provider=lxc"}); err == nil {
+			t.Error("ApplyOverrides() should fail for an invalid provider")
+		}
+	})
+
+	t.Run("setup entry", func(t *testing.T) {
+		config := newConfig()
+		if err := config.ApplyOverrides([]string{"container.setup[0]=apk add git", "container.setup[1]=apk add make"}); err != nil {
+			t.Fatalf("ApplyOverrides() failed: %v", err)
+		}
+		expected := []string{"apk add git", "apk add make"}
+		if len(config.Container.Setup) != 2 || config.Container.Setup[0] != expected[0] || config.Container.Setup[1] != expected[1] {
+			t.Errorf("Expected setup %v, got %v", expected, config.Container.Setup)
+		}
+	})
+
+	t.Run("nested list and map entries", func(t *testing.T) {
+		config := newConfig()
+		overrides := []string{
+			"shell.scripts[0].commands[0]=go test -race ./...",
+			"container.build.dockerfile=Dockerfile",
+			"container.build.args.GO_VERSION=1.22",
+		}
+		if err := config.ApplyOverrides(overrides); err != nil {
+			t.Fatalf("ApplyOverrides() failed: %v", err)
+		}
+		if config.Shell.Scripts[0].Commands[0] != "go test -race ./..." {
+			t.Errorf("Unexpected script commands %v", config.Shell.Scripts[0].Commands)
+		}
+		if config.Container.Build == nil || config.Container.Build.Args["GO_VERSION"] != "1.22" {
+			t.Errorf("Unexpected build config %+v", config.Container.Build)
+		}
+		if config.Container.Build.Context != "." {
+			t.Errorf("Expected validation to default the context, got '%s'", config.Container.Build.Context)
+		}
+	})
+
+	t.Run("invalid overrides", func(t *testing.T) {
+		for _, override := range []string{
+			"container.image",
+			"container.unknown=x",
+			"container.setup[5]=x",
+			"container.setup[x]=x",
+			"container=x",
+		} {
+			if err := newConfig().ApplyOverrides([]string{override}); err == nil {
+				t.Errorf("ApplyOverrides(%q) should fail", override)
+			}
+		}
+	})
+}
+
+func TestFindConfigFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"", "api", "web/app", ".git", "web/node_modules/pkg"} {
+		path := filepath.Join(root, dir)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(path, ConfigFileName), []byte("name: test\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+	}
+
+	files, err := FindConfigFiles(root)
+	if err != nil {
+		t.Fatalf("FindConfigFiles() failed: %v", err)
+	}
+
+	// WalkDir visits entries in lexical order
+	expected := []string{
+		filepath.Join(root, "api", ConfigFileName),
+		filepath.Join(root, ConfigFileName),
+		filepath.Join(root, "web", "app", ConfigFileName),
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, files)
+	}
+	for i := range expected {
+		if files[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, files)
+			break
+		}
+	}
+}
+
+func TestValidateConfig_Image(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		image   string
+		wantErr bool
+	}{
+		{image: "alpine"},
+		{image: "alpine:3.19"},
+		{image: "golang:1.22-alpine"},
+		{image: "library/alpine:latest"},
+		{image: "mcr.microsoft.com/devcontainers/go:1"},
+		{image: "localhost:5000/team/app_name__x:v1.0"},
+		{image: "alpine@" + digest},
+		{image: "alpine:3.19@" + digest},
+		{image: "Alpine:latest", wantErr: true},
+		{image: "alpine:", wantErr: true},
+		{image: "alpine latest", wantErr: true},
+		{image: "alpine:3.19@sha256:abc", wantErr: true},
+		{image: "-alpine", wantErr: true},
+		{image: "alpine//edge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			config := &Config{Container: Container{Image: tt.image}}
+			err := validateConfig(config)
+			if tt.wantErr && err == nil {
+				t.Error("validateConfig() should fail")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateConfig() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckWorkspacePath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		hostOS  string
+		wantErr string
+	}{
+		{"mountable", dir, "linux", ""},
+		{"colon", dir + "/a:b", "linux", "contains ':'"},
+		{"control character", dir + "/a\nb", "linux", "control characters"},
+		{"missing", filepath.Join(dir, "missing"), "linux", "no such file"},
+		{"not a directory", file, "linux", "not a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkWorkspacePath(tt.dir, tt.hostOS, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected %s to be mountable, got %v", tt.dir, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// A drive letter is the one colon Windows paths may have
+	_, err := checkWorkspacePath(`C:\missing`, "windows", nil)
+	if err != nil && strings.Contains(err.Error(), "':'") {
+		t.Errorf("Expected the drive letter to be accepted, got %v", err)
+	}
+}
+
+func TestWorkspaceWarnings(t *testing.T) {
+	mounts := parseMounts("/dev/sda1 / ext4 rw 0 0\nserver:/export /mnt/my\\040share nfs4 rw 0 0\n")
+
+	tests := []struct {
+		name     string
+		dir      string
+		hostOS   string
+		expected string
+	}{
+		{"local disk", "/home/dev/project", "linux", ""},
+		{"network drive", "/mnt/my share/project", "linux", "network drive (nfs4 at /mnt/my share)"},
+		{"long path", "/home/" + strings.Repeat("a", maxWorkspacePath), "linux", "characters long"},
+		{"shared on macOS", "/Users/dev/project", "darwin", ""},
+		{"not shared on macOS", "/opt/project", "darwin", "file sharing settings"},
+		{"windows local", `C:\Users\dev\project`, "windows", ""},
+		{"windows network share", `\\server\share\project`, "windows", "network share"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := workspaceWarnings(tt.dir, tt.hostOS, mounts)
+			if tt.expected == "" {
+				if len(warnings) > 0 {
+					t.Errorf("Expected no warnings, got %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.expected) {
+				t.Errorf("Expected one warning containing %q, got %v", tt.expected, warnings)
+			}
+		})
+	}
+}
+
+func TestConfig_ApplyProfile(t *testing.T) {
+	configContent := `name: test
+container:
+  image: alpine:latest
+  setup:
+    - apk add git
+  environment:
+    - APP_ENV=dev
+    - DEBUG=1
+  mounts:
+    cache:
+      host: .
+      path: /cache
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+profiles:
+  ci:
+    container:
+      image: golang:1.22
+      environment:
+        - APP_ENV=ci
+        - CI=true
+      mounts:
+        data:
+          host: .
+          path: /data
+  lint:
+    shell:
+      scripts:
+        - name: lint
+          commands:
+            - golangci-lint run
+`
+	load := func(t *testing.T) *Config {
+		t.Helper()
+		configFile := filepath.Join(t.TempDir(), ConfigFileName)
+		if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		config, err := LoadConfigFromFile(configFile)
+		if err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		return config
+	}
+
+	t.Run("container", func(t *testing.T) {
+		config := load(t)
+		if err := config.ApplyProfile("ci"); err != nil {
+			t.Fatalf("ApplyProfile() failed: %v", err)
+		}
+		if config.Container.Image != "golang:1.22" {
+			t.Errorf("Expected the profile image, got %s", config.Container.Image)
+		}
+		if len(config.Container.Setup) != 1 || config.Container.Setup[0] != "apk add git" {
+			t.Errorf("Expected the base setup to be kept, got %v", config.Container.Setup)
+		}
+		if len(config.Container.Mounts) != 2 {
+			t.Errorf("Expected the mounts to be merged, got %v", config.Container.Mounts)
+		}
+		expectedEnv := []string{"APP_ENV=ci", "DEBUG=1", "CI=true"}
+		if !reflect.DeepEqual(config.Container.Environment, expectedEnv) {
+			t.Errorf("Expected the environment merged by name %v, got %v", expectedEnv, config.Container.Environment)
+		}
+		if _, ok := config.GetScript("test"); !ok {
+			t.Error("Expected the base scripts to be kept")
+		}
+	})
+
+	t.Run("shell", func(t *testing.T) {
+		config := load(t)
+		if err := config.ApplyProfile("lint"); err != nil {
+			t.Fatalf("ApplyProfile() failed: %v", err)
+		}
+		if _, ok := config.GetScript("test"); ok {
+			t.Error("Expected the profile scripts to replace the base ones")
+		}
+		if _, ok := config.GetScript("lint"); !ok {
+			t.Error("Expected the profile script")
+		}
+		if config.Container.Image != "alpine:latest" {
+			t.Errorf("Expected the base image, got %s", config.Container.Image)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		config := load(t)
+		if err := config.ApplyProfile(""); err != nil {
+			t.Fatalf("ApplyProfile() failed: %v", err)
+		}
+		if config.Container.Image != "alpine:latest" || len(config.Container.Mounts) != 1 {
+			t.Errorf("Expected the config to be untouched, got %+v", config.Container)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		err := load(t).ApplyProfile("dev")
+		if err == nil || !strings.Contains(err.Error(), "available profiles are ci, lint") {
+			t.Errorf("Expected an unknown profile error, got %v", err)
+		}
+	})
+}
+
+func TestConfig_Hash(t *testing.T) {
+	base := `name: test
+container:
+  provider: docker
+  image: alpine:latest
+profiles:
+  ci:
+    container:
+      image: golang:1.22
+`
+	hashOf := func(t *testing.T, content, profile string) string {
+		t.Helper()
+		configFile := filepath.Join(t.TempDir(), ConfigFileName)
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		config, err := LoadConfigFromFile(configFile)
+		if err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		if err := config.ApplyProfile(profile); err != nil {
+			t.Fatalf("ApplyProfile() failed: %v", err)
+		}
+		hash, err := config.hash()
+		if err != nil {
+			t.Fatalf("hash() failed: %v", err)
+		}
+		if len(hash) != 12 {
+			t.Errorf("Expected a 12 character hash, got %q", hash)
+		}
+		return hash
+	}
+
+	baseHash := hashOf(t, base, "")
+
+	formatted := "# Project environment\n" + strings.Replace(base, "image: alpine:latest", "image: \"alpine:latest\"  # pinned", 1)
+	if hashOf(t, formatted, "") != baseHash {
+		t.Error("Expected comments and quoting not to change the hash")
+	}
+	if hashOf(t, strings.Replace(base, "docker", "podman", 1), "") == baseHash {
+		t.Error("Expected the provider to change the hash")
+	}
+	if hashOf(t, base, "ci") == baseHash {
+		t.Error("Expected the ci profile to change the hash")
+	}
+	if hashOf(t, strings.Replace(base, "golang:1.22", "golang:1.23", 1), "") != baseHash {
+		t.Error("Expected editing an unselected profile not to change the hash")
+	}
+}
+
+func TestLoadConfigFromFile_Extends(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "shared", "base.yaml"), `name: base
+container:
+  image: alpine:latest
+  setup:
+    - apk add git
+  environment:
+    - CI=false
+shell:
+  scripts:
+    - name: test
+      commands:
+        - echo base test
+    - name: lint
+      commands:
+        - echo lint
+`)
+		configFile := filepath.Join(dir, ConfigFileName)
+		write(t, configFile, `extends: shared/base.yaml
+name: app
+container:
+  setup:
+    - apk add make
+shell:
+  scripts:
+    - name: test
+      commands:
+        - go test ./...
+    - name: build
+      commands:
+        - go build ./...
+`)
+
+		config, err := LoadConfigFromFile(configFile)
+		if err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		if config.Name != "app" || config.Container.Image != "alpine:latest" {
+			t.Errorf("Expected local name and base image, got %s and %s", config.Name, config.Container.Image)
+		}
+		if !reflect.DeepEqual(config.Container.Setup, []string{"apk add git", "apk add make"}) {
+			t.Errorf("Expected setup to be appended, got %v", config.Container.Setup)
+		}
+		if !reflect.DeepEqual(config.Container.Environment, []string{"CI=false"}) {
+			t.Errorf("Expected the base environment, got %v", config.Container.Environment)
+		}
+
+		var names []string
+		for _, script := range config.Shell.Scripts {
+			names = append(names, script.Name)
+		}
+		if !reflect.DeepEqual(names, []string{"test", "lint", "build"}) {
+			t.Errorf("Expected scripts merged by name, got %v", names)
+		}
+		if script, _ := config.GetScript("test"); script.Commands[0] != "go test ./..." {
+			t.Errorf("Expected the local test script to win, got %v", script.Commands)
+		}
+	})
+
+	t.Run("base paths", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "shared", "scripts", "lint.sh"), "golangci-lint run")
+		write(t, filepath.Join(dir, "shared", "Dockerfile"), "FROM golang:1.22\n")
+		write(t, filepath.Join(dir, "shared", "base.env"), "GOFLAGS=-mod=mod\n")
+		write(t, filepath.Join(dir, "shared", "certs", "ca.pem"), "")
+		write(t, filepath.Join(dir, "shared", "base.yaml"), `container:
+  build:
+    dockerfile: Dockerfile
+  env_file:
+    - base.env
+  mounts:
+    certs:
+      host: certs
+      path: /certs
+  volumes:
+    - ./cache:/cache
+    - gomod:/go/pkg/mod
+    - ~/.ssh:/root/.ssh:ro
+shell:
+  scripts:
+    - name: lint
+      file: scripts/lint.sh
+profiles:
+  ci:
+    container:
+      env_file:
+        - base.env
+        - ci.env
+`)
+		configFile := filepath.Join(dir, "app", ConfigFileName)
+		write(t, configFile, `extends: ../shared/base.yaml
+name: app
+container:
+  env_file:
+    - app.env
+`)
+		write(t, filepath.Join(dir, "app", "app.env"), "PORT=8080\n")
+
+		config, err := LoadConfigFromFile(configFile)
+		if err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		if script, _ := config.GetScript("lint"); len(script.Commands) != 1 || script.Commands[0] != "golangci-lint run" {
+			t.Errorf("Expected the base script file to be read from the base directory, got %v", script.Commands)
+		}
+		if config.Container.Build.Dockerfile != "../shared/Dockerfile" {
+			t.Errorf("Expected the Dockerfile relative to the base, got %s", config.Container.Build.Dockerfile)
+		}
+		if !reflect.DeepEqual(config.Container.EnvFile, []string{"../shared/base.env", "app.env"}) {
+			t.Errorf("Expected base env files rebased and local ones kept, got %v", config.Container.EnvFile)
+		}
+		if host := config.Container.Mounts["certs"].Host; host != "../shared/certs" {
+			t.Errorf("Expected the mount relative to the base, got %s", host)
+		}
+		expectedVolumes := []string{"../shared/cache:/cache", "gomod:/go/pkg/mod", "~/.ssh:/root/.ssh:ro"}
+		if !reflect.DeepEqual(config.Container.Volumes, expectedVolumes) {
+			t.Errorf("Expected %v, got %v", expectedVolumes, config.Container.Volumes)
+		}
+		if profile := config.Profiles["ci"]; !reflect.DeepEqual(profile.Container.EnvFile, []string{"../shared/base.env", "../shared/ci.env"}) {
+			t.Errorf("Expected profile paths rebased too, got %v", profile.Container.EnvFile)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "go.yaml"), "container:\n  image: golang:1.22\n")
+		write(t, filepath.Join(dir, "pinned.yaml"), "container:\n  image: golang:1.22.5\n")
+		configFile := filepath.Join(dir, ConfigFileName)
+		write(t, configFile, "extends:\n  - go.yaml\n  - pinned.yaml\nname: app\n")
+
+		config, err := LoadConfigFromFile(configFile)
+		if err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		if config.Container.Image != "golang:1.22.5" {
+			t.Errorf("Expected the later base to win, got %s", config.Container.Image)
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		dir := t.TempDir()
+		for i := 0; i <= maxExtendsDepth; i++ {
+			write(t, filepath.Join(dir, fmt.Sprintf("%d.yaml", i)), fmt.Sprintf("extends: %d.yaml\n", i+1))
+		}
+		write(t, filepath.Join(dir, fmt.Sprintf("%d.yaml", maxExtendsDepth+1)), "name: app\ncontainer:\n  image: alpine\n")
+
+		_, err := LoadConfigFromFile(filepath.Join(dir, "0.yaml"))
+		if err == nil || !strings.Contains(err.Error(), "levels deep") {
+			t.Errorf("Expected a depth error, got %v", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{name: "missing", files: map[string]string{ConfigFileName: "extends: base.yaml\n"}, wantErr: "which was not found"},
+		{name: "cycle", files: map[string]string{
+			ConfigFileName: "extends: a.yaml\n",
+			"a.yaml":       "extends: b.yaml\n",
+			"b.yaml":       "extends: a.yaml\n",
+		}, wantErr: "extends cycle"},
+		{name: "url", files: map[string]string{ConfigFileName: "extends: https://example.com/base.yaml\n"}, wantErr: "only local files"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				write(t, filepath.Join(dir, name), content)
+			}
+
+			_, err := LoadConfigFromFile(filepath.Join(dir, ConfigFileName))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package mikoshell
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -11,24 +21,152 @@ import (
 // ContainerProvider defines the interface for container providers
 type ContainerProvider interface {
 	IsAvailable() bool
-	BuildImage(cfg *Config, tag string) error
-	RunCommand(cfg *Config, tag string, command []string) error
+	CheckDaemon() error
+	BuildImage(cfg *Config, tag string, opts BuildOptions) error
+	RunCommand(cfg *Config, tag string, command []string, opts RunOptions) error
 	RunShell(cfg *Config, tag string) error
 	RunShellWithStartup(cfg *Config, tag string) error
 	ImageExists(tag string) bool
 	RemoveImage(tag string) error
+	TagImage(src, dst string) error
+	SaveImage(tag, path string) error
+	LoadImage(path string) error
+	PullImage(cfg *Config, ref string) error
 	ListImages() ([]ImageListItem, error)
-	CleanImages(all bool) ([]string, error)
+	CleanImages(cfg *Config, keep []string) ([]string, error)
 	GetImageInfo(imageID string) (*ImageInfo, error)
+	InspectImage(imageID string) ([]byte, error)
+	ImageHistory(tag string) ([]LayerInfo, error)
 	GetPruneInfo() (*PruneInfo, error)
 	PruneImages() (*PruneResult, error)
+	PruneBuildCache() (*PruneResult, error)
+	CopyFromContainer(container, src, dest string) error
+	RemoveContainer(name string) error
+	StartContainer(cfg *Config, tag string, opts RunOptions) error
+	ExecCommand(cfg *Config, container string, command []string, opts RunOptions) error
+	VerifyImage(tag string, commands []string) error
+	HomeDir(cfg *Config, tag string) (string, error)
+}
+
+// Labels stamped on every image built by miko-shell
+const (
+	LabelName       = "org.mikoshell.name"
+	LabelConfigHash = "org.mikoshell.config-hash"
+	LabelVersion    = "org.mikoshell.version"
+)
+
+// InContainerEnv is set to "1" in every run and open container, so
+// miko-shell can tell it is being invoked from inside its own environment
+const InContainerEnv = "MIKO_IN_CONTAINER"
+
+// Version is the miko-shell version stamped on built images; the CLI sets it
+// from its build-time version
+var Version = "dev"
+
+// RunOptions holds per-invocation settings for running a command in a container
+type RunOptions struct {
+	// Name is the container name; an anonymous container is used when empty
+	Name string
+	// Keep prevents the container from being removed when it exits
+	Keep bool
+	// CopyOut lists container paths copied to the host after the command finishes
+	CopyOut []CopySpec
+	// ReplaceEntrypoint clears the image ENTRYPOINT so the command runs directly
+	ReplaceEntrypoint bool
+	// Literal runs the arguments as a command even when the first one names a script
+	Literal bool
+	// ShellWrap runs a direct command through "sh -c" with its arguments
+	// joined, so pipes and globs work; scripts always run through a shell
+	ShellWrap bool
+	// StrictArgs makes a script fail when it references a positional argument
+	// that wasn't passed, like shell.strict_args
+	StrictArgs bool
+	// Retries is the number of extra attempts made when the command fails
+	Retries int
+	// RetryDelay is the pause between attempts
+	RetryDelay time.Duration
+	// RerunWithTTY re-runs a failed command with a TTY attached, for tools
+	// whose output differs under a terminal. The command is exec'd into a
+	// container kept running, so the re-run sees the state the failure left.
+	RerunWithTTY bool
+	// TTY runs the command with an interactive terminal attached
+	TTY bool
+	// OutputPrefix is written at the start of every output line when set
+	OutputPrefix string
+	// Workdir runs the command in this directory, relative to the project
+	// mount, e.g. one package of a monorepo
+	Workdir string
+	// Summary prints how long each command of a script took after the run
+	Summary bool
+	// DumpEnv is a host file the container environment is written to just
+	// before the command runs, after the startup hooks
+	DumpEnv string
+	// Stdout and Stderr receive the command output; os.Stdout and os.Stderr when nil
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Build progress output modes
+const (
+	BuildProgressAuto  = "auto"
+	BuildProgressPlain = "plain"
+	BuildProgressTTY   = "tty"
+)
+
+// BuildOptions holds per-invocation settings for building an image
+type BuildOptions struct {
+	// Progress selects the BuildKit progress output (auto, plain or tty)
+	Progress string
+	// NoCache builds without the layer cache; container.build.no_cache
+	// enables this for the custom image regardless
+	NoCache bool
+	// BuildArgs override container.build.args for this build
+	BuildArgs map[string]string
+}
+
+// CopySpec describes a path copied out of a container to a host directory
+type CopySpec struct {
+	Src  string
+	Dest string
+}
+
+// cliProvider implements ContainerProvider on top of a docker-compatible CLI.
+// DockerProvider, PodmanProvider and NerdctlProvider configure it with their
+// binary and the few places where the CLIs differ.
+type cliProvider struct {
+	// binary is the CLI run for every command, e.g. "docker"
+	binary string
+	// targetFlag selects the daemon to talk to, e.g. "--context"; it is only
+	// passed when target is set
+	targetFlag string
+	target     string
+	// versionFormat is the "info --format" template printing the server version
+	versionFormat string
+	// buildKit passes the build progress flag and enables BuildKit for it
+	buildKit bool
+	// cdiGPUs requests GPUs as CDI devices (--device nvidia.com/gpu=...)
+	// instead of with --gpus
+	cdiGPUs bool
 }
 
 // DockerProvider implements the ContainerProvider interface for Docker
-type DockerProvider struct{}
+type DockerProvider struct {
+	// Context is the docker context to target; the current one when empty
+	Context string
+}
 
 // PodmanProvider implements the ContainerProvider interface for Podman
-type PodmanProvider struct{}
+type PodmanProvider struct {
+	// Connection is the podman system connection to target; the default when empty
+	Connection string
+}
+
+// NerdctlProvider implements the ContainerProvider interface for nerdctl
+// (containerd), whose CLI is docker-compatible
+type NerdctlProvider struct {
+	// Namespace is the containerd namespace to target; the default when empty
+	Namespace string
+}
 
 // NewContainerProvider creates a new container provider
 func NewContainerProvider(providerName string) (ContainerProvider, error) {
@@ -37,29 +175,700 @@ func NewContainerProvider(providerName string) (ContainerProvider, error) {
 		return &DockerProvider{}, nil
 	case "podman":
 		return &PodmanProvider{}, nil
+	case "nerdctl":
+		return &NerdctlProvider{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported container provider: %s", providerName)
 	}
 }
 
-// Docker Provider Implementation
-func (d *DockerProvider) IsAvailable() bool {
-	_, err := exec.LookPath("docker")
+// NewContainerProviderForConfig creates the provider selected by cfg, targeting
+// container.context (a docker context, podman connection or containerd
+// namespace) when set
+func NewContainerProviderForConfig(cfg *Config) (ContainerProvider, error) {
+	switch cfg.Container.Provider {
+	case "docker":
+		return &DockerProvider{Context: cfg.Container.Context}, nil
+	case "podman":
+		return &PodmanProvider{Connection: cfg.Container.Context}, nil
+	case "nerdctl":
+		return &NerdctlProvider{Namespace: cfg.Container.Context}, nil
+	default:
+		return nil, fmt.Errorf("unsupported container provider: %s", cfg.Container.Provider)
+	}
+}
+
+// cli returns the shared implementation configured for docker
+func (d *DockerProvider) cli() *cliProvider {
+	return &cliProvider{
+		binary:        "docker",
+		targetFlag:    "--context",
+		target:        d.Context,
+		versionFormat: "{{.ServerVersion}}",
+		buildKit:      true,
+	}
+}
+
+// cli returns the shared implementation configured for podman, which builds
+// without BuildKit so BuildOptions.Progress has no effect; its builder
+// handles RUN --mount on its own, so container.build.buildkit needs no flag
+func (p *PodmanProvider) cli() *cliProvider {
+	return &cliProvider{
+		binary:        "podman",
+		targetFlag:    "--connection",
+		target:        p.Connection,
+		versionFormat: "{{.Version.Version}}",
+		cdiGPUs:       true,
+	}
+}
+
+// cli returns the shared implementation configured for nerdctl
+func (n *NerdctlProvider) cli() *cliProvider {
+	return &cliProvider{
+		binary:        "nerdctl",
+		targetFlag:    "--namespace",
+		target:        n.Namespace,
+		versionFormat: "{{.ServerVersion}}",
+		buildKit:      true,
+	}
+}
+
+// commandFunc builds a provider command; ctx may bound how long it runs
+type commandFunc func(ctx context.Context, args ...string) *exec.Cmd
+
+// commandContext builds a provider command against the configured target
+func (c *cliProvider) commandContext(ctx context.Context, args ...string) *exec.Cmd {
+	if c.target != "" {
+		args = append([]string{c.targetFlag, c.target}, args...)
+	}
+	return exec.CommandContext(ctx, c.binary, args...)
+}
+
+// command builds a provider command against the configured target
+func (c *cliProvider) command(args ...string) *exec.Cmd {
+	return c.commandContext(context.Background(), args...)
+}
+
+// configHashPattern matches a config hash embedded in a tag rendered from
+// container.tag_format
+var configHashPattern = regexp.MustCompile(`(?:^|[^0-9a-f])([0-9a-f]{12})(?:[^0-9a-f]|$)`)
+
+// tagHash returns the config hash of an image tag, or "" if it has none
+func tagHash(tag string) string {
+	// Custom tag formats may place the hash anywhere; use the last one
+	if matches := configHashPattern.FindAllStringSubmatch(tag, -1); matches != nil {
+		return matches[len(matches)-1][1]
+	}
+
+	// Skip registry ports like host:5000/name
+	if i := strings.LastIndex(tag, ":"); i >= 0 && !strings.Contains(tag[i+1:], "/") {
+		return tag[i+1:]
+	}
+	return ""
+}
+
+// imageLabelArgs returns the --label arguments that stamp miko-shell metadata on a build
+func imageLabelArgs(cfg *Config, tag string) []string {
+	args := []string{"--label", fmt.Sprintf("%s=%s", LabelName, cfg.Name)}
+
+	if hash := tagHash(tag); hash != "" {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", LabelConfigHash, hash))
+	}
+	args = append(args, "--label", fmt.Sprintf("%s=%s", LabelVersion, Version))
+
+	return args
+}
+
+// customImageLabelArgs returns the --label arguments for the image built from
+// container.build: the miko-shell labels plus container.build.labels, sorted
+// by key. The runtime image inherits them through its FROM line.
+func customImageLabelArgs(cfg *Config, tag string) []string {
+	args := imageLabelArgs(cfg, tag)
+
+	labels := cfg.Container.Build.Labels
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	return args
+}
+
+// buildArgArgs returns the --build-arg arguments for the config build args
+// merged with the per-build overrides, which take precedence, sorted by key
+func buildArgArgs(configArgs, overrides map[string]string) []string {
+	merged := make(map[string]string, len(configArgs)+len(overrides))
+	for key, value := range configArgs {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, merged[key]))
+	}
+	return args
+}
+
+// progressArgs returns the docker build flag selecting the progress output.
+// auto is BuildKit's own default, so no flag is passed for it.
+func progressArgs(opts BuildOptions) []string {
+	if opts.Progress == "" || opts.Progress == BuildProgressAuto {
+		return nil
+	}
+	return []string{"--progress=" + opts.Progress}
+}
+
+// buildEnv returns the environment for docker build, enabling BuildKit when
+// the build needs it or a progress mode is requested, since the legacy
+// builder rejects --progress. A nil result inherits the current environment.
+func buildEnv(opts BuildOptions, buildKit bool) []string {
+	if !buildKit && len(progressArgs(opts)) == 0 {
+		return nil
+	}
+	return append(os.Environ(), "DOCKER_BUILDKIT=1")
+}
+
+// customImageTag returns the tag of the intermediate image built from
+// container.build. It is keyed by the config hash so build changes are rebuilt.
+func customImageTag(cfg *Config, tag string) string {
+	if hash := tagHash(tag); hash != "" {
+		return cfg.Name + ":custom-" + hash
+	}
+	return cfg.Name + ":custom"
+}
+
+// mikoShellTagPattern matches the tags miko-shell gives its images:
+// <name>:<config-hash> and the intermediate <name>:custom[-<config-hash>]
+var mikoShellTagPattern = regexp.MustCompile(`^([^:]+):(?:custom-)?([0-9a-f]{12}|custom)$`)
+
+// isMikoShellImage reports whether an image was built by miko-shell. Labeled
+// images are matched on LabelName; images built before labels were stamped
+// fall back to the tag naming convention. With a nil cfg any miko-shell image
+// matches, otherwise only the images of that project.
+func isMikoShellImage(item ImageListItem, cfg *Config) bool {
+	if name, ok := item.Labels[LabelName]; ok {
+		return cfg == nil || name == cfg.Name
+	}
+
+	// Podman lists local images under the localhost/ registry
+	match := mikoShellTagPattern.FindStringSubmatch(strings.TrimPrefix(item.Tag, "localhost/"))
+	if match == nil {
+		return false
+	}
+	return cfg == nil || match[1] == cfg.Name
+}
+
+// imageRefPattern matches an image reference: [registry[:port]/]path[:tag][@digest]
+var imageRefPattern = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?` +
+	`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+	`(?::[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?` +
+	`(?:@sha256:[a-f0-9]{64})?$`)
+
+// validateImageRef checks that ref is a well-formed image reference, optionally
+// pinned to a digest
+func validateImageRef(ref string) error {
+	if !imageRefPattern.MatchString(ref) {
+		return fmt.Errorf("invalid image reference '%s' (expected name[:tag][@sha256:digest])", ref)
+	}
+	return nil
+}
+
+// timezoneArgs returns the arguments that sync the host timezone into a
+// container when container.sync_timezone is set
+func timezoneArgs(cfg *Config) []string {
+	if !cfg.Container.SyncTimezone {
+		return nil
+	}
+
+	var args []string
+	if tz := detectHostTimezone(); tz != "" {
+		args = append(args, "-e", "TZ="+tz)
+	}
+
+	// Images without tzdata still pick up the host zone from /etc/localtime
+	if runtime.GOOS == "linux" {
+		if _, err := os.Stat("/etc/localtime"); err == nil {
+			args = append(args, "-v", "/etc/localtime:/etc/localtime:ro")
+		}
+	}
+
+	return args
+}
+
+// historyFormat is the Go template passed to "<provider> history --format"
+const historyFormat = "{{.ID}}\t{{.Size}}\t{{.CreatedBy}}"
+
+// parseImageHistory parses history output in historyFormat into layers
+func parseImageHistory(output []byte) []LayerInfo {
+	var layers []LayerInfo
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		layers = append(layers, LayerInfo{
+			ID:        fields[0],
+			Size:      fields[1],
+			CreatedBy: strings.TrimSpace(fields[2]),
+		})
+	}
+	return layers
+}
+
+// imageInspect holds the fields of "<provider> image inspect" output used by
+// GetImageInfo; Docker and Podman share this layout
+type imageInspect struct {
+	ID           string   `json:"Id"`
+	RepoTags     []string `json:"RepoTags"`
+	Created      time.Time
+	Size         int64
+	Os           string
+	Architecture string
+	Variant      string
+	Config       struct {
+		Labels       map[string]string
+		Env          []string
+		ExposedPorts map[string]struct{}
+	}
+	RootFS struct {
+		Layers []string
+	}
+}
+
+// parseImageInspect converts "<provider> image inspect" output into ImageInfo
+func parseImageInspect(output []byte) (*ImageInfo, error) {
+	var images []imageInspect
+	if err := json.Unmarshal(output, &images); err != nil {
+		return nil, fmt.Errorf("failed to parse image inspect output: %w", err)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("image inspect returned no images")
+	}
+	image := images[0]
+
+	info := &ImageInfo{
+		ID:           strings.TrimPrefix(image.ID, "sha256:"),
+		Tag:          strings.TrimPrefix(image.ID, "sha256:"),
+		Size:         formatSize(image.Size),
+		Created:      image.Created,
+		Platform:     image.Os + "/" + image.Architecture,
+		Labels:       image.Config.Labels,
+		Layers:       []LayerInfo{},
+		Env:          image.Config.Env,
+		ExposedPorts: []string{},
+	}
+	if len(image.RepoTags) > 0 {
+		info.Tag = image.RepoTags[0]
+	}
+	if image.Variant != "" {
+		info.Platform += "/" + image.Variant
+	}
+	if info.Labels == nil {
+		info.Labels = make(map[string]string)
+	}
+	if info.Env == nil {
+		info.Env = []string{}
+	}
+	for _, layer := range image.RootFS.Layers {
+		info.Layers = append(info.Layers, LayerInfo{ID: strings.TrimPrefix(layer, "sha256:")})
+	}
+	for port := range image.Config.ExposedPorts {
+		info.ExposedPorts = append(info.ExposedPorts, port)
+	}
+	sort.Strings(info.ExposedPorts)
+
+	return info, nil
+}
+
+// imageListFormat is the Go template passed to "<provider> images --format"
+const imageListFormat = "{{.ID}}\t{{.Repository}}:{{.Tag}}\t{{.Size}}\t{{.CreatedAt}}"
+
+// imageCreatedLayout is the layout of the CreatedAt field; Podman adds
+// fractional seconds, which time.Parse accepts without a layout change
+const imageCreatedLayout = "2006-01-02 15:04:05 -0700 MST"
+
+// parseImageList parses images output in imageListFormat, keeping only the
+// images built by miko-shell: the labeled ones, whose IDs are in labeled,
+// and older unlabeled ones named like miko-shell images
+func parseImageList(output []byte, labeled map[string]bool) []ImageListItem {
+	images := []ImageListItem{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\t", 4)
+		if len(fields) < 4 {
+			continue
+		}
+
+		item := ImageListItem{
+			ID:   fields[0],
+			Tag:  fields[1],
+			Size: fields[2],
+		}
+		if !labeled[item.ID] && !isMikoShellImage(item, nil) {
+			continue
+		}
+		if created, err := time.Parse(imageCreatedLayout, strings.TrimSpace(fields[3])); err == nil {
+			item.Created = created
+		}
+		images = append(images, item)
+	}
+	return images
+}
+
+// systemDFEntry is one row of "<provider> system df --format json". Docker
+// reports counts as strings and Podman as numbers; json.Number accepts both.
+type systemDFEntry struct {
+	Type        string
+	TotalCount  json.Number
+	Total       json.Number
+	Active      json.Number
+	Reclaimable string
+}
+
+// count returns the number of items in the row
+func (e systemDFEntry) count() int {
+	n := e.TotalCount
+	if n == "" {
+		n = e.Total
+	}
+	count, _ := n.Int64()
+	return int(count)
+}
+
+// parseSystemDF parses system df JSON output into prune information. Docker
+// prints one object per line, Podman a single array.
+func parseSystemDF(output []byte) (*PruneInfo, error) {
+	var entries []systemDFEntry
+	if trimmed := bytes.TrimSpace(output); bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse system df output: %w", err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		for decoder.More() {
+			var entry systemDFEntry
+			if err := decoder.Decode(&entry); err != nil {
+				return nil, fmt.Errorf("failed to parse system df output: %w", err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	info := &PruneInfo{BuildCacheSize: "0B"}
+	var reclaimable int64
+	for _, entry := range entries {
+		// Reclaimable reads like "1.2GB (40%)"
+		size := strings.TrimSpace(strings.SplitN(entry.Reclaimable, "(", 2)[0])
+		switch entry.Type {
+		case "Images":
+			active, _ := entry.Active.Int64()
+			info.TotalImages = entry.count()
+			info.UnusedImages = info.TotalImages - int(active)
+			reclaimable += parseSize(size)
+		case "Build Cache":
+			info.BuildCacheSize = formatSize(parseSize(size))
+			reclaimable += parseSize(size)
+		}
+	}
+	info.TotalSize = formatSize(reclaimable)
+
+	return info, nil
+}
+
+// parsePruneOutput extracts the removed image count and the reclaimed bytes
+// from "<provider> image prune" or "builder prune" output
+func parsePruneOutput(output []byte) (int, int64) {
+	removed := 0
+	var reclaimed int64
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "deleted:"):
+			removed++
+		case strings.HasPrefix(line, "Total reclaimed space:"):
+			reclaimed += parseSize(strings.TrimSpace(strings.TrimPrefix(line, "Total reclaimed space:")))
+		case strings.HasPrefix(line, "Total:"):
+			reclaimed += parseSize(strings.TrimSpace(strings.TrimPrefix(line, "Total:")))
+		}
+	}
+	return removed, reclaimed
+}
+
+// parseBuilderPruneOutput extracts the removed cache object count and the
+// reclaimed bytes from "builder prune" output, which is either a list under
+// "Deleted build cache objects:" or a table with an ID column
+func parseBuilderPruneOutput(output []byte) (int, int64) {
+	_, reclaimed := parsePruneOutput(output)
+
+	removed := 0
+	listing := false
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "Deleted build cache objects:" || strings.HasPrefix(line, "ID"):
+			listing = true
+		case line == "" || strings.HasPrefix(line, "Total"):
+			listing = false
+		case listing:
+			removed++
+		}
+	}
+	return removed, reclaimed
+}
+
+// countLines returns the number of non-empty lines, e.g. in "-q" output
+func countLines(output []byte) int {
+	count := 0
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// sizePattern matches the human-readable sizes printed by docker and podman
+var sizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([kKMGTP]?)B$`)
+
+// sizeUnits are the decimal size units used by docker and podman
+var sizeUnits = []string{"B", "kB", "MB", "GB", "TB", "PB"}
+
+// parseSize converts a human-readable size such as "1.2GB" to bytes; unknown
+// formats count as zero
+func parseSize(size string) int64 {
+	match := sizePattern.FindStringSubmatch(size)
+	if match == nil {
+		return 0
+	}
+
+	value, _ := strconv.ParseFloat(match[1], 64)
+	for _, unit := range sizeUnits {
+		if strings.EqualFold(strings.TrimSuffix(unit, "B"), match[2]) {
+			break
+		}
+		value *= 1000
+	}
+	return int64(value)
+}
+
+// formatSize renders bytes the way docker does, e.g. "1.2GB"
+func formatSize(size int64) string {
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(sizeUnits)-1 {
+		value /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.4g%s", value, sizeUnits[unit])
+}
+
+// daemonCheckTimeout bounds how long CheckDaemon waits for the daemon to answer
+const daemonCheckTimeout = 5 * time.Second
+
+// DaemonUnavailableError reports that the provider binary is installed but
+// its daemon or service cannot be reached
+type DaemonUnavailableError struct {
+	Provider string
+	Err      error
+}
+
+func (e *DaemonUnavailableError) Error() string {
+	return fmt.Sprintf("%s is installed but the daemon isn't running or reachable (%v); start it and try again", e.Provider, e.Err)
+}
+
+func (e *DaemonUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status carried by err, such as the code a
+// container command exited with: 0 for nil and 1 for errors without one
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// checkDaemon asks the provider for its server version, which fails fast
+// when the daemon or service is down
+func checkDaemon(provider string, command commandFunc, versionFormat string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), daemonCheckTimeout)
+	defer cancel()
+
+	cmd := command(ctx, "info", "--format", versionFormat)
+	if _, err := runner.Output(cmd); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("no answer within %s", daemonCheckTimeout)
+		}
+		return &DaemonUnavailableError{Provider: provider, Err: err}
+	}
+	return nil
+}
+
+// verifyImage runs each command in a throwaway container of tag, returning
+// the output of the first command that fails
+func verifyImage(providerCommand func(args ...string) *exec.Cmd, tag string, commands []string) error {
+	for _, command := range commands {
+		cmd := providerCommand("run", "--rm", "--entrypoint", "", tag,
+			"/bin/sh", "-c", fmt.Sprintf("{ %s\n} 2>&1", command))
+		output, err := runner.Output(cmd)
+		if err != nil {
+			return fmt.Errorf("verify command '%s' failed: %w\n%s", command, err, strings.TrimRight(string(output), "\n"))
+		}
+	}
+	return nil
+}
+
+// shellQuote wraps a value in single quotes for safe use in a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "'\"'\"'") + "'"
+}
+
+// wrapperCommands renders the script body for the in-container wrapper,
+// where the script arguments are the positional parameters. Missing arguments
+// with a default are appended with "set --", so $10, $@ and quoting behave as
+// in any shell script.
+func (s *Script) wrapperCommands(strict bool, indent string) string {
+	var body strings.Builder
+
+	last := 0
+	for i, arg := range s.Args {
+		if arg.Default != "" {
+			last = i + 1
+		}
+	}
+	for n := 1; n <= last; n++ {
+		body.WriteString(fmt.Sprintf("%s[ $# -ge %d ] || set -- \"$@\" %s\n", indent, n, shellQuote(s.argDefault(n))))
+	}
+
+	if strict {
+		required := 0
+		for _, command := range s.Commands {
+			if n := s.requiredArgs(command); n > required {
+				required = n
+			}
+		}
+		if required > 0 {
+			body.WriteString(indent + argsGuard(required) + "\n")
+		}
+	}
+
+	for _, command := range s.Commands {
+		body.WriteString(indent + command + "\n")
+	}
+	return body.String()
+}
+
+// startupCommands renders the shell.startup commands according to the startup policy.
+// The strict policy relies on the caller's "set -e"; the others guard each command.
+func startupCommands(cfg *Config) string {
+	var script strings.Builder
+
+	for _, cmd := range cfg.Shell.InitHook {
+		switch cfg.Shell.StartupPolicy {
+		case StartupPolicyContinue:
+			script.WriteString(fmt.Sprintf("if ! { %s\n}; then\n", cmd))
+			script.WriteString(fmt.Sprintf("  echo \"miko-shell: startup command failed, continuing: \"%s >&2\n", shellQuote(cmd)))
+			script.WriteString("fi\n")
+		case StartupPolicyPrompt:
+			script.WriteString(fmt.Sprintf("if ! { %s\n}; then\n", cmd))
+			script.WriteString(fmt.Sprintf("  echo \"miko-shell: startup command failed: \"%s >&2\n", shellQuote(cmd)))
+			script.WriteString("  printf 'Continue anyway? [y/N]: ' >&2\n")
+			script.WriteString("  read -r miko_answer || miko_answer=\"\"\n")
+			script.WriteString("  case \"$miko_answer\" in\n")
+			script.WriteString("    y|Y|yes|YES) ;;\n")
+			script.WriteString("    *) exit 1 ;;\n")
+			script.WriteString("  esac\n")
+			script.WriteString("fi\n")
+		default:
+			script.WriteString(cmd + "\n")
+		}
+	}
+
+	return script.String()
+}
+
+// interactiveShellCommand returns the POSIX snippet that starts the interactive
+// login shell: container.shell when set, falling back to /bin/sh if the image
+// lacks it, otherwise bash when shell.interactive is "auto" and it exists
+func interactiveShellCommand(cfg *Config) string {
+	if shell := cfg.Container.Shell; shell != "" {
+		return fmt.Sprintf(`if [ -x %[1]s ]; then
+  exec %[1]s --login
+fi
+echo "miko-shell: %[2]s not found in the image, falling back to /bin/sh" >&2
+exec /bin/sh --login`, shellQuote(shell), shell)
+	}
+
+	if cfg.Shell.Interactive != InteractiveShellAuto {
+		return "exec /bin/sh --login"
+	}
+
+	return `if command -v bash >/dev/null 2>&1; then
+  exec bash --login
+fi
+exec /bin/sh --login`
+}
+
+// startupScriptCommand returns the POSIX snippet that runs /tmp/startup.sh,
+// under container.shell when it is set and exists in the image
+func startupScriptCommand(cfg *Config) string {
+	if cfg.Container.Shell == "" {
+		return "exec /tmp/startup.sh"
+	}
+	return fmt.Sprintf(`if [ -x %[1]s ]; then
+  exec %[1]s /tmp/startup.sh
+fi
+exec /tmp/startup.sh`, shellQuote(cfg.Container.Shell))
+}
+
+// IsAvailable reports whether the provider CLI is installed
+func (c *cliProvider) IsAvailable() bool {
+	_, err := exec.LookPath(c.binary)
 	return err == nil
 }
 
-func (d *DockerProvider) BuildImage(cfg *Config, tag string) error {
+// CheckDaemon reports a DaemonUnavailableError when the daemon, service or
+// machine behind the CLI is unreachable
+func (c *cliProvider) CheckDaemon() error {
+	return checkDaemon(c.binary, c.commandContext, c.versionFormat)
+}
+
+func (c *cliProvider) BuildImage(cfg *Config, tag string, opts BuildOptions) error {
 	// First, build custom image if needed
 	if cfg.Container.Build != nil {
-		if err := d.buildCustomImage(cfg); err != nil {
+		if err := c.buildCustomImage(cfg, tag, opts); err != nil {
 			return fmt.Errorf("failed to build custom image: %w", err)
 		}
 	}
 
-	return d.buildImage(cfg, tag)
+	return c.buildImage(cfg, tag, opts)
+}
+
+func (c *cliProvider) RunCommand(cfg *Config, tag string, command []string, opts RunOptions) error {
+	return c.runContainer(cfg, tag, withStartup(cfg, command), opts.TTY, opts)
 }
 
-func (d *DockerProvider) RunCommand(cfg *Config, tag string, command []string) error {
+// withStartup returns command preceded by the shell.init_hook commands, with
+// the variables they export persisted for later shells. Without hooks the
+// command is returned as is.
+func withStartup(cfg *Config, command []string) []string {
 	// If there are startup commands, we need to run them first to set up environment variables
 	if len(cfg.Shell.InitHook) > 0 {
 		// Create startup script
@@ -67,9 +876,7 @@ func (d *DockerProvider) RunCommand(cfg *Config, tag string, command []string) e
 		startupScript.WriteString("#!/bin/sh\n")
 		startupScript.WriteString("set -e\n\n")
 
-		for _, cmd := range cfg.Shell.InitHook {
-			startupScript.WriteString(cmd + "\n")
-		}
+		startupScript.WriteString(startupCommands(cfg))
 
 		// Properly escape the original command for execution
 		var commandStr string
@@ -118,21 +925,24 @@ fi
 			startupScript.String(),
 			commandStr)
 
-		return d.runContainer(cfg, tag, []string{"/bin/sh", "-c", fullCommand}, false)
+		return []string{"/bin/sh", "-c", fullCommand}
 	}
 
 	// No startup commands, run directly
-	return d.runContainer(cfg, tag, command, false)
+	return command
 }
 
-func (d *DockerProvider) RunShell(cfg *Config, tag string) error {
-	return d.runContainer(cfg, tag, []string{"/bin/sh"}, true)
+func (c *cliProvider) RunShell(cfg *Config, tag string) error {
+	if cfg.Shell.Interactive == InteractiveShellAuto || cfg.Container.Shell != "" {
+		return c.runContainer(cfg, tag, []string{"/bin/sh", "-c", interactiveShellCommand(cfg)}, true, RunOptions{})
+	}
+	return c.runContainer(cfg, tag, []string{"/bin/sh"}, true, RunOptions{})
 }
 
-func (d *DockerProvider) RunShellWithStartup(cfg *Config, tag string) error {
+func (c *cliProvider) RunShellWithStartup(cfg *Config, tag string) error {
 	// If no startup commands and no scripts are defined, just run the shell
 	if len(cfg.Shell.InitHook) == 0 && len(cfg.Shell.Scripts) == 0 {
-		return d.RunShell(cfg, tag)
+		return c.RunShell(cfg, tag)
 	}
 
 	// 1. Script de startup original
@@ -145,9 +955,8 @@ func (d *DockerProvider) RunShellWithStartup(cfg *Config, tag string) error {
 	startupScript.WriteString("env | sort > /tmp/env-before.txt\n\n")
 
 	// Agregar comandos de startup
-	for _, cmd := range cfg.Shell.InitHook {
-		startupScript.WriteString(cmd + "\n\n")
-	}
+	startupScript.WriteString(startupCommands(cfg))
+	startupScript.WriteString("\n")
 
 	// Capture environment changes and persist them automatically
 	startupScript.WriteString("# Capture environment changes and persist them\n")
@@ -211,34 +1020,10 @@ func (d *DockerProvider) RunShellWithStartup(cfg *Config, tag string) error {
 	// Agregar case para cada script
 	for _, script := range cfg.Shell.Scripts {
 		mikoShell.WriteString(fmt.Sprintf("    %s)\n", script.Name))
-		mikoShell.WriteString("      # Ejecutar script con argumentos pasados\n")
-
-		// Exportar variables para los argumentos posicionales
-		mikoShell.WriteString("      # Establecer argumentos posicionales\n")
-		mikoShell.WriteString("      i=1\n")
-		mikoShell.WriteString("      for arg in \"$@\"; do\n")
-		mikoShell.WriteString("        export \"_MIKO_ARG_${i}=$arg\"\n")
-		mikoShell.WriteString("        i=$((i+1))\n")
-		mikoShell.WriteString("      done\n\n")
-
-		// Ejecutar cada comando del script, reemplazando $1, $2, etc. con las variables exportadas
-		for _, cmd := range script.Commands {
-			// Reemplazar $1, $2, etc. con las variables _MIKO_ARG_1, _MIKO_ARG_2, etc.
-			processedCmd := cmd
-			for i := 1; i <= 9; i++ {
-				placeholder := fmt.Sprintf("$%d", i)
-				replacement := fmt.Sprintf("${_MIKO_ARG_%d:-}", i)
-				processedCmd = strings.ReplaceAll(processedCmd, placeholder, replacement)
-			}
-			mikoShell.WriteString(fmt.Sprintf("      %s\n", processedCmd))
+		if cfg.Shell.Flags != "" {
+			mikoShell.WriteString("      set " + cfg.Shell.Flags + "\n")
 		}
-
-		// Limpiar las variables de argumentos
-		mikoShell.WriteString("\n      # Limpiar variables de argumentos\n")
-		mikoShell.WriteString("      for j in $(seq 1 $((i-1))); do\n")
-		mikoShell.WriteString("        unset \"_MIKO_ARG_${j}\"\n")
-		mikoShell.WriteString("      done\n")
-
+		mikoShell.WriteString(script.wrapperCommands(cfg.Shell.StrictArgs, "      "))
 		mikoShell.WriteString("      return $?\n")
 		mikoShell.WriteString("      ;;\n")
 	}
@@ -373,111 +1158,402 @@ cat > /tmp/startup.sh << 'MIKO_SCRIPT_EOF'
 %s
 # Export PATH for interactive shell
 export PATH="/go/bin:/usr/local/go/bin:$PATH"
-# Start interactive shell
-exec /bin/sh --login
+# Start interactive shell in the workdir, even if a startup command changed directory
+cd %s
+%s
 MIKO_SCRIPT_EOF
 
 chmod +x /tmp/startup.sh
-exec /tmp/startup.sh`,
+%s`,
 		version,
 		mikoShell.String(),
 
-		startupScript.String())
+		startupScript.String(),
+		shellQuote(cfg.workdir()),
+		interactiveShellCommand(cfg),
+		startupScriptCommand(cfg))
 
 	// Run the command
-	return d.runContainer(cfg, tag, []string{"/bin/sh", "-c", shellCommand}, true)
+	return c.runContainer(cfg, tag, []string{"/bin/sh", "-c", shellCommand}, true, RunOptions{})
 }
 
-func (d *DockerProvider) ImageExists(tag string) bool {
-	cmd := exec.Command("docker", "image", "inspect", tag)
-	return cmd.Run() == nil
+func (c *cliProvider) ImageExists(tag string) bool {
+	cmd := c.command("image", "inspect", tag)
+	return runner.Run(cmd) == nil
 }
 
-func (d *DockerProvider) RemoveImage(tag string) error {
-	cmd := exec.Command("docker", "rmi", "-f", tag)
-	return cmd.Run()
+func (c *cliProvider) RemoveImage(tag string) error {
+	cmd := c.command("rmi", "-f", tag)
+	return runner.Run(cmd)
 }
 
-func (d *DockerProvider) buildCustomImage(cfg *Config) error {
-	build := cfg.Container.Build
-	customTag := cfg.Name + ":custom"
-
-	// Check if custom image already exists
-	if d.ImageExists(customTag) {
-		return nil
-	}
-
-	args := []string{"build", "-t", customTag, "-f", build.Dockerfile}
-
-	// Add build args if specified
-	for key, value := range build.Args {
-		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, value))
-	}
-
-	// Add context path
-	args = append(args, build.Context)
-
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
+func (c *cliProvider) TagImage(src, dst string) error {
+	cmd := c.command("tag", src, dst)
 	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+	return runner.Run(cmd)
 }
 
-func (d *DockerProvider) buildImage(cfg *Config, tag string) error {
-	dockerfile := d.generateDockerfile(cfg)
+// SaveImage writes tag to path as a tarball that "docker load" imports
+func (c *cliProvider) SaveImage(tag, path string) error {
+	cmd := c.command("save", "-o", path, tag)
+	cmd.Stderr = os.Stderr
+	return runner.Run(cmd)
+}
 
-	cmd := exec.Command("docker", "build", "-t", tag, "-f", "-", ".")
-	cmd.Stdin = strings.NewReader(dockerfile)
+// LoadImage imports the images in a tarball written by "docker save"
+func (c *cliProvider) LoadImage(path string) error {
+	cmd := c.command("load", "-i", path)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	return runner.Run(cmd)
+}
 
-	return cmd.Run()
+// PullImage pulls ref from its registry
+func (c *cliProvider) PullImage(cfg *Config, ref string) error {
+	return runRetried(cfg, func() *exec.Cmd {
+		cmd := c.command("pull", ref)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd
+	})
 }
 
-func (d *DockerProvider) runContainer(cfg *Config, tag string, command []string, interactive bool) error {
-	args := []string{"run", "--rm"}
+// buildRetryDelay is the wait before the first retry of a build or pull,
+// doubled for each further one; a variable so tests don't wait
+var buildRetryDelay = 2 * time.Second
+
+// transientPatterns are lowercase fragments of engine output pointing at a
+// network or registry problem, which may pass when retried
+var transientPatterns = []string{
+	"timeout",
+	"timed out",
+	"connection reset",
+	"connection refused",
+	"tls handshake",
+	"temporary failure in name resolution",
+	"temporary failure resolving",
+	"no such host",
+	"network is unreachable",
+	"unexpected eof",
+	"toomanyrequests",
+	"too many requests",
+	"bad gateway",
+	"service unavailable",
+	"internal server error",
+}
 
-	if interactive {
-		args = append(args, "-it")
+// isTransientOutput reports whether failed build or pull output looks like a
+// network or registry problem rather than e.g. a Dockerfile error
+func isTransientOutput(output string) bool {
+	output = strings.ToLower(output)
+	for _, pattern := range transientPatterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Add host platform environment variables
-	hostOS, hostArch, err := detectHostPlatform()
-	if err == nil {
-		args = append(args, "-e", fmt.Sprintf("MIKO_HOST_OS=%s", hostOS))
-		args = append(args, "-e", fmt.Sprintf("MIKO_HOST_ARCH=%s", hostArch))
+// runRetried runs the build or pull command made by newCmd, running a fresh
+// one up to container.build_retries more times with exponential backoff while
+// it fails with transient-looking output
+func runRetried(cfg *Config, newCmd func() *exec.Cmd) error {
+	if cfg.Container.BuildRetries == 0 {
+		// Without retries the output stays on the terminal, keeping TTY progress
+		return runner.Run(newCmd())
 	}
 
-	// Mount current directory
-	workingDir, _ := os.Getwd()
-	args = append(args, "-v", fmt.Sprintf("%s:/workspace", workingDir))
-	args = append(args, "-w", "/workspace")
+	delay := buildRetryDelay
+	for attempt := 0; ; attempt++ {
+		cmd := newCmd()
+		// Keep a copy of the output to tell transient failures apart
+		var output bytes.Buffer
+		cmd.Stdout = io.MultiWriter(writerOr(cmd.Stdout, io.Discard), &output)
+		cmd.Stderr = io.MultiWriter(writerOr(cmd.Stderr, io.Discard), &output)
+
+		err := runner.Run(cmd)
+		if err == nil || attempt >= cfg.Container.BuildRetries || !isTransientOutput(output.String()) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Attempt %d/%d failed with a network or registry error: %v; retrying in %s\n",
+			attempt+1, cfg.Container.BuildRetries+1, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (c *cliProvider) buildCustomImage(cfg *Config, tag string, opts BuildOptions) error {
+	build := cfg.Container.Build
+	customTag := customImageTag(cfg, tag)
+
+	dockerfile, context, err := cfg.buildPaths()
+	if err != nil {
+		return err
+	}
+	contextArgs, err := cfg.buildContextArgs()
+	if err != nil {
+		return err
+	}
+
+	// Reuse an existing custom image unless a fresh build was requested
+	noCache := opts.NoCache || build.NoCache
+	if !noCache && c.ImageExists(customTag) {
+		return nil
+	}
+
+	args := []string{"build", "-t", customTag, "-f", dockerfile}
+
+	args = append(args, buildArgArgs(build.Args, opts.BuildArgs)...)
+	args = append(args, contextArgs...)
+	args = append(args, customImageLabelArgs(cfg, tag)...)
+	if noCache {
+		args = append(args, "--no-cache")
+	}
+
+	if c.buildKit {
+		args = append(args, progressArgs(opts)...)
+	}
+
+	// Add context path
+	args = append(args, context)
+
+	return runRetried(cfg, func() *exec.Cmd {
+		cmd := c.command(args...)
+		if c.buildKit {
+			cmd.Env = buildEnv(opts, build.BuildKit)
+		}
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd
+	})
+}
+
+func (c *cliProvider) buildImage(cfg *Config, tag string, opts BuildOptions) error {
+	dockerfile := c.generateDockerfile(cfg, tag)
+
+	args := []string{"build", "-t", tag}
+	args = append(args, imageLabelArgs(cfg, tag)...)
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if c.buildKit {
+		args = append(args, progressArgs(opts)...)
+	}
+	args = append(args, "-f", "-", cfg.resolvePath("."))
+
+	return runRetried(cfg, func() *exec.Cmd {
+		cmd := c.command(args...)
+		if c.buildKit {
+			cmd.Env = buildEnv(opts, false)
+		}
+		cmd.Stdin = strings.NewReader(dockerfile)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd
+	})
+}
+
+// gpuArgs returns the run flags requesting gpus, a container.gpus value
+func (c *cliProvider) gpuArgs(gpus string) ([]string, error) {
+	if !c.cdiGPUs {
+		// --gpus reads a CSV field, so a device list must be quoted
+		if strings.Contains(gpus, ",") {
+			gpus = `"` + gpus + `"`
+		}
+		return []string{"--gpus", gpus}, nil
+	}
+
+	if gpus == "all" {
+		return []string{"--device", "nvidia.com/gpu=all"}, nil
+	}
+	// CDI devices are named, so there is no way to ask for a number of them
+	ids, ok := strings.CutPrefix(gpus, "device=")
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support 'container.gpus: %s': it selects GPUs by device, so use 'all' or 'device=<id>[,<id>...]'", c.binary, gpus)
+	}
+	var args []string
+	for _, id := range strings.Split(ids, ",") {
+		args = append(args, "--device", "nvidia.com/gpu="+id)
+	}
+	return args, nil
+}
 
+func (c *cliProvider) runContainer(cfg *Config, tag string, command []string, interactive bool, opts RunOptions) error {
+	args, err := c.runFlags(cfg, interactive, opts)
+	if err != nil {
+		return err
+	}
+	args = append([]string{"run"}, args...)
 	args = append(args, tag)
 	args = append(args, command...)
 
-	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
+	cmd := c.command(args...)
+	cmd.Stdout = writerOr(opts.Stdout, os.Stdout)
+	cmd.Stderr = writerOr(opts.Stderr, os.Stderr)
+	cmd.Stdin = os.Stdin
+
+	return runner.Run(cmd)
+}
+
+// idleCommand keeps a started container running until it is removed
+var idleCommand = []string{"/bin/sh", "-c", "while :; do sleep 3600; done"}
+
+// StartContainer starts a detached container named opts.Name that idles
+// until removed, for commands to be exec'd into. Its entrypoint is cleared
+// so the idle command is what runs.
+func (c *cliProvider) StartContainer(cfg *Config, tag string, opts RunOptions) error {
+	opts.ReplaceEntrypoint = true
+	args, err := c.runFlags(cfg, false, opts)
+	if err != nil {
+		return err
+	}
+	args = append([]string{"run", "-d"}, args...)
+	args = append(args, tag)
+	args = append(args, idleCommand...)
+
+	cmd := c.command(args...)
 	cmd.Stderr = os.Stderr
+	return runner.Run(cmd)
+}
+
+// ExecCommand runs command in the running container, with the startup hooks
+// and workdir a run would use; the container provides the rest of the setup
+func (c *cliProvider) ExecCommand(cfg *Config, container string, command []string, opts RunOptions) error {
+	args := []string{"exec"}
+	if opts.TTY {
+		args = append(args, "-it")
+	}
+	args = append(args, "-w", path.Join(cfg.workdir(), opts.Workdir), container)
+	args = append(args, withStartup(cfg, command)...)
+
+	cmd := c.command(args...)
+	cmd.Stdout = writerOr(opts.Stdout, os.Stdout)
+	cmd.Stderr = writerOr(opts.Stderr, os.Stderr)
 	cmd.Stdin = os.Stdin
 
-	return cmd.Run()
+	return runner.Run(cmd)
+}
+
+// runFlags returns the "run" flags for a project container, everything
+// between "run" and the image tag
+func (c *cliProvider) runFlags(cfg *Config, interactive bool, opts RunOptions) ([]string, error) {
+	// Catch unmountable workspaces here; the engine's own errors are cryptic
+	if _, err := cfg.CheckWorkspace(); err != nil {
+		return nil, err
+	}
+
+	var args []string
+
+	if !opts.Keep {
+		args = append(args, "--rm")
+	}
+
+	if opts.Name != "" {
+		args = append(args, "--name", opts.Name)
+	}
+
+	if opts.ReplaceEntrypoint {
+		args = append(args, "--entrypoint", "")
+	}
+
+	if interactive {
+		args = append(args, "-it")
+	}
+
+	if cfg.Container.Init {
+		args = append(args, "--init")
+	}
+
+	if cfg.Container.Network != "" {
+		args = append(args, "--network", cfg.Container.Network)
+	}
+
+	if cfg.Container.GPUs != "" {
+		gpuArgs, err := c.gpuArgs(cfg.Container.GPUs)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, gpuArgs...)
+	}
+
+	// Add host platform environment variables
+	hostOS, hostArch, err := detectHostPlatform()
+	if err == nil {
+		args = append(args, "-e", fmt.Sprintf("MIKO_HOST_OS=%s", hostOS))
+		args = append(args, "-e", fmt.Sprintf("MIKO_HOST_ARCH=%s", hostArch))
+	}
+
+	args = append(args, timezoneArgs(cfg)...)
+	args = append(args, cfg.userArgs()...)
+
+	for _, port := range cfg.Container.Ports {
+		args = append(args, "-p", port)
+	}
+
+	// Docker Desktop defines host.docker.internal; on Linux it must be added.
+	// Podman 5.3+ resolves host-gateway; older versions only provide host.containers.internal
+	if cfg.Container.HostGateway {
+		args = append(args, "--add-host", "host.docker.internal:host-gateway")
+	}
+
+	// Variables set with -e take precedence over the env files
+	envFileArgs, err := cfg.envFileArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, envFileArgs...)
+
+	// Prefix matches come first so explicit environment entries override them
+	args = append(args, cfg.passEnvArgs(os.Environ())...)
+
+	// The provider resolves bare KEY entries from the host environment
+	for _, entry := range cfg.Container.Environment {
+		args = append(args, "-e", entry)
+	}
+
+	// Mark the container so a nested miko-shell refuses to run
+	args = append(args, "-e", InContainerEnv+"=1")
+
+	// Mount current directory
+	args = append(args, "-v", fmt.Sprintf("%s:%s", cfg.hostMountPath(cfg.workspaceDir()), cfg.workdir()))
+	args = append(args, "-w", path.Join(cfg.workdir(), opts.Workdir))
+
+	mountArgs, err := cfg.mountArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, mountArgs...)
+
+	volumeArgs, err := cfg.volumeArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, volumeArgs...)
+
+	// Extra engine flags come last so they can add to anything above
+	args = append(args, cfg.Container.RunArgs...)
+
+	return args, nil
 }
 
-func (d *DockerProvider) generateDockerfile(cfg *Config) string {
+func (c *cliProvider) generateDockerfile(cfg *Config, tag string) string {
 	var dockerfile strings.Builder
 
 	// Handle custom build or base image
 	if cfg.Container.Build != nil {
 		// For custom builds, we'll build the custom image first
 		// This function generates a runtime Dockerfile that uses the custom image
-		dockerfile.WriteString(fmt.Sprintf("FROM %s\n", cfg.Name+":custom"))
+		dockerfile.WriteString(fmt.Sprintf("FROM %s\n", customImageTag(cfg, tag)))
 	} else {
 		dockerfile.WriteString(fmt.Sprintf("FROM %s\n", cfg.Container.Image))
 	}
 
-	dockerfile.WriteString("WORKDIR /workspace\n")
+	dockerfile.WriteString(fmt.Sprintf("WORKDIR %s\n", cfg.workdir()))
+
+	// Copy local files before setup so setup commands can use them
+	for _, entry := range cfg.Container.Copy {
+		dockerfile.WriteString(fmt.Sprintf("COPY %s %s\n", entry.Src, entry.Dest))
+	}
 
 	// Add setup commands
 	for _, cmd := range cfg.Container.Setup {
@@ -489,563 +1565,603 @@ func (d *DockerProvider) generateDockerfile(cfg *Config) string {
 	return dockerfile.String()
 }
 
-// Podman Provider Implementation
-func (p *PodmanProvider) IsAvailable() bool {
-	_, err := exec.LookPath("podman")
-	return err == nil
-}
+// ListImages implementation for cliProvider
+func (c *cliProvider) ListImages() ([]ImageListItem, error) {
+	// The image list has no labels, so the labeled images, whatever their
+	// container.tag_format, are found with a filtered listing
+	labeled, err := c.labeledImages(LabelName)
+	if err != nil {
+		return nil, err
+	}
 
-func (p *PodmanProvider) BuildImage(cfg *Config, tag string) error {
-	// First, build custom image if needed
-	if cfg.Container.Build != nil {
-		if err := p.buildCustomImage(cfg); err != nil {
-			return fmt.Errorf("failed to build custom image: %w", err)
-		}
+	output, err := runner.Output(c.command("images", "--format", imageListFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
 	}
+	return parseImageList(output, labeled), nil
+}
 
-	return p.buildImage(cfg, tag)
+// labeledImages returns the IDs of the images matching a label filter, e.g.
+// "key" or "key=value"
+func (c *cliProvider) labeledImages(filter string) (map[string]bool, error) {
+	output, err := runner.Output(c.command("images", "--filter", "label="+filter, "--format", "{{.ID}}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	ids := make(map[string]bool)
+	for _, id := range strings.Fields(string(output)) {
+		ids[id] = true
+	}
+	return ids, nil
 }
 
-func (p *PodmanProvider) RunCommand(cfg *Config, tag string, command []string) error {
-	// If there are startup commands, we need to run them first to set up environment variables
-	if len(cfg.Shell.InitHook) > 0 {
-		// Create startup script
-		var startupScript strings.Builder
-		startupScript.WriteString("#!/bin/sh\n")
-		startupScript.WriteString("set -e\n\n")
+// CleanImages removes the images of the project cfg defines, except those
+// sharing an ID with a reference in keep, and returns the removed references.
+// Images labeled for another project are left alone even if their tag looks
+// like this project's.
+func (c *cliProvider) CleanImages(cfg *Config, keep []string) ([]string, error) {
+	labeled, err := c.labeledImages(LabelName)
+	if err != nil {
+		return nil, err
+	}
+	project, err := c.labeledImages(LabelName + "=" + cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runner.Output(c.command("images", "--format", imageListFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
 
-		for _, cmd := range cfg.Shell.InitHook {
-			startupScript.WriteString(cmd + "\n")
+	var images []ImageListItem
+	for _, item := range parseImageList(output, labeled) {
+		if project[item.ID] || (!labeled[item.ID] && isMikoShellImage(item, cfg)) {
+			images = append(images, item)
 		}
+	}
 
-		// Properly escape the original command for execution
-		var commandStr string
-		if len(command) == 3 && command[0] == "/bin/sh" && command[1] == "-c" {
-			// This is already a shell command, use it directly
-			commandStr = command[2]
-		} else {
-			// This is a direct command, need to properly quote arguments
-			escapedArgs := make([]string, len(command))
-			for i, arg := range command {
-				escapedArgs[i] = fmt.Sprintf("'%s'", strings.ReplaceAll(arg, "'", "'\"'\"'"))
+	// Keep kept images under every tag, e.g. after image retag
+	kept := make(map[string]bool)
+	for _, ref := range keep {
+		for _, item := range images {
+			if item.Tag == ref || item.Tag == "localhost/"+ref {
+				kept[item.ID] = true
 			}
-			commandStr = strings.Join(escapedArgs, " ")
 		}
+	}
 
-		// Create the complete command that runs startup, captures env, then runs the target command
-		fullCommand := fmt.Sprintf(`
-# Capture environment before startup
-env | sort > /tmp/env_before.txt
+	removed := []string{}
+	for _, item := range images {
+		if kept[item.ID] {
+			continue
+		}
+		// Untagged images can only be removed by ID
+		ref := item.Tag
+		if strings.Contains(ref, "<none>") {
+			ref = item.ID
+		}
+		if err := c.RemoveImage(ref); err != nil {
+			return removed, fmt.Errorf("failed to remove image '%s': %w", ref, err)
+		}
+		removed = append(removed, ref)
+	}
+	return removed, nil
+}
 
-# Run startup script
-%s
+// GetImageInfo implementation for cliProvider
+func (c *cliProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
+	output, err := c.InspectImage(imageID)
+	if err != nil {
+		return nil, err
+	}
+	return parseImageInspect(output)
+}
 
-# Capture environment after startup
-env | sort > /tmp/env_after.txt
+// InspectImage implementation for cliProvider
+func (c *cliProvider) InspectImage(imageID string) ([]byte, error) {
+	output, err := runner.Output(c.command("image", "inspect", imageID))
+	if err != nil {
+		return nil, fmt.Errorf("image '%s' not found: %w", imageID, err)
+	}
+	return output, nil
+}
 
-# Find new environment variables and create environment file
-comm -13 /tmp/env_before.txt /tmp/env_after.txt > /tmp/env_new.txt
-if [ -s /tmp/env_new.txt ]; then
-  mkdir -p /etc/profile.d
-  {
-    echo '# Auto-generated environment variables from miko-shell startup'
-    while IFS='=' read -r var_line || [ -n "$var_line" ]; do
-      if [ -n "$var_line" ]; then
-        echo "export $var_line"
-      fi
-    done < /tmp/env_new.txt
-  } > /etc/profile.d/miko-shell-env.sh
-  
-  # Source the environment file in current shell
-  . /etc/profile.d/miko-shell-env.sh
-fi
+// ImageHistory implementation for cliProvider
+func (c *cliProvider) ImageHistory(tag string) ([]LayerInfo, error) {
+	cmd := c.command("history", "--no-trunc", "--format", historyFormat, tag)
+	output, err := runner.Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history of image '%s': %w", tag, err)
+	}
+	return parseImageHistory(output), nil
+}
 
-# Run the actual command in the same shell context
-%s`,
-			startupScript.String(),
-			commandStr)
+// GetPruneInfo implementation for cliProvider
+func (c *cliProvider) GetPruneInfo() (*PruneInfo, error) {
+	output, err := runner.Output(c.command("system", "df", "--format", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk usage: %w", err)
+	}
+	info, err := parseSystemDF(output)
+	if err != nil {
+		return nil, err
+	}
 
-		return p.runContainer(cfg, tag, []string{"/bin/sh", "-c", fullCommand}, false)
+	// "image prune" only removes dangling images, so count those rather than
+	// everything system df reports as reclaimable
+	dangling, danglingSize, err := c.danglingImages()
+	if err != nil {
+		return nil, err
 	}
+	info.DanglingImages = dangling
+	info.TotalSize = formatSize(danglingSize + parseSize(info.BuildCacheSize))
 
-	// No startup commands, run directly
-	return p.runContainer(cfg, tag, command, false)
+	return info, nil
 }
 
-func (p *PodmanProvider) RunShell(cfg *Config, tag string) error {
-	return p.runContainer(cfg, tag, []string{"/bin/sh"}, true)
+// danglingImages returns the number and total size of the dangling images,
+// which are the ones "image prune" removes
+func (c *cliProvider) danglingImages() (int, int64, error) {
+	output, err := runner.Output(c.command("images", "--filter", "dangling=true", "--format", "{{.Size}}"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list dangling images: %w", err)
+	}
+
+	count := 0
+	var size int64
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			count++
+			size += parseSize(line)
+		}
+	}
+	return count, size, nil
 }
 
-func (p *PodmanProvider) RunShellWithStartup(cfg *Config, tag string) error {
-	// If no startup commands and no scripts are defined, just run the shell
-	if len(cfg.Shell.InitHook) == 0 && len(cfg.Shell.Scripts) == 0 {
-		return p.RunShell(cfg, tag)
+// PruneImages implementation for cliProvider
+func (c *cliProvider) PruneImages() (*PruneResult, error) {
+	output, err := runner.Output(c.command("image", "prune", "-f"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune images: %w", err)
 	}
+	removed, reclaimed := parsePruneOutput(output)
 
-	// 1. Script de startup original
-	var startupScript strings.Builder
-	startupScript.WriteString("#!/bin/sh\n")
-	startupScript.WriteString("set -e\n\n")
+	output, err = runner.Output(c.command("builder", "prune", "-f"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune build cache: %w", err)
+	}
+	_, cacheReclaimed := parsePruneOutput(output)
 
-	// Capture initial environment before startup
-	startupScript.WriteString("# Capture initial environment\n")
-	startupScript.WriteString("env | sort > /tmp/env-before.txt\n\n")
+	return &PruneResult{
+		RemovedImages:  removed,
+		ReclaimedSpace: formatSize(reclaimed + cacheReclaimed),
+	}, nil
+}
 
-	// Agregar comandos de startup
-	for _, cmd := range cfg.Shell.InitHook {
-		startupScript.WriteString(cmd + "\n\n")
+// PruneBuildCache removes the BuildKit build cache only
+func (c *cliProvider) PruneBuildCache() (*PruneResult, error) {
+	output, err := runner.Output(c.command("builder", "prune", "-f"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune build cache: %w", err)
 	}
+	removed, reclaimed := parseBuilderPruneOutput(output)
 
-	// Capture environment changes and persist them automatically
-	startupScript.WriteString("# Capture environment changes and persist them\n")
-	startupScript.WriteString("env | sort > /tmp/env-after.txt\n")
-	startupScript.WriteString("echo '#!/bin/sh' > /etc/profile.d/miko-shell-env.sh\n")
-	startupScript.WriteString("echo '# Variables exported during startup' >> /etc/profile.d/miko-shell-env.sh\n")
-	startupScript.WriteString("comm -13 /tmp/env-before.txt /tmp/env-after.txt | grep -v '^_=' | while read line; do\n")
-	startupScript.WriteString("  echo \"export $line\" >> /etc/profile.d/miko-shell-env.sh\n")
-	startupScript.WriteString("done\n")
-	startupScript.WriteString("chmod +x /etc/profile.d/miko-shell-env.sh\n")
-	startupScript.WriteString("rm -f /tmp/env-before.txt /tmp/env-after.txt\n\n")
+	return &PruneResult{
+		RemovedCacheObjects: removed,
+		ReclaimedSpace:      formatSize(reclaimed),
+	}, nil
+}
 
-	// 2. Generar wrapper miko-shell
-	var mikoShell strings.Builder
-	mikoShell.WriteString("#!/bin/sh\n")
-	mikoShell.WriteString("set -e\n\n")
+// CopyFromContainer copies a path from a container into a host directory
+func (c *cliProvider) CopyFromContainer(container, src, dest string) error {
+	cmd := c.command("cp", fmt.Sprintf("%s:%s", container, src), dest)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
-	// Configurar PATH para incluir herramientas de Go
-	mikoShell.WriteString("# Ensure Go tools are in PATH\n")
-	mikoShell.WriteString("export PATH=\"/go/bin:/usr/local/go/bin:$PATH\"\n\n")
+	return runner.Run(cmd)
+}
 
-	// Función de ayuda
-	mikoShell.WriteString("show_help() {\n")
-	mikoShell.WriteString("  echo \"Miko Shell - Container development environment\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
-	mikoShell.WriteString("  echo \"Usage:\"\n")
-	mikoShell.WriteString("  echo \"  miko-shell [command]\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
-	mikoShell.WriteString("  echo \"Available Commands:\"\n")
-	mikoShell.WriteString("  echo \"  help        Show help for miko-shell\"\n")
-	mikoShell.WriteString("  echo \"  list        List available scripts\"\n")
-	mikoShell.WriteString("  echo \"  run         Run a script or command inside the container\"\n")
-	mikoShell.WriteString("  echo \"  version     Show miko-shell version\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
-	mikoShell.WriteString("  echo \"Run 'miko-shell run --help' for information about running scripts\"\n")
-	mikoShell.WriteString("}\n\n")
+// RemoveContainer forcibly removes a container
+func (c *cliProvider) RemoveContainer(name string) error {
+	cmd := c.command("rm", "-f", name)
+	return runner.Run(cmd)
+}
 
-	// Función para listar scripts
-	mikoShell.WriteString("list_scripts() {\n")
-	mikoShell.WriteString("  echo \"Available scripts:\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
-	for _, script := range cfg.Shell.Scripts {
-		desc := script.Description
-		if desc == "" {
-			desc = script.Name
-		}
-		mikoShell.WriteString(fmt.Sprintf("  echo \"  %-15s %s\"\n", script.Name, desc))
+// VerifyImage runs the container.verify commands against a built image
+func (c *cliProvider) VerifyImage(tag string, commands []string) error {
+	return verifyImage(c.command, tag, commands)
+}
+
+// HomeDir returns the home directory of the user containers of tag run as,
+// asking a throwaway container so users defined by the image resolve too
+func (c *cliProvider) HomeDir(cfg *Config, tag string) (string, error) {
+	args := []string{"run", "--rm", "--entrypoint", ""}
+	args = append(args, cfg.userArgs()...)
+	args = append(args, tag, "/bin/sh", "-c", `printf '%s' "$HOME"`)
+
+	output, err := runner.Output(c.command(args...))
+	if err != nil {
+		return "", fmt.Errorf("failed to find the container home directory: %w", err)
 	}
-	mikoShell.WriteString("}\n\n")
+	home := strings.TrimSpace(string(output))
+	if !strings.HasPrefix(home, "/") {
+		return "", fmt.Errorf("failed to find the container home directory: got '%s'", home)
+	}
+	return home, nil
+}
 
-	// Función para ejecutar scripts
-	mikoShell.WriteString("run_script() {\n")
-	mikoShell.WriteString("  # Load environment variables from startup script if they exist\n")
-	mikoShell.WriteString("  if [ -f /etc/profile.d/miko-shell-env.sh ]; then\n")
-	mikoShell.WriteString("    . /etc/profile.d/miko-shell-env.sh\n")
-	mikoShell.WriteString("  fi\n\n")
-	mikoShell.WriteString("  script_name=\"$1\"\n")
-	mikoShell.WriteString("  shift\n\n")
-	mikoShell.WriteString("  case \"$script_name\" in\n")
+// DockerProvider methods delegate to the shared CLI implementation
+func (d *DockerProvider) IsAvailable() bool {
+	return d.cli().IsAvailable()
+}
+
+func (d *DockerProvider) CheckDaemon() error {
+	return d.cli().CheckDaemon()
+}
+
+func (d *DockerProvider) BuildImage(cfg *Config, tag string, opts BuildOptions) error {
+	return d.cli().BuildImage(cfg, tag, opts)
+}
+
+func (d *DockerProvider) RunCommand(cfg *Config, tag string, command []string, opts RunOptions) error {
+	return d.cli().RunCommand(cfg, tag, command, opts)
+}
+
+func (d *DockerProvider) RunShell(cfg *Config, tag string) error {
+	return d.cli().RunShell(cfg, tag)
+}
+
+func (d *DockerProvider) RunShellWithStartup(cfg *Config, tag string) error {
+	return d.cli().RunShellWithStartup(cfg, tag)
+}
+
+func (d *DockerProvider) ImageExists(tag string) bool {
+	return d.cli().ImageExists(tag)
+}
+
+func (d *DockerProvider) RemoveImage(tag string) error {
+	return d.cli().RemoveImage(tag)
+}
+
+func (d *DockerProvider) TagImage(src, dst string) error {
+	return d.cli().TagImage(src, dst)
+}
+
+func (d *DockerProvider) SaveImage(tag, path string) error {
+	return d.cli().SaveImage(tag, path)
+}
+
+func (d *DockerProvider) LoadImage(path string) error {
+	return d.cli().LoadImage(path)
+}
+
+func (d *DockerProvider) PullImage(cfg *Config, ref string) error {
+	return d.cli().PullImage(cfg, ref)
+}
+
+func (d *DockerProvider) ListImages() ([]ImageListItem, error) {
+	return d.cli().ListImages()
+}
+
+func (d *DockerProvider) CleanImages(cfg *Config, keep []string) ([]string, error) {
+	return d.cli().CleanImages(cfg, keep)
+}
+
+func (d *DockerProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
+	return d.cli().GetImageInfo(imageID)
+}
+
+func (d *DockerProvider) InspectImage(imageID string) ([]byte, error) {
+	return d.cli().InspectImage(imageID)
+}
+
+func (d *DockerProvider) ImageHistory(tag string) ([]LayerInfo, error) {
+	return d.cli().ImageHistory(tag)
+}
+
+func (d *DockerProvider) GetPruneInfo() (*PruneInfo, error) {
+	return d.cli().GetPruneInfo()
+}
 
-	// Agregar case para cada script
-	for _, script := range cfg.Shell.Scripts {
-		mikoShell.WriteString(fmt.Sprintf("    %s)\n", script.Name))
-		mikoShell.WriteString("      # Ejecutar script con argumentos pasados\n")
-
-		// Exportar variables para los argumentos posicionales
-		mikoShell.WriteString("      # Establecer argumentos posicionales\n")
-		mikoShell.WriteString("      i=1\n")
-		mikoShell.WriteString("      for arg in \"$@\"; do\n")
-		mikoShell.WriteString("        export \"_MIKO_ARG_${i}=$arg\"\n")
-		mikoShell.WriteString("        i=$((i+1))\n")
-		mikoShell.WriteString("      done\n\n")
-
-		// Ejecutar cada comando del script, reemplazando $1, $2, etc. con las variables exportadas
-		for _, cmd := range script.Commands {
-			// Reemplazar $1, $2, etc. con las variables _MIKO_ARG_1, _MIKO_ARG_2, etc.
-			processedCmd := cmd
-			for i := 1; i <= 9; i++ {
-				placeholder := fmt.Sprintf("$%d", i)
-				replacement := fmt.Sprintf("${_MIKO_ARG_%d:-}", i)
-				processedCmd = strings.ReplaceAll(processedCmd, placeholder, replacement)
-			}
-			mikoShell.WriteString(fmt.Sprintf("      %s\n", processedCmd))
-		}
+func (d *DockerProvider) PruneImages() (*PruneResult, error) {
+	return d.cli().PruneImages()
+}
 
-		// Limpiar las variables de argumentos
-		mikoShell.WriteString("\n      # Limpiar variables de argumentos\n")
-		mikoShell.WriteString("      for j in $(seq 1 $((i-1))); do\n")
-		mikoShell.WriteString("        unset \"_MIKO_ARG_${j}\"\n")
-		mikoShell.WriteString("      done\n")
+func (d *DockerProvider) PruneBuildCache() (*PruneResult, error) {
+	return d.cli().PruneBuildCache()
+}
 
-		mikoShell.WriteString("      return $?\n")
-		mikoShell.WriteString("      ;;\n")
-	}
+func (d *DockerProvider) CopyFromContainer(container, src, dest string) error {
+	return d.cli().CopyFromContainer(container, src, dest)
+}
 
-	// Caso para comando directo (ejecuta el comando pasado directamente)
-	mikoShell.WriteString("    --)\n")
-	mikoShell.WriteString("      shift\n")
-	mikoShell.WriteString("      \"$@\"\n")
-	mikoShell.WriteString("      return $?\n")
-	mikoShell.WriteString("      ;;\n")
+func (d *DockerProvider) RemoveContainer(name string) error {
+	return d.cli().RemoveContainer(name)
+}
 
-	// Caso para script desconocido
-	mikoShell.WriteString("    *)\n")
-	mikoShell.WriteString("      echo \"Error: Unknown script '$script_name'\"\n")
-	mikoShell.WriteString("      echo \"\"\n")
-	mikoShell.WriteString("      list_scripts\n")
-	mikoShell.WriteString("      return 1\n")
-	mikoShell.WriteString("      ;;\n")
-	mikoShell.WriteString("  esac\n")
-	mikoShell.WriteString("}\n\n")
+func (d *DockerProvider) StartContainer(cfg *Config, tag string, opts RunOptions) error {
+	return d.cli().StartContainer(cfg, tag, opts)
+}
 
-	// Función para mostrar ayuda de run
-	mikoShell.WriteString("show_run_help() {\n")
-	mikoShell.WriteString("  echo \"Run a script or command inside the container\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
-	mikoShell.WriteString("  echo \"Usage:\"\n")
-	mikoShell.WriteString("  echo \"  miko-shell run <script-name> [args...]  Run a script with optional arguments\"\n")
-	mikoShell.WriteString("  echo \"  miko-shell run -- <command> [args...]   Run a direct command\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
-	mikoShell.WriteString("  echo \"Available scripts:\"\n")
-	mikoShell.WriteString("  echo \"\"\n")
+func (d *DockerProvider) ExecCommand(cfg *Config, container string, command []string, opts RunOptions) error {
+	return d.cli().ExecCommand(cfg, container, command, opts)
+}
 
-	// Listar scripts disponibles
-	for _, script := range cfg.Shell.Scripts {
-		desc := script.Description
-		if desc == "" {
-			desc = script.Name
-		}
-		mikoShell.WriteString(fmt.Sprintf("  echo \"  %-15s %s\"\n", script.Name, desc))
-	}
-	mikoShell.WriteString("}\n\n")
+func (d *DockerProvider) VerifyImage(tag string, commands []string) error {
+	return d.cli().VerifyImage(tag, commands)
+}
 
-	// Comando principal
-	mikoShell.WriteString("# Detectar versión de la imagen\n")
-	mikoShell.WriteString("MIKO_VERSION=\"$(cat /tmp/miko-version 2>/dev/null || echo 'dev')\"\n\n")
-	mikoShell.WriteString("# Procesar comandos\n")
-	mikoShell.WriteString("case \"$1\" in\n")
+func (d *DockerProvider) HomeDir(cfg *Config, tag string) (string, error) {
+	return d.cli().HomeDir(cfg, tag)
+}
 
-	// Comando run
-	mikoShell.WriteString("  run)\n")
-	mikoShell.WriteString("    shift\n")
-	mikoShell.WriteString("    if [ \"$1\" = \"--help\" ] || [ \"$1\" = \"-h\" ]; then\n")
-	mikoShell.WriteString("      show_run_help\n")
-	mikoShell.WriteString("      exit 0\n")
-	mikoShell.WriteString("    fi\n")
-	mikoShell.WriteString("    if [ -z \"$1\" ]; then\n")
-	mikoShell.WriteString("      echo \"Error: Missing script name or command\"\n")
-	mikoShell.WriteString("      echo \"\"\n")
-	mikoShell.WriteString("      show_run_help\n")
-	mikoShell.WriteString("      exit 1\n")
-	mikoShell.WriteString("    fi\n")
-	mikoShell.WriteString("    run_script \"$@\"\n")
-	mikoShell.WriteString("    exit $?\n")
-	mikoShell.WriteString("    ;;\n")
+func (d *DockerProvider) generateDockerfile(cfg *Config, tag string) string {
+	return d.cli().generateDockerfile(cfg, tag)
+}
 
-	// Comando open (debe fallar dentro del contenedor)
-	mikoShell.WriteString("  open)\n")
-	mikoShell.WriteString("    echo \"Error: Already inside a miko-shell container\"\n")
-	mikoShell.WriteString("    echo \"The 'open' command can only be used from outside the container\"\n")
-	mikoShell.WriteString("    exit 1\n")
-	mikoShell.WriteString("    ;;\n")
+// PodmanProvider methods delegate to the shared CLI implementation
+func (p *PodmanProvider) IsAvailable() bool {
+	return p.cli().IsAvailable()
+}
 
-	// Comando list
-	mikoShell.WriteString("  list)\n")
-	mikoShell.WriteString("    list_scripts\n")
-	mikoShell.WriteString("    exit 0\n")
-	mikoShell.WriteString("    ;;\n")
+func (p *PodmanProvider) CheckDaemon() error {
+	return p.cli().CheckDaemon()
+}
 
-	// Comando version
-	mikoShell.WriteString("  version)\n")
-	mikoShell.WriteString("    echo \"miko-shell version $MIKO_VERSION\"\n")
-	mikoShell.WriteString("    exit 0\n")
-	mikoShell.WriteString("    ;;\n")
+func (p *PodmanProvider) BuildImage(cfg *Config, tag string, opts BuildOptions) error {
+	return p.cli().BuildImage(cfg, tag, opts)
+}
 
-	// Comando help o sin argumentos
-	mikoShell.WriteString("  help|-h|--help|\"\")\n")
-	mikoShell.WriteString("    show_help\n")
-	mikoShell.WriteString("    exit 0\n")
-	mikoShell.WriteString("    ;;\n")
+func (p *PodmanProvider) RunCommand(cfg *Config, tag string, command []string, opts RunOptions) error {
+	return p.cli().RunCommand(cfg, tag, command, opts)
+}
 
-	// Comando desconocido
-	mikoShell.WriteString("  *)\n")
-	mikoShell.WriteString("    echo \"Error: Unknown command '$1'\"\n")
-	mikoShell.WriteString("    echo \"\"\n")
-	mikoShell.WriteString("    show_help\n")
-	mikoShell.WriteString("    exit 1\n")
-	mikoShell.WriteString("    ;;\n")
-	mikoShell.WriteString("esac\n")
+func (p *PodmanProvider) RunShell(cfg *Config, tag string) error {
+	return p.cli().RunShell(cfg, tag)
+}
 
-	// Crear el comando completo que:
-	// 1. Guarda la versión en un archivo
-	// 2. Crea el script miko-shell
-	// 3. Genera el autocompletado
-	// 4. Ejecuta el script de startup
-	version := "dev"
-	if v := os.Getenv("MIKO_VERSION"); v != "" {
-		version = v
-	}
+func (p *PodmanProvider) RunShellWithStartup(cfg *Config, tag string) error {
+	return p.cli().RunShellWithStartup(cfg, tag)
+}
 
-	shellCommand := fmt.Sprintf(`
-# Save version information
-echo "%s" > /tmp/miko-version
+func (p *PodmanProvider) ImageExists(tag string) bool {
+	return p.cli().ImageExists(tag)
+}
 
-# Create the miko-shell wrapper
-cat > /usr/local/bin/miko-shell << 'MIKO_WRAPPER_EOF'
-%s
-MIKO_WRAPPER_EOF
-chmod +x /usr/local/bin/miko-shell
+func (p *PodmanProvider) RemoveImage(tag string) error {
+	return p.cli().RemoveImage(tag)
+}
 
-# Bash completion disabled for sh compatibility
-# Bash completion for miko-shell (disabled for sh compatibility)
-touch /etc/profile.d/miko-shell-completion.sh
+func (p *PodmanProvider) TagImage(src, dst string) error {
+	return p.cli().TagImage(src, dst)
+}
 
-# Setup PATH to include Go tools for all sessions
-echo 'export PATH="/go/bin:/usr/local/go/bin:$PATH"' >> /etc/profile.d/miko-shell-path.sh
+func (p *PodmanProvider) SaveImage(tag, path string) error {
+	return p.cli().SaveImage(tag, path)
+}
 
-# Setup prompt to show we're in a miko-shell
-echo 'PS1="[\[\e[1;32m\]miko-shell\[\e[0m\]] \w \$ "' >> /etc/profile.d/miko-shell-prompt.sh
+func (p *PodmanProvider) LoadImage(path string) error {
+	return p.cli().LoadImage(path)
+}
 
-# Now run the startup script
-cat > /tmp/startup.sh << 'MIKO_SCRIPT_EOF'
-%s
-# Export PATH for interactive shell
-export PATH="/go/bin:/usr/local/go/bin:$PATH"
-# Start interactive shell
-exec /bin/sh --login
-MIKO_SCRIPT_EOF
+func (p *PodmanProvider) PullImage(cfg *Config, ref string) error {
+	return p.cli().PullImage(cfg, ref)
+}
 
-chmod +x /tmp/startup.sh
-exec /tmp/startup.sh`,
-		version,
-		mikoShell.String(),
+func (p *PodmanProvider) ListImages() ([]ImageListItem, error) {
+	return p.cli().ListImages()
+}
 
-		startupScript.String())
+func (p *PodmanProvider) CleanImages(cfg *Config, keep []string) ([]string, error) {
+	return p.cli().CleanImages(cfg, keep)
+}
 
-	// Run the command
-	return p.runContainer(cfg, tag, []string{"/bin/sh", "-c", shellCommand}, true)
+func (p *PodmanProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
+	return p.cli().GetImageInfo(imageID)
 }
 
-func (p *PodmanProvider) ImageExists(tag string) bool {
-	cmd := exec.Command("podman", "image", "inspect", tag)
-	return cmd.Run() == nil
+func (p *PodmanProvider) InspectImage(imageID string) ([]byte, error) {
+	return p.cli().InspectImage(imageID)
 }
 
-func (p *PodmanProvider) RemoveImage(tag string) error {
-	cmd := exec.Command("podman", "rmi", "-f", tag)
-	return cmd.Run()
+func (p *PodmanProvider) ImageHistory(tag string) ([]LayerInfo, error) {
+	return p.cli().ImageHistory(tag)
 }
 
-func (p *PodmanProvider) buildCustomImage(cfg *Config) error {
-	build := cfg.Container.Build
-	customTag := cfg.Name + ":custom"
+func (p *PodmanProvider) GetPruneInfo() (*PruneInfo, error) {
+	return p.cli().GetPruneInfo()
+}
 
-	// Check if custom image already exists
-	if p.ImageExists(customTag) {
-		return nil
-	}
+func (p *PodmanProvider) CopyFromContainer(container, src, dest string) error {
+	return p.cli().CopyFromContainer(container, src, dest)
+}
 
-	args := []string{"build", "-t", customTag, "-f", build.Dockerfile}
+func (p *PodmanProvider) RemoveContainer(name string) error {
+	return p.cli().RemoveContainer(name)
+}
 
-	// Add build args if specified
-	for key, value := range build.Args {
-		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, value))
-	}
+func (p *PodmanProvider) StartContainer(cfg *Config, tag string, opts RunOptions) error {
+	return p.cli().StartContainer(cfg, tag, opts)
+}
 
-	// Add context path
-	args = append(args, build.Context)
+func (p *PodmanProvider) ExecCommand(cfg *Config, container string, command []string, opts RunOptions) error {
+	return p.cli().ExecCommand(cfg, container, command, opts)
+}
 
-	cmd := exec.Command("podman", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func (p *PodmanProvider) VerifyImage(tag string, commands []string) error {
+	return p.cli().VerifyImage(tag, commands)
+}
 
-	return cmd.Run()
+func (p *PodmanProvider) HomeDir(cfg *Config, tag string) (string, error) {
+	return p.cli().HomeDir(cfg, tag)
 }
 
-func (p *PodmanProvider) buildImage(cfg *Config, tag string) error {
-	dockerfile := p.generateDockerfile(cfg)
+func (p *PodmanProvider) generateDockerfile(cfg *Config, tag string) string {
+	return p.cli().generateDockerfile(cfg, tag)
+}
 
-	cmd := exec.Command("podman", "build", "-t", tag, "-f", "-", ".")
-	cmd.Stdin = strings.NewReader(dockerfile)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// NerdctlProvider methods delegate to the shared CLI implementation
+func (n *NerdctlProvider) IsAvailable() bool {
+	return n.cli().IsAvailable()
+}
 
-	return cmd.Run()
+func (n *NerdctlProvider) CheckDaemon() error {
+	return n.cli().CheckDaemon()
 }
 
-func (p *PodmanProvider) runContainer(cfg *Config, tag string, command []string, interactive bool) error {
-	args := []string{"run", "--rm"}
+func (n *NerdctlProvider) BuildImage(cfg *Config, tag string, opts BuildOptions) error {
+	return n.cli().BuildImage(cfg, tag, opts)
+}
 
-	if interactive {
-		args = append(args, "-it")
-	}
+func (n *NerdctlProvider) RunCommand(cfg *Config, tag string, command []string, opts RunOptions) error {
+	return n.cli().RunCommand(cfg, tag, command, opts)
+}
 
-	// Add host platform environment variables
-	hostOS, hostArch, err := detectHostPlatform()
-	if err == nil {
-		args = append(args, "-e", fmt.Sprintf("MIKO_HOST_OS=%s", hostOS))
-		args = append(args, "-e", fmt.Sprintf("MIKO_HOST_ARCH=%s", hostArch))
-	}
+func (n *NerdctlProvider) RunShell(cfg *Config, tag string) error {
+	return n.cli().RunShell(cfg, tag)
+}
 
-	// Mount current directory
-	workingDir, _ := os.Getwd()
-	args = append(args, "-v", fmt.Sprintf("%s:/workspace", workingDir))
-	args = append(args, "-w", "/workspace")
+func (n *NerdctlProvider) RunShellWithStartup(cfg *Config, tag string) error {
+	return n.cli().RunShellWithStartup(cfg, tag)
+}
 
-	args = append(args, tag)
-	args = append(args, command...)
+func (n *NerdctlProvider) ImageExists(tag string) bool {
+	return n.cli().ImageExists(tag)
+}
 
-	cmd := exec.Command("podman", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+func (n *NerdctlProvider) RemoveImage(tag string) error {
+	return n.cli().RemoveImage(tag)
+}
 
-	return cmd.Run()
+func (n *NerdctlProvider) TagImage(src, dst string) error {
+	return n.cli().TagImage(src, dst)
 }
 
-func (p *PodmanProvider) generateDockerfile(cfg *Config) string {
-	var dockerfile strings.Builder
+func (n *NerdctlProvider) SaveImage(tag, path string) error {
+	return n.cli().SaveImage(tag, path)
+}
 
-	// Handle custom build or base image
-	if cfg.Container.Build != nil {
-		dockerfile.WriteString(fmt.Sprintf("FROM %s\n", cfg.Name+":custom"))
-	} else {
-		dockerfile.WriteString(fmt.Sprintf("FROM %s\n", cfg.Container.Image))
-	}
+func (n *NerdctlProvider) LoadImage(path string) error {
+	return n.cli().LoadImage(path)
+}
 
-	dockerfile.WriteString("WORKDIR /workspace\n")
+func (n *NerdctlProvider) PullImage(cfg *Config, ref string) error {
+	return n.cli().PullImage(cfg, ref)
+}
 
-	// Add setup commands
-	for _, cmd := range cfg.Container.Setup {
-		dockerfile.WriteString(fmt.Sprintf("RUN %s\n", cmd))
-	}
+func (n *NerdctlProvider) ListImages() ([]ImageListItem, error) {
+	return n.cli().ListImages()
+}
 
-	dockerfile.WriteString("CMD [\"/bin/sh\"]\n")
+func (n *NerdctlProvider) CleanImages(cfg *Config, keep []string) ([]string, error) {
+	return n.cli().CleanImages(cfg, keep)
+}
 
-	return dockerfile.String()
+func (n *NerdctlProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
+	return n.cli().GetImageInfo(imageID)
 }
 
-// ListImages implementation for DockerProvider
-func (d *DockerProvider) ListImages() ([]ImageListItem, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would parse docker images output
-	// and filter for miko-shell related images
-	return []ImageListItem{}, nil
+func (n *NerdctlProvider) InspectImage(imageID string) ([]byte, error) {
+	return n.cli().InspectImage(imageID)
 }
 
-// CleanImages implementation for DockerProvider
-func (d *DockerProvider) CleanImages(all bool) ([]string, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would:
-	// 1. List miko-shell images
-	// 2. Remove unused ones (or all if all=true)
-	// 3. Return list of removed image IDs
-	return []string{}, nil
+func (n *NerdctlProvider) ImageHistory(tag string) ([]LayerInfo, error) {
+	return n.cli().ImageHistory(tag)
 }
 
-// GetImageInfo implementation for DockerProvider
-func (d *DockerProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would use "docker inspect" to get detailed info
-	return &ImageInfo{
-		ID:           imageID,
-		Tag:          imageID,
-		Size:         "Unknown",
-		Created:      time.Now(),
-		Platform:     "linux/amd64",
-		Labels:       make(map[string]string),
-		Layers:       []LayerInfo{},
-		Env:          []string{},
-		ExposedPorts: []string{},
-	}, nil
+func (n *NerdctlProvider) PruneImages() (*PruneResult, error) {
+	return n.cli().PruneImages()
 }
 
-// GetPruneInfo implementation for DockerProvider
-func (d *DockerProvider) GetPruneInfo() (*PruneInfo, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would analyze docker system df output
-	return &PruneInfo{
-		TotalImages:    0,
-		UnusedImages:   0,
-		DanglingImages: 0,
-		BuildCacheSize: "0B",
-		TotalSize:      "0B",
-	}, nil
+func (n *NerdctlProvider) PruneBuildCache() (*PruneResult, error) {
+	return n.cli().PruneBuildCache()
 }
 
-// PruneImages implementation for DockerProvider
-func (d *DockerProvider) PruneImages() (*PruneResult, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would run "docker system prune"
-	return &PruneResult{
-		RemovedImages:  0,
-		ReclaimedSpace: "0B",
-	}, nil
+func (n *NerdctlProvider) CopyFromContainer(container, src, dest string) error {
+	return n.cli().CopyFromContainer(container, src, dest)
 }
 
-// ListImages implementation for PodmanProvider
-func (p *PodmanProvider) ListImages() ([]ImageListItem, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would parse podman images output
-	// and filter for miko-shell related images
-	return []ImageListItem{}, nil
+func (n *NerdctlProvider) RemoveContainer(name string) error {
+	return n.cli().RemoveContainer(name)
 }
 
-// CleanImages implementation for PodmanProvider
-func (p *PodmanProvider) CleanImages(all bool) ([]string, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would:
-	// 1. List miko-shell images
-	// 2. Remove unused ones (or all if all=true)
-	// 3. Return list of removed image IDs
-	return []string{}, nil
+func (n *NerdctlProvider) StartContainer(cfg *Config, tag string, opts RunOptions) error {
+	return n.cli().StartContainer(cfg, tag, opts)
 }
 
-// GetImageInfo implementation for PodmanProvider
-func (p *PodmanProvider) GetImageInfo(imageID string) (*ImageInfo, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would use "podman inspect" to get detailed info
-	return &ImageInfo{
-		ID:           imageID,
-		Tag:          imageID,
-		Size:         "Unknown",
-		Created:      time.Now(),
-		Platform:     "linux/amd64",
-		Labels:       make(map[string]string),
-		Layers:       []LayerInfo{},
-		Env:          []string{},
-		ExposedPorts: []string{},
-	}, nil
+func (n *NerdctlProvider) ExecCommand(cfg *Config, container string, command []string, opts RunOptions) error {
+	return n.cli().ExecCommand(cfg, container, command, opts)
 }
 
-// GetPruneInfo implementation for PodmanProvider
-func (p *PodmanProvider) GetPruneInfo() (*PruneInfo, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would analyze podman system df output
-	return &PruneInfo{
-		TotalImages:    0,
-		UnusedImages:   0,
-		DanglingImages: 0,
-		BuildCacheSize: "0B",
-		TotalSize:      "0B",
-	}, nil
+func (n *NerdctlProvider) VerifyImage(tag string, commands []string) error {
+	return n.cli().VerifyImage(tag, commands)
+}
+
+func (n *NerdctlProvider) HomeDir(cfg *Config, tag string) (string, error) {
+	return n.cli().HomeDir(cfg, tag)
+}
+
+func (n *NerdctlProvider) generateDockerfile(cfg *Config, tag string) string {
+	return n.cli().generateDockerfile(cfg, tag)
 }
 
 // PruneImages implementation for PodmanProvider
 func (p *PodmanProvider) PruneImages() (*PruneResult, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would run "podman system prune"
+	// Podman prints only the removed image IDs, so the reclaimed space is
+	// taken from the disk usage measured before pruning
+	info, err := p.GetPruneInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := runner.Output(p.cli().command("image", "prune", "-f"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune images: %w", err)
+	}
+
 	return &PruneResult{
-		RemovedImages:  0,
-		ReclaimedSpace: "0B",
+		RemovedImages:  countLines(output),
+		ReclaimedSpace: info.TotalSize,
 	}, nil
 }
+
+// PruneBuildCache implementation for PodmanProvider. Podman builds with
+// buildah, whose layer cache is made of intermediate images.
+func (p *PodmanProvider) PruneBuildCache() (*PruneResult, error) {
+	return nil, fmt.Errorf("podman has no separate build cache; its cached layers are removed by 'image prune'")
+}
+
+// GetPruneInfo implementation for NerdctlProvider. nerdctl has no
+// "system df", so the counts come from the image and container lists and the
+// build cache size is not reported.
+func (n *NerdctlProvider) GetPruneInfo() (*PruneInfo, error) {
+	output, err := runner.Output(n.cli().command("images", "--format", "{{.Repository}}:{{.Tag}}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	containers, err := runner.Output(n.cli().command("ps", "-a", "--format", "{{.Image}}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	used := make(map[string]bool)
+	for _, line := range strings.Split(string(containers), "\n") {
+		used[strings.TrimSpace(line)] = true
+	}
+
+	info := &PruneInfo{TotalImages: countLines(output), BuildCacheSize: "0B"}
+	for _, ref := range strings.Split(string(output), "\n") {
+		if ref = strings.TrimSpace(ref); ref != "" && !used[ref] {
+			info.UnusedImages++
+		}
+	}
+
+	dangling, danglingSize, err := n.cli().danglingImages()
+	if err != nil {
+		return nil, err
+	}
+	info.DanglingImages = dangling
+	info.TotalSize = formatSize(danglingSize)
+
+	return info, nil
+}
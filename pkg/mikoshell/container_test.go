@@ -1,9 +1,61 @@
 package mikoshell
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
+// mockRunner records provider commands instead of executing them
+type mockRunner struct {
+	calls  [][]string
+	envs   [][]string
+	output []byte
+	// outputs, when set, are returned by successive Output calls in place
+	// of output
+	outputs [][]byte
+	err     error
+	// run, when set, fakes each Run call instead of returning err
+	run func(cmd *exec.Cmd) error
+}
+
+func (m *mockRunner) Run(cmd *exec.Cmd) error {
+	m.calls = append(m.calls, cmd.Args)
+	m.envs = append(m.envs, cmd.Env)
+	if m.run != nil {
+		return m.run(cmd)
+	}
+	return m.err
+}
+
+func (m *mockRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	m.calls = append(m.calls, cmd.Args)
+	m.envs = append(m.envs, cmd.Env)
+	if len(m.outputs) > 0 {
+		output := m.outputs[0]
+		m.outputs = m.outputs[1:]
+		return output, m.err
+	}
+	return m.output, m.err
+}
+
+// useMockRunner installs a mockRunner for the duration of a test
+func useMockRunner(t *testing.T) *mockRunner {
+	t.Helper()
+	mock := &mockRunner{}
+	previous := SetCommandRunner(mock)
+	t.Cleanup(func() { SetCommandRunner(previous) })
+	return mock
+}
+
 func TestNewContainerProvider(t *testing.T) {
 	t.Run("docker provider", func(t *testing.T) {
 		provider, err := NewContainerProvider("docker")
@@ -45,6 +97,17 @@ func TestNewContainerProvider(t *testing.T) {
 		}
 	})
 
+	t.Run("nerdctl provider", func(t *testing.T) {
+		provider, err := NewContainerProvider("nerdctl")
+		if err != nil {
+			t.Fatalf("NewContainerProvider('nerdctl') failed: %v", err)
+		}
+
+		if _, ok := provider.(*NerdctlProvider); !ok {
+			t.Error("Expected provider to be a NerdctlProvider")
+		}
+	})
+
 	t.Run("invalid provider", func(t *testing.T) {
 		provider, err := NewContainerProvider("invalid")
 		if err == nil {
@@ -112,7 +175,7 @@ func TestDockerProvider_BuildImage(t *testing.T) {
 	}
 
 	// Test building image (this won't actually build unless docker is available)
-	err := provider.BuildImage(config, "test-image:latest")
+	err := provider.BuildImage(config, "test-image:latest", BuildOptions{})
 
 	if err != nil {
 		t.Logf("Build failed (expected if docker not available): %v", err)
@@ -132,7 +195,7 @@ func TestDockerProvider_RunCommand(t *testing.T) {
 	}
 
 	// Test running a command (this won't actually run unless docker is available)
-	err := provider.RunCommand(config, "test-image:latest", []string{"echo", "test"})
+	err := provider.RunCommand(config, "test-image:latest", []string{"echo", "test"}, RunOptions{})
 
 	if err != nil {
 		t.Logf("Command failed (expected if docker not available): %v", err)
@@ -185,7 +248,7 @@ func TestPodmanProvider_BuildImage(t *testing.T) {
 	}
 
 	// Test building image (this won't actually build unless podman is available)
-	err := provider.BuildImage(config, "test-image:latest")
+	err := provider.BuildImage(config, "test-image:latest", BuildOptions{})
 
 	if err != nil {
 		t.Logf("Build failed (expected if podman not available): %v", err)
@@ -205,7 +268,7 @@ func TestPodmanProvider_RunCommand(t *testing.T) {
 	}
 
 	// Test running a command (this won't actually run unless podman is available)
-	err := provider.RunCommand(config, "test-image:latest", []string{"echo", "test"})
+	err := provider.RunCommand(config, "test-image:latest", []string{"echo", "test"}, RunOptions{})
 
 	if err != nil {
 		t.Logf("Command failed (expected if podman not available): %v", err)
@@ -314,3 +377,2209 @@ func TestStartupScriptGeneration(t *testing.T) {
 		_ = podmanProvider // Use the variable to avoid unused variable warning
 	})
 }
+
+func TestProvider_CopyFromContainer(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ContainerProvider
+		binary   string
+	}{
+		{name: "docker", provider: &DockerProvider{}, binary: "docker"},
+		{name: "podman", provider: &PodmanProvider{}, binary: "podman"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+
+			if err := tt.provider.CopyFromContainer("proj-run-1", "/out", "dist"); err != nil {
+				t.Fatalf("CopyFromContainer() failed: %v", err)
+			}
+			if err := tt.provider.RemoveContainer("proj-run-1"); err != nil {
+				t.Fatalf("RemoveContainer() failed: %v", err)
+			}
+
+			expected := [][]string{
+				{tt.binary, "cp", "proj-run-1:/out", "dist"},
+				{tt.binary, "rm", "-f", "proj-run-1"},
+			}
+			if !reflect.DeepEqual(runner.calls, expected) {
+				t.Errorf("Expected calls %v, got %v", expected, runner.calls)
+			}
+		})
+	}
+}
+
+func TestProvider_RunCommandKeepsNamedContainer(t *testing.T) {
+	runner := useMockRunner(t)
+	provider := &DockerProvider{}
+	config := &Config{Container: Container{Image: "alpine:latest"}}
+
+	opts := RunOptions{Name: "proj-run-1", Keep: true}
+	if err := provider.RunCommand(config, "proj:abc", []string{"true"}, opts); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[0]
+	for _, arg := range args {
+		if arg == "--rm" {
+			t.Errorf("Expected no --rm for kept container, got %v", args)
+		}
+	}
+	if !containsSequence(args, "--name", "proj-run-1") {
+		t.Errorf("Expected --name proj-run-1 in %v", args)
+	}
+}
+
+// containsSequence reports whether args contains the given values consecutively
+func containsSequence(args []string, values ...string) bool {
+	for i := 0; i+len(values) <= len(args); i++ {
+		if reflect.DeepEqual(args[i:i+len(values)], values) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProvider_BuildImageStampsLabels(t *testing.T) {
+	runner := useMockRunner(t)
+	provider := &DockerProvider{}
+	config := &Config{Name: "proj", Container: Container{Image: "alpine:latest"}}
+
+	if err := provider.BuildImage(config, "proj:abc123def456", BuildOptions{}); err != nil {
+		t.Fatalf("BuildImage() failed: %v", err)
+	}
+
+	args := runner.calls[len(runner.calls)-1]
+	if !containsSequence(args, "--label", LabelName+"=proj") {
+		t.Errorf("Expected name label in %v", args)
+	}
+	if !containsSequence(args, "--label", LabelConfigHash+"=abc123def456") {
+		t.Errorf("Expected config hash label in %v", args)
+	}
+}
+
+func TestProvider_StartAndExec(t *testing.T) {
+	runner := useMockRunner(t)
+	config := &Config{Name: "proj", dir: t.TempDir(), Container: Container{Image: "alpine:latest"}}
+	provider := &DockerProvider{}
+
+	if err := provider.StartContainer(config, "proj:abc123def456", RunOptions{Name: "proj-run-1"}); err != nil {
+		t.Fatalf("StartContainer() failed: %v", err)
+	}
+	start := runner.calls[0]
+	if !containsSequence(start, "docker", "run", "-d", "--rm", "--name", "proj-run-1", "--entrypoint", "") {
+		t.Errorf("Expected a detached named container, got %v", start)
+	}
+	if !containsSequence(start, append([]string{"proj:abc123def456"}, idleCommand...)...) {
+		t.Errorf("Expected the container to idle, got %v", start)
+	}
+
+	command := []string{"/bin/sh", "-c", "ls *.go | wc -l"}
+	if err := provider.ExecCommand(config, "proj-run-1", command, RunOptions{TTY: true, Workdir: "services/api"}); err != nil {
+		t.Fatalf("ExecCommand() failed: %v", err)
+	}
+	expected := []string{"docker", "exec", "-it", "-w", "/workspace/services/api", "proj-run-1", "/bin/sh", "-c", "ls *.go | wc -l"}
+	if !reflect.DeepEqual(runner.calls[1], expected) {
+		t.Errorf("Expected %v, got %v", expected, runner.calls[1])
+	}
+
+	// Startup hooks run before an exec'd command as they do before a run
+	config.Shell.InitHook = []string{"export GREETING=hi"}
+	if err := provider.ExecCommand(config, "proj-run-1", []string{"env"}, RunOptions{}); err != nil {
+		t.Fatalf("ExecCommand() failed: %v", err)
+	}
+	exec := runner.calls[2]
+	if !containsSequence(exec, "docker", "exec", "-w", "/workspace", "proj-run-1", "/bin/sh", "-c") || !strings.Contains(exec[len(exec)-1], "export GREETING=hi") {
+		t.Errorf("Expected the startup hooks in the exec'd command, got %v", exec)
+	}
+}
+
+func TestProvider_RunGPUs(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ContainerProvider
+		gpus     string
+		expected []string
+		wantErr  bool
+	}{
+		{name: "docker all", provider: &DockerProvider{}, gpus: "all", expected: []string{"--gpus", "all"}},
+		{name: "docker count", provider: &DockerProvider{}, gpus: "2", expected: []string{"--gpus", "2"}},
+		{name: "docker devices", provider: &DockerProvider{}, gpus: "device=0,1", expected: []string{"--gpus", `"device=0,1"`}},
+		{name: "nerdctl all", provider: &NerdctlProvider{}, gpus: "all", expected: []string{"--gpus", "all"}},
+		{name: "podman all", provider: &PodmanProvider{}, gpus: "all", expected: []string{"--device", "nvidia.com/gpu=all"}},
+		{
+			name:     "podman devices",
+			provider: &PodmanProvider{},
+			gpus:     "device=0,1",
+			expected: []string{"--device", "nvidia.com/gpu=0", "--device", "nvidia.com/gpu=1"},
+		},
+		{name: "podman count", provider: &PodmanProvider{}, gpus: "2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", GPUs: tt.gpus}}
+
+			err := tt.provider.RunCommand(config, "proj:abc123def456", []string{"nvidia-smi"}, RunOptions{})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "doesn't support 'container.gpus: 2'") {
+					t.Errorf("Expected an unsupported GPU error, got %v", err)
+				}
+				if len(runner.calls) != 0 {
+					t.Errorf("Expected nothing to run, got %v", runner.calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunCommand() failed: %v", err)
+			}
+			if call := runner.calls[len(runner.calls)-1]; !containsSequence(call, tt.expected...) {
+				t.Errorf("Expected %v in %v", tt.expected, call)
+			}
+		})
+	}
+}
+
+func TestProvider_RunArgs(t *testing.T) {
+	runner := useMockRunner(t)
+	config := &Config{Name: "proj", Container: Container{
+		Image:   "alpine:latest",
+		RunArgs: []string{"--cap-add", "SYS_PTRACE", "--device=/dev/fuse"},
+	}}
+
+	if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+	if err := (&PodmanProvider{}).RunShell(config, "proj:abc123def456"); err != nil {
+		t.Fatalf("RunShell() failed: %v", err)
+	}
+
+	for _, call := range runner.calls {
+		if !containsSequence(call, "--cap-add", "SYS_PTRACE", "--device=/dev/fuse", "proj:abc123def456") {
+			t.Errorf("Expected the run args verbatim before the image, got %v", call)
+		}
+	}
+}
+
+func TestProvider_LoadImage(t *testing.T) {
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}, {"nerdctl", &NerdctlProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			if err := provider.p.LoadImage("in/env.tar"); err != nil {
+				t.Fatalf("LoadImage() failed: %v", err)
+			}
+			expected := []string{provider.name, "load", "-i", "in/env.tar"}
+			if len(runner.calls) != 1 || !reflect.DeepEqual(runner.calls[0], expected) {
+				t.Errorf("Expected %v, got %v", expected, runner.calls)
+			}
+		})
+	}
+}
+
+func TestProvider_SaveImage(t *testing.T) {
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}, {"nerdctl", &NerdctlProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			if err := provider.p.SaveImage("proj:abc123def456", "out/env.tar"); err != nil {
+				t.Fatalf("SaveImage() failed: %v", err)
+			}
+			expected := []string{provider.name, "save", "-o", "out/env.tar", "proj:abc123def456"}
+			if len(runner.calls) != 1 || !reflect.DeepEqual(runner.calls[0], expected) {
+				t.Errorf("Expected %v, got %v", expected, runner.calls)
+			}
+		})
+	}
+}
+
+func TestProvider_RunNetwork(t *testing.T) {
+	for _, network := range []string{"host", "myapp_default", ""} {
+		runner := useMockRunner(t)
+		config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", Network: network}}
+
+		if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if err := (&PodmanProvider{}).RunShell(config, "proj:abc123def456"); err != nil {
+			t.Fatalf("RunShell() failed: %v", err)
+		}
+
+		for _, call := range runner.calls {
+			if network == "" && containsSequence(call, "--network") {
+				t.Errorf("Expected no --network by default, got %v", call)
+			}
+			if network != "" && !containsSequence(call, "--network", network) {
+				t.Errorf("Expected --network %s in %v", network, call)
+			}
+		}
+	}
+}
+
+func TestProvider_HomeDir(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.output = []byte("/home/node\n")
+	config := &Config{Container: Container{Image: "node:22", User: "node"}}
+
+	home, err := (&DockerProvider{}).HomeDir(config, "proj:abc123def456")
+	if err != nil {
+		t.Fatalf("HomeDir() failed: %v", err)
+	}
+	if home != "/home/node" {
+		t.Errorf("Expected /home/node, got %q", home)
+	}
+	args := runner.calls[0]
+	if !containsSequence(args, "--user", "node", "proj:abc123def456", "/bin/sh", "-c") {
+		t.Errorf("Expected the image run as the configured user, got %v", args)
+	}
+
+	runner.output = []byte("")
+	if _, err := (&DockerProvider{}).HomeDir(config, "proj:abc123def456"); err == nil {
+		t.Error("Expected an error for an empty home directory")
+	}
+}
+
+func TestProvider_RunCommandHomeMounts(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/home/me/.cache")
+	specs, err := homeMountVolumes("api", "/root", []string{".aws", ".config/gcloud"})
+	if err != nil {
+		t.Fatalf("homeMountVolumes() failed: %v", err)
+	}
+
+	runner := useMockRunner(t)
+	config := &Config{Name: "api", Container: Container{Image: "alpine:latest", Volumes: specs}}
+	if err := (&DockerProvider{}).RunCommand(config, "api:abc123def456", []string{"aws", "configure"}, RunOptions{}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[len(runner.calls)-1]
+	for _, spec := range []string{
+		"/home/me/.cache/miko-shell/api/home/.aws:/root/.aws",
+		"/home/me/.cache/miko-shell/api/home/.config/gcloud:/root/.config/gcloud",
+	} {
+		if !containsSequence(args, "-v", spec) {
+			t.Errorf("Expected -v %s in %v", spec, args)
+		}
+	}
+}
+
+func TestProvider_BuildRetries(t *testing.T) {
+	previousDelay := buildRetryDelay
+	buildRetryDelay = 0
+	t.Cleanup(func() { buildRetryDelay = previousDelay })
+
+	// failing returns a fake Run failing the first n calls with output
+	failing := func(n int, output string) func(cmd *exec.Cmd) error {
+		calls := 0
+		return func(cmd *exec.Cmd) error {
+			calls++
+			if calls > n {
+				return nil
+			}
+			io.WriteString(cmd.Stderr, output)
+			return exitCodeError(1)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int
+		output    string
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "transient error retried", retries: 3, failures: 2, output: "net/http: TLS handshake timeout\n", wantCalls: 3},
+		{name: "registry rate limit retried", retries: 1, failures: 1, output: "toomanyrequests: You have reached your pull rate limit\n", wantCalls: 2},
+		{name: "retries exhausted", retries: 2, failures: 5, output: "dial tcp: i/o timeout\n", wantCalls: 3, wantErr: true},
+		{name: "dockerfile error not retried", retries: 3, failures: 1, output: "dockerfile parse error line 3: unknown instruction: RUNN\n", wantCalls: 1, wantErr: true},
+		{name: "no retries configured", failures: 1, output: "dial tcp: i/o timeout\n", wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			runner.run = failing(tt.failures, tt.output)
+			config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", BuildRetries: tt.retries}}
+
+			err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BuildImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(runner.calls) != tt.wantCalls {
+				t.Errorf("Expected %d build attempts, got %d", tt.wantCalls, len(runner.calls))
+			}
+		})
+	}
+
+	t.Run("pull", func(t *testing.T) {
+		runner := useMockRunner(t)
+		runner.run = failing(1, "Error response from daemon: Get \"https://ghcr.io/v2/\": net/http: request canceled (Client.Timeout exceeded)\n")
+		config := &Config{Container: Container{Image: "ghcr.io/acme/toolbox:1.4", Pull: true, BuildRetries: 1}}
+
+		if err := (&PodmanProvider{}).PullImage(config, "ghcr.io/acme/toolbox:1.4"); err != nil {
+			t.Fatalf("PullImage() failed: %v", err)
+		}
+		if len(runner.calls) != 2 || !containsSequence(runner.calls[1], "pull", "ghcr.io/acme/toolbox:1.4") {
+			t.Errorf("Expected the pull run twice, got %v", runner.calls)
+		}
+	})
+}
+
+func TestIsTransientOutput(t *testing.T) {
+	for output, expected := range map[string]bool{
+		"failed to resolve source metadata: dial tcp: lookup registry-1.docker.io: no such host": true,
+		"received unexpected HTTP status: 503 Service Unavailable":                               true,
+		"Error: failed to solve: process \"/bin/sh -c make\" did not complete successfully":      false,
+		"COPY failed: file not found in build context":                                           false,
+	} {
+		if got := isTransientOutput(output); got != expected {
+			t.Errorf("isTransientOutput(%q) = %v, expected %v", output, got, expected)
+		}
+	}
+}
+
+func TestStartupCommands(t *testing.T) {
+	hooks := []string{"false", "export READY=1"}
+
+	t.Run("strict", func(t *testing.T) {
+		cfg := &Config{Shell: Shell{InitHook: hooks, StartupPolicy: StartupPolicyStrict}}
+		script := startupCommands(cfg)
+
+		if script != "false\nexport READY=1\n" {
+			t.Errorf("Expected commands verbatim, got:\n%s", script)
+		}
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		cfg := &Config{Shell: Shell{InitHook: hooks, StartupPolicy: StartupPolicyContinue}}
+		script := startupCommands(cfg)
+
+		if !strings.Contains(script, "if ! { false\n}; then") {
+			t.Errorf("Expected guarded command, got:\n%s", script)
+		}
+		if strings.Contains(script, "read ") {
+			t.Errorf("Continue policy should not prompt, got:\n%s", script)
+		}
+
+		out, err := exec.Command("/bin/sh", "-c", "set -e\n"+script+"echo ready=$READY").CombinedOutput()
+		if err != nil {
+			t.Fatalf("Script should keep going after a failure: %v\n%s", err, out)
+		}
+		if !strings.Contains(string(out), "startup command failed, continuing: false") || !strings.Contains(string(out), "ready=1") {
+			t.Errorf("Unexpected output:\n%s", out)
+		}
+	})
+
+	t.Run("prompt", func(t *testing.T) {
+		cfg := &Config{Shell: Shell{InitHook: hooks, StartupPolicy: StartupPolicyPrompt}}
+		script := startupCommands(cfg)
+
+		if !strings.Contains(script, "Continue anyway? [y/N]") {
+			t.Errorf("Expected prompt, got:\n%s", script)
+		}
+
+		cmd := exec.Command("/bin/sh", "-c", "set -e\n"+script+"echo ready=$READY")
+		cmd.Stdin = strings.NewReader("n\n")
+		if err := cmd.Run(); err == nil {
+			t.Error("Declining the prompt should abort startup")
+		}
+
+		cmd = exec.Command("/bin/sh", "-c", "set -e\n"+script+"echo ready=$READY")
+		cmd.Stdin = strings.NewReader("y\n")
+		out, err := cmd.Output()
+		if err != nil || !strings.Contains(string(out), "ready=1") {
+			t.Errorf("Accepting the prompt should continue startup: %v\n%s", err, out)
+		}
+	})
+}
+
+func TestProvider_RunCommandReplaceEntrypoint(t *testing.T) {
+	config := &Config{Container: Container{Image: "alpine:latest"}}
+
+	for _, provider := range []ContainerProvider{&DockerProvider{}, &PodmanProvider{}} {
+		runner := useMockRunner(t)
+
+		if err := provider.RunCommand(config, "proj:abc", []string{"ls"}, RunOptions{ReplaceEntrypoint: true}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+		if err := provider.RunCommand(config, "proj:abc", []string{"ls"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		if !containsSequence(runner.calls[0], "--entrypoint", "") {
+			t.Errorf("Expected empty --entrypoint, got %v", runner.calls[0])
+		}
+		if containsSequence(runner.calls[1], "--entrypoint") {
+			t.Errorf("Expected no --entrypoint by default, got %v", runner.calls[1])
+		}
+	}
+}
+
+func TestProvider_BuildCustomImageBuildArgs(t *testing.T) {
+	runner := useMockRunner(t)
+	// Failing every command reports the custom image as missing so it is built
+	runner.err = exec.ErrNotFound
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	config := &Config{
+		Name: "proj",
+		Container: Container{Build: &ContainerBuild{
+			Dockerfile: "Dockerfile",
+			Context:    ".",
+			Args:       map[string]string{"VERSION": "dev", "GO_VERSION": "1.24"},
+		}},
+		dir: dir,
+	}
+
+	opts := BuildOptions{BuildArgs: map[string]string{"VERSION": "v1.2.3", "COMMIT": "abc"}}
+	_ = (&DockerProvider{}).BuildImage(config, "proj:abc123def456", opts)
+
+	var customBuild []string
+	for _, call := range runner.calls {
+		if containsSequence(call, "build", "-t", "proj:custom-abc123def456") {
+			customBuild = call
+		}
+	}
+	expected := []string{"--build-arg", "COMMIT=abc", "--build-arg", "GO_VERSION=1.24", "--build-arg", "VERSION=v1.2.3"}
+	if !containsSequence(customBuild, expected...) {
+		t.Errorf("Expected merged build args %v, got %v", expected, customBuild)
+	}
+}
+
+func TestProvider_BuildCustomImageKeyedByHash(t *testing.T) {
+	runner := useMockRunner(t)
+	// Failing every command reports the custom image as missing so it is built
+	runner.err = exec.ErrNotFound
+	provider := &DockerProvider{}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile.ci"), []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	config := &Config{
+		Name:      "proj",
+		Container: Container{Build: &ContainerBuild{Dockerfile: "Dockerfile.ci", Context: "."}},
+		dir:       dir,
+	}
+
+	_ = provider.BuildImage(config, "proj:abc123def456", BuildOptions{})
+
+	var customBuild []string
+	for _, call := range runner.calls {
+		if containsSequence(call, "build", "-t", "proj:custom-abc123def456") {
+			customBuild = call
+		}
+	}
+	if customBuild == nil {
+		t.Fatalf("Expected custom image build keyed by hash, got %v", runner.calls)
+	}
+	if !containsSequence(customBuild, "-f", filepath.Join(dir, "Dockerfile.ci")) {
+		t.Errorf("Expected custom build to use Dockerfile.ci, got %v", customBuild)
+	}
+
+	dockerfile := provider.generateDockerfile(config, "proj:abc123def456")
+	if !strings.HasPrefix(dockerfile, "FROM proj:custom-abc123def456\n") {
+		t.Errorf("Expected runtime image to build FROM the custom image, got:\n%s", dockerfile)
+	}
+}
+
+func TestGenerateDockerfile_Copy(t *testing.T) {
+	config := &Config{
+		Container: Container{
+			Image: "alpine:latest",
+			Copy:  []CopyEntry{{Src: "certs/ca.pem", Dest: "/usr/local/share/ca-certificates/ca.pem"}},
+			Setup: []string{"update-ca-certificates"},
+		},
+	}
+
+	expected := "FROM alpine:latest\n" +
+		"WORKDIR /workspace\n" +
+		"COPY certs/ca.pem /usr/local/share/ca-certificates/ca.pem\n" +
+		"RUN update-ca-certificates\n" +
+		"CMD [\"/bin/sh\"]\n"
+
+	if got := (&DockerProvider{}).generateDockerfile(config, "proj:abc"); got != expected {
+		t.Errorf("Docker Dockerfile mismatch.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+	if got := (&PodmanProvider{}).generateDockerfile(config, "proj:abc"); got != expected {
+		t.Errorf("Podman Dockerfile mismatch.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestGenerateDockerfile_DigestImage(t *testing.T) {
+	digest := "@sha256:" + strings.Repeat("ab", 32)
+
+	for _, image := range []string{
+		"alpine" + digest,
+		"alpine:3.19" + digest,
+		"registry.example.com:5000/team/alpine:3.19" + digest,
+	} {
+		config := &Config{Container: Container{Image: image}}
+		expected := "FROM " + image + "\n"
+
+		for _, provider := range []interface {
+			generateDockerfile(*Config, string) string
+		}{&DockerProvider{}, &PodmanProvider{}, &NerdctlProvider{}} {
+			if got := provider.generateDockerfile(config, "proj:abc123def456"); !strings.HasPrefix(got, expected) {
+				t.Errorf("%T: expected Dockerfile to start with %q, got:\n%s", provider, expected, got)
+			}
+		}
+	}
+}
+
+func TestInteractiveShellCommand(t *testing.T) {
+	t.Run("default uses sh", func(t *testing.T) {
+		got := interactiveShellCommand(&Config{})
+		if got != "exec /bin/sh --login" {
+			t.Errorf("Expected plain sh, got:\n%s", got)
+		}
+	})
+
+	t.Run("auto detects bash", func(t *testing.T) {
+		got := interactiveShellCommand(&Config{Shell: Shell{Interactive: InteractiveShellAuto}})
+
+		for _, expected := range []string{"command -v bash", "exec bash --login", "exec /bin/sh --login"} {
+			if !strings.Contains(got, expected) {
+				t.Errorf("Expected %q in snippet:\n%s", expected, got)
+			}
+		}
+		if strings.Index(got, "exec bash") > strings.Index(got, "exec /bin/sh") {
+			t.Errorf("Expected bash to be tried before the sh fallback:\n%s", got)
+		}
+	})
+
+	t.Run("configured shell falls back to sh", func(t *testing.T) {
+		got := interactiveShellCommand(&Config{Container: Container{Shell: "/bin/bash"}, Shell: Shell{Interactive: InteractiveShellAuto}})
+
+		for _, expected := range []string{"[ -x '/bin/bash' ]", "exec '/bin/bash' --login", "exec /bin/sh --login"} {
+			if !strings.Contains(got, expected) {
+				t.Errorf("Expected %q in snippet:\n%s", expected, got)
+			}
+		}
+		if strings.Contains(got, "command -v bash") {
+			t.Errorf("Expected container.shell to take precedence over auto detection:\n%s", got)
+		}
+	})
+
+	t.Run("startup script runs under the configured shell", func(t *testing.T) {
+		runner := useMockRunner(t)
+		cfg := &Config{
+			Container: Container{Image: "ubuntu:22.04", Shell: "/bin/bash"},
+			Shell:     Shell{InitHook: []string{"shopt -s globstar"}},
+		}
+
+		if err := (&DockerProvider{}).RunShellWithStartup(cfg, "proj:abc"); err != nil {
+			t.Fatalf("RunShellWithStartup() failed: %v", err)
+		}
+		args := runner.calls[0]
+		script := args[len(args)-1]
+		for _, expected := range []string{"exec '/bin/bash' /tmp/startup.sh", "exec /tmp/startup.sh", "exec '/bin/bash' --login"} {
+			if !strings.Contains(script, expected) {
+				t.Errorf("Expected %q in startup command:\n%s", expected, script)
+			}
+		}
+	})
+
+	t.Run("open passes snippet to sh", func(t *testing.T) {
+		runner := useMockRunner(t)
+		cfg := &Config{Container: Container{Image: "alpine:latest"}, Shell: Shell{Interactive: InteractiveShellAuto}}
+
+		if err := (&DockerProvider{}).RunShell(cfg, "proj:abc"); err != nil {
+			t.Fatalf("RunShell() failed: %v", err)
+		}
+		args := runner.calls[0]
+		if !containsSequence(args, "proj:abc", "/bin/sh", "-c", interactiveShellCommand(cfg)) {
+			t.Errorf("Expected detection snippet in %v", args)
+		}
+	})
+}
+
+func TestProvider_RunShellWithStartupStrictArgs(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		runner := useMockRunner(t)
+		cfg := &Config{
+			Container: Container{Image: "alpine:latest"},
+			Shell: Shell{
+				StrictArgs: strict,
+				Scripts:    []Script{{Name: "greet", Commands: []string{"echo $1 $2"}}},
+			},
+		}
+
+		if err := (&DockerProvider{}).RunShellWithStartup(cfg, "proj:abc"); err != nil {
+			t.Fatalf("RunShellWithStartup() failed: %v", err)
+		}
+		args := runner.calls[0]
+		wrapper := args[len(args)-1]
+
+		expected := "echo $1 $2\n"
+		if strict {
+			expected = "[ $# -ge 2 ] || { echo \"missing argument 2\" >&2; exit 1; }\n      echo $1 $2\n"
+		}
+		if !strings.Contains(wrapper, expected) {
+			t.Errorf("strict=%v: expected %q in wrapper", strict, expected)
+		}
+	}
+}
+
+func TestProvider_RunShellWithStartupShellFlags(t *testing.T) {
+	runner := useMockRunner(t)
+	cfg := &Config{
+		Container: Container{Image: "alpine:latest"},
+		Shell: Shell{
+			Flags:   "-eu",
+			Scripts: []Script{{Name: "greet", Commands: []string{"echo hello"}}},
+		},
+	}
+
+	if err := (&DockerProvider{}).RunShellWithStartup(cfg, "proj:abc"); err != nil {
+		t.Fatalf("RunShellWithStartup() failed: %v", err)
+	}
+	args := runner.calls[0]
+	wrapper := args[len(args)-1]
+
+	if !strings.Contains(wrapper, "    greet)\n      set -eu\n      echo hello\n") {
+		t.Errorf("Expected the script to set -eu before its commands in wrapper:\n%s", wrapper)
+	}
+}
+
+func TestScript_WrapperCommands(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	// run mirrors the wrapper's run_script: the script arguments are the
+	// positional parameters of a shell function
+	run := func(script Script, strict bool, args ...string) (string, error) {
+		body := "run_script() {\n" + script.wrapperCommands(strict, "  ") + "}\nrun_script \"$@\""
+		output, err := exec.Command("sh", append([]string{"-c", body, "sh"}, args...)...).CombinedOutput()
+		return string(output), err
+	}
+
+	t.Run("more than nine arguments", func(t *testing.T) {
+		script := Script{Name: "many", Commands: []string{`echo "$1|${10}|${12}|$#"`}}
+		args := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+
+		output, err := run(script, false, args...)
+		if err != nil {
+			t.Fatalf("script failed: %v\n%s", err, output)
+		}
+		if output != "a|j|l|12\n" {
+			t.Errorf("Expected a|j|l|12, got %q", output)
+		}
+	})
+
+	t.Run("arguments with spaces", func(t *testing.T) {
+		script := Script{Name: "quote", Commands: []string{`for arg in "$@"; do echo "[$arg]"; done`}}
+
+		output, err := run(script, false, "hello world", "it's")
+		if err != nil {
+			t.Fatalf("script failed: %v\n%s", err, output)
+		}
+		if output != "[hello world]\n[it's]\n" {
+			t.Errorf("Expected quoting preserved, got %q", output)
+		}
+	})
+
+	t.Run("forward all arguments", func(t *testing.T) {
+		script := Script{Name: "pytest", Commands: []string{`printf '[%s]' "$@" "$*"`}}
+
+		output, err := run(script, true, "-k", "slow tests")
+		if err != nil {
+			t.Fatalf("script failed: %v\n%s", err, output)
+		}
+		if output != "[-k][slow tests][-k slow tests]" {
+			t.Errorf("Expected $@ and $* to expand every argument, got %q", output)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		script := Script{
+			Name:     "greet",
+			Args:     []ScriptArg{{Name: "name"}, {Name: "greeting", Default: "hello there"}},
+			Commands: []string{`echo "$2, $1 ($#)"`},
+		}
+
+		output, err := run(script, false, "Alice")
+		if err != nil {
+			t.Fatalf("script failed: %v\n%s", err, output)
+		}
+		if output != "hello there, Alice (2)\n" {
+			t.Errorf("Expected the default filled in, got %q", output)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		script := Script{Name: "greet", Commands: []string{"echo $1 ${11}"}}
+
+		if output, err := run(script, true, "a"); err == nil || !strings.Contains(output, "missing argument 11") {
+			t.Errorf("Expected missing argument 11, got %q (%v)", output, err)
+		}
+	})
+}
+
+func TestDockerProvider_BuildImageProgress(t *testing.T) {
+	config := &Config{Name: "proj", Container: Container{Image: "alpine:latest"}}
+
+	t.Run("plain enables buildkit", func(t *testing.T) {
+		runner := useMockRunner(t)
+		if err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{Progress: BuildProgressPlain}); err != nil {
+			t.Fatalf("BuildImage() failed: %v", err)
+		}
+
+		args := runner.calls[len(runner.calls)-1]
+		if !containsSequence(args, "--progress=plain") {
+			t.Errorf("Expected --progress=plain in %v", args)
+		}
+	})
+
+	t.Run("auto passes no flag", func(t *testing.T) {
+		runner := useMockRunner(t)
+		if err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{Progress: BuildProgressAuto}); err != nil {
+			t.Fatalf("BuildImage() failed: %v", err)
+		}
+
+		for _, arg := range runner.calls[len(runner.calls)-1] {
+			if strings.HasPrefix(arg, "--progress") {
+				t.Errorf("Unexpected progress flag %q", arg)
+			}
+		}
+	})
+}
+
+func TestProvider_BuildImageNoCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		configNoCache   bool
+		flagNoCache     bool
+		wantCustom      bool
+		wantRuntimeFlag bool
+	}{
+		{name: "neither reuses the custom image"},
+		{name: "config only", configNoCache: true, wantCustom: true},
+		{name: "flag only", flagNoCache: true, wantCustom: true, wantRuntimeFlag: true},
+		{name: "config and flag", configNoCache: true, flagNoCache: true, wantCustom: true, wantRuntimeFlag: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The mock reports every image as existing
+			runner := useMockRunner(t)
+			config := &Config{
+				Name: "proj",
+				Container: Container{Build: &ContainerBuild{
+					Dockerfile: "Dockerfile",
+					Context:    ".",
+					NoCache:    tt.configNoCache,
+				}},
+				dir: dir,
+			}
+
+			if err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{NoCache: tt.flagNoCache}); err != nil {
+				t.Fatalf("BuildImage() failed: %v", err)
+			}
+
+			var builds [][]string
+			for _, call := range runner.calls {
+				if len(call) > 1 && call[1] == "build" {
+					builds = append(builds, call)
+				}
+			}
+
+			if tt.wantCustom {
+				if len(builds) != 2 || !containsSequence(builds[0], "--no-cache") {
+					t.Fatalf("Expected a custom build with --no-cache, got %v", builds)
+				}
+			} else if len(builds) != 1 {
+				t.Fatalf("Expected only the runtime build, got %v", builds)
+			}
+
+			runtimeBuild := builds[len(builds)-1]
+			if containsSequence(runtimeBuild, "--no-cache") != tt.wantRuntimeFlag {
+				t.Errorf("Unexpected --no-cache state in runtime build %v", runtimeBuild)
+			}
+		})
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	if env := buildEnv(BuildOptions{}, false); env != nil {
+		t.Errorf("Expected inherited environment, got %d entries", len(env))
+	}
+
+	env := buildEnv(BuildOptions{Progress: BuildProgressTTY}, false)
+	if len(env) == 0 || env[len(env)-1] != "DOCKER_BUILDKIT=1" {
+		t.Errorf("Expected DOCKER_BUILDKIT=1 in environment")
+	}
+
+	env = buildEnv(BuildOptions{}, true)
+	if len(env) == 0 || env[len(env)-1] != "DOCKER_BUILDKIT=1" {
+		t.Errorf("Expected DOCKER_BUILDKIT=1 in environment for a BuildKit build")
+	}
+}
+
+func TestProvider_BuildCustomImageBuildKit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	config := &Config{
+		Name:      "proj",
+		Container: Container{Build: &ContainerBuild{Dockerfile: "Dockerfile", BuildKit: true}},
+		dir:       dir,
+	}
+	hasBuildKit := func(env []string) bool {
+		for _, entry := range env {
+			if entry == "DOCKER_BUILDKIT=1" {
+				return true
+			}
+		}
+		return false
+	}
+
+	runner := useMockRunner(t)
+	runner.err = errors.New("no such image")
+	provider := &DockerProvider{}
+	_ = provider.BuildImage(config, "proj:abc123def456", BuildOptions{})
+	// Once the custom image exists only the runtime image is built
+	runner.err = nil
+	_ = provider.BuildImage(config, "proj:abc123def456", BuildOptions{})
+	_ = provider.RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{})
+
+	var customBuild, runtimeBuild, run = -1, -1, -1
+	for i, call := range runner.calls {
+		switch {
+		case containsSequence(call, "build", "-t", "proj:custom-abc123def456"):
+			customBuild = i
+		case containsSequence(call, "build", "-t", "proj:abc123def456"):
+			runtimeBuild = i
+		case containsSequence(call, "run"):
+			run = i
+		}
+	}
+	if customBuild < 0 || runtimeBuild < 0 || run < 0 {
+		t.Fatalf("Expected custom build, runtime build and run calls, got %v", runner.calls)
+	}
+	if !hasBuildKit(runner.envs[customBuild]) {
+		t.Error("Expected DOCKER_BUILDKIT=1 for the custom image build")
+	}
+	if hasBuildKit(runner.envs[runtimeBuild]) || hasBuildKit(runner.envs[run]) {
+		t.Error("Expected DOCKER_BUILDKIT=1 only for the custom image build")
+	}
+}
+
+func TestIsMikoShellImage(t *testing.T) {
+	project := &Config{Name: "proj"}
+
+	tests := []struct {
+		name     string
+		item     ImageListItem
+		cfg      *Config
+		expected bool
+	}{
+		{
+			name:     "labeled image of project",
+			item:     ImageListItem{Tag: "anything:latest", Labels: map[string]string{LabelName: "proj"}},
+			cfg:      project,
+			expected: true,
+		},
+		{
+			name:     "labeled image of another project",
+			item:     ImageListItem{Tag: "other:abc123def456", Labels: map[string]string{LabelName: "other"}},
+			cfg:      project,
+			expected: false,
+		},
+		{
+			name:     "labeled image without project scope",
+			item:     ImageListItem{Tag: "other:abc123def456", Labels: map[string]string{LabelName: "other"}},
+			expected: true,
+		},
+		{
+			name:     "unlabeled hash tag",
+			item:     ImageListItem{Tag: "proj:abc123def456"},
+			cfg:      project,
+			expected: true,
+		},
+		{
+			name:     "unlabeled custom tag",
+			item:     ImageListItem{Tag: "proj:custom-abc123def456"},
+			cfg:      project,
+			expected: true,
+		},
+		{
+			name:     "unlabeled podman tag",
+			item:     ImageListItem{Tag: "localhost/proj:custom"},
+			cfg:      project,
+			expected: true,
+		},
+		{
+			name:     "unlabeled hash tag of another project",
+			item:     ImageListItem{Tag: "other:abc123def456"},
+			cfg:      project,
+			expected: false,
+		},
+		{
+			name:     "unrelated image",
+			item:     ImageListItem{Tag: "alpine:latest"},
+			expected: false,
+		},
+		{
+			name:     "unrelated image with other labels",
+			item:     ImageListItem{Tag: "proj:latest", Labels: map[string]string{"maintainer": "me"}},
+			cfg:      project,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isMikoShellImage(tt.item, tt.cfg); result != tt.expected {
+				t.Errorf("isMikoShellImage(%+v) = %v, want %v", tt.item, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProvider_BuildResolvesPathsFromConfigDir(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "subdir")
+	if err := os.MkdirAll(filepath.Join(projectDir, "docker"), 0755); err != nil {
+		t.Fatalf("Failed to create project dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "docker", "Dockerfile"), []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+
+	writeConfig := func(t *testing.T, build string) *Config {
+		configPath := filepath.Join(projectDir, ConfigFileName)
+		content := "name: proj\ncontainer:\n  build:\n" + build
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		config, err := LoadConfigFromFile(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfigFromFile() failed: %v", err)
+		}
+		return config
+	}
+
+	t.Run("dockerfile and context relative to config", func(t *testing.T) {
+		runner := useMockRunner(t)
+		runner.err = exec.ErrNotFound
+		config := writeConfig(t, "    dockerfile: ./docker/Dockerfile\n    context: docker\n")
+
+		_ = (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{})
+
+		customBuild := runner.calls[1]
+		if !containsSequence(customBuild, "-f", filepath.Join(projectDir, "docker", "Dockerfile")) {
+			t.Errorf("Expected Dockerfile resolved against config dir, got %v", customBuild)
+		}
+		if customBuild[len(customBuild)-1] != filepath.Join(projectDir, "docker") {
+			t.Errorf("Expected context resolved against config dir, got %v", customBuild)
+		}
+	})
+
+	t.Run("missing dockerfile", func(t *testing.T) {
+		runner := useMockRunner(t)
+		config := writeConfig(t, "    dockerfile: Dockerfile.missing\n")
+
+		err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{})
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(projectDir, "Dockerfile.missing")) {
+			t.Errorf("Expected error naming the missing Dockerfile, got %v", err)
+		}
+		if len(runner.calls) != 0 {
+			t.Errorf("Expected no build to run, got %v", runner.calls)
+		}
+	})
+
+	t.Run("missing context", func(t *testing.T) {
+		useMockRunner(t)
+		config := writeConfig(t, "    dockerfile: docker/Dockerfile\n    context: missing\n")
+
+		err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{})
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(projectDir, "missing")) {
+			t.Errorf("Expected error naming the missing context, got %v", err)
+		}
+	})
+}
+
+func TestProvider_RunMountsConfigDir(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "subdir")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project dir: %v", err)
+	}
+	configPath := filepath.Join(projectDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte("name: proj\ncontainer:\n  image: alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	config, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile() failed: %v", err)
+	}
+
+	runner := useMockRunner(t)
+	if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[len(runner.calls)-1]
+	if !containsSequence(args, "-v", projectDir+":/workspace") {
+		t.Errorf("Expected config dir mounted at /workspace, got %v", args)
+	}
+}
+
+func TestProvider_RunUsesWorkdir(t *testing.T) {
+	projectDir := t.TempDir()
+	config := &Config{dir: projectDir, Container: Container{Image: "alpine:latest", Workdir: "/app"}}
+
+	runner := useMockRunner(t)
+	if err := (&PodmanProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[len(runner.calls)-1]
+	if !containsSequence(args, "-v", projectDir+":/app", "-w", "/app") {
+		t.Errorf("Expected config dir mounted and used at /app, got %v", args)
+	}
+}
+
+func TestProvider_RunSubWorkdir(t *testing.T) {
+	config := &Config{dir: t.TempDir(), Container: Container{Image: "alpine:latest"}}
+
+	runner := useMockRunner(t)
+	opts := RunOptions{Workdir: "services/api"}
+	if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, opts); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[len(runner.calls)-1]
+	if !containsSequence(args, "-v", config.dir+":/workspace", "-w", "/workspace/services/api") {
+		t.Errorf("Expected the workspace mounted and the subdirectory as workdir, got %v", args)
+	}
+}
+
+func TestProvider_RunAsUser(t *testing.T) {
+	config := &Config{Container: Container{Image: "alpine:latest", User: "1000:1000"}}
+
+	runner := useMockRunner(t)
+	if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"touch", "file"}, RunOptions{}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	if args := runner.calls[len(runner.calls)-1]; !containsSequence(args, "--user", "1000:1000") {
+		t.Errorf("Expected the container to run as 1000:1000, got %v", args)
+	}
+}
+
+func TestNerdctlProvider_GetPruneInfo(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.outputs = [][]byte{
+		[]byte("proj:abc123def456\nalpine:latest\n<none>:<none>\n"),
+		[]byte("alpine:latest\n"),
+		[]byte("8MB\n"),
+	}
+
+	info, err := (&NerdctlProvider{}).GetPruneInfo()
+	if err != nil {
+		t.Fatalf("GetPruneInfo() failed: %v", err)
+	}
+
+	// Only the dangling image is pruned, so only its size is reclaimed
+	expected := PruneInfo{TotalImages: 3, UnusedImages: 2, DanglingImages: 1, BuildCacheSize: "0B", TotalSize: "8MB"}
+	if *info != expected {
+		t.Errorf("GetPruneInfo() = %+v, want %+v", *info, expected)
+	}
+	if !containsSequence(runner.calls[1], "nerdctl", "ps", "-a") {
+		t.Errorf("Expected a nerdctl container listing, got %v", runner.calls[1])
+	}
+}
+
+func TestProvider_SharedArgs(t *testing.T) {
+	config := &Config{
+		Name: "proj",
+		dir:  t.TempDir(),
+		Container: Container{
+			Image:       "alpine:latest",
+			Setup:       []string{"apk add git"},
+			Environment: []string{"FOO=bar"},
+			Ports:       []string{"8080:80"},
+			HostGateway: true,
+		},
+		Shell: Shell{
+			InitHook: []string{"export READY=1"},
+			Scripts:  []Script{{Name: "test", Commands: []string{"go test ./..."}}},
+		},
+	}
+
+	operations := []struct {
+		name string
+		run  func(p ContainerProvider) error
+	}{
+		{name: "build", run: func(p ContainerProvider) error {
+			return p.BuildImage(config, "proj:abc123def456", BuildOptions{NoCache: true})
+		}},
+		{name: "run", run: func(p ContainerProvider) error {
+			return p.RunCommand(config, "proj:abc123def456", []string{"go", "test"}, RunOptions{Name: "job", TTY: true})
+		}},
+		{name: "shell with startup", run: func(p ContainerProvider) error {
+			return p.RunShellWithStartup(config, "proj:abc123def456")
+		}},
+		{name: "verify", run: func(p ContainerProvider) error {
+			return p.VerifyImage("proj:abc123def456", []string{"go version"})
+		}},
+	}
+
+	// callsOf records the provider's commands with the binary name dropped
+	callsOf := func(t *testing.T, p ContainerProvider, run func(ContainerProvider) error) [][]string {
+		runner := useMockRunner(t)
+		if err := run(p); err != nil {
+			t.Fatalf("operation failed: %v", err)
+		}
+		var calls [][]string
+		for _, call := range runner.calls {
+			calls = append(calls, call[1:])
+		}
+		return calls
+	}
+
+	for _, op := range operations {
+		t.Run(op.name, func(t *testing.T) {
+			docker := callsOf(t, &DockerProvider{}, op.run)
+			for _, other := range []ContainerProvider{&PodmanProvider{}, &NerdctlProvider{}} {
+				if calls := callsOf(t, other, op.run); !reflect.DeepEqual(calls, docker) {
+					t.Errorf("%T args differ from docker:\n got %v\nwant %v", other, calls, docker)
+				}
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	processErr := exec.Command("sh", "-c", "exit 3").Run()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "no error", err: nil, expected: 0},
+		{name: "process exit status", err: processErr, expected: 3},
+		{name: "wrapped exit status", err: fmt.Errorf("script failed: %w", processErr), expected: 3},
+		{name: "other error", err: errors.New("config invalid"), expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProvider_TagImage(t *testing.T) {
+	runner := useMockRunner(t)
+
+	if err := (&PodmanProvider{}).TagImage("proj:abc123def456", "proj:release"); err != nil {
+		t.Fatalf("TagImage() failed: %v", err)
+	}
+
+	expected := []string{"podman", "tag", "proj:abc123def456", "proj:release"}
+	if !reflect.DeepEqual(runner.calls[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, runner.calls[0])
+	}
+}
+
+func TestProvider_RunCommandMounts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "shared"), 0755); err != nil {
+		t.Fatalf("Failed to create mount dir: %v", err)
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".cache", "go"), 0755); err != nil {
+		t.Fatalf("Failed to create home mount dir: %v", err)
+	}
+
+	newConfig := func(mounts map[string]Mount) *Config {
+		return &Config{
+			Name:      "proj",
+			Container: Container{Image: "alpine:latest", Mounts: mounts},
+			dir:       dir,
+		}
+	}
+
+	t.Run("relative and home paths", func(t *testing.T) {
+		runner := useMockRunner(t)
+		config := newConfig(map[string]Mount{
+			"shared":  {Host: "shared", Path: "/shared", ReadOnly: true},
+			"gocache": {Host: "~/.cache/go", Path: "/root/.cache/go"},
+		})
+
+		if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		if !containsSequence(runner.calls[0],
+			"-v", filepath.Join(home, ".cache", "go")+":/root/.cache/go",
+			"-v", filepath.Join(dir, "shared")+":/shared:ro") {
+			t.Errorf("Expected sorted absolute mount args, got %v", runner.calls[0])
+		}
+	})
+
+	t.Run("missing host path", func(t *testing.T) {
+		runner := useMockRunner(t)
+		config := newConfig(map[string]Mount{"shared": {Host: "../missing", Path: "/shared"}})
+
+		err := (&PodmanProvider{}).RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{})
+		if err == nil || !strings.Contains(err.Error(), "shared") {
+			t.Errorf("Expected error naming the missing mount, got %v", err)
+		}
+		if len(runner.calls) != 0 {
+			t.Errorf("Expected no container to run, got %v", runner.calls)
+		}
+	})
+}
+
+func TestProvider_RunCommandEnvironmentAndPorts(t *testing.T) {
+	config := &Config{
+		Name: "proj",
+		Container: Container{
+			Image:       "alpine:latest",
+			Environment: []string{"APP_ENV=dev", "GITHUB_TOKEN"},
+			Ports:       []string{"8080:80", "3000"},
+		},
+	}
+
+	for _, provider := range []ContainerProvider{&DockerProvider{}, &PodmanProvider{}} {
+		runner := useMockRunner(t)
+		if err := provider.RunCommand(config, "proj:abc123def456", []string{"env"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		if !containsSequence(runner.calls[0], "-p", "8080:80", "-p", "3000") {
+			t.Errorf("Expected port args, got %v", runner.calls[0])
+		}
+		if !containsSequence(runner.calls[0], "-e", "APP_ENV=dev", "-e", "GITHUB_TOKEN") {
+			t.Errorf("Expected environment args, got %v", runner.calls[0])
+		}
+		if !containsSequence(runner.calls[0], "-e", InContainerEnv+"=1") {
+			t.Errorf("Expected the in-container marker, got %v", runner.calls[0])
+		}
+	}
+}
+
+func TestProvider_RunCommandPassEnvPrefix(t *testing.T) {
+	t.Setenv("MIKOTEST_TOKEN", "secret")
+	t.Setenv("MIKOTEST_MODE", "ci")
+	config := &Config{
+		Name: "proj",
+		Container: Container{
+			Image:         "alpine:latest",
+			PassEnvPrefix: []string{"MIKOTEST_"},
+			Environment:   []string{"MIKOTEST_MODE=local"},
+		},
+	}
+
+	runner := useMockRunner(t)
+	if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"env"}, RunOptions{}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[0]
+	if !containsSequence(args, "-e", "MIKOTEST_MODE", "-e", "MIKOTEST_TOKEN", "-e", "MIKOTEST_MODE=local") {
+		t.Errorf("Expected prefix matches before explicit environment, got %v", args)
+	}
+	if strings.Contains(strings.Join(args, " "), "secret") {
+		t.Errorf("Expected host values to stay off the command line, got %v", args)
+	}
+}
+
+func TestProvider_RunCommandEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".env", ".env.local"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("APP_ENV=dev\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	newConfig := func(files ...string) *Config {
+		return &Config{
+			Name:      "proj",
+			Container: Container{Image: "alpine:latest", EnvFile: files, Environment: []string{"DEBUG=1"}},
+			dir:       dir,
+		}
+	}
+
+	t.Run("files in order before -e", func(t *testing.T) {
+		runner := useMockRunner(t)
+		if err := (&DockerProvider{}).RunCommand(newConfig(".env", ".env.local"), "proj:abc123def456", []string{"env"}, RunOptions{}); err != nil {
+			t.Fatalf("RunCommand() failed: %v", err)
+		}
+
+		if !containsSequence(runner.calls[0],
+			"--env-file", filepath.Join(dir, ".env"),
+			"--env-file", filepath.Join(dir, ".env.local"),
+			"-e", "DEBUG=1") {
+			t.Errorf("Expected ordered env file args, got %v", runner.calls[0])
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		runner := useMockRunner(t)
+		err := (&PodmanProvider{}).RunCommand(newConfig(".env.missing"), "proj:abc123def456", []string{"env"}, RunOptions{})
+		if err == nil || !strings.Contains(err.Error(), ".env.missing") {
+			t.Errorf("Expected error naming the missing env file, got %v", err)
+		}
+		if len(runner.calls) != 0 {
+			t.Errorf("Expected no container to run, got %v", runner.calls)
+		}
+	})
+}
+
+func TestProvider_RunCommandAutoEnv(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".env", ".env.local"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("APP_ENV=dev\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		autoEnv  bool
+		envFiles []string
+		expected []string
+	}{
+		{name: "off", dir: dir, expected: []string{"-e", "DEBUG=1"}},
+		{name: "on", dir: dir, autoEnv: true, expected: []string{"--env-file", filepath.Join(dir, ".env"), "-e", "DEBUG=1"}},
+		{name: "before explicit env files", dir: dir, autoEnv: true, envFiles: []string{".env.local"}, expected: []string{
+			"--env-file", filepath.Join(dir, ".env"), "--env-file", filepath.Join(dir, ".env.local"), "-e", "DEBUG=1",
+		}},
+		{name: "listed explicitly", dir: dir, autoEnv: true, envFiles: []string{".env"}, expected: []string{
+			"--env-file", filepath.Join(dir, ".env"), "-e", "DEBUG=1",
+		}},
+		{name: "no .env", dir: t.TempDir(), autoEnv: true, expected: []string{"-e", "DEBUG=1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			config := &Config{
+				Name:      "proj",
+				Container: Container{Image: "alpine:latest", AutoEnv: tt.autoEnv, EnvFile: tt.envFiles, Environment: []string{"DEBUG=1"}},
+				dir:       tt.dir,
+			}
+			if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"env"}, RunOptions{}); err != nil {
+				t.Fatalf("RunCommand() failed: %v", err)
+			}
+
+			var got []string
+			for i, arg := range runner.calls[0] {
+				if arg == "--env-file" || (arg == "-e" && i+1 < len(runner.calls[0]) && runner.calls[0][i+1] == "DEBUG=1") {
+					got = append(got, arg, runner.calls[0][i+1])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected env args %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProvider_RunCommandHostGateway(t *testing.T) {
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			for _, enabled := range []bool{true, false} {
+				runner := useMockRunner(t)
+				config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", HostGateway: enabled}}
+
+				if err := provider.p.RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+					t.Fatalf("RunCommand() failed: %v", err)
+				}
+
+				got := containsSequence(runner.calls[0], "--add-host", "host.docker.internal:host-gateway")
+				if got != enabled {
+					t.Errorf("host_gateway=%v: unexpected args %v", enabled, runner.calls[0])
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_RunInit(t *testing.T) {
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			for _, enabled := range []bool{true, false} {
+				runner := useMockRunner(t)
+				config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", Init: enabled}}
+
+				if err := provider.p.RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+					t.Fatalf("RunCommand() failed: %v", err)
+				}
+				if err := provider.p.RunShell(config, "proj:abc123def456"); err != nil {
+					t.Fatalf("RunShell() failed: %v", err)
+				}
+
+				for _, call := range runner.calls {
+					if got := containsSequence(call, "--init"); got != enabled {
+						t.Errorf("init=%v: unexpected args %v", enabled, call)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_ContextArgs(t *testing.T) {
+	config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", Context: "remote"}}
+
+	tests := []struct {
+		name     string
+		provider string
+		expected []string
+	}{
+		{name: "docker context", provider: "docker", expected: []string{"docker", "--context", "remote"}},
+		{name: "podman connection", provider: "podman", expected: []string{"podman", "--connection", "remote"}},
+		{name: "nerdctl namespace", provider: "nerdctl", expected: []string{"nerdctl", "--namespace", "remote"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Container.Provider = tt.provider
+			provider, err := NewContainerProviderForConfig(config)
+			if err != nil {
+				t.Fatalf("NewContainerProviderForConfig() failed: %v", err)
+			}
+
+			runner := useMockRunner(t)
+			if err := provider.BuildImage(config, "proj:abc123def456", BuildOptions{}); err != nil {
+				t.Fatalf("BuildImage() failed: %v", err)
+			}
+			if err := provider.RunCommand(config, "proj:abc123def456", []string{"true"}, RunOptions{}); err != nil {
+				t.Fatalf("RunCommand() failed: %v", err)
+			}
+			provider.ImageExists("proj:abc123def456")
+			if _, err := provider.ListImages(); err != nil {
+				t.Fatalf("ListImages() failed: %v", err)
+			}
+
+			for _, call := range runner.calls {
+				if !reflect.DeepEqual(call[:3], tt.expected) {
+					t.Errorf("Expected %v prefix, got %v", tt.expected, call)
+				}
+			}
+		})
+	}
+
+	t.Run("no context", func(t *testing.T) {
+		runner := useMockRunner(t)
+		(&DockerProvider{}).ImageExists("proj:abc123def456")
+		if containsSequence(runner.calls[0], "--context") {
+			t.Errorf("Unexpected --context in %v", runner.calls[0])
+		}
+	})
+}
+
+func TestProvider_CheckDaemon(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ContainerProvider
+		expected []string
+	}{
+		{name: "docker", provider: &DockerProvider{}, expected: []string{"docker", "info", "--format", "{{.ServerVersion}}"}},
+		{name: "podman", provider: &PodmanProvider{}, expected: []string{"podman", "info", "--format", "{{.Version.Version}}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			if err := tt.provider.CheckDaemon(); err != nil {
+				t.Fatalf("CheckDaemon() failed: %v", err)
+			}
+			if !reflect.DeepEqual(runner.calls[0], tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, runner.calls[0])
+			}
+
+			runner.err = errors.New("Cannot connect to the Docker daemon")
+			err := tt.provider.CheckDaemon()
+			var daemonErr *DaemonUnavailableError
+			if !errors.As(err, &daemonErr) || daemonErr.Provider != tt.name {
+				t.Fatalf("Expected a DaemonUnavailableError for %s, got %v", tt.name, err)
+			}
+			if !strings.Contains(err.Error(), tt.name+" is installed but the daemon isn't running") {
+				t.Errorf("Unexpected message %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestProvider_VerifyImage(t *testing.T) {
+	t.Run("runs each command", func(t *testing.T) {
+		runner := useMockRunner(t)
+		if err := (&DockerProvider{}).VerifyImage("proj:abc123def456", []string{"go version", "make --version"}); err != nil {
+			t.Fatalf("VerifyImage() failed: %v", err)
+		}
+
+		if len(runner.calls) != 2 {
+			t.Fatalf("Expected 2 verify runs, got %v", runner.calls)
+		}
+		if !containsSequence(runner.calls[0], "run", "--rm", "--entrypoint", "", "proj:abc123def456", "/bin/sh", "-c", "{ go version\n} 2>&1") {
+			t.Errorf("Unexpected verify run %v", runner.calls[0])
+		}
+	})
+
+	t.Run("stops at the first failure", func(t *testing.T) {
+		runner := useMockRunner(t)
+		runner.output = []byte("sh: go: not found\n")
+		runner.err = errors.New("exit status 127")
+
+		err := (&PodmanProvider{}).VerifyImage("proj:abc123def456", []string{"go version", "make --version"})
+		if err == nil || !strings.Contains(err.Error(), "go version") || !strings.Contains(err.Error(), "sh: go: not found") {
+			t.Errorf("Expected error with the command and its output, got %v", err)
+		}
+		if len(runner.calls) != 1 {
+			t.Errorf("Expected verification to stop after the failure, got %v", runner.calls)
+		}
+	})
+}
+
+func TestProvider_BuildCustomImageContexts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "shared"), 0755); err != nil {
+		t.Fatalf("Failed to create context dir: %v", err)
+	}
+
+	newConfig := func(contexts map[string]string) *Config {
+		return &Config{
+			Name: "proj",
+			Container: Container{Build: &ContainerBuild{
+				Dockerfile: "Dockerfile",
+				Context:    ".",
+				Contexts:   contexts,
+			}},
+			dir: dir,
+		}
+	}
+
+	t.Run("emits sorted context args", func(t *testing.T) {
+		runner := useMockRunner(t)
+		runner.err = exec.ErrNotFound
+		config := newConfig(map[string]string{
+			"shared": "shared",
+			"base":   "docker-image://alpine:3.19",
+		})
+
+		_ = (&PodmanProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{})
+
+		customBuild := runner.calls[1]
+		if !containsSequence(customBuild,
+			"--build-context", "base=docker-image://alpine:3.19",
+			"--build-context", "shared="+filepath.Join(dir, "shared")) {
+			t.Errorf("Expected build context args, got %v", customBuild)
+		}
+	})
+
+	t.Run("missing local context", func(t *testing.T) {
+		runner := useMockRunner(t)
+		config := newConfig(map[string]string{"shared": "missing"})
+
+		err := (&DockerProvider{}).BuildImage(config, "proj:abc123def456", BuildOptions{})
+		if err == nil || !strings.Contains(err.Error(), "shared") {
+			t.Errorf("Expected error naming the missing context, got %v", err)
+		}
+		if len(runner.calls) != 0 {
+			t.Errorf("Expected no build to run, got %v", runner.calls)
+		}
+	})
+}
+
+func TestProvider_RunSyncTimezone(t *testing.T) {
+	t.Setenv("TZ", "Europe/Madrid")
+
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{name: "enabled", enabled: true},
+		{name: "disabled", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			config := &Config{Name: "proj", Container: Container{Image: "alpine:latest", SyncTimezone: tt.enabled}}
+
+			if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"date"}, RunOptions{}); err != nil {
+				t.Fatalf("RunCommand() failed: %v", err)
+			}
+
+			args := runner.calls[len(runner.calls)-1]
+			if passed := containsSequence(args, "-e", "TZ=Europe/Madrid"); passed != tt.enabled {
+				t.Errorf("Expected TZ passed = %v, got %v", tt.enabled, args)
+			}
+		})
+	}
+}
+
+func TestParseImageHistory(t *testing.T) {
+	output := "sha256:1a2b3c\t12.3MB\t/bin/sh -c apk add --no-cache curl git\n" +
+		"<missing>\t0B\t/bin/sh -c #(nop)  CMD [\"/bin/sh\"]\n" +
+		"<missing>\t7.8MB\t/bin/sh -c #(nop) ADD file:abc in / \n" +
+		"malformed line\n"
+
+	layers := parseImageHistory([]byte(output))
+
+	expected := []LayerInfo{
+		{ID: "sha256:1a2b3c", Size: "12.3MB", CreatedBy: "/bin/sh -c apk add --no-cache curl git"},
+		{ID: "<missing>", Size: "0B", CreatedBy: `/bin/sh -c #(nop)  CMD ["/bin/sh"]`},
+		{ID: "<missing>", Size: "7.8MB", CreatedBy: "/bin/sh -c #(nop) ADD file:abc in /"},
+	}
+	if !reflect.DeepEqual(layers, expected) {
+		t.Errorf("parseImageHistory() = %+v, want %+v", layers, expected)
+	}
+}
+
+func TestProvider_ImageHistory(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.output = []byte("sha256:1a2b3c\t12.3MB\t/bin/sh -c apk add curl\n")
+
+	layers, err := (&DockerProvider{}).ImageHistory("proj:abc123def456")
+	if err != nil {
+		t.Fatalf("ImageHistory() failed: %v", err)
+	}
+
+	expected := []string{"docker", "history", "--no-trunc", "--format", historyFormat, "proj:abc123def456"}
+	if !reflect.DeepEqual(runner.calls[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, runner.calls[0])
+	}
+	if len(layers) != 1 || layers[0].Size != "12.3MB" {
+		t.Errorf("Unexpected layers %+v", layers)
+	}
+}
+
+func TestProvider_ListImagesTagFormat(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.outputs = [][]byte{
+		[]byte("1a2b3c4d5e6f\n"),
+		[]byte("1a2b3c4d5e6f\tregistry.example.com/proj:abc123def456-linux-amd64\t12.3MB\t2024-03-01 10:20:30 +0000 UTC\n" +
+			"2b3c4d5e6f7a\told:0123456789ab\t8MB\t2024-02-01 10:20:30 +0000 UTC\n" +
+			"3c4d5e6f7a8b\talpine:latest\t7.8MB\t2024-01-01 00:00:00 +0000 UTC\n"),
+	}
+
+	images, err := (&DockerProvider{}).ListImages()
+	if err != nil {
+		t.Fatalf("ListImages() failed: %v", err)
+	}
+
+	expectedCalls := [][]string{
+		{"docker", "images", "--filter", "label=" + LabelName, "--format", "{{.ID}}"},
+		{"docker", "images", "--format", imageListFormat},
+	}
+	if !reflect.DeepEqual(runner.calls, expectedCalls) {
+		t.Errorf("Expected %v, got %v", expectedCalls, runner.calls)
+	}
+	// The labeled image is listed despite its custom tag, the unlabeled one by its name
+	if len(images) != 2 || images[0].Tag != "registry.example.com/proj:abc123def456-linux-amd64" || images[1].Tag != "old:0123456789ab" {
+		t.Errorf("Unexpected images %+v", images)
+	}
+}
+
+func TestParseImageList(t *testing.T) {
+	output := "1a2b3c4d5e6f\tproj:abc123def456\t12.3MB\t2024-03-01 10:20:30 +0000 UTC\n" +
+		"2b3c4d5e6f7a\tlocalhost/other:custom\t1.1GB\t2024-03-02 08:00:00.123456789 +0000 UTC\n" +
+		"3c4d5e6f7a8b\talpine:latest\t7.8MB\t2024-01-01 00:00:00 +0000 UTC\n" +
+		"4d5e6f7a8b9c\t<none>:<none>\t5MB\t2024-01-01 00:00:00 +0000 UTC\n" +
+		"malformed line\n"
+
+	images := parseImageList([]byte(output), nil)
+
+	expected := []ImageListItem{
+		{ID: "1a2b3c4d5e6f", Tag: "proj:abc123def456", Size: "12.3MB", Created: time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)},
+		{ID: "2b3c4d5e6f7a", Tag: "localhost/other:custom", Size: "1.1GB", Created: time.Date(2024, 3, 2, 8, 0, 0, 123456789, time.UTC)},
+	}
+	if len(images) != len(expected) {
+		t.Fatalf("parseImageList() = %+v, want %+v", images, expected)
+	}
+	for i := range expected {
+		if images[i].ID != expected[i].ID || images[i].Tag != expected[i].Tag || images[i].Size != expected[i].Size {
+			t.Errorf("images[%d] = %+v, want %+v", i, images[i], expected[i])
+		}
+		if !images[i].Created.Equal(expected[i].Created) {
+			t.Errorf("images[%d].Created = %v, want %v", i, images[i].Created, expected[i].Created)
+		}
+	}
+}
+
+func TestProvider_ListImages(t *testing.T) {
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			runner.output = []byte("1a2b3c4d5e6f\tproj:abc123def456\t12.3MB\t2024-03-01 10:20:30 +0000 UTC\n")
+
+			images, err := provider.p.ListImages()
+			if err != nil {
+				t.Fatalf("ListImages() failed: %v", err)
+			}
+
+			expected := []string{provider.name, "images", "--format", imageListFormat}
+			if len(runner.calls) != 2 || !reflect.DeepEqual(runner.calls[1], expected) {
+				t.Errorf("Expected %v after the labeled listing, got %v", expected, runner.calls)
+			}
+			if len(images) != 1 || images[0].Tag != "proj:abc123def456" {
+				t.Errorf("Unexpected images %+v", images)
+			}
+		})
+	}
+}
+
+func TestProvider_CleanImages(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.outputs = [][]byte{
+		[]byte("111111111111\n222222222222\n333333333333\n444444444444\n555555555555\n"),
+		[]byte("111111111111\n222222222222\n333333333333\n444444444444\n"),
+		[]byte(strings.Join([]string{
+			"111111111111\tproj:aaaaaaaaaaaa\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"222222222222\tproj:bbbbbbbbbbbb\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"222222222222\tproj:stable\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"333333333333\tregistry.example.com/proj:cccccccccccc-linux\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"444444444444\t<none>:<none>\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"555555555555\tproj:dddddddddddd\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"666666666666\tproj:eeeeeeeeeeee\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"777777777777\tother:ffffffffffff\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+			"888888888888\talpine:latest\t10MB\t2024-03-01 10:20:30 +0000 UTC",
+		}, "\n")),
+	}
+	cfg := &Config{Name: "proj"}
+
+	removed, err := (&DockerProvider{}).CleanImages(cfg, []string{"proj:bbbbbbbbbbbb"})
+	if err != nil {
+		t.Fatalf("CleanImages() failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(runner.calls[1], []string{"docker", "images", "--filter", "label=" + LabelName + "=proj", "--format", "{{.ID}}"}) {
+		t.Errorf("Expected the project's labeled images listed, got %v", runner.calls[1])
+	}
+	// 555555555555 is labeled for another project and 777777777777 is named
+	// after one; the current image is kept under both of its tags
+	expected := []string{"proj:aaaaaaaaaaaa", "registry.example.com/proj:cccccccccccc-linux", "444444444444", "proj:eeeeeeeeeeee"}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("Expected %v removed, got %v", expected, removed)
+	}
+	var rmi []string
+	for _, call := range runner.calls[3:] {
+		if len(call) != 4 || call[1] != "rmi" || call[2] != "-f" {
+			t.Fatalf("Expected only image removals, got %v", call)
+		}
+		rmi = append(rmi, call[3])
+	}
+	if !reflect.DeepEqual(rmi, expected) {
+		t.Errorf("Expected rmi of %v, got %v", expected, rmi)
+	}
+}
+
+func TestParseSystemDF(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected PruneInfo
+	}{
+		{
+			name: "docker json lines",
+			output: `{"Active":"2","Reclaimable":"1.2GB (40%)","Size":"3GB","TotalCount":"5","Type":"Images"}
+{"Active":"1","Reclaimable":"0B (0%)","Size":"10kB","TotalCount":"1","Type":"Containers"}
+{"Active":"0","Reclaimable":"300MB","Size":"300MB","TotalCount":"12","Type":"Build Cache"}`,
+			expected: PruneInfo{TotalImages: 5, UnusedImages: 3, BuildCacheSize: "300MB", TotalSize: "1.5GB"},
+		},
+		{
+			name:     "podman json array",
+			output:   `[{"Type":"Images","Total":4,"Active":1,"Size":"2GB","Reclaimable":"750MB (37%)"}]`,
+			expected: PruneInfo{TotalImages: 4, UnusedImages: 3, BuildCacheSize: "0B", TotalSize: "750MB"},
+		},
+		{
+			name:     "empty output",
+			output:   "",
+			expected: PruneInfo{BuildCacheSize: "0B", TotalSize: "0B"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseSystemDF([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parseSystemDF() failed: %v", err)
+			}
+			if *info != tt.expected {
+				t.Errorf("parseSystemDF() = %+v, want %+v", *info, tt.expected)
+			}
+		})
+	}
+
+	if _, err := parseSystemDF([]byte("not json")); err == nil {
+		t.Error("Expected an error for malformed output")
+	}
+}
+
+func TestParsePruneOutput(t *testing.T) {
+	output := "Deleted Images:\nuntagged: proj:abc123def456\ndeleted: sha256:1a2b\ndeleted: sha256:3c4d\n\nTotal reclaimed space: 1.2GB\n"
+
+	removed, reclaimed := parsePruneOutput([]byte(output))
+	if removed != 2 {
+		t.Errorf("Expected 2 removed images, got %d", removed)
+	}
+	if reclaimed != 1200000000 {
+		t.Errorf("Expected 1200000000 reclaimed bytes, got %d", reclaimed)
+	}
+
+	_, reclaimed = parsePruneOutput([]byte("ID\tRECLAIMABLE\tSIZE\nabc\ttrue\t12MB\nTotal:\t12MB\n"))
+	if reclaimed != 12000000 {
+		t.Errorf("Expected 12000000 reclaimed bytes from builder prune, got %d", reclaimed)
+	}
+}
+
+func TestParseBuilderPruneOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		removed   int
+		reclaimed int64
+	}{
+		{
+			name:      "object list",
+			output:    "Deleted build cache objects:\nx1yk6ajm4c2qfmxq0dcjzyf3r\nv6wm7qfy1jz0x9qkhm9aupahn\n8dlf5gyj0hlwgu9bdurfh4lzt\n\nTotal reclaimed space: 1.5GB\n",
+			removed:   3,
+			reclaimed: 1500000000,
+		},
+		{
+			name:      "table",
+			output:    "ID\t\tRECLAIMABLE\tSIZE\tLAST ACCESSED\nabc123\ttrue\t12MB\t2 days ago\ndef456\ttrue\t8MB\t3 days ago\nTotal:\t20MB\n",
+			removed:   2,
+			reclaimed: 20000000,
+		},
+		{
+			name:   "nothing to prune",
+			output: "Total:\t0B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, reclaimed := parseBuilderPruneOutput([]byte(tt.output))
+			if removed != tt.removed || reclaimed != tt.reclaimed {
+				t.Errorf("Expected %d objects and %d bytes, got %d and %d", tt.removed, tt.reclaimed, removed, reclaimed)
+			}
+		})
+	}
+}
+
+func TestProvider_PruneBuildCache(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.output = []byte("Deleted build cache objects:\nabc\ndef\n\nTotal reclaimed space: 80MB\n")
+
+	result, err := (&DockerProvider{}).PruneBuildCache()
+	if err != nil {
+		t.Fatalf("PruneBuildCache() failed: %v", err)
+	}
+	if !containsSequence(runner.calls[0], "docker", "builder", "prune", "-f") {
+		t.Errorf("Expected docker builder prune, got %v", runner.calls[0])
+	}
+	if result.RemovedCacheObjects != 2 || result.ReclaimedSpace != "80MB" || result.RemovedImages != 0 {
+		t.Errorf("Unexpected prune result: %+v", result)
+	}
+
+	if _, err := (&PodmanProvider{}).PruneBuildCache(); err == nil {
+		t.Error("Expected podman to report it has no separate build cache")
+	}
+}
+
+func TestSizeRoundTrip(t *testing.T) {
+	tests := []struct {
+		size  string
+		bytes int64
+	}{
+		{"0B", 0},
+		{"512B", 512},
+		{"10kB", 10000},
+		{"1.2GB", 1200000000},
+		{"300MB", 300000000},
+	}
+
+	for _, tt := range tests {
+		if got := parseSize(tt.size); got != tt.bytes {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.size, got, tt.bytes)
+		}
+		if got := formatSize(tt.bytes); got != tt.size {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.bytes, got, tt.size)
+		}
+	}
+
+	if got := parseSize("unknown"); got != 0 {
+		t.Errorf("parseSize(\"unknown\") = %d, want 0", got)
+	}
+}
+
+func TestProvider_GetPruneInfo(t *testing.T) {
+	runner := useMockRunner(t)
+	runner.outputs = [][]byte{
+		[]byte(`{"Active":"2","Reclaimable":"1.2GB (40%)","TotalCount":"5","Type":"Images"}
+{"Active":"0","Reclaimable":"300MB","TotalCount":"12","Type":"Build Cache"}`),
+		[]byte("50MB\n25MB\n"),
+	}
+
+	info, err := (&DockerProvider{}).GetPruneInfo()
+	if err != nil {
+		t.Fatalf("GetPruneInfo() failed: %v", err)
+	}
+
+	expectedCalls := [][]string{
+		{"docker", "system", "df", "--format", "json"},
+		{"docker", "images", "--filter", "dangling=true", "--format", "{{.Size}}"},
+	}
+	if !reflect.DeepEqual(runner.calls, expectedCalls) {
+		t.Errorf("Expected %v, got %v", expectedCalls, runner.calls)
+	}
+	// Unused but tagged images are kept by the prune, so the total covers
+	// the dangling images and the build cache only
+	expected := PruneInfo{TotalImages: 5, UnusedImages: 3, DanglingImages: 2, BuildCacheSize: "300MB", TotalSize: "375MB"}
+	if *info != expected {
+		t.Errorf("GetPruneInfo() = %+v, want %+v", *info, expected)
+	}
+}
+
+func TestProvider_PruneImages(t *testing.T) {
+	t.Run("docker", func(t *testing.T) {
+		runner := useMockRunner(t)
+		runner.output = []byte("deleted: sha256:1a2b\nTotal reclaimed space: 1GB\n")
+
+		result, err := (&DockerProvider{}).PruneImages()
+		if err != nil {
+			t.Fatalf("PruneImages() failed: %v", err)
+		}
+
+		expected := [][]string{
+			{"docker", "image", "prune", "-f"},
+			{"docker", "builder", "prune", "-f"},
+		}
+		if !reflect.DeepEqual(runner.calls, expected) {
+			t.Errorf("Expected %v, got %v", expected, runner.calls)
+		}
+		// The mock returns the same output for both prunes
+		if result.RemovedImages != 1 || result.ReclaimedSpace != "2GB" {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	})
+
+	t.Run("podman", func(t *testing.T) {
+		runner := useMockRunner(t)
+		runner.outputs = [][]byte{
+			[]byte(`[{"Type":"Images","Total":2,"Active":0,"Reclaimable":"1GB"}]`),
+			[]byte("40 MB\n"),
+			[]byte("1a2b3c4d5e6f\n"),
+		}
+
+		result, err := (&PodmanProvider{}).PruneImages()
+		if err != nil {
+			t.Fatalf("PruneImages() failed: %v", err)
+		}
+
+		expected := []string{"podman", "image", "prune", "-f"}
+		if !reflect.DeepEqual(runner.calls[len(runner.calls)-1], expected) {
+			t.Errorf("Expected podman image prune, got %v", runner.calls)
+		}
+		// Only the dangling image counts, not everything system df reports
+		if result.RemovedImages != 1 || result.ReclaimedSpace != "40MB" {
+			t.Errorf("Expected the dangling image's size reclaimed, got %+v", result)
+		}
+	})
+}
+
+func TestParseImageInspect(t *testing.T) {
+	output := `[{
+		"Id": "sha256:1a2b3c4d5e6f7a8b",
+		"RepoTags": ["proj:abc123def456"],
+		"Created": "2024-03-01T10:20:30.5Z",
+		"Size": 12300000,
+		"Os": "linux",
+		"Architecture": "arm64",
+		"Variant": "v8",
+		"Config": {
+			"Labels": {"org.mikoshell.name": "proj"},
+			"Env": ["PATH=/usr/bin"],
+			"ExposedPorts": {"8080/tcp": {}, "443/tcp": {}}
+		},
+		"RootFS": {"Layers": ["sha256:aaaa", "sha256:bbbb"]}
+	}]`
+
+	info, err := parseImageInspect([]byte(output))
+	if err != nil {
+		t.Fatalf("parseImageInspect() failed: %v", err)
+	}
+
+	expected := &ImageInfo{
+		ID:           "1a2b3c4d5e6f7a8b",
+		Tag:          "proj:abc123def456",
+		Size:         "12.3MB",
+		Created:      time.Date(2024, 3, 1, 10, 20, 30, 500000000, time.UTC),
+		Platform:     "linux/arm64/v8",
+		Labels:       map[string]string{LabelName: "proj"},
+		Layers:       []LayerInfo{{ID: "aaaa"}, {ID: "bbbb"}},
+		Env:          []string{"PATH=/usr/bin"},
+		ExposedPorts: []string{"443/tcp", "8080/tcp"},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("parseImageInspect() = %+v, want %+v", info, expected)
+	}
+
+	if _, err := parseImageInspect([]byte("[]")); err == nil {
+		t.Error("Expected an error when no image is returned")
+	}
+}
+
+func TestProvider_InspectImageRaw(t *testing.T) {
+	// Fields GetImageInfo doesn't model must survive untouched
+	raw := []byte(`[{"Id":"sha256:abc","Config":{"Healthcheck":{"Test":["CMD","true"]}}}]` + "\n")
+
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			runner.output = raw
+
+			output, err := provider.p.InspectImage("proj:abc123def456")
+			if err != nil {
+				t.Fatalf("InspectImage() failed: %v", err)
+			}
+			if !bytes.Equal(output, raw) {
+				t.Errorf("Expected raw output %q, got %q", raw, output)
+			}
+
+			expected := []string{provider.name, "image", "inspect", "proj:abc123def456"}
+			if !reflect.DeepEqual(runner.calls[0], expected) {
+				t.Errorf("Expected %v, got %v", expected, runner.calls[0])
+			}
+		})
+	}
+}
+
+func TestProvider_GetImageInfoNotFound(t *testing.T) {
+	for _, provider := range []struct {
+		name string
+		p    ContainerProvider
+	}{{"docker", &DockerProvider{}}, {"podman", &PodmanProvider{}}} {
+		t.Run(provider.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			runner.err = exec.ErrNotFound
+
+			info, err := provider.p.GetImageInfo("missing:latest")
+			if err == nil || !strings.Contains(err.Error(), "missing:latest") {
+				t.Errorf("Expected an error naming the image, got %v", err)
+			}
+			if info != nil {
+				t.Errorf("Expected no image info, got %+v", info)
+			}
+
+			expected := []string{provider.name, "image", "inspect", "missing:latest"}
+			if !reflect.DeepEqual(runner.calls[0], expected) {
+				t.Errorf("Expected %v, got %v", expected, runner.calls[0])
+			}
+		})
+	}
+}
+
+func TestProvider_BuildImageLabelsForBuildConfigs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:latest\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name:   "image config",
+			config: &Config{Name: "proj", Container: Container{Image: "alpine:latest"}},
+		},
+		{
+			name: "build config",
+			config: &Config{
+				Name: "proj",
+				Container: Container{Build: &ContainerBuild{
+					Dockerfile: "Dockerfile",
+					Context:    ".",
+					Labels:     map[string]string{"org.example.team": "platform"},
+				}},
+				dir: dir,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := useMockRunner(t)
+			runner.err = exec.ErrNotFound
+
+			_ = (&DockerProvider{}).BuildImage(tt.config, "proj:abc123def456", BuildOptions{})
+
+			runtimeBuild := runner.calls[len(runner.calls)-1]
+			for _, label := range []string{LabelName + "=proj", LabelConfigHash + "=abc123def456", LabelVersion + "=" + Version} {
+				if !containsSequence(runtimeBuild, "--label", label) {
+					t.Errorf("Expected label %s on runtime image, got %v", label, runtimeBuild)
+				}
+			}
+
+			if tt.config.Container.Build != nil {
+				customBuild := runner.calls[1]
+				for _, label := range []string{LabelName + "=proj", "org.example.team=platform"} {
+					if !containsSequence(customBuild, "--label", label) {
+						t.Errorf("Expected label %s on custom image, got %v", label, customBuild)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_RunCommandTTY(t *testing.T) {
+	runner := useMockRunner(t)
+	config := &Config{Name: "proj", Container: Container{Image: "alpine:latest"}}
+
+	if err := (&DockerProvider{}).RunCommand(config, "proj:abc123def456", []string{"git", "diff"}, RunOptions{TTY: true}); err != nil {
+		t.Fatalf("RunCommand() failed: %v", err)
+	}
+
+	args := runner.calls[len(runner.calls)-1]
+	if !containsSequence(args, "-it") || !containsSequence(args, "proj:abc123def456", "git", "diff") {
+		t.Errorf("Expected a TTY run of the command, got %v", args)
+	}
+}
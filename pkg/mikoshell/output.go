@@ -0,0 +1,198 @@
+package mikoshell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prefixWriter writes a prefix at the start of every line written through it
+type prefixWriter struct {
+	w       io.Writer
+	prefix  []byte
+	midLine bool
+}
+
+// newPrefixWriter returns a writer that prefixes each line written to w
+func newPrefixWriter(w io.Writer, prefix string) io.Writer {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		if !p.midLine {
+			if _, err := p.w.Write(p.prefix); err != nil {
+				return written, err
+			}
+			p.midLine = true
+		}
+
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+			p.midLine = false
+		}
+
+		n, err := p.w.Write(line)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		data = data[len(line):]
+	}
+	return written, nil
+}
+
+// writerOr returns w, or fallback when w is nil
+func writerOr(w, fallback io.Writer) io.Writer {
+	if w == nil {
+		return fallback
+	}
+	return w
+}
+
+// timingMarker starts the line a script writes to stderr before each of its
+// commands when run with a summary, followed by the command number
+const timingMarker = "::miko-shell-timing::"
+
+// timingWriter removes timing marker lines from a stream and records when
+// each one arrived, so command durations are measured on the host without
+// relying on 'time' or 'date' in the image
+type timingWriter struct {
+	w       io.Writer
+	pending []byte
+	// begin is when the current attempt started
+	begin time.Time
+	// starts holds when each command started, indexed by command number - 1
+	starts []time.Time
+}
+
+// newTimingWriter returns a writer passing everything but timing markers to w
+func newTimingWriter(w io.Writer) *timingWriter {
+	return &timingWriter{w: w, begin: time.Now()}
+}
+
+// reset forgets the commands of an earlier attempt
+func (t *timingWriter) reset() {
+	t.begin = time.Now()
+	t.starts = nil
+}
+
+func (t *timingWriter) Write(data []byte) (int, error) {
+	buf := append(t.pending, data...)
+	t.pending = nil
+
+	for len(buf) > 0 {
+		i := bytes.Index(buf, []byte(timingMarker))
+		if i < 0 {
+			// Hold back a tail that may be the start of a marker
+			keep := 0
+			for n := len(timingMarker) - 1; n > 0; n-- {
+				if bytes.HasSuffix(buf, []byte(timingMarker[:n])) {
+					keep = n
+					break
+				}
+			}
+			t.pending = append(t.pending, buf[len(buf)-keep:]...)
+			buf = buf[:len(buf)-keep]
+			break
+		}
+
+		end := bytes.IndexByte(buf[i:], '\n')
+		if end < 0 {
+			t.pending = append(t.pending, buf[i:]...)
+			buf = buf[:i]
+			break
+		}
+
+		if _, err := t.w.Write(buf[:i]); err != nil {
+			return 0, err
+		}
+		t.record(string(buf[i+len(timingMarker) : i+end]))
+		buf = buf[i+end+1:]
+	}
+
+	if _, err := t.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// record notes the start of the command whose number follows a marker
+func (t *timingWriter) record(number string) {
+	n, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil || n < 1 {
+		return
+	}
+	for len(t.starts) < n {
+		t.starts = append(t.starts, time.Time{})
+	}
+	t.starts[n-1] = time.Now()
+}
+
+// flush writes out a held back partial marker
+func (t *timingWriter) flush() {
+	if len(t.pending) > 0 {
+		t.w.Write(t.pending)
+		t.pending = nil
+	}
+}
+
+// durations returns how long each of n commands ran, given that the run ended
+// at end; a command that never started gets -1. A single command without
+// markers, e.g. a direct command, spans the whole attempt.
+func (t *timingWriter) durations(n int, end time.Time) []time.Duration {
+	starts := t.starts
+	if len(starts) == 0 && n == 1 {
+		starts = []time.Time{t.begin}
+	}
+
+	durations := make([]time.Duration, n)
+	for i := range durations {
+		durations[i] = -1
+		if i >= len(starts) || starts[i].IsZero() {
+			continue
+		}
+		finish := end
+		if i+1 < len(starts) && !starts[i+1].IsZero() {
+			finish = starts[i+1]
+		}
+		durations[i] = finish.Sub(starts[i])
+	}
+	return durations
+}
+
+// writeTimingSummary prints how long each command took. When the run
+// failed, the last command that started is the one that failed.
+func writeTimingSummary(w io.Writer, labels []string, durations []time.Duration, failed bool) {
+	last := -1
+	var total time.Duration
+	for i, d := range durations {
+		if d >= 0 {
+			last = i
+			total += d
+		}
+	}
+
+	fmt.Fprintf(w, "\nSummary:\n")
+	for i, label := range labels {
+		switch {
+		case durations[i] < 0:
+			fmt.Fprintf(w, "  %9s  %s (not run)\n", "-", label)
+		case failed && i == last:
+			fmt.Fprintf(w, "  %9s  %s (failed)\n", formatDuration(durations[i]), label)
+		default:
+			fmt.Fprintf(w, "  %9s  %s\n", formatDuration(durations[i]), label)
+		}
+	}
+	fmt.Fprintf(w, "  %9s  total\n", formatDuration(total))
+}
+
+// formatDuration renders a command duration with millisecond precision
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
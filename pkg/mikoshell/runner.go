@@ -0,0 +1,32 @@
+package mikoshell
+
+import (
+	"os/exec"
+)
+
+// CommandRunner executes the external commands issued by container providers
+type CommandRunner interface {
+	Run(cmd *exec.Cmd) error
+	Output(cmd *exec.Cmd) ([]byte, error)
+}
+
+// execRunner runs commands directly on the host
+type execRunner struct{}
+
+func (execRunner) Run(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+func (execRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	return cmd.Output()
+}
+
+// runner is the CommandRunner used by all providers
+var runner CommandRunner = execRunner{}
+
+// SetCommandRunner replaces the runner used by providers and returns the previous one
+func SetCommandRunner(r CommandRunner) CommandRunner {
+	previous := runner
+	runner = r
+	return previous
+}
@@ -0,0 +1,86 @@
+package mikoshell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// traceRunner wraps a CommandRunner and logs every provider command, its exit
+// code and its captured output in a form suitable for pasting into bug reports
+type traceRunner struct {
+	next CommandRunner
+	w    io.Writer
+	mu   sync.Mutex
+}
+
+// NewTraceRunner returns a CommandRunner that delegates to next and writes a
+// trace of each command to w
+func NewTraceRunner(next CommandRunner, w io.Writer) CommandRunner {
+	return &traceRunner{next: next, w: w}
+}
+
+func (t *traceRunner) Run(cmd *exec.Cmd) error {
+	err := t.next.Run(cmd)
+	// Run streams output straight to the terminal, so there is nothing to capture
+	t.trace(cmd, err, nil)
+	return err
+}
+
+func (t *traceRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	output, err := t.next.Output(cmd)
+	captured := output
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		captured = append(append([]byte{}, output...), exitErr.Stderr...)
+	}
+	t.trace(cmd, err, captured)
+	return output, err
+}
+
+// trace writes a single command record
+func (t *traceRunner) trace(cmd *exec.Cmd, err error, output []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintf(t.w, "$ %s\n", traceArgs(cmd.Args))
+	fmt.Fprintf(t.w, "exit: %s\n", traceExit(err))
+	if text := strings.TrimRight(string(output), "\n"); text != "" {
+		for _, line := range strings.Split(text, "\n") {
+			fmt.Fprintf(t.w, "  %s\n", line)
+		}
+	}
+	fmt.Fprintln(t.w)
+}
+
+// traceSafeArg matches arguments that can be shown without quoting
+var traceSafeArg = regexp.MustCompile(`^[A-Za-z0-9_./:=@,+%-]+$`)
+
+// traceArgs renders argv as a shell command line
+func traceArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if traceSafeArg.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// traceExit renders the exit status of a command
+func traceExit(err error) string {
+	if err == nil {
+		return "0"
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Sprintf("%d", exitErr.ExitCode())
+	}
+	return fmt.Sprintf("error (%v)", err)
+}
@@ -0,0 +1,61 @@
+package mikoshell
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestTraceRunner(t *testing.T) {
+	t.Run("records argv, exit code and output", func(t *testing.T) {
+		mock := &mockRunner{output: []byte("abc123\ndef456\n")}
+		var trace bytes.Buffer
+		r := NewTraceRunner(mock, &trace)
+
+		output, err := r.Output(exec.Command("docker", "images", "--format", "{{.ID}} {{.Tag}}"))
+		if err != nil {
+			t.Fatalf("Output() failed: %v", err)
+		}
+		if string(output) != "abc123\ndef456\n" {
+			t.Errorf("Expected output to pass through, got %q", output)
+		}
+
+		expected := "$ docker images --format '{{.ID}} {{.Tag}}'\nexit: 0\n  abc123\n  def456\n\n"
+		if trace.String() != expected {
+			t.Errorf("Expected trace %q, got %q", expected, trace.String())
+		}
+	})
+
+	t.Run("records failures", func(t *testing.T) {
+		mock := &mockRunner{err: errors.New("executable file not found")}
+		var trace bytes.Buffer
+		r := NewTraceRunner(mock, &trace)
+
+		if err := r.Run(exec.Command("podman", "run", "--rm", "proj:abc123def456")); err == nil {
+			t.Fatal("Expected the runner error to pass through")
+		}
+
+		if !strings.Contains(trace.String(), "$ podman run --rm proj:abc123def456\n") {
+			t.Errorf("Expected argv in trace, got %q", trace.String())
+		}
+		if !strings.Contains(trace.String(), "exit: error (executable file not found)") {
+			t.Errorf("Expected failure in trace, got %q", trace.String())
+		}
+	})
+
+	t.Run("records exit codes", func(t *testing.T) {
+		if _, err := exec.LookPath("sh"); err != nil {
+			t.Skip("sh not available")
+		}
+		var trace bytes.Buffer
+		r := NewTraceRunner(execRunner{}, &trace)
+
+		_ = r.Run(exec.Command("sh", "-c", "exit 3"))
+
+		if !strings.Contains(trace.String(), "exit: 3\n") {
+			t.Errorf("Expected exit code 3 in trace, got %q", trace.String())
+		}
+	})
+}